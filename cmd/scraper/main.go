@@ -1,10 +1,13 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
+	"os/exec"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -12,20 +15,84 @@ import (
 	"github.com/neo1908/lemmy-image-scraper/internal/config"
 	"github.com/neo1908/lemmy-image-scraper/internal/database"
 	"github.com/neo1908/lemmy-image-scraper/internal/downloader"
+	"github.com/neo1908/lemmy-image-scraper/internal/httpclient"
+	"github.com/neo1908/lemmy-image-scraper/internal/pidfile"
+	"github.com/neo1908/lemmy-image-scraper/internal/ratelimit"
 	"github.com/neo1908/lemmy-image-scraper/internal/scraper"
+	"github.com/neo1908/lemmy-image-scraper/internal/storage"
+	"github.com/neo1908/lemmy-image-scraper/internal/tokencache"
 	"github.com/neo1908/lemmy-image-scraper/internal/web"
+	"github.com/neo1908/lemmy-image-scraper/pkg/models"
 	log "github.com/sirupsen/logrus"
 )
 
 var (
-	configPath = flag.String("config", "config.yaml", "Path to configuration file")
-	verbose    = flag.Bool("verbose", false, "Enable verbose logging")
-	stats      = flag.Bool("stats", false, "Display statistics and exit")
+	configPath    = flag.String("config", "config.yaml", "Path to configuration file, or \"env\" to use only LIS_* environment variables")
+	verbose       = flag.Bool("verbose", false, "Enable verbose logging")
+	stats         = flag.Bool("stats", false, "Display statistics and exit")
+	jsonOutput    = flag.Bool("json", false, "Print -stats output as JSON")
+	printDefaults = flag.Bool("print-default-config", false, "Print a configuration file with every option at its default value and exit")
+	clean         = flag.Bool("clean", false, "Delete orphaned database records and exit")
+	reclassify    = flag.Bool("reclassify", false, "Re-detect media types of stored files from their content and exit")
+	since         = flag.String("since", "", "Only process posts newer than this duration (e.g. 24h), or \"auto\" for the last run that scraped each community")
+	watch         = flag.Bool("watch", false, "Scrape new posts as they appear (same as run_mode.mode: watch)")
+	postID        = flag.Int64("post-id", 0, "Scrape a single post by ID and exit")
+	migrate       = flag.Bool("migrate", false, "Apply pending database schema migrations and exit")
+	migrateStatus = flag.Bool("migrate-status", false, "List pending database schema migrations without applying them and exit")
+	repairPaths   = flag.Bool("repair-paths", false, "Move recorded file paths from -old-base to -new-base and exit")
+	oldBase       = flag.String("old-base", "", "Storage directory the files were moved from (with -repair-paths)")
+	newBase       = flag.String("new-base", "", "Storage directory the files were moved to (with -repair-paths, default: storage.base_directory)")
+	migrateToCAS  = flag.Bool("migrate-to-cas", false, "Rename stored files to their content hash, as storage.name_by_hash names new downloads, and exit")
+	dryRun        = flag.Bool("dry-run", false, "List the files -migrate-to-cas would rename without renaming them")
 )
 
+// forceCommunities replaces the configured communities for this run
+var forceCommunities stringList
+
+func init() {
+	flag.Var(&forceCommunities, "force-community", "Scrape this community instead of the configured ones for this run (repeatable)")
+}
+
+// stringList is a flag that collects every occurrence of a repeated string flag
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	if value == "" {
+		return fmt.Errorf("must not be empty")
+	}
+	*l = append(*l, value)
+	return nil
+}
+
+// overrideCommunities replaces the configured communities with the ones given
+// by -force-community, if any
+func overrideCommunities(cfg *config.Config, forced stringList) {
+	if len(forced) == 0 {
+		return
+	}
+	if len(cfg.Lemmy.Communities) > 0 {
+		log.Warnf("Overriding the configured communities with %s for this run", forced.String())
+	}
+	cfg.Lemmy.Communities = forced
+}
+
 func main() {
 	flag.Parse()
 
+	// Needs no config file, and prints nothing else so the output can be redirected
+	if *printDefaults {
+		data, err := config.DefaultConfigYAML()
+		if err != nil {
+			log.Fatalf("Failed to print default config: %v", err)
+		}
+		os.Stdout.Write(data)
+		return
+	}
+
 	// Configure logging
 	log.SetFormatter(&log.TextFormatter{
 		FullTimestamp: true,
@@ -38,58 +105,208 @@ func main() {
 
 	log.Info("Starting Lemmy Media Scraper")
 
-	// Load configuration
-	cfg, err := config.LoadConfig(*configPath)
+	// Load configuration, from environment variables alone with -config env or LIS_CONFIG=env
+	cfg, err := loadConfig()
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 	cfg.SetDefaults()
+	if *watch {
+		cfg.RunMode.Mode = "watch"
+	}
+	overrideCommunities(cfg, forceCommunities)
 
-	log.Infof("Loaded configuration from %s", *configPath)
 	log.Infof("Instance: %s", cfg.Lemmy.Instance)
-	log.Infof("Storage directory: %s", cfg.Storage.BaseDirectory)
+	if cfg.Storage.Backend == "s3" {
+		log.Infof("Storage bucket: s3://%s/%s", cfg.Storage.S3.Bucket, cfg.Storage.S3.Prefix)
+	} else {
+		log.Infof("Storage directory: %s", cfg.Storage.BaseDirectory)
+	}
 	log.Infof("Run mode: %s", cfg.RunMode.Mode)
 
+	// Handle schema migrations on their own if requested
+	if *migrate || *migrateStatus {
+		runMigrate(cfg, *migrateStatus)
+		return
+	}
+
 	// Initialize database
-	db, err := database.New(cfg.Database.Path)
+	db, err := database.New(&cfg.Database, false)
 	if err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 	defer db.Close()
 
-	log.Infof("Database initialized at %s", cfg.Database.Path)
+	if cfg.Database.Driver == "postgres" {
+		log.Infof("Database initialized (postgres)")
+	} else {
+		log.Infof("Database initialized at %s", cfg.Database.Path)
+	}
+
+	if *repairPaths {
+		runRepairPaths(db, *oldBase, *newBase, cfg.Storage.BaseDirectory)
+		return
+	}
+
+	if *migrateToCAS {
+		runMigrateToCAS(db, cfg, *dryRun)
+		return
+	}
 
 	// Display stats if requested
 	if *stats {
-		displayStats(db)
+		outputFormat := "text"
+		if *jsonOutput {
+			outputFormat = "json"
+		}
+		displayStats(db, os.Stdout, outputFormat)
+		return
+	}
+
+	// Clean up orphaned records if requested
+	if *clean {
+		runClean(db)
+		return
+	}
+
+	// Initialize storage backend
+	store, err := storage.New(&cfg.Storage)
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+
+	// Reprocess media types if requested
+	if *reclassify {
+		log.Info("Reclassifying stored media...")
+		checked, fixed, err := downloader.New(db, store).Reclassify()
+		if err != nil {
+			log.Fatalf("Failed to reclassify media: %v", err)
+		}
+		log.Infof("Reclassified %d of %d media files", fixed, checked)
 		return
 	}
 
-	// Create storage directory
-	if err := os.MkdirAll(cfg.Storage.BaseDirectory, 0755); err != nil {
-		log.Fatalf("Failed to create storage directory: %v", err)
+	// Left until here so the inspection commands above don't write
+	fixLegacyPostURLs(db, cfg.Lemmy.Instance)
+
+	// Shared transport carries the instance TLS settings
+	transport, err := httpclient.NewTransport(&cfg.Lemmy)
+	if err != nil {
+		log.Fatalf("Failed to configure HTTP transport: %v", err)
+	}
+
+	// One throttle spaces out API calls and downloads together
+	throttle := ratelimit.NewRequestLimiter(time.Duration(cfg.Scraper.RequestDelay))
+	if cfg.Scraper.RequestDelay > 0 {
+		log.Infof("Waiting at least %s between requests", cfg.Scraper.RequestDelay)
 	}
 
 	// Initialize API client
 	apiClient := api.NewClient(cfg.Lemmy.Instance)
+	apiClient.HTTPClient.Transport = transport
+	apiClient.Throttle = throttle
+	apiClient.UserAgent = cfg.Lemmy.UserAgent
+	apiClient.ExtraHeaders = cfg.Lemmy.ExtraHeaders
+	apiClient.SetBasicAuth(cfg.Lemmy.HTTPBasicAuthUser, cfg.Lemmy.HTTPBasicAuthPassword)
 
-	// Login
-	log.Info("Authenticating with Lemmy instance...")
-	if err := apiClient.Login(cfg.Lemmy.Username, cfg.Lemmy.Password); err != nil {
-		log.Fatalf("Failed to authenticate: %v", err)
+	// Login, or reuse the token from a previous run. Fetching the instance
+	// metadata also tells us whether a cached token is still accepted.
+	site, err := authenticate(apiClient, &cfg.Lemmy)
+	if err != nil {
+		log.Warnf("Failed to get instance info: %v", err)
+	} else {
+		log.Infof("Connected to %s (Lemmy %s)", site.SiteView.Site.Name, site.Version)
+		if !apiClient.AtLeastVersion(0, 19) {
+			log.Info("Instance predates Lemmy 0.19, using legacy query parameter authentication")
+		}
 	}
 
 	// Initialize downloader
-	dl := downloader.New(db, cfg.Storage.BaseDirectory)
+	dl := downloader.NewFromConfig(cfg, db, store)
+	dl.HTTPClient.Transport = transport
+	dl.Throttle = throttle
+	dl.Bandwidth = ratelimit.NewBandwidthLimiter(cfg.Downloader.MaxBytesPerSecond)
+	if dl.Bandwidth != nil {
+		log.Infof("Download bandwidth limited to %d bytes/s", cfg.Downloader.MaxBytesPerSecond)
+	}
+	if cfg.Downloader.UseYtDlp {
+		if path, err := exec.LookPath(cfg.Downloader.YtDlpPath); err != nil {
+			log.Warnf("use_ytdlp is enabled but %s was not found, video platform links will be skipped", cfg.Downloader.YtDlpPath)
+		} else {
+			dl.YtDlp = &downloader.YtDlp{
+				Path:      path,
+				Proxy:     cfg.Lemmy.ProxyURL,
+				RateLimit: cfg.Downloader.MaxBytesPerSecond,
+			}
+			log.Infof("Downloading video platform links with %s", path)
+		}
+	}
+	if cfg.Scraper.ConvertGIFtoMP4 {
+		if _, err := exec.LookPath("ffmpeg"); err != nil {
+			log.Warn("convert_gif_to_mp4 is enabled but ffmpeg was not found in PATH, GIFs will be stored as-is")
+		} else {
+			dl.ConvertGIFs = true
+		}
+	}
+	if cfg.Downloader.ThumbnailFormat != "" {
+		if _, err := exec.LookPath("ffmpeg"); err != nil {
+			log.Warn("thumbnail_format is set but ffmpeg was not found in PATH, thumbnails will be stored as-is")
+		} else {
+			dl.ThumbnailFormat = cfg.Downloader.ThumbnailFormat
+		}
+	}
+	if cfg.Scraper.ExtractVideoDuration {
+		if _, err := exec.LookPath("ffprobe"); err != nil {
+			log.Warn("extract_video_duration is enabled but ffprobe was not found in PATH, video durations will not be recorded")
+		} else {
+			dl.ProbeDuration = true
+		}
+	}
 
 	// Initialize scraper
 	s := scraper.New(cfg, apiClient, db, dl)
 
+	if cfg.Scraper.AutoSubscribe {
+		s.SubscribeCommunities()
+	}
+
+	// Scrape a single post if requested
+	if *postID > 0 {
+		if err := s.ScrapePost(*postID); err != nil {
+			log.Fatalf("Failed to scrape post: %v", err)
+		}
+		return
+	}
+
+	// Apply the optional time gate
+	switch *since {
+	case "":
+	case "auto":
+		s.SinceAuto = true
+		if cfg.Scraper.StopAtSeenPosts {
+			log.Warn("-since=auto is intended to replace the seen-post heuristic; consider setting stop_at_seen_posts: false")
+		}
+	default:
+		d, err := time.ParseDuration(*since)
+		if err != nil || d <= 0 {
+			log.Fatalf("Invalid -since value %q: must be a positive duration or \"auto\"", *since)
+		}
+		s.SinceDuration = d
+	}
+
 	// Start web server if enabled
+	var webServer *web.Server
 	if cfg.WebServer.Enabled {
-		webServer := web.New(cfg, db)
+		webServer, err = web.New(cfg, db, store, dl)
+		if err != nil {
+			log.Fatalf("Failed to initialize web server: %v", err)
+		}
+		scheme := "http"
+		if cfg.WebServer.TLSCert != "" {
+			scheme = "https"
+		}
 		go func() {
-			log.Infof("Web UI enabled at http://%s:%d", cfg.WebServer.Host, cfg.WebServer.Port)
+			log.Infof("Web UI enabled at %s://%s:%d", scheme, cfg.WebServer.Host, cfg.WebServer.Port)
 			if err := webServer.Start(); err != nil {
 				log.Errorf("Web server error: %v", err)
 			}
@@ -97,15 +314,128 @@ func main() {
 	}
 
 	// Run based on mode
-	if cfg.RunMode.Mode == "once" {
-		runOnce(s, cfg.WebServer.Enabled)
-	} else {
-		runContinuous(s, cfg.RunMode.Interval)
+	switch cfg.RunMode.Mode {
+	case "once":
+		runOnce(s, cfg)
+	case "watch":
+		runWatch(s, cfg)
+	default:
+		if err := runContinuous(s, cfg); err != nil {
+			log.Fatalf("Failed to run in continuous mode: %v", err)
+		}
+	}
+
+	if webServer != nil {
+		shutdownWebServer(webServer, time.Duration(cfg.WebServer.ShutdownTimeout))
+	}
+}
+
+// shutdownWebServer lets in-flight web requests finish, up to timeout
+func shutdownWebServer(webServer *web.Server, timeout time.Duration) {
+	log.Infof("Stopping web server (waiting up to %s for open requests)", timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := webServer.Shutdown(ctx); err != nil {
+		log.Warnf("Web server did not shut down cleanly: %v", err)
+	}
+}
+
+// loadConfig loads the config file named by -config, or by LIS_CONFIG when -config
+// isn't given. The path "env" builds the configuration from LIS_* variables alone.
+func loadConfig() (*config.Config, error) {
+	path := *configPath
+	if env := os.Getenv("LIS_CONFIG"); env != "" && !flagSet("config") {
+		path = env
+	}
+
+	if path == config.EnvConfigSentinel {
+		cfg, err := config.LoadConfigFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		log.Info("Loaded configuration from environment variables")
+		return cfg, nil
+	}
+
+	cfg, err := config.LoadConfig(path)
+	if err != nil {
+		return nil, err
 	}
+	log.Infof("Loaded configuration from %s", path)
+	return cfg, nil
+}
+
+// flagSet reports whether a flag was given on the command line
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
 }
 
-// runOnce runs the scraper once and exits (unless web server is enabled)
-func runOnce(s *scraper.Scraper, webServerEnabled bool) {
+// authenticate logs in, reusing the cached token when one is configured and still
+// valid, and returns the instance metadata; the version decides which API features are used
+func authenticate(apiClient *api.Client, cfg *config.LemmyConfig) (*models.SiteResponse, error) {
+	// API keys don't expire, so there is no login and nothing to cache
+	if cfg.APIKey != "" {
+		if cfg.Username != "" || cfg.Password != "" {
+			log.Warn("Both lemmy.api_key and a username/password are configured, using the API key")
+		}
+		log.Info("Using API key authentication")
+		apiClient.APIKey = cfg.APIKey
+		if err := apiClient.Login("", ""); err != nil {
+			log.Fatalf("Failed to authenticate: %v", err)
+		}
+		return apiClient.GetSiteInfo()
+	}
+
+	if cfg.TokenCacheFile != "" {
+		tokens := tokencache.New(cfg.TokenCacheFile)
+		// Every login, including ones after the token expires mid-run, updates the cache
+		apiClient.OnLogin = func(token string) {
+			if err := tokens.Put(cfg.Instance, cfg.Username, token); err != nil {
+				log.Warnf("Failed to cache login token: %v", err)
+			}
+		}
+
+		token, err := tokens.Get(cfg.Instance, cfg.Username)
+		if err != nil {
+			log.Warnf("Failed to read cached login token: %v", err)
+		} else if token != "" {
+			// A token the instance rejects outright is replaced by a fresh login
+			apiClient.AuthToken = token
+			apiClient.SetCredentials(cfg.Username, cfg.Password)
+			site, err := apiClient.GetSiteInfo()
+			if err != nil {
+				return nil, err
+			}
+			if site.MyUser != nil {
+				if apiClient.AuthToken == token {
+					log.Info("Reusing cached login token")
+				}
+				return site, nil
+			}
+			log.Info("Cached login token is no longer valid")
+			apiClient.AuthToken = ""
+		}
+	}
+
+	log.Info("Authenticating with Lemmy instance...")
+	if err := apiClient.Login(cfg.Username, cfg.Password); err != nil {
+		log.Fatalf("Failed to authenticate: %v", err)
+	}
+
+	return apiClient.GetSiteInfo()
+}
+
+// runOnce runs the scraper once and exits (unless web server is enabled).
+// With the web server enabled and a background refresh interval set, the
+// scraper also runs again on that interval while the UI is being served.
+func runOnce(s *scraper.Scraper, cfg *config.Config) {
+	webServerEnabled := cfg.WebServer.Enabled
 	log.Info("Running in one-time mode")
 	if err := s.Run(); err != nil {
 		log.Errorf("Scraper error: %v", err)
@@ -116,69 +446,234 @@ func runOnce(s *scraper.Scraper, webServerEnabled bool) {
 	log.Info("Scrape completed successfully")
 
 	// If web server is enabled, keep running
-	if webServerEnabled {
-		log.Info("Web server is running. Press Ctrl+C to exit.")
-		sigChan := make(chan os.Signal, 1)
-		signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-		sig := <-sigChan
-		log.Infof("Received signal %v, shutting down gracefully", sig)
+	if !webServerEnabled {
+		return
+	}
+	log.Info("Web server is running. Press Ctrl+C to exit.")
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	// A nil channel never fires, so without a refresh interval this only waits for a signal
+	var refresh <-chan time.Time
+	if interval := time.Duration(cfg.WebServer.BackgroundRefreshInterval); interval > 0 {
+		log.Infof("Refreshing in the background every %s", interval)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		refresh = ticker.C
 	}
+
+	for {
+		select {
+		case sig := <-sigChan:
+			log.Infof("Received signal %v, shutting down gracefully", sig)
+			return
+		case <-refresh:
+			log.Info("Starting background refresh")
+			if err := s.Run(); err != nil {
+				log.Errorf("Scraper error: %v", err)
+			}
+		}
+	}
+}
+
+// holdPIDFile refuses to start if another instance owns the PID file, and
+// returns a function removing it again. An empty path does nothing.
+func holdPIDFile(path string) (release func()) {
+	if path == "" {
+		return func() {}
+	}
+	if err := pidfile.Acquire(path); err != nil {
+		log.Fatalf("Failed to acquire PID file: %v", err)
+	}
+	log.Infof("Wrote PID file %s", path)
+	return func() {
+		if err := pidfile.Release(path); err != nil {
+			log.Errorf("Failed to remove PID file: %v", err)
+		}
+	}
+}
+
+// runWatch scrapes new posts as they appear until interrupted
+func runWatch(s *scraper.Scraper, cfg *config.Config) {
+	log.Infof("Running in watch mode, checking for new posts every %s", cfg.RunMode.WatchInterval)
+
+	release := holdPIDFile(cfg.RunMode.PIDFile)
+	defer release()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := s.Watch(ctx, time.Duration(cfg.RunMode.WatchInterval)); err != nil {
+		log.Errorf("Scraper error: %v", err)
+		return
+	}
+	log.Info("Received signal, shutting down gracefully")
 }
 
-// runContinuous runs the scraper on an interval
-func runContinuous(s *scraper.Scraper, interval time.Duration) {
-	log.Infof("Running in continuous mode with interval: %s", interval)
+// runContinuous runs the scraper on an interval. Each community is scheduled
+// separately so communities with an interval override are checked on their own cadence.
+// Errors are returned rather than fatal, so the PID file is still removed.
+func runContinuous(s *scraper.Scraper, cfg *config.Config) error {
+	log.Infof("Running in continuous mode with interval: %s", cfg.RunMode.Interval)
+
+	release := holdPIDFile(cfg.RunMode.PIDFile)
+	defer release()
 
 	// Create a channel to listen for interrupt signals
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
-	// Create ticker for interval
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
-
-	// Run immediately first time
-	if err := s.Run(); err != nil {
-		log.Errorf("Scraper error: %v", err)
+	// An empty name stands for the hot page, used when no communities are configured
+	targets, err := s.Targets()
+	if err != nil {
+		return fmt.Errorf("failed to determine communities to scrape: %w", err)
+	}
+	for _, community := range targets {
+		if interval := cfg.ScrapeIntervalFor(community); interval != time.Duration(cfg.RunMode.Interval) {
+			log.Infof("Community %s uses interval: %s", community, interval)
+		}
 	}
 
+	schedule := scraper.NewSchedule(targets, cfg.ScrapeIntervalFor, time.Now())
 	for {
-		select {
-		case <-ticker.C:
+		due, next := schedule.Due(time.Now())
+		if len(due) > 0 {
 			log.Info("Starting scheduled scrape run")
-			if err := s.Run(); err != nil {
+			if err := s.RunCommunities(due); err != nil {
 				log.Errorf("Scraper error: %v", err)
 			}
+			schedule.Scraped(due, time.Now())
+			continue
+		}
+
+		select {
+		case <-time.After(time.Until(next)):
 		case sig := <-sigChan:
 			log.Infof("Received signal %v, shutting down gracefully", sig)
-			return
+			return nil
 		}
 	}
 }
 
-// displayStats shows statistics about scraped media
-func displayStats(db *database.DB) {
-	stats, err := db.GetStats()
+// runClean removes database records left behind by deleted posts and vacuums the database
+func runClean(db *database.DB) {
+	orphans, err := db.GetOrphanedComments()
 	if err != nil {
-		log.Fatalf("Failed to get stats: %v", err)
+		log.Fatalf("Failed to find orphaned comments: %v", err)
+	}
+	if len(orphans) == 0 {
+		log.Info("No orphaned comments found")
+		return
 	}
 
-	fmt.Println("\n=== Lemmy Media Scraper Statistics ===")
-	fmt.Printf("\nTotal media files: %d\n", stats["total_media"])
+	log.Infof("Found %d orphaned comments", len(orphans))
+	deleted, err := db.DeleteOrphanedComments()
+	if err != nil {
+		log.Fatalf("Failed to delete orphaned comments: %v", err)
+	}
+	log.Infof("Deleted %d orphaned comments", deleted)
 
-	if typeCounts, ok := stats["by_type"].(map[string]int); ok && len(typeCounts) > 0 {
-		fmt.Println("\nBy media type:")
-		for mediaType, count := range typeCounts {
-			fmt.Printf("  %s: %d\n", mediaType, count)
+	// Reclaim the space unless the delete already passed auto_vacuum_threshold
+	if db.DeletedSinceVacuum() > 0 {
+		if err := db.VacuumAndAnalyze(); err != nil {
+			log.Fatalf("Failed to vacuum database: %v", err)
 		}
 	}
+}
+
+// runRepairPaths points the file paths of media stored under oldBase at newBase,
+// which defaults to the configured storage directory
+func runRepairPaths(db *database.DB, oldBase, newBase, baseDirectory string) {
+	if oldBase == "" {
+		log.Fatal("-repair-paths requires -old-base")
+	}
+	if newBase == "" {
+		newBase = baseDirectory
+	}
+
+	// The number of records changed is logged by RepairFilePaths
+	if _, err := db.RepairFilePaths(oldBase, newBase); err != nil {
+		log.Fatalf("Failed to repair file paths: %v", err)
+	}
+}
+
+// runMigrateToCAS renames the stored media files to their content hash
+func runMigrateToCAS(db *database.DB, cfg *config.Config, dryRun bool) {
+	if cfg.Storage.Backend != "" && cfg.Storage.Backend != "local" {
+		log.Fatal("-migrate-to-cas only supports local storage")
+	}
+
+	moved, err := db.MigrateToContentAddressable(cfg.Storage.BaseDirectory, dryRun)
+	if err != nil {
+		log.Fatalf("Failed to migrate files to hash-based names: %v", err)
+	}
+	if dryRun {
+		log.Infof("Would rename %d media files", moved)
+		return
+	}
+	log.Infof("Renamed %d media files", moved)
+	if !cfg.Storage.NameByHash {
+		log.Info("Set storage.name_by_hash: true so new downloads are named the same way")
+	}
+}
+
+// fixLegacyPostURLs repairs the post URLs of media saved by older versions,
+// which stored the media URL as the post URL
+func fixLegacyPostURLs(db *database.DB, instance string) {
+	if fixed, err := db.FixLegacyPostURLs(instance); err != nil {
+		log.Warnf("Failed to fix post URLs: %v", err)
+	} else if fixed > 0 {
+		log.Infof("Fixed the post URL of %d media records", fixed)
+	}
+}
+
+// runMigrate applies pending schema migrations and repairs legacy post URLs, or
+// only shows the schema version and lists the migrations when dryRun is set
+func runMigrate(cfg *config.Config, dryRun bool) {
+	// Opened without migrating, so the pending changes can be listed first
+	db, err := database.New(&cfg.Database, true)
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	version, err := db.SchemaVersion()
+	if err != nil {
+		log.Fatalf("Failed to get schema version: %v", err)
+	}
 
-	if communityCounts, ok := stats["top_communities"].(map[string]int); ok && len(communityCounts) > 0 {
-		fmt.Println("\nTop communities:")
-		for community, count := range communityCounts {
-			fmt.Printf("  %s: %d\n", community, count)
+	if dryRun {
+		pending, err := db.PendingMigrations()
+		if err != nil {
+			log.Fatalf("Failed to check for pending migrations: %v", err)
+		}
+		fmt.Printf("Schema version: %d (latest: %d)\n", version, database.LatestSchemaVersion)
+		if len(pending) == 0 {
+			if version < database.LatestSchemaVersion {
+				fmt.Println("No pending changes; -migrate will record the latest version")
+				return
+			}
+			fmt.Println("Database schema is up to date")
+			return
+		}
+		fmt.Printf("%d pending migration(s):\n", len(pending))
+		for _, migration := range pending {
+			fmt.Printf("  %s\n", migration)
 		}
+		return
 	}
 
-	fmt.Println()
+	applied, err := db.Migrate()
+	if err != nil {
+		log.Fatalf("Failed to migrate database: %v", err)
+	}
+	fixLegacyPostURLs(db, cfg.Lemmy.Instance)
+	if len(applied) == 0 && version == database.LatestSchemaVersion {
+		fmt.Printf("Database schema is up to date at version %d, nothing to apply\n", version)
+		return
+	}
+	fmt.Printf("Applied %d migration(s), schema version %d -> %d:\n", len(applied), version, database.LatestSchemaVersion)
+	for _, migration := range applied {
+		fmt.Printf("  %s\n", migration)
+	}
 }
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/neo1908/lemmy-image-scraper/internal/api"
+	"github.com/neo1908/lemmy-image-scraper/internal/config"
+	"github.com/neo1908/lemmy-image-scraper/internal/database"
+	"github.com/neo1908/lemmy-image-scraper/internal/downloader"
+	"github.com/neo1908/lemmy-image-scraper/internal/scraper"
+	"github.com/neo1908/lemmy-image-scraper/internal/storage"
+)
+
+func TestForceCommunityReplacesConfiguredCommunities(t *testing.T) {
+	var forced stringList
+	flags := flag.NewFlagSet("scraper", flag.ContinueOnError)
+	flags.Var(&forced, "force-community", "")
+	if err := flags.Parse([]string{"-force-community", "news", "-force-community", "art"}); err != nil {
+		t.Fatalf("failed to parse flags: %v", err)
+	}
+
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	cfg.Lemmy.Communities = []string{"pics", "memes"}
+	cfg.Storage.BaseDirectory = dir
+	cfg.Database.Path = dir + "/test.db"
+	cfg.SetDefaults()
+	overrideCommunities(cfg, forced)
+
+	var mu sync.Mutex
+	var listed []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v3/post/list" {
+			http.NotFound(w, r)
+			return
+		}
+		mu.Lock()
+		listed = append(listed, r.URL.Query().Get("community_name"))
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"posts": []}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	db, err := database.New(&cfg.Database, false)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	store, err := storage.NewLocal(dir)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	client := api.NewClient("example.invalid")
+	client.BaseURL = srv.URL + "/api/v3"
+	client.HTTPClient = srv.Client()
+	s := scraper.New(cfg, client, db, downloader.New(db, store))
+
+	targets, err := s.Targets()
+	if err != nil {
+		t.Fatalf("Targets: %v", err)
+	}
+	if err := s.RunCommunities(targets); err != nil {
+		t.Fatalf("RunCommunities: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	sort.Strings(listed)
+	if len(listed) != 2 || listed[0] != "art" || listed[1] != "news" {
+		t.Errorf("communities scraped = %v, want [art news]", listed)
+	}
+}
+
+func TestForceCommunityUnsetKeepsConfiguredCommunities(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Lemmy.Communities = []string{"pics", "memes"}
+	overrideCommunities(cfg, nil)
+
+	if len(cfg.Lemmy.Communities) != 2 || cfg.Lemmy.Communities[0] != "pics" || cfg.Lemmy.Communities[1] != "memes" {
+		t.Errorf("communities = %v, want [pics memes]", cfg.Lemmy.Communities)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/neo1908/lemmy-image-scraper/internal/database"
+	"github.com/neo1908/lemmy-image-scraper/internal/format"
+	log "github.com/sirupsen/logrus"
+)
+
+// displayStats writes statistics about scraped media to w, as "text" or "json"
+func displayStats(db *database.DB, w io.Writer, outputFormat string) {
+	stats, err := db.GetStats()
+	if err != nil {
+		log.Fatalf("Failed to get stats: %v", err)
+	}
+
+	if outputFormat == "json" {
+		err = formatStatsJSON(stats, w)
+	} else {
+		err = formatStatsText(stats, w)
+	}
+	if err != nil {
+		log.Fatalf("Failed to write stats: %v", err)
+	}
+}
+
+// formatStatsText writes stats as the human-readable -stats report
+func formatStatsText(stats map[string]interface{}, w io.Writer) error {
+	var out []byte
+	out = fmt.Appendln(out, "\n=== Lemmy Media Scraper Statistics ===")
+	out = fmt.Appendf(out, "\nTotal media files: %d\n", stats["total_media"])
+	if totalSize, ok := stats["total_size"].(int64); ok {
+		out = fmt.Appendf(out, "Total downloaded: %s\n", format.FileSize(totalSize))
+	}
+
+	if typeCounts, ok := stats["by_type"].(map[string]int); ok && len(typeCounts) > 0 {
+		out = fmt.Appendln(out, "\nBy media type:")
+		for _, mediaType := range sortedByCount(typeCounts) {
+			out = fmt.Appendf(out, "  %s: %d\n", mediaType, typeCounts[mediaType])
+		}
+	}
+
+	if communityCounts, ok := stats["top_communities"].(map[string]int); ok && len(communityCounts) > 0 {
+		out = fmt.Appendln(out, "\nTop communities:")
+		for _, community := range sortedByCount(communityCounts) {
+			out = fmt.Appendf(out, "  %s: %d\n", community, communityCounts[community])
+		}
+	}
+
+	out = fmt.Appendln(out)
+	_, err := w.Write(out)
+	return err
+}
+
+// formatStatsJSON writes stats as an indented JSON object for scripts
+func formatStatsJSON(stats map[string]interface{}, w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(stats)
+}
+
+// sortedByCount returns the keys of counts, highest count first and then by name
+func sortedByCount(counts map[string]int) []string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+// testStats has the shape of DB.GetStats output
+func testStats() map[string]interface{} {
+	return map[string]interface{}{
+		"total_media":     42,
+		"total_size":      int64(3 * 1024 * 1024),
+		"by_type":         map[string]int{"image": 40, "video": 2},
+		"top_communities": map[string]int{"pics": 30, "art": 6, "memes": 6},
+	}
+}
+
+func TestFormatStatsText(t *testing.T) {
+	var buf bytes.Buffer
+	if err := formatStatsText(testStats(), &buf); err != nil {
+		t.Fatalf("formatStatsText: %v", err)
+	}
+
+	want := `
+=== Lemmy Media Scraper Statistics ===
+
+Total media files: 42
+Total downloaded: 3.0 MB
+
+By media type:
+  image: 40
+  video: 2
+
+Top communities:
+  pics: 30
+  art: 6
+  memes: 6
+
+`
+	if got := buf.String(); got != want {
+		t.Errorf("text stats =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestFormatStatsJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := formatStatsJSON(testStats(), &buf); err != nil {
+		t.Fatalf("formatStatsJSON: %v", err)
+	}
+
+	var got struct {
+		TotalMedia     int            `json:"total_media"`
+		TotalSize      int64          `json:"total_size"`
+		ByType         map[string]int `json:"by_type"`
+		TopCommunities map[string]int `json:"top_communities"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("stats are not valid JSON: %v\n%s", err, buf.String())
+	}
+	if got.TotalMedia != 42 || got.TotalSize != 3*1024*1024 || got.ByType["video"] != 2 || got.TopCommunities["pics"] != 30 {
+		t.Errorf("JSON stats = %+v", got)
+	}
+}
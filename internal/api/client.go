@@ -3,21 +3,68 @@ package api
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/neo1908/lemmy-image-scraper/internal/ratelimit"
 	"github.com/neo1908/lemmy-image-scraper/pkg/models"
 	log "github.com/sirupsen/logrus"
 )
 
+// ErrUnauthorized is returned when the instance rejects the request's credentials,
+// e.g. because the login token has expired
+var ErrUnauthorized = errors.New("request failed with status 401")
+
+// StatusError is returned when the instance answers with an unexpected status code
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("request failed with status %d: %s", e.StatusCode, e.Body)
+}
+
+// IsTransient reports whether a failed request is worth retrying: network
+// errors, unreadable responses, rate limiting and server errors. Other client
+// errors, such as an unknown community, fail the same way every time.
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, ErrUnauthorized) {
+		return false
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= 500
+	}
+	return true
+}
+
 // Client represents a Lemmy API client
 type Client struct {
 	BaseURL    string
 	HTTPClient *http.Client
 	AuthToken  string
+	Version    string                    // Lemmy version reported by the instance, set by GetSiteInfo
+	Throttle   *ratelimit.RequestLimiter // Optional throttle shared with the downloader, nil for none
+	OnLogin    func(token string)        // Optional hook called with the new token after every successful login
+	APIKey     string                    // Long-lived API key; when set, Login uses it instead of logging in
+
+	UserAgent    string            // User-Agent sent with every request, empty for Go's default
+	ExtraHeaders map[string]string // Extra headers sent with every request
+
+	// Credentials used to log in again when the token expires
+	username string
+	password string
+
+	// HTTP basic auth credentials for a proxy in front of the instance
+	basicAuthUser     string
+	basicAuthPassword string
 }
 
 // NewClient creates a new Lemmy API client
@@ -30,8 +77,35 @@ func NewClient(instance string) *Client {
 	}
 }
 
-// Login authenticates with the Lemmy instance and stores the JWT token
+// SetCredentials stores the credentials used to log in again when a request is
+// rejected as unauthorized, without logging in now
+func (c *Client) SetCredentials(username, password string) {
+	c.username = username
+	c.password = password
+}
+
+// SetBasicAuth sets HTTP basic auth credentials sent with every request, for
+// instances behind a proxy that asks for them before Lemmy sees the request.
+// Both must be non-empty for them to be sent.
+func (c *Client) SetBasicAuth(user, password string) {
+	c.basicAuthUser = user
+	c.basicAuthPassword = password
+}
+
+// usesBasicAuth reports whether requests carry basic auth credentials
+func (c *Client) usesBasicAuth() bool {
+	return c.basicAuthUser != "" && c.basicAuthPassword != ""
+}
+
+// Login authenticates with the Lemmy instance and stores the JWT token.
+// The credentials are kept so an expired token can be replaced.
+// With an APIKey set no request is made and the key is used as the token.
 func (c *Client) Login(username, password string) error {
+	if c.APIKey != "" {
+		c.AuthToken = c.APIKey
+		return nil
+	}
+
 	loginReq := models.LoginRequest{
 		UsernameOrEmail: username,
 		Password:        password,
@@ -42,31 +116,246 @@ func (c *Client) Login(username, password string) error {
 		return fmt.Errorf("failed to marshal login request: %w", err)
 	}
 
-	resp, err := c.HTTPClient.Post(
-		fmt.Sprintf("%s/user/login", c.BaseURL),
-		"application/json",
-		bytes.NewBuffer(jsonData),
-	)
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/user/login", c.BaseURL), bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create login request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, body, err := c.do(req)
 	if err != nil {
 		return fmt.Errorf("failed to send login request: %w", err)
 	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
 		return fmt.Errorf("login failed with status %d: %s", resp.StatusCode, string(body))
 	}
 
 	var loginResp models.LoginResponse
-	if err := json.NewDecoder(resp.Body).Decode(&loginResp); err != nil {
+	if err := json.Unmarshal(body, &loginResp); err != nil {
 		return fmt.Errorf("failed to decode login response: %w", err)
 	}
 
 	c.AuthToken = loginResp.JWT
+	c.SetCredentials(username, password)
 	log.Info("Successfully authenticated with Lemmy instance")
+	if c.OnLogin != nil {
+		c.OnLogin(c.AuthToken)
+	}
+	return nil
+}
+
+// setAuth adds authentication to a request if the client is logged in
+func (c *Client) setAuth(req *http.Request) {
+	if c.AuthToken == "" {
+		return
+	}
+
+	// Add Authorization header with Bearer token. A request has one
+	// Authorization header and it can't carry Basic and Bearer credentials at
+	// once, so with basic auth the token goes in the "jwt" cookie instead,
+	// which Lemmy also reads.
+	if c.usesBasicAuth() {
+		req.AddCookie(&http.Cookie{Name: "jwt", Value: c.AuthToken})
+	} else {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.AuthToken))
+	}
+
+	// Lemmy before 0.19 only accepts the token as an "auth" query parameter
+	if c.Version != "" && !c.AtLeastVersion(0, 19) {
+		q := req.URL.Query()
+		q.Set("auth", c.AuthToken)
+		req.URL.RawQuery = q.Encode()
+	}
+}
+
+// do executes a request, reads the whole response body and logs the call with its timing.
+// Every request goes through here, so it also adds the configured headers.
+func (c *Client) do(req *http.Request) (*http.Response, []byte, error) {
+	if c.usesBasicAuth() {
+		req.SetBasicAuth(c.basicAuthUser, c.basicAuthPassword)
+	}
+	for name, value := range c.ExtraHeaders {
+		req.Header.Set(name, value)
+	}
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+
+	if err := c.Throttle.Wait(req.Context()); err != nil {
+		return nil, nil, err
+	}
+
+	start := time.Now()
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		log.Debugf("API %s %s failed after %s: %v", req.Method, redactURL(req.URL), time.Since(start), err)
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	elapsed := time.Since(start)
+	if err != nil {
+		log.Debugf("API %s %s -> %d, failed reading body after %s: %v", req.Method, redactURL(req.URL), resp.StatusCode, elapsed, err)
+		return nil, nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	log.Debugf("API %s %s -> %d (%d bytes in %s)", req.Method, redactURL(req.URL), resp.StatusCode, len(body), elapsed)
+	return resp, body, nil
+}
+
+// getJSON sends an authenticated GET request to an API endpoint and decodes the JSON response into out.
+// If the token has expired, it logs in again with the stored credentials and retries once.
+func (c *Client) getJSON(endpoint string, queryParams url.Values, out interface{}) error {
+	err := c.getJSONOnce(endpoint, queryParams, out)
+	if !errors.Is(err, ErrUnauthorized) || c.username == "" {
+		return err
+	}
+
+	log.Warn("Login token was rejected, logging in again")
+	if loginErr := c.Login(c.username, c.password); loginErr != nil {
+		return fmt.Errorf("failed to re-authenticate: %w", loginErr)
+	}
+	return c.getJSONOnce(endpoint, queryParams, out)
+}
+
+// getJSONOnce sends a single GET request for getJSON
+func (c *Client) getJSONOnce(endpoint string, queryParams url.Values, out interface{}) error {
+	reqURL := fmt.Sprintf("%s%s", c.BaseURL, endpoint)
+	if len(queryParams) > 0 {
+		reqURL += "?" + queryParams.Encode()
+	}
+
+	req, err := http.NewRequest("GET", reqURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	c.setAuth(req)
+
+	resp, body, err := c.do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("%w: %s", ErrUnauthorized, string(body))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &StatusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
 	return nil
 }
 
+// postJSON sends an authenticated POST request with a JSON body to an API endpoint
+// and decodes the JSON response into out, logging in again once like getJSON
+func (c *Client) postJSON(endpoint string, payload, out interface{}) error {
+	err := c.postJSONOnce(endpoint, payload, out)
+	if !errors.Is(err, ErrUnauthorized) || c.username == "" {
+		return err
+	}
+
+	log.Warn("Login token was rejected, logging in again")
+	if loginErr := c.Login(c.username, c.password); loginErr != nil {
+		return fmt.Errorf("failed to re-authenticate: %w", loginErr)
+	}
+	return c.postJSONOnce(endpoint, payload, out)
+}
+
+// postJSONOnce sends a single POST request for postJSON
+func (c *Client) postJSONOnce(endpoint string, payload, out interface{}) error {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s%s", c.BaseURL, endpoint), bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	c.setAuth(req)
+
+	resp, body, err := c.do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("%w: %s", ErrUnauthorized, string(body))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &StatusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// redactURL returns the URL as a string with any auth token removed, for logging
+func redactURL(u *url.URL) string {
+	q := u.Query()
+	if q.Get("auth") == "" {
+		return u.String()
+	}
+	q.Set("auth", "REDACTED")
+	redacted := *u
+	redacted.RawQuery = q.Encode()
+	return redacted.String()
+}
+
+// GetSiteInfo retrieves instance metadata, including the Lemmy version
+func (c *Client) GetSiteInfo() (*models.SiteResponse, error) {
+	var siteResp models.SiteResponse
+	if err := c.getJSON("/site", nil, &siteResp); err != nil {
+		return nil, err
+	}
+
+	c.Version = siteResp.Version
+	return &siteResp, nil
+}
+
+// AtLeastVersion reports whether the instance runs at least the given Lemmy version.
+// An unknown version is assumed to be current.
+func (c *Client) AtLeastVersion(major, minor int) bool {
+	gotMajor, gotMinor, ok := ParseVersion(c.Version)
+	if !ok {
+		return true
+	}
+	if gotMajor != major {
+		return gotMajor > major
+	}
+	return gotMinor >= minor
+}
+
+// ParseVersion extracts the major and minor numbers from a Lemmy version string
+// such as "0.19.3" or "v0.18.5-rc.1"
+func ParseVersion(version string) (major, minor int, ok bool) {
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return 0, 0, false
+	}
+
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, false
+	}
+	minor, err = strconv.Atoi(strings.SplitN(parts[1], "-", 2)[0])
+	if err != nil {
+		return 0, 0, false
+	}
+	return major, minor, true
+}
+
 // GetPosts retrieves posts from the Lemmy instance
 func (c *Client) GetPosts(params GetPostsParams) (*models.GetPostsResponse, error) {
 	queryParams := url.Values{}
@@ -90,83 +379,107 @@ func (c *Client) GetPosts(params GetPostsParams) (*models.GetPostsResponse, erro
 		queryParams.Set("type_", params.Type)
 	}
 
-	reqURL := fmt.Sprintf("%s/post/list?%s", c.BaseURL, queryParams.Encode())
-
-	log.Debugf("Requesting URL: %s", reqURL)
-
-	req, err := http.NewRequest("GET", reqURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+	var postsResp models.GetPostsResponse
+	if err := c.getJSON("/post/list", queryParams, &postsResp); err != nil {
+		return nil, err
 	}
 
-	// Add Authorization header with Bearer token if authenticated
-	if c.AuthToken != "" {
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.AuthToken))
-	}
+	log.Debugf("Retrieved %d posts from API", len(postsResp.Posts))
+	return &postsResp, nil
+}
 
-	resp, err := c.HTTPClient.Do(req)
+// GetPostByID retrieves a single post by its ID
+func (c *Client) GetPostByID(postID int64) (*models.PostView, error) {
+	postResp, err := c.GetPost(postID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(body))
-	}
+	return &postResp.PostView, nil
+}
 
-	var postsResp models.GetPostsResponse
-	if err := json.NewDecoder(resp.Body).Decode(&postsResp); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+// GetPost retrieves a single post by its ID along with its crossposts
+func (c *Client) GetPost(postID int64) (*models.GetPostResponse, error) {
+	queryParams := url.Values{}
+	queryParams.Set("id", fmt.Sprintf("%d", postID))
+
+	var postResp models.GetPostResponse
+	if err := c.getJSON("/post", queryParams, &postResp); err != nil {
+		return nil, err
 	}
 
-	log.Debugf("Retrieved %d posts from API", len(postsResp.Posts))
-	return &postsResp, nil
+	return &postResp, nil
 }
 
 // GetCommunityID retrieves the community ID by name
 func (c *Client) GetCommunityID(communityName string) (int64, error) {
+	view, err := c.GetCommunity(communityName)
+	if err != nil {
+		return 0, err
+	}
+	return view.Community.ID, nil
+}
+
+// GetCommunity retrieves a community by name, including whether the logged-in
+// user is subscribed to it. Remote communities are named "name@instance".
+func (c *Client) GetCommunity(communityName string) (*models.CommunityView, error) {
 	queryParams := url.Values{}
 	queryParams.Set("name", communityName)
 
-	reqURL := fmt.Sprintf("%s/community?%s", c.BaseURL, queryParams.Encode())
-
-	req, err := http.NewRequest("GET", reqURL, nil)
-	if err != nil {
-		return 0, fmt.Errorf("failed to create request: %w", err)
+	var communityResp models.CommunityResponse
+	if err := c.getJSON("/community", queryParams, &communityResp); err != nil {
+		return nil, err
 	}
 
-	// Add Authorization header with Bearer token if authenticated
-	if c.AuthToken != "" {
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.AuthToken))
-	}
+	return &communityResp.CommunityView, nil
+}
 
-	resp, err := c.HTTPClient.Do(req)
-	if err != nil {
-		return 0, fmt.Errorf("failed to send request: %w", err)
+// FollowCommunity subscribes the logged-in user to a community, which makes
+// the instance federate its posts, and returns the community with its new
+// subscription state. Following an already followed community is harmless.
+func (c *Client) FollowCommunity(communityID int64) (*models.CommunityView, error) {
+	followReq := models.FollowCommunityRequest{
+		CommunityID: communityID,
+		Follow:      true,
+	}
+	// Lemmy before 0.19 only accepts the token in the body of POST requests
+	if c.Version != "" && !c.AtLeastVersion(0, 19) {
+		followReq.Auth = c.AuthToken
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return 0, fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(body))
+	var communityResp models.CommunityResponse
+	if err := c.postJSON("/community/follow", followReq, &communityResp); err != nil {
+		return nil, err
 	}
 
-	var communityResp struct {
-		CommunityView struct {
-			Community models.Community `json:"community"`
-		} `json:"community_view"`
+	return &communityResp.CommunityView, nil
+}
+
+// GetCommunityList retrieves one page of the communities hosted on the instance,
+// oldest first so pages stay stable while new communities are created
+func (c *Client) GetCommunityList(page, limit int) (*models.ListCommunitiesResponse, error) {
+	queryParams := url.Values{}
+	queryParams.Set("type_", "Local")
+	queryParams.Set("sort", "Old")
+	if page > 0 {
+		queryParams.Set("page", fmt.Sprintf("%d", page))
+	}
+	if limit > 0 {
+		queryParams.Set("limit", fmt.Sprintf("%d", limit))
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&communityResp); err != nil {
-		return 0, fmt.Errorf("failed to decode response: %w", err)
+	var communitiesResp models.ListCommunitiesResponse
+	if err := c.getJSON("/community/list", queryParams, &communitiesResp); err != nil {
+		return nil, err
 	}
 
-	return communityResp.CommunityView.Community.ID, nil
+	log.Debugf("Retrieved %d communities from API", len(communitiesResp.Communities))
+	return &communitiesResp, nil
 }
 
-// GetComments retrieves comments for a post from the Lemmy instance
-func (c *Client) GetComments(postID int64, maxDepth, limit int) (*models.GetCommentsResponse, error) {
+// GetComments retrieves comments for a post from the Lemmy instance.
+// Sort is a Lemmy CommentSortType such as "Top" or "New"; empty uses "Top".
+func (c *Client) GetComments(postID int64, maxDepth, limit int, sort string) (*models.GetCommentsResponse, error) {
 	queryParams := url.Values{}
 	queryParams.Set("post_id", fmt.Sprintf("%d", postID))
 
@@ -176,36 +489,14 @@ func (c *Client) GetComments(postID int64, maxDepth, limit int) (*models.GetComm
 	if limit > 0 {
 		queryParams.Set("limit", fmt.Sprintf("%d", limit))
 	}
-	queryParams.Set("sort", "Top") // Get best comments first
-
-	reqURL := fmt.Sprintf("%s/comment/list?%s", c.BaseURL, queryParams.Encode())
-
-	log.Debugf("Requesting comments URL: %s", reqURL)
-
-	req, err := http.NewRequest("GET", reqURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	// Add Authorization header with Bearer token if authenticated
-	if c.AuthToken != "" {
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.AuthToken))
-	}
-
-	resp, err := c.HTTPClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(body))
+	if sort == "" {
+		sort = "Top" // Get best comments first
 	}
+	queryParams.Set("sort", sort)
 
 	var commentsResp models.GetCommentsResponse
-	if err := json.NewDecoder(resp.Body).Decode(&commentsResp); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	if err := c.getJSON("/comment/list", queryParams, &commentsResp); err != nil {
+		return nil, err
 	}
 
 	log.Debugf("Retrieved %d comments from API", len(commentsResp.Comments))
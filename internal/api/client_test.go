@@ -0,0 +1,235 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// newTestClient returns a client for a test server running handler
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	client := NewClient("example.invalid")
+	client.BaseURL = srv.URL + "/api/v3"
+	client.HTTPClient = srv.Client()
+	return client
+}
+
+func TestGetSiteInfo(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v3/site" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"site_view": {}, "version": "0.18.5-rc.1"}`))
+	})
+
+	site, err := client.GetSiteInfo()
+	if err != nil {
+		t.Fatalf("GetSiteInfo: %v", err)
+	}
+	if site.Version != "0.18.5-rc.1" || client.Version != "0.18.5-rc.1" {
+		t.Errorf("version = %q, client.Version = %q, want 0.18.5-rc.1", site.Version, client.Version)
+	}
+	if !client.AtLeastVersion(0, 18) {
+		t.Error("AtLeastVersion(0, 18) = false for 0.18.5-rc.1")
+	}
+	if client.AtLeastVersion(0, 19) {
+		t.Error("AtLeastVersion(0, 19) = true for 0.18.5-rc.1")
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		version      string
+		major, minor int
+		ok           bool
+	}{
+		{"0.19.3", 0, 19, true},
+		{"v0.18.5-rc.1", 0, 18, true},
+		{"1.0-beta", 1, 0, true},
+		{" 0.19.11 ", 0, 19, true},
+		{"", 0, 0, false},
+		{"unknown", 0, 0, false},
+		{"0.x.1", 0, 0, false},
+	}
+	for _, tt := range tests {
+		major, minor, ok := ParseVersion(tt.version)
+		if major != tt.major || minor != tt.minor || ok != tt.ok {
+			t.Errorf("ParseVersion(%q) = %d, %d, %v, want %d, %d, %v",
+				tt.version, major, minor, ok, tt.major, tt.minor, tt.ok)
+		}
+	}
+}
+
+func TestAtLeastVersionUnknown(t *testing.T) {
+	client := NewClient("example.invalid")
+	if !client.AtLeastVersion(0, 19) {
+		t.Error("AtLeastVersion = false for an unknown version, want true")
+	}
+}
+
+func TestGetPostsListingType(t *testing.T) {
+	tests := []struct {
+		name     string
+		typ      string
+		want     string
+		wantSent bool
+	}{
+		{"local", "Local", "Local", true},
+		{"all", "All", "All", true},
+		{"subscribed", "Subscribed", "Subscribed", true},
+		{"unset", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var query url.Values
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				query = r.URL.Query()
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"posts": []}`))
+			})
+
+			if _, err := client.GetPosts(GetPostsParams{CommunityName: "pics", Type: tt.typ}); err != nil {
+				t.Fatalf("GetPosts: %v", err)
+			}
+			if got, sent := query.Get("type_"), query.Has("type_"); got != tt.want || sent != tt.wantSent {
+				t.Errorf("type_ = %q (sent: %v), want %q (sent: %v)", got, sent, tt.want, tt.wantSent)
+			}
+			if got := query.Get("community_name"); got != "pics" {
+				t.Errorf("community_name = %q, want pics", got)
+			}
+		})
+	}
+}
+
+func TestAuthWithBasicAuth(t *testing.T) {
+	tests := []struct {
+		name      string
+		basicAuth bool
+	}{
+		{"bearer", false},
+		{"basic auth and cookie", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req *http.Request
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				req = r
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"posts": []}`))
+			})
+			if tt.basicAuth {
+				client.SetBasicAuth("proxyuser", "proxypass")
+			}
+			client.AuthToken = "token"
+
+			if _, err := client.GetPosts(GetPostsParams{CommunityName: "pics"}); err != nil {
+				t.Fatalf("GetPosts: %v", err)
+			}
+
+			user, password, ok := req.BasicAuth()
+			cookie, cookieErr := req.Cookie("jwt")
+			if !tt.basicAuth {
+				if got := req.Header.Get("Authorization"); got != "Bearer token" {
+					t.Errorf("Authorization = %q, want Bearer token", got)
+				}
+				if cookieErr == nil {
+					t.Errorf("jwt cookie = %q, want none", cookie.Value)
+				}
+				return
+			}
+			if !ok || user != "proxyuser" || password != "proxypass" {
+				t.Errorf("basic auth = %q, %q (ok: %v), want proxyuser, proxypass", user, password, ok)
+			}
+			if cookieErr != nil {
+				t.Fatalf("jwt cookie: %v", cookieErr)
+			}
+			if cookie.Value != "token" {
+				t.Errorf("jwt cookie = %q, want token", cookie.Value)
+			}
+		})
+	}
+}
+
+func TestLoginWithAPIKeySendsNoLoginRequest(t *testing.T) {
+	var paths []string
+	var authorization string
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		authorization = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"posts": []}`))
+	})
+	client.APIKey = "api-key"
+
+	if err := client.Login("user", "pass"); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if len(paths) != 0 {
+		t.Errorf("Login sent requests to %v, want none", paths)
+	}
+	if client.AuthToken != "api-key" {
+		t.Errorf("AuthToken = %q, want the API key", client.AuthToken)
+	}
+
+	if _, err := client.GetPosts(GetPostsParams{CommunityName: "pics"}); err != nil {
+		t.Fatalf("GetPosts: %v", err)
+	}
+	if len(paths) != 1 || paths[0] != "/api/v3/post/list" {
+		t.Errorf("requests = %v, want only /api/v3/post/list", paths)
+	}
+	if authorization != "Bearer api-key" {
+		t.Errorf("Authorization = %q, want Bearer api-key", authorization)
+	}
+}
+
+func TestExtraHeadersOnEveryRequest(t *testing.T) {
+	headers := map[string]http.Header{}
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		headers[r.URL.Path] = r.Header.Clone()
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/v3/user/login":
+			w.Write([]byte(`{"jwt": "token"}`))
+		case "/api/v3/post/list":
+			w.Write([]byte(`{"posts": []}`))
+		default:
+			w.Write([]byte(`{"comments": []}`))
+		}
+	})
+	client.UserAgent = "archiver/1.0"
+	client.ExtraHeaders = map[string]string{"X-Forwarded-For": "203.0.113.7", "X-Waf-Token": "secret"}
+
+	if err := client.Login("user", "pass"); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if _, err := client.GetPosts(GetPostsParams{CommunityName: "pics"}); err != nil {
+		t.Fatalf("GetPosts: %v", err)
+	}
+	if _, err := client.GetComments(1, 0, 0, ""); err != nil {
+		t.Fatalf("GetComments: %v", err)
+	}
+
+	for _, path := range []string{"/api/v3/user/login", "/api/v3/post/list", "/api/v3/comment/list"} {
+		h, ok := headers[path]
+		if !ok {
+			t.Errorf("%s was not requested", path)
+			continue
+		}
+		if got := h.Get("User-Agent"); got != "archiver/1.0" {
+			t.Errorf("%s: User-Agent = %q, want archiver/1.0", path, got)
+		}
+		if got := h.Get("X-Forwarded-For"); got != "203.0.113.7" {
+			t.Errorf("%s: X-Forwarded-For = %q, want 203.0.113.7", path, got)
+		}
+		if got := h.Get("X-Waf-Token"); got != "secret" {
+			t.Errorf("%s: X-Waf-Token = %q, want secret", path, got)
+		}
+	}
+}
@@ -2,18 +2,28 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"os"
+	"regexp"
+	"strings"
 	"time"
 
+	"github.com/neo1908/lemmy-image-scraper/internal/version"
+	log "github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v3"
 )
 
+// MinScrapeInterval is the shortest continuous mode interval allowed. Use watch
+// mode to pick up new posts more quickly.
+const MinScrapeInterval = Duration(30 * time.Second)
+
 // Config represents the application configuration
 type Config struct {
 	Lemmy      LemmyConfig      `yaml:"lemmy"`
 	Storage    StorageConfig    `yaml:"storage"`
 	Database   DatabaseConfig   `yaml:"database"`
 	Scraper    ScraperConfig    `yaml:"scraper"`
+	Downloader DownloaderConfig `yaml:"downloader"`
 	RunMode    RunModeConfig    `yaml:"run_mode"`
 	WebServer  WebServerConfig  `yaml:"web_server"`
 }
@@ -23,17 +33,66 @@ type LemmyConfig struct {
 	Instance    string   `yaml:"instance"`     // e.g., "lemmy.ml"
 	Username    string   `yaml:"username"`
 	Password    string   `yaml:"password"`
+	APIKey      string   `yaml:"api_key"`      // Long-lived API key (Lemmy 0.19+), used instead of username/password
 	Communities []string `yaml:"communities"`  // Optional list of communities to scrape
+
+	SkipCommunities []string `yaml:"skip_communities"`  // Communities whose posts are left out, e.g. of the hot page
+
+	CommunityOverrides map[string]CommunityOverride `yaml:"community_overrides"`  // Per-community settings, keyed by community name
+
+	CACertFile         string `yaml:"ca_cert_file"`          // Extra CA certificate (PEM) to trust, e.g. for self-signed instances
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`  // DANGEROUS: disable TLS verification (testing only)
+	ProxyURL           string `yaml:"proxy_url"`             // HTTP(S) or SOCKS5 proxy for API requests and downloads, e.g. "socks5://127.0.0.1:9050"
+	TokenCacheFile     string `yaml:"token_cache_file"`      // Optional file to keep the login token in between runs
+
+	UserAgent    string            `yaml:"user_agent"`     // User-Agent for API requests and downloads (default: lemmy-image-scraper/<version>)
+	ExtraHeaders map[string]string `yaml:"extra_headers"`  // Extra headers sent with every API request, e.g. for an auth proxy
+
+	HTTPBasicAuthUser     string `yaml:"http_basic_auth_user"`      // HTTP basic auth for a proxy in front of the instance, sent with every API request
+	HTTPBasicAuthPassword string `yaml:"http_basic_auth_password"`
+}
+
+// CommunityOverride contains settings that replace the global ones for a single community
+type CommunityOverride struct {
+	ScrapeInterval Duration      `yaml:"scrape_interval"`  // Continuous mode interval for this community (default: run_mode.interval)
+	ListingType    *string       `yaml:"listing_type"`     // Listing type for this community's posts (default: scraper.listing_type)
 }
 
 // StorageConfig contains settings for media storage
 type StorageConfig struct {
-	BaseDirectory string `yaml:"base_directory"`  // Where to save downloaded media
+	Backend        string   `yaml:"backend"`          // "local" (default) or "s3"
+	BaseDirectory  string   `yaml:"base_directory"`   // Where to save downloaded media
+	S3             S3Config `yaml:"s3"`               // Settings for the "s3" backend
+	NameByHash     bool     `yaml:"name_by_hash"`     // Name files by SHA256 in sharded subdirectories (ab/cd/abcd...ext) instead of postID_name
+	MaxTotalSize   int64    `yaml:"max_total_size"`   // Archive size cap in bytes, enforced after each scrape (0 = unlimited)
+	EvictionPolicy string   `yaml:"eviction_policy"`  // Which media go first past max_total_size: "oldest" (default), "lowest_score" or "largest"
+	Layout         string   `yaml:"layout"`           // Directories media is stored in: "community" (default), "date", "community_date" or a template such as "{community}/{year}"
+}
+
+// S3Config contains settings for S3-compatible object storage (AWS S3, MinIO, etc.)
+type S3Config struct {
+	Endpoint        string        `yaml:"endpoint"`          // e.g., "s3.amazonaws.com" or "minio.local:9000"
+	Region          string        `yaml:"region"`            // Bucket region (optional for MinIO)
+	Bucket          string        `yaml:"bucket"`            // Bucket to store media in
+	Prefix          string        `yaml:"prefix"`            // Optional key prefix inside the bucket
+	AccessKeyID     string        `yaml:"access_key_id"`
+	SecretAccessKey string        `yaml:"secret_access_key"`
+	DisableSSL      bool          `yaml:"disable_ssl"`       // Use plain HTTP to talk to the endpoint
+	RedirectServe   bool          `yaml:"redirect_serve"`    // Redirect web clients to presigned URLs instead of proxying
+	URLExpiry       Duration      `yaml:"url_expiry"`        // Lifetime of presigned URLs (default: 1h)
 }
 
-// DatabaseConfig contains SQLite database settings
+// DatabaseConfig contains database settings
 type DatabaseConfig struct {
-	Path string `yaml:"path"`  // Path to SQLite database file
+	Driver       string        `yaml:"driver"`          // Database driver: "sqlite" or "postgres" (default: sqlite)
+	Path         string        `yaml:"path"`            // Path to SQLite database file
+	DSN          string        `yaml:"dsn"`             // PostgreSQL connection string
+	JournalMode  string        `yaml:"journal_mode"`    // SQLite journal mode (default: WAL)
+	Synchronous  string        `yaml:"synchronous"`     // SQLite synchronous setting (default: NORMAL)
+	BusyTimeout  Duration      `yaml:"busy_timeout"`    // How long to wait for a locked database (default: 5s)
+	MaxOpenConns int           `yaml:"max_open_conns"`  // Connection pool size (default: 8)
+
+	AutoVacuumThreshold int `yaml:"auto_vacuum_threshold"`  // Run VACUUM and ANALYZE after this many rows are deleted (0 = never)
 }
 
 // ScraperConfig contains scraping behavior settings
@@ -43,23 +102,74 @@ type ScraperConfig struct {
 	SkipSeenPosts          bool `yaml:"skip_seen_posts"`             // Skip seen posts but continue scraping (vs stopping)
 	EnablePagination       bool `yaml:"enable_pagination"`           // Fetch multiple pages to get more than 50 posts
 	SeenPostsThreshold     int  `yaml:"seen_posts_threshold"`        // Stop after encountering this many seen posts in a row
+	SeenPostsDensityThreshold float64 `yaml:"seen_posts_density_threshold"` // Instead stop when more than this fraction of recent posts were seen (0 = use seen_posts_threshold)
+	SeenPostsWindowSize    int  `yaml:"seen_posts_window_size"`      // How many recent posts the density is measured over (default: 20)
+	StopOnShortPage        bool `yaml:"stop_on_short_page"`          // Legacy: treat a page with fewer posts than requested as the end
 	SortType               string `yaml:"sort_type"`                 // e.g., "Hot", "New", "TopDay"
+	ListingType            string `yaml:"listing_type"`              // "Local" (default), "All" or "Subscribed"
+	ScrapeAllCommunities   bool `yaml:"scrape_all_communities"`      // With no communities configured, scrape every local community instead of the hot page
+	CommunityFilter        []string `yaml:"community_filter"`        // Only archive posts from these communities, e.g. of the hot page (empty = all)
+	RespectRobots          bool `yaml:"respect_robots"`              // Honour the instance's robots.txt Crawl-delay and warn if the API is disallowed
+	RequestDelay           Duration      `yaml:"request_delay"`       // Minimum time between API and download requests (0 = no delay)
 	IncludeImages          bool `yaml:"include_images"`              // Download images
 	IncludeVideos          bool `yaml:"include_videos"`              // Download videos
 	IncludeOtherMedia      bool `yaml:"include_other_media"`         // Download other media types
+	SkipThumbnails         bool `yaml:"skip_thumbnails"`             // Never fall back to the post thumbnail when a post has no other media
+	CommentSort            string `yaml:"comment_sort"`              // Order comments are fetched in: "Top", "Hot", "New", "Old", "Controversial"
+	KeepRemovedComments    bool `yaml:"keep_removed_comments"`       // Store removed/deleted comments (hidden in the web UI by default)
+	MinCommentScore        int  `yaml:"min_comment_score"`           // Only store comments scoring at least this, plus their parents (0 = store all)
+	AutoCleanOrphans       bool `yaml:"auto_clean_orphans"`          // Delete comments of deleted posts at the start of each run
+	DownloadCommunityAssets bool `yaml:"download_community_assets"` // Download each scraped community's icon and banner
+	BackfillComments       bool `yaml:"backfill_comments"`           // Fetch comments for posts with media but no stored comments at the end of each run
+	ConvertGIFtoMP4        bool `yaml:"convert_gif_to_mp4"`          // Store animated GIFs as MP4 (requires ffmpeg)
+	ExtractVideoDuration   bool `yaml:"extract_video_duration"`      // Record the length of downloaded videos (requires ffprobe)
+	TrackScoreHistory      bool `yaml:"track_score_history"`         // Re-check recent posts' scores after each scrape
+	ScoreHistoryDays       int  `yaml:"score_history_days"`          // How many days back to re-check scores (default: 7)
+	TrackCrossposts        bool `yaml:"track_crossposts"`            // Fetch and store the crossposts of posts with media
+	AutoSubscribe          bool `yaml:"auto_subscribe"`              // Subscribe the account to each configured community at startup
+}
+
+// DownloaderConfig contains media download settings
+type DownloaderConfig struct {
+	MaxBytesPerSecond int64 `yaml:"max_bytes_per_second"`  // Combined download bandwidth cap (0 = unlimited)
+	SaveThumbnails    bool  `yaml:"save_thumbnails"`       // Store each post's instance thumbnail for faster grid previews
+	ThumbnailFormat   string `yaml:"thumbnail_format"`   // Re-encode saved thumbnails as "jpeg" or "webp" (requires ffmpeg; default: keep the instance's format)
+	MaxFileSize       int64 `yaml:"max_file_size"`         // Skip files larger than this many bytes (0 = unlimited)
+	SlowDownloadThreshold Duration `yaml:"slow_download_threshold"` // Log downloads that take longer than this with their host and speed (0 = never)
+	PreferOriginal    bool  `yaml:"prefer_original"`       // Download pict-rs originals rather than thumbnails or converted variants
+	UseYtDlp          bool   `yaml:"use_ytdlp"`           // Download videos from YouTube, Vimeo etc. link posts with yt-dlp
+	YtDlpPath         string `yaml:"ytdlp_path"`          // yt-dlp executable (default: "yt-dlp" from PATH)
 }
 
 // RunModeConfig contains run mode settings
 type RunModeConfig struct {
-	Mode     string        `yaml:"mode"`      // "once" or "continuous"
-	Interval time.Duration `yaml:"interval"`  // Interval for continuous mode (e.g., "5m", "1h")
+	Mode     string        `yaml:"mode"`      // "once", "continuous" or "watch"
+	Interval Duration      `yaml:"interval"`  // Interval for continuous mode (e.g., "5m", "1h")
+	WatchInterval Duration      `yaml:"watch_interval"` // How often watch mode checks for new posts (default: 10s)
+	PIDFile  string        `yaml:"pid_file"`  // Optional PID file preventing two continuous or watch instances from running
 }
 
 // WebServerConfig contains web UI server settings
 type WebServerConfig struct {
-	Enabled bool   `yaml:"enabled"`  // Enable web UI server
-	Host    string `yaml:"host"`     // Host to bind to (e.g., "localhost", "0.0.0.0")
-	Port    int    `yaml:"port"`     // Port to listen on
+	Enabled          bool   `yaml:"enabled"`            // Enable web UI server
+	Host             string `yaml:"host"`               // Host to bind to (e.g., "localhost", "0.0.0.0")
+	Port             int    `yaml:"port"`               // Port to listen on
+	DefaultCommunity string `yaml:"default_community"`  // Community filter applied on first load (empty = all)
+	DefaultType      string `yaml:"default_type"`       // Media type filter applied on first load (empty = all)
+	DefaultSort      string `yaml:"default_sort"`       // Sort field applied on first load (default: downloaded_at)
+	DefaultOrder     string `yaml:"default_order"`      // Sort order applied on first load: "DESC" or "ASC"
+	ShutdownTimeout  Duration      `yaml:"shutdown_timeout"` // How long in-flight requests get to finish on shutdown (default: 10s)
+	TLSCert          string `yaml:"tls_cert"`           // Certificate (PEM) to serve HTTPS with; requires tls_key
+	TLSKey           string `yaml:"tls_key"`            // Private key (PEM) for tls_cert
+	HTTPRedirectPort int    `yaml:"http_redirect_port"` // Optional plain HTTP port redirecting to HTTPS (0 = disabled)
+	DebugMode        bool   `yaml:"debug_mode"`         // Show debugging tools, such as a media hash search, in the web UI
+	AdditionalMediaDirs []string `yaml:"additional_media_dirs"` // Directories searched in order for media missing from storage, e.g. moved to cold storage
+	BackgroundRefreshInterval Duration `yaml:"background_refresh_interval"` // In once mode, scrape again on this interval while serving the UI (0 = disabled)
+	CORSAllowOrigins []string `yaml:"cors_allow_origins"` // Origins allowed to call /api/ from a browser, e.g. "https://app.example.com", or "*" for any
+	MaxRequestBodyBytes int64 `yaml:"max_request_body_bytes"` // Largest request body accepted, except by /media/ (default: 1 MB)
+	UploadUsername   string `yaml:"upload_username"`    // Basic auth user for POST /api/media/upload; uploads are disabled unless both are set
+	UploadPassword   string `yaml:"upload_password"`    // Basic auth password for POST /api/media/upload
+	MaxUploadBytes   int64  `yaml:"max_upload_bytes"`   // Largest upload accepted by /api/media/upload (default: 100 MB)
 }
 
 // LoadConfig loads configuration from a YAML file
@@ -74,6 +184,11 @@ func LoadConfig(path string) (*Config, error) {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
 
+	// LIS_* environment variables override the file, e.g. for secrets
+	if err := config.applyEnv(); err != nil {
+		return nil, err
+	}
+
 	// Validate required fields
 	if err := config.Validate(); err != nil {
 		return nil, fmt.Errorf("config validation failed: %w", err)
@@ -87,24 +202,215 @@ func (c *Config) Validate() error {
 	if c.Lemmy.Instance == "" {
 		return fmt.Errorf("lemmy.instance is required")
 	}
-	if c.Lemmy.Username == "" {
-		return fmt.Errorf("lemmy.username is required")
+	// An API key replaces the username and password
+	if c.Lemmy.APIKey == "" {
+		if c.Lemmy.Username == "" {
+			return fmt.Errorf("lemmy.username is required unless lemmy.api_key is set")
+		}
+		if c.Lemmy.Password == "" {
+			return fmt.Errorf("lemmy.password is required unless lemmy.api_key is set")
+		}
+	}
+	if c.Lemmy.ProxyURL != "" {
+		proxy, err := url.Parse(c.Lemmy.ProxyURL)
+		if err != nil {
+			return fmt.Errorf("lemmy.proxy_url is invalid: %w", err)
+		}
+		switch proxy.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return fmt.Errorf("lemmy.proxy_url must use the http, https or socks5 scheme")
+		}
+		if proxy.Host == "" {
+			return fmt.Errorf("lemmy.proxy_url must include a host")
+		}
+	}
+	if c.Lemmy.HTTPBasicAuthUser != "" && c.Lemmy.HTTPBasicAuthPassword == "" {
+		log.Warn("lemmy.http_basic_auth_user is set without lemmy.http_basic_auth_password, basic auth will not be used")
+	}
+	for name := range c.Lemmy.ExtraHeaders {
+		if name == "" || strings.ContainsAny(name, " \t\r\n:") {
+			return fmt.Errorf("lemmy.extra_headers has an invalid header name %q", name)
+		}
+	}
+	switch c.Storage.Backend {
+	case "", "local":
+		if c.Storage.BaseDirectory == "" {
+			return fmt.Errorf("storage.base_directory is required")
+		}
+	case "s3":
+		if c.Storage.S3.Endpoint == "" {
+			return fmt.Errorf("storage.s3.endpoint is required for the s3 backend")
+		}
+		if c.Storage.S3.Bucket == "" {
+			return fmt.Errorf("storage.s3.bucket is required for the s3 backend")
+		}
+	default:
+		return fmt.Errorf("storage.backend must be 'local' or 's3'")
+	}
+	if c.Storage.MaxTotalSize < 0 {
+		return fmt.Errorf("storage.max_total_size must not be negative")
+	}
+	switch c.Storage.EvictionPolicy {
+	case "", "oldest", "lowest_score", "largest":
+	default:
+		return fmt.Errorf("storage.eviction_policy must be 'oldest', 'lowest_score' or 'largest'")
+	}
+	if err := validateLayout(c.Storage.Layout); err != nil {
+		return fmt.Errorf("storage.layout %w", err)
+	}
+	switch strings.ToLower(c.Database.Driver) {
+	case "", "sqlite":
+		if c.Database.Path == "" {
+			return fmt.Errorf("database.path is required")
+		}
+	case "postgres":
+		if c.Database.DSN == "" {
+			return fmt.Errorf("database.dsn is required for the postgres driver")
+		}
+	default:
+		return fmt.Errorf("database.driver must be 'sqlite' or 'postgres'")
 	}
-	if c.Lemmy.Password == "" {
-		return fmt.Errorf("lemmy.password is required")
+	switch strings.ToUpper(c.Database.JournalMode) {
+	case "", "WAL", "DELETE", "TRUNCATE", "PERSIST", "MEMORY", "OFF":
+	default:
+		return fmt.Errorf("database.journal_mode must be one of WAL, DELETE, TRUNCATE, PERSIST, MEMORY, OFF")
 	}
-	if c.Storage.BaseDirectory == "" {
-		return fmt.Errorf("storage.base_directory is required")
+	switch strings.ToUpper(c.Database.Synchronous) {
+	case "", "OFF", "NORMAL", "FULL", "EXTRA":
+	default:
+		return fmt.Errorf("database.synchronous must be one of OFF, NORMAL, FULL, EXTRA")
 	}
-	if c.Database.Path == "" {
-		return fmt.Errorf("database.path is required")
+	if c.Database.AutoVacuumThreshold < 0 {
+		return fmt.Errorf("database.auto_vacuum_threshold must not be negative")
 	}
-	if c.RunMode.Mode != "once" && c.RunMode.Mode != "continuous" {
-		return fmt.Errorf("run_mode.mode must be 'once' or 'continuous'")
+	switch strings.ToLower(c.Scraper.ListingType) {
+	case "", "local", "all", "subscribed":
+	default:
+		return fmt.Errorf("scraper.listing_type must be 'Local', 'All' or 'Subscribed'")
+	}
+	if c.Scraper.SeenPostsDensityThreshold < 0 || c.Scraper.SeenPostsDensityThreshold > 1 {
+		return fmt.Errorf("scraper.seen_posts_density_threshold must be between 0 and 1")
+	}
+	if c.Scraper.SeenPostsWindowSize < 0 {
+		return fmt.Errorf("scraper.seen_posts_window_size must not be negative")
+	}
+	for _, origin := range c.WebServer.CORSAllowOrigins {
+		if origin == "*" {
+			continue
+		}
+		if !(strings.HasPrefix(origin, "http://") || strings.HasPrefix(origin, "https://")) || strings.HasSuffix(origin, "/") {
+			return fmt.Errorf("web_server.cors_allow_origins: %q must be \"*\" or an origin such as \"https://app.example.com\"", origin)
+		}
+	}
+	for _, dir := range c.WebServer.AdditionalMediaDirs {
+		if strings.TrimSpace(dir) == "" {
+			return fmt.Errorf("web_server.additional_media_dirs must not contain empty paths")
+		}
+	}
+	if interval := c.WebServer.BackgroundRefreshInterval; interval != 0 && interval < MinScrapeInterval {
+		return fmt.Errorf("web_server.background_refresh_interval must be at least %s, got %s", MinScrapeInterval, interval)
+	}
+	if c.WebServer.ShutdownTimeout < 0 {
+		return fmt.Errorf("web_server.shutdown_timeout must not be negative")
+	}
+	if c.WebServer.MaxRequestBodyBytes < 0 {
+		return fmt.Errorf("web_server.max_request_body_bytes must not be negative")
+	}
+	if c.WebServer.MaxUploadBytes < 0 {
+		return fmt.Errorf("web_server.max_upload_bytes must not be negative")
+	}
+	if (c.WebServer.UploadUsername == "") != (c.WebServer.UploadPassword == "") {
+		return fmt.Errorf("web_server.upload_username and web_server.upload_password must be set together")
+	}
+	if (c.WebServer.TLSCert == "") != (c.WebServer.TLSKey == "") {
+		return fmt.Errorf("web_server.tls_cert and web_server.tls_key must be set together")
+	}
+	if c.WebServer.HTTPRedirectPort != 0 {
+		if c.WebServer.TLSCert == "" {
+			return fmt.Errorf("web_server.http_redirect_port requires tls_cert and tls_key")
+		}
+		if c.WebServer.HTTPRedirectPort < 0 || c.WebServer.HTTPRedirectPort > 65535 {
+			return fmt.Errorf("web_server.http_redirect_port must be between 1 and 65535")
+		}
+	}
+	if c.Scraper.RequestDelay < 0 {
+		return fmt.Errorf("scraper.request_delay must not be negative")
+	}
+	if c.Downloader.MaxBytesPerSecond < 0 {
+		return fmt.Errorf("downloader.max_bytes_per_second must not be negative")
+	}
+	if c.Downloader.MaxFileSize < 0 {
+		return fmt.Errorf("downloader.max_file_size must not be negative")
+	}
+	if c.Downloader.SlowDownloadThreshold < 0 {
+		return fmt.Errorf("downloader.slow_download_threshold must not be negative")
+	}
+	switch c.Downloader.ThumbnailFormat {
+	case "", "jpeg", "webp":
+	default:
+		return fmt.Errorf("downloader.thumbnail_format must be 'jpeg' or 'webp'")
+	}
+	if c.RunMode.Mode != "once" && c.RunMode.Mode != "continuous" && c.RunMode.Mode != "watch" {
+		return fmt.Errorf("run_mode.mode must be 'once', 'continuous' or 'watch'")
+	}
+	if c.RunMode.WatchInterval < 0 {
+		return fmt.Errorf("run_mode.watch_interval must not be negative")
 	}
 	if c.RunMode.Mode == "continuous" && c.RunMode.Interval == 0 {
 		return fmt.Errorf("run_mode.interval is required for continuous mode")
 	}
+	if c.RunMode.Mode == "continuous" && c.RunMode.Interval < MinScrapeInterval {
+		return fmt.Errorf("run_mode.interval must be at least %s, got %s", MinScrapeInterval, c.RunMode.Interval)
+	}
+	for name, override := range c.Lemmy.CommunityOverrides {
+		if override.ScrapeInterval < 0 {
+			return fmt.Errorf("lemmy.community_overrides.%s.scrape_interval must not be negative", name)
+		}
+		if override.ScrapeInterval > 0 && override.ScrapeInterval < MinScrapeInterval {
+			return fmt.Errorf("lemmy.community_overrides.%s.scrape_interval must be at least %s, got %s", name, MinScrapeInterval, override.ScrapeInterval)
+		}
+		if override.ListingType != nil {
+			switch strings.ToLower(*override.ListingType) {
+			case "local", "all", "subscribed":
+			default:
+				return fmt.Errorf("lemmy.community_overrides.%s.listing_type must be 'Local', 'All' or 'Subscribed'", name)
+			}
+		}
+	}
+	return nil
+}
+
+// layoutPlaceholder matches the placeholders in a storage.layout template
+var layoutPlaceholder = regexp.MustCompile(`\{[^{}]*\}`)
+
+// validateLayout checks that a storage.layout is one of the named layouts or a
+// template of relative directories using only the known placeholders
+func validateLayout(layout string) error {
+	switch layout {
+	case "", "community", "date", "community_date":
+		return nil
+	}
+
+	placeholders := layoutPlaceholder.FindAllString(layout, -1)
+	if len(placeholders) == 0 {
+		return fmt.Errorf("must be 'community', 'date', 'community_date' or a template using {community}, {year}, {month} and {day}")
+	}
+	for _, p := range placeholders {
+		switch p {
+		case "{community}", "{year}", "{month}", "{day}":
+		default:
+			return fmt.Errorf("has unknown placeholder %s", p)
+		}
+	}
+	if strings.HasPrefix(layout, "/") || strings.Contains(layout, "\\") {
+		return fmt.Errorf("must be a relative path using '/'")
+	}
+	for _, dir := range strings.Split(layout, "/") {
+		if dir == ".." {
+			return fmt.Errorf("must not contain '..'")
+		}
+	}
 	return nil
 }
 
@@ -118,6 +424,9 @@ func (c *Config) SetDefaults() {
 	if c.Scraper.SeenPostsThreshold == 0 {
 		c.Scraper.SeenPostsThreshold = 5 // Stop after seeing 5 posts in a row we've already processed
 	}
+	if c.Scraper.SeenPostsWindowSize == 0 {
+		c.Scraper.SeenPostsWindowSize = 20
+	}
 
 	// If pagination is disabled, limit to 50 (API max per request)
 	if !c.Scraper.EnablePagination && c.Scraper.MaxPostsPerRun > 50 {
@@ -130,14 +439,72 @@ func (c *Config) SetDefaults() {
 	// Normalize sort type to match Lemmy API expectations
 	c.Scraper.SortType = normalizeSortType(c.Scraper.SortType)
 
+	if c.Downloader.YtDlpPath == "" {
+		c.Downloader.YtDlpPath = "yt-dlp"
+	}
+
+	if c.Lemmy.UserAgent == "" {
+		c.Lemmy.UserAgent = version.UserAgent()
+	}
+
+	if c.Scraper.ListingType == "" {
+		c.Scraper.ListingType = "Local"
+	}
+	c.Scraper.ListingType = normalizeListingType(c.Scraper.ListingType)
+
 	if !c.Scraper.IncludeImages && !c.Scraper.IncludeVideos && !c.Scraper.IncludeOtherMedia {
 		c.Scraper.IncludeImages = true
 		c.Scraper.IncludeVideos = true
 		c.Scraper.IncludeOtherMedia = true
 	}
+	if c.Scraper.CommentSort == "" {
+		c.Scraper.CommentSort = "Top"
+	}
+	c.Scraper.CommentSort = normalizeCommentSort(c.Scraper.CommentSort)
+
+	if c.Scraper.ScoreHistoryDays == 0 {
+		c.Scraper.ScoreHistoryDays = 7
+	}
 	if c.RunMode.Mode == "" {
 		c.RunMode.Mode = "once"
 	}
+	if c.RunMode.WatchInterval == 0 {
+		c.RunMode.WatchInterval = Duration(10 * time.Second)
+	}
+
+	// Database defaults: WAL lets the web server read while the scraper writes
+	if c.Database.Driver == "" {
+		c.Database.Driver = "sqlite"
+	}
+	c.Database.Driver = strings.ToLower(c.Database.Driver)
+	if c.Database.JournalMode == "" {
+		c.Database.JournalMode = "WAL"
+	}
+	c.Database.JournalMode = strings.ToUpper(c.Database.JournalMode)
+	if c.Database.Synchronous == "" {
+		c.Database.Synchronous = "NORMAL"
+	}
+	c.Database.Synchronous = strings.ToUpper(c.Database.Synchronous)
+	if c.Database.BusyTimeout == 0 {
+		c.Database.BusyTimeout = Duration(5 * time.Second)
+	}
+	if c.Database.MaxOpenConns == 0 {
+		c.Database.MaxOpenConns = 8
+	}
+
+	// Storage defaults
+	if c.Storage.Backend == "" {
+		c.Storage.Backend = "local"
+	}
+	if c.Storage.Layout == "" {
+		c.Storage.Layout = "community"
+	}
+	if c.Storage.EvictionPolicy == "" {
+		c.Storage.EvictionPolicy = "oldest"
+	}
+	if c.Storage.S3.URLExpiry == 0 {
+		c.Storage.S3.URLExpiry = Duration(time.Hour)
+	}
 
 	// Web server defaults
 	if c.WebServer.Port == 0 {
@@ -146,6 +513,40 @@ func (c *Config) SetDefaults() {
 	if c.WebServer.Host == "" {
 		c.WebServer.Host = "localhost"
 	}
+	if c.WebServer.ShutdownTimeout == 0 {
+		c.WebServer.ShutdownTimeout = Duration(10 * time.Second)
+	}
+	if c.WebServer.MaxRequestBodyBytes == 0 {
+		c.WebServer.MaxRequestBodyBytes = 1 << 20
+	}
+	if c.WebServer.MaxUploadBytes == 0 {
+		c.WebServer.MaxUploadBytes = 100 << 20
+	}
+	if c.WebServer.DefaultSort == "" {
+		c.WebServer.DefaultSort = "downloaded_at"
+	}
+	c.WebServer.DefaultOrder = strings.ToUpper(c.WebServer.DefaultOrder)
+	if c.WebServer.DefaultOrder != "ASC" {
+		c.WebServer.DefaultOrder = "DESC"
+	}
+}
+
+// ScrapeIntervalFor returns the continuous mode interval for a community,
+// falling back to the global interval when it has no override
+func (c *Config) ScrapeIntervalFor(community string) time.Duration {
+	if override, ok := c.Lemmy.CommunityOverrides[community]; ok && override.ScrapeInterval > 0 {
+		return time.Duration(override.ScrapeInterval)
+	}
+	return time.Duration(c.RunMode.Interval)
+}
+
+// ListingTypeFor returns the listing type to request a community's posts with,
+// falling back to scraper.listing_type when it has no override
+func (c *Config) ListingTypeFor(community string) string {
+	if override, ok := c.Lemmy.CommunityOverrides[community]; ok && override.ListingType != nil {
+		return normalizeListingType(*override.ListingType)
+	}
+	return c.Scraper.ListingType
 }
 
 // normalizeSortType converts user-friendly sort type names to API format
@@ -176,3 +577,37 @@ func normalizeSortType(sort string) string {
 	}
 	return sort
 }
+
+// normalizeCommentSort converts user-friendly comment sort names to API format
+func normalizeCommentSort(sort string) string {
+	// Based on Lemmy's CommentSortType enum
+	switch strings.ToLower(sort) {
+	case "hot":
+		return "Hot"
+	case "top":
+		return "Top"
+	case "new":
+		return "New"
+	case "old":
+		return "Old"
+	case "controversial":
+		return "Controversial"
+	default:
+		return sort
+	}
+}
+
+// normalizeListingType converts user-friendly listing type names to API format
+func normalizeListingType(listingType string) string {
+	// Based on Lemmy's ListingType enum
+	switch strings.ToLower(listingType) {
+	case "local":
+		return "Local"
+	case "all":
+		return "All"
+	case "subscribed":
+		return "Subscribed"
+	default:
+		return listingType
+	}
+}
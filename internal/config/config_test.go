@@ -0,0 +1,74 @@
+package config
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestListingTypeFor(t *testing.T) {
+	all := "all"
+	cfg := &Config{}
+	cfg.Scraper.ListingType = "subscribed"
+	cfg.Lemmy.CommunityOverrides = map[string]CommunityOverride{
+		"pics":  {ListingType: &all},
+		"memes": {ScrapeInterval: Duration(time.Minute)},
+	}
+	cfg.SetDefaults()
+
+	tests := []struct {
+		community string
+		want      string
+	}{
+		{"", "Subscribed"},
+		{"pics", "All"},
+		{"memes", "Subscribed"},
+		{"news", "Subscribed"},
+	}
+	for _, tt := range tests {
+		if got := cfg.ListingTypeFor(tt.community); got != tt.want {
+			t.Errorf("ListingTypeFor(%q) = %q, want %q", tt.community, got, tt.want)
+		}
+	}
+}
+
+func TestValidateWarnsOnBasicAuthUserWithoutPassword(t *testing.T) {
+	var buf bytes.Buffer
+	out := log.StandardLogger().Out
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(out) })
+
+	tests := []struct {
+		name     string
+		password string
+		warn     bool
+	}{
+		{"without password", "", true},
+		{"with password", "proxypass", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			cfg := &Config{}
+			cfg.Lemmy.Instance = "lemmy.example"
+			cfg.Lemmy.Username = "user"
+			cfg.Lemmy.Password = "pass"
+			cfg.Lemmy.HTTPBasicAuthUser = "proxyuser"
+			cfg.Lemmy.HTTPBasicAuthPassword = tt.password
+			cfg.Storage.BaseDirectory = t.TempDir()
+			cfg.Database.Path = "scraper.db"
+			cfg.SetDefaults()
+
+			if err := cfg.Validate(); err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			warned := strings.Contains(buf.String(), "http_basic_auth_password")
+			if warned != tt.warn {
+				t.Errorf("warned = %v, want %v; log: %q", warned, tt.warn, buf.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultConfigYAML returns a configuration file listing every option with its
+// default value, and placeholders for the instance and credentials. It's built
+// from Config itself, so it always matches the options that are read.
+func DefaultConfigYAML() ([]byte, error) {
+	var config Config
+	config.Lemmy.Instance = "lemmy.example.com"
+	config.Lemmy.Username = "your-username"
+	config.Lemmy.Password = "your-password"
+	config.Lemmy.Communities = []string{"pics"}
+	config.Storage.BaseDirectory = "./downloads"
+	config.Database.Path = "./lemmy-scraper.db"
+	config.SetDefaults()
+
+	// Left empty so the default follows the version after an upgrade
+	config.Lemmy.UserAgent = ""
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&config); err != nil {
+		return nil, fmt.Errorf("failed to marshal default config: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("failed to marshal default config: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,146 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix starts the name of every environment variable that sets a config
+// option. The rest of the name is the option's YAML path in upper case joined
+// by underscores, e.g. LIS_LEMMY_INSTANCE or LIS_RUN_MODE_INTERVAL.
+const EnvPrefix = "LIS_"
+
+// EnvConfigSentinel is the -config value (or LIS_CONFIG value) that loads the
+// configuration from environment variables alone
+const EnvConfigSentinel = "env"
+
+// durationType is Duration's type, which is parsed rather than set as an integer
+var durationType = reflect.TypeOf(Duration(0))
+
+// LoadConfigFromEnv builds the configuration from LIS_* environment variables
+// without reading a file. Only options whose variable is set are populated.
+func LoadConfigFromEnv() (*Config, error) {
+	var config Config
+	if err := config.applyEnv(); err != nil {
+		return nil, err
+	}
+
+	// Defaults first, so options such as run_mode.mode needn't all be given as variables
+	config.SetDefaults()
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("config validation failed: %w", err)
+	}
+
+	return &config, nil
+}
+
+// applyEnv sets every option that has a LIS_* environment variable, replacing
+// any value from the config file
+func (c *Config) applyEnv() error {
+	return applyEnvToStruct(reflect.ValueOf(c).Elem(), strings.TrimSuffix(EnvPrefix, "_"))
+}
+
+// applyEnvToStruct sets the fields of a config struct from the environment,
+// descending into nested sections
+func applyEnvToStruct(v reflect.Value, prefix string) error {
+	for i := 0; i < v.NumField(); i++ {
+		tag := strings.Split(v.Type().Field(i).Tag.Get("yaml"), ",")[0]
+		if tag == "" || tag == "-" {
+			continue
+		}
+		name := prefix + "_" + strings.ToUpper(tag)
+		field := v.Field(i)
+
+		if field.Kind() == reflect.Struct {
+			if err := applyEnvToStruct(field, name); err != nil {
+				return err
+			}
+			continue
+		}
+
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setFromEnv(field, value); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// setFromEnv parses an environment variable into a config field. Lists are
+// comma separated and maps are written as "key=value,key=value". Options with
+// nested values, such as lemmy.community_overrides, can only be set in a file.
+func setFromEnv(field reflect.Value, value string) error {
+	if field.Type() == durationType {
+		d, err := ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		field.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("cannot be set from the environment")
+		}
+		items := reflect.MakeSlice(field.Type(), 0, 0)
+		for _, item := range splitEnvList(value) {
+			items = reflect.Append(items, reflect.ValueOf(item))
+		}
+		field.Set(items)
+	case reflect.Map:
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("cannot be set from the environment")
+		}
+		entries := reflect.MakeMap(field.Type())
+		for _, item := range splitEnvList(value) {
+			key, val, ok := strings.Cut(item, "=")
+			if !ok {
+				return fmt.Errorf("invalid entry %q, expected key=value", item)
+			}
+			entries.SetMapIndex(reflect.ValueOf(strings.TrimSpace(key)), reflect.ValueOf(strings.TrimSpace(val)))
+		}
+		field.Set(entries)
+	default:
+		return fmt.Errorf("cannot be set from the environment")
+	}
+	return nil
+}
+
+// splitEnvList splits a comma separated list, dropping empty items
+func splitEnvList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// setRequiredEnv sets the variables for the options Validate requires
+func setRequiredEnv(t *testing.T) {
+	t.Helper()
+	t.Setenv("LIS_LEMMY_INSTANCE", "lemmy.example")
+	t.Setenv("LIS_LEMMY_USERNAME", "user")
+	t.Setenv("LIS_LEMMY_PASSWORD", "pass")
+	t.Setenv("LIS_STORAGE_BASE_DIRECTORY", t.TempDir())
+	t.Setenv("LIS_DATABASE_PATH", "scraper.db")
+}
+
+func TestLoadConfigFromEnv(t *testing.T) {
+	setRequiredEnv(t)
+	t.Setenv("LIS_LEMMY_COMMUNITIES", "pics, memes,")
+	t.Setenv("LIS_LEMMY_EXTRA_HEADERS", "X-Forwarded-For=203.0.113.7,X-Waf-Token = secret")
+	t.Setenv("LIS_SCRAPER_MAX_POSTS_PER_RUN", "25")
+	t.Setenv("LIS_SCRAPER_SKIP_SEEN_POSTS", "true")
+	t.Setenv("LIS_RUN_MODE_INTERVAL", "2h")
+	t.Setenv("LIS_SCRAPER_REQUEST_DELAY", "1.5")
+	t.Setenv("LIS_DATABASE_BUSY_TIMEOUT", "90s")
+
+	cfg, err := LoadConfigFromEnv()
+	if err != nil {
+		t.Fatalf("LoadConfigFromEnv: %v", err)
+	}
+
+	if cfg.Lemmy.Instance != "lemmy.example" || cfg.Lemmy.Username != "user" || cfg.Lemmy.Password != "pass" {
+		t.Errorf("instance, username, password = %q, %q, %q", cfg.Lemmy.Instance, cfg.Lemmy.Username, cfg.Lemmy.Password)
+	}
+	if got := strings.Join(cfg.Lemmy.Communities, ","); got != "pics,memes" {
+		t.Errorf("communities = %v, want [pics memes]", cfg.Lemmy.Communities)
+	}
+	if h := cfg.Lemmy.ExtraHeaders; len(h) != 2 || h["X-Forwarded-For"] != "203.0.113.7" || h["X-Waf-Token"] != "secret" {
+		t.Errorf("extra headers = %v", h)
+	}
+	if cfg.Scraper.MaxPostsPerRun != 25 || !cfg.Scraper.SkipSeenPosts {
+		t.Errorf("max posts per run, skip seen posts = %d, %v, want 25, true", cfg.Scraper.MaxPostsPerRun, cfg.Scraper.SkipSeenPosts)
+	}
+
+	durations := []struct {
+		name string
+		got  Duration
+		want time.Duration
+	}{
+		{"run_mode.interval", cfg.RunMode.Interval, 2 * time.Hour},
+		{"scraper.request_delay", cfg.Scraper.RequestDelay, 1500 * time.Millisecond},
+		{"database.busy_timeout", cfg.Database.BusyTimeout, 90 * time.Second},
+	}
+	for _, d := range durations {
+		if time.Duration(d.got) != d.want {
+			t.Errorf("%s = %s, want %s", d.name, time.Duration(d.got), d.want)
+		}
+	}
+
+	// Unset options get their defaults
+	if cfg.RunMode.Mode == "" || cfg.Storage.Backend == "" {
+		t.Errorf("run mode, storage backend = %q, %q, want defaults", cfg.RunMode.Mode, cfg.Storage.Backend)
+	}
+}
+
+func TestLoadConfigFromEnvErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{"invalid duration", map[string]string{"LIS_RUN_MODE_INTERVAL": "soon"}, "LIS_RUN_MODE_INTERVAL"},
+		{"invalid integer", map[string]string{"LIS_SCRAPER_MAX_POSTS_PER_RUN": "many"}, "LIS_SCRAPER_MAX_POSTS_PER_RUN"},
+		{"invalid header", map[string]string{"LIS_LEMMY_EXTRA_HEADERS": "X-Token"}, "LIS_LEMMY_EXTRA_HEADERS"},
+		{"missing instance", map[string]string{"LIS_LEMMY_INSTANCE": ""}, "lemmy.instance is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setRequiredEnv(t)
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			_, err := LoadConfigFromEnv()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadConfigFromEnv error = %v, want one mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// HashFileName names a file by its content hash, sharded into two levels of
+// subdirectories by the hash's first four characters, e.g. "ab/cd/abcd....jpg"
+func HashFileName(hash, ext string) string {
+	return path.Join(hash[:2], hash[2:4], hash+ext)
+}
+
+// casMove is a file moved by MigrateToContentAddressable
+type casMove struct {
+	from, to string
+}
+
+// MigrateToContentAddressable renames the files of media stored below baseDir to
+// the hash-based names storage.name_by_hash gives new downloads, and updates
+// their file_path and file_name in a single transaction. Files stay in their
+// directory, so thumbnails are still found next to them. Rows already named by
+// hash, or whose file isn't below baseDir, are left alone, so running it again
+// is safe. With dryRun set it only counts the files that would be moved.
+//
+// If the transaction fails, the files moved are moved back.
+func (db *DB) MigrateToContentAddressable(baseDir string, dryRun bool) (moved int, err error) {
+	var rows []struct {
+		ID        int64  `db:"id"`
+		MediaHash string `db:"media_hash"`
+		FileName  string `db:"file_name"`
+		FilePath  string `db:"file_path"`
+	}
+	if err := db.Select(&rows, `SELECT id, media_hash, file_name, file_path FROM scraped_media ORDER BY id`); err != nil {
+		return 0, fmt.Errorf("failed to get media files: %w", err)
+	}
+
+	var moves []casMove
+	err = db.WithTx(func(tx *Tx) error {
+		for _, row := range rows {
+			if len(row.MediaHash) < 4 || row.FileName == "" {
+				continue
+			}
+			newName := HashFileName(row.MediaHash, filepath.Ext(row.FileName))
+			if row.FileName == newName {
+				continue
+			}
+
+			rel, err := filepath.Rel(baseDir, row.FilePath)
+			if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				log.Warnf("Skipping media %d: %s is not below %s", row.ID, row.FilePath, baseDir)
+				continue
+			}
+			if !strings.HasSuffix(row.FilePath, filepath.FromSlash(row.FileName)) {
+				log.Warnf("Skipping media %d: file path %s doesn't end in its file name %s", row.ID, row.FilePath, row.FileName)
+				continue
+			}
+			newPath := strings.TrimSuffix(row.FilePath, filepath.FromSlash(row.FileName)) + filepath.FromSlash(newName)
+
+			if dryRun {
+				log.Infof("Would move %s to %s", row.FilePath, newPath)
+				moved++
+				continue
+			}
+
+			// A previous run may have moved the file but failed to record it
+			if _, err := os.Stat(newPath); err == nil {
+				if _, err := os.Stat(row.FilePath); err == nil {
+					log.Warnf("Skipping media %d: %s already exists", row.ID, newPath)
+					continue
+				}
+			} else {
+				if err := moveFile(row.FilePath, newPath); err != nil {
+					return fmt.Errorf("failed to move media %d: %w", row.ID, err)
+				}
+				moves = append(moves, casMove{from: row.FilePath, to: newPath})
+			}
+
+			if _, err := tx.Exec(tx.Rebind(`UPDATE scraped_media SET file_path = ?, file_name = ? WHERE id = ?`),
+				newPath, newName, row.ID); err != nil {
+				return fmt.Errorf("failed to update media %d: %w", row.ID, err)
+			}
+			moved++
+		}
+		return nil
+	})
+	if err != nil {
+		// The records still name the old files, so put them back
+		for i := len(moves) - 1; i >= 0; i-- {
+			if undoErr := moveFile(moves[i].to, moves[i].from); undoErr != nil {
+				log.Errorf("Failed to move %s back to %s: %v", moves[i].to, moves[i].from, undoErr)
+			}
+		}
+		return 0, err
+	}
+	return moved, nil
+}
+
+// moveFile renames from to to, creating to's directory. Across filesystems,
+// where a rename isn't possible, the file is copied and the original removed.
+func moveFile(from, to string) error {
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	err := os.Rename(from, to)
+	if err == nil || !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		os.Remove(to)
+		return fmt.Errorf("failed to copy file: %w", err)
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(to)
+		return fmt.Errorf("failed to copy file: %w", err)
+	}
+	return os.Remove(from)
+}
@@ -0,0 +1,109 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neo1908/lemmy-image-scraper/pkg/models"
+)
+
+// saveMediaFile writes content to name below dir and records it as media of
+// post postID with the given hash
+func saveMediaFile(t *testing.T, db *DB, dir, name, hash, content string, postID int64) {
+	t.Helper()
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := db.SaveMedia(&models.ScrapedMedia{
+		PostID:        postID,
+		CommunityName: "pics",
+		MediaURL:      "https://example.invalid/" + hash,
+		MediaHash:     hash,
+		FileName:      name,
+		FilePath:      path,
+		FileSize:      int64(len(content)),
+		MediaType:     "image",
+		PostCreated:   time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("SaveMedia: %v", err)
+	}
+}
+
+// mediaFile returns the recorded file name and path of the media with hash
+func mediaFile(t *testing.T, db *DB, hash string) (name, path string) {
+	t.Helper()
+	var row struct {
+		FileName string `db:"file_name"`
+		FilePath string `db:"file_path"`
+	}
+	if err := db.Get(&row, `SELECT file_name, file_path FROM scraped_media WHERE media_hash = ?`, hash); err != nil {
+		t.Fatalf("failed to get media %s: %v", hash, err)
+	}
+	return row.FileName, row.FilePath
+}
+
+func TestMigrateToContentAddressable(t *testing.T) {
+	db := newTestDB(t)
+	base := t.TempDir()
+	outside := t.TempDir()
+
+	first := strings.Repeat("ab", 32)
+	second := strings.Repeat("cd", 32)
+	elsewhere := strings.Repeat("ef", 32)
+	saveMediaFile(t, db, filepath.Join(base, "pics"), "1_a.png", first, "first", 1)
+	saveMediaFile(t, db, filepath.Join(base, "pics"), "2_b.jpg", second, "second", 2)
+	saveMediaFile(t, db, outside, "3_c.png", elsewhere, "elsewhere", 3)
+
+	// A dry run only counts
+	moved, err := db.MigrateToContentAddressable(base, true)
+	if err != nil || moved != 2 {
+		t.Fatalf("dry run: moved = %d, err = %v, want 2", moved, err)
+	}
+	if name, _ := mediaFile(t, db, first); name != "1_a.png" {
+		t.Errorf("dry run renamed media to %s", name)
+	}
+	if _, err := os.Stat(filepath.Join(base, "pics", "1_a.png")); err != nil {
+		t.Errorf("dry run moved a file: %v", err)
+	}
+
+	moved, err = db.MigrateToContentAddressable(base, false)
+	if err != nil || moved != 2 {
+		t.Fatalf("migration: moved = %d, err = %v, want 2", moved, err)
+	}
+
+	for _, m := range []struct{ hash, ext, oldName, content string }{
+		{first, ".png", "1_a.png", "first"},
+		{second, ".jpg", "2_b.jpg", "second"},
+	} {
+		wantName := HashFileName(m.hash, m.ext)
+		wantPath := filepath.Join(base, "pics", filepath.FromSlash(wantName))
+		name, path := mediaFile(t, db, m.hash)
+		if name != wantName || path != wantPath {
+			t.Errorf("media %s recorded as %s at %s, want %s at %s", m.oldName, name, path, wantName, wantPath)
+		}
+		if data, err := os.ReadFile(wantPath); err != nil || string(data) != m.content {
+			t.Errorf("moved file %s = %q, err = %v, want %q", wantPath, data, err, m.content)
+		}
+		if _, err := os.Stat(filepath.Join(base, "pics", m.oldName)); !os.IsNotExist(err) {
+			t.Errorf("old file %s still exists: %v", m.oldName, err)
+		}
+	}
+
+	// Media outside the base directory is left alone
+	if name, path := mediaFile(t, db, elsewhere); name != "3_c.png" || path != filepath.Join(outside, "3_c.png") {
+		t.Errorf("media outside base directory moved to %s", path)
+	}
+
+	// Running again finds nothing to do
+	if moved, err := db.MigrateToContentAddressable(base, false); err != nil || moved != 0 {
+		t.Errorf("second migration: moved = %d, err = %v, want 0", moved, err)
+	}
+}
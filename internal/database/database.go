@@ -2,118 +2,376 @@ package database
 
 import (
 	"crypto/sha256"
+	"database/sql"
+	"errors"
 	"fmt"
 	"io"
+	"net/url"
+	"os"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/neo1908/lemmy-image-scraper/internal/config"
 	"github.com/neo1908/lemmy-image-scraper/pkg/models"
+	log "github.com/sirupsen/logrus"
 )
 
+// ErrMediaNotFound is returned when no media record has the requested ID
+var ErrMediaNotFound = errors.New("media not found")
+
 // DB represents the database connection
 type DB struct {
 	*sqlx.DB
+
+	autoVacuumThreshold int64        // Rows deleted before VacuumAndAnalyze runs automatically, 0 for never
+	deletedRows         atomic.Int64 // Rows deleted by bulk deletes since the last vacuum
+	txLock              sync.RWMutex // Read-held by open transactions, so a vacuum waits for them to close
 }
 
-// New creates a new database connection and initializes the schema
-func New(dbPath string) (*DB, error) {
-	db, err := sqlx.Open("sqlite3", dbPath)
+// New creates a new database connection and brings the schema up to date.
+// With dryRun set the schema is left untouched, e.g. to list pending
+// migrations without applying them.
+func New(cfg *config.DatabaseConfig, dryRun bool) (*DB, error) {
+	database, err := open(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if dryRun {
+		return database, nil
+	}
+	if err := database.initSchema(); err != nil {
+		database.Close()
+		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+	}
+
+	return database, nil
+}
+
+// open creates a new database connection without touching the schema
+func open(cfg *config.DatabaseConfig) (*DB, error) {
+	driverName, dsn := "sqlite3", dataSourceName(cfg)
+	if cfg.Driver == "postgres" {
+		driverName, dsn = "postgres", cfg.DSN
+	}
+
+	db, err := sqlx.Open(driverName, dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
+	if cfg.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(cfg.MaxOpenConns)
+	}
 
 	if err := db.Ping(); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	database := &DB{db}
-	if err := database.initSchema(); err != nil {
-		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+	return &DB{DB: db, autoVacuumThreshold: int64(cfg.AutoVacuumThreshold)}, nil
+}
+
+// dataSourceName builds the SQLite DSN. Pragmas are passed as driver parameters
+// so they are applied to every connection in the pool, not just the first.
+func dataSourceName(cfg *config.DatabaseConfig) string {
+	params := url.Values{}
+	if cfg.JournalMode != "" {
+		params.Set("_journal_mode", cfg.JournalMode)
+	}
+	if cfg.Synchronous != "" {
+		params.Set("_synchronous", cfg.Synchronous)
+	}
+	if cfg.BusyTimeout > 0 {
+		params.Set("_busy_timeout", fmt.Sprintf("%d", time.Duration(cfg.BusyTimeout).Milliseconds()))
+	}
+	if len(params) == 0 {
+		return cfg.Path
 	}
 
-	return database, nil
+	separator := "?"
+	if strings.Contains(cfg.Path, "?") {
+		separator = "&"
+	}
+	return cfg.Path + separator + params.Encode()
 }
 
+// sqliteSchema creates the database tables if they don't exist and brings the
+// data of older databases up to date. postgresSchema rewrites it for PostgreSQL.
+// New tables go at the end, as the schema version counts them in order.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS scraped_media (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	post_id INTEGER NOT NULL,
+	post_title TEXT NOT NULL,
+	community_name TEXT NOT NULL,
+	community_id INTEGER NOT NULL,
+	author_name TEXT NOT NULL,
+	author_id INTEGER NOT NULL,
+	media_url TEXT NOT NULL,
+	media_hash TEXT NOT NULL UNIQUE,
+	file_name TEXT NOT NULL,
+	file_path TEXT NOT NULL,
+	file_size INTEGER NOT NULL,
+	media_type TEXT NOT NULL,
+	post_url TEXT NOT NULL,
+	post_score INTEGER NOT NULL,
+	post_created DATETIME NOT NULL,
+	downloaded_at DATETIME NOT NULL,
+	is_favorite BOOLEAN NOT NULL DEFAULT FALSE,
+	thumbnail_file TEXT NOT NULL DEFAULT '',
+	post_ap_id TEXT NOT NULL DEFAULT '',
+	animated BOOLEAN NOT NULL DEFAULT FALSE,
+	post_upvotes INTEGER NOT NULL DEFAULT 0,
+	post_downvotes INTEGER NOT NULL DEFAULT 0,
+	post_comments INTEGER NOT NULL DEFAULT 0,
+	mime_type TEXT NOT NULL DEFAULT '',
+	duration_seconds REAL NOT NULL DEFAULT 0,
+	download_ms INTEGER NOT NULL DEFAULT 0,
+	UNIQUE(post_id, media_url)
+);
+
+CREATE TABLE IF NOT EXISTS scraped_posts (
+	post_id INTEGER PRIMARY KEY,
+	post_title TEXT NOT NULL,
+	community_name TEXT NOT NULL,
+	community_id INTEGER NOT NULL,
+	author_name TEXT NOT NULL,
+	author_id INTEGER NOT NULL,
+	post_created DATETIME NOT NULL,
+	scraped_at DATETIME NOT NULL,
+	had_media BOOLEAN NOT NULL,
+	media_count INTEGER NOT NULL,
+	rescrape_count INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS scraped_comments (
+	comment_id INTEGER PRIMARY KEY,
+	post_id INTEGER NOT NULL,
+	creator_id INTEGER NOT NULL,
+	creator_name TEXT NOT NULL,
+	content TEXT NOT NULL,
+	path TEXT NOT NULL,
+	score INTEGER NOT NULL,
+	upvotes INTEGER NOT NULL,
+	downvotes INTEGER NOT NULL,
+	child_count INTEGER NOT NULL,
+	published DATETIME NOT NULL,
+	updated DATETIME,
+	removed BOOLEAN NOT NULL,
+	deleted BOOLEAN NOT NULL,
+	distinguished BOOLEAN NOT NULL,
+	scraped_at DATETIME NOT NULL,
+	FOREIGN KEY (post_id) REFERENCES scraped_posts(post_id)
+);
+
+CREATE TABLE IF NOT EXISTS media_posts (
+	media_id INTEGER NOT NULL,
+	post_id INTEGER NOT NULL,
+	post_title TEXT NOT NULL,
+	community_name TEXT NOT NULL,
+	community_id INTEGER NOT NULL,
+	author_name TEXT NOT NULL,
+	author_id INTEGER NOT NULL,
+	linked_at DATETIME NOT NULL,
+	PRIMARY KEY (media_id, post_id),
+	FOREIGN KEY (media_id) REFERENCES scraped_media(id)
+);
+
+CREATE TABLE IF NOT EXISTS scrape_runs (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	started_at DATETIME NOT NULL,
+	finished_at DATETIME,
+	status TEXT NOT NULL,
+	instance_version TEXT NOT NULL DEFAULT '',
+	error TEXT
+);
+
+CREATE TABLE IF NOT EXISTS post_score_history (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	post_id INTEGER NOT NULL,
+	score INTEGER NOT NULL,
+	sampled_at DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS communities (
+	name TEXT PRIMARY KEY,
+	community_id INTEGER NOT NULL,
+	title TEXT NOT NULL,
+	icon_url TEXT NOT NULL DEFAULT '',
+	banner_url TEXT NOT NULL DEFAULT '',
+	icon_path TEXT NOT NULL DEFAULT '',
+	banner_path TEXT NOT NULL DEFAULT '',
+	description TEXT NOT NULL DEFAULT '',
+	updated_at DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS post_crossposts (
+	post_id INTEGER NOT NULL,
+	crosspost_id INTEGER NOT NULL,
+	post_title TEXT NOT NULL,
+	community_name TEXT NOT NULL,
+	post_ap_id TEXT NOT NULL,
+	post_created DATETIME NOT NULL,
+	recorded_at DATETIME NOT NULL,
+	PRIMARY KEY (post_id, crosspost_id)
+);
+
+CREATE TABLE IF NOT EXISTS tags (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS media_tags (
+	media_id INTEGER NOT NULL,
+	tag_id INTEGER NOT NULL,
+	PRIMARY KEY (media_id, tag_id),
+	FOREIGN KEY (media_id) REFERENCES scraped_media(id),
+	FOREIGN KEY (tag_id) REFERENCES tags(id)
+);
+
+CREATE TABLE IF NOT EXISTS scrape_run_communities (
+	run_id INTEGER NOT NULL,
+	community TEXT NOT NULL,
+	finished_at DATETIME NOT NULL,
+	PRIMARY KEY (run_id, community),
+	FOREIGN KEY (run_id) REFERENCES scrape_runs(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_media_hash ON scraped_media(media_hash);
+CREATE INDEX IF NOT EXISTS idx_post_id ON scraped_media(post_id);
+CREATE INDEX IF NOT EXISTS idx_community_name ON scraped_media(community_name);
+CREATE INDEX IF NOT EXISTS idx_downloaded_at ON scraped_media(downloaded_at);
+CREATE INDEX IF NOT EXISTS idx_file_name ON scraped_media(file_name);
+CREATE INDEX IF NOT EXISTS idx_file_path ON scraped_media(file_path);
+CREATE INDEX IF NOT EXISTS idx_scraped_posts_community ON scraped_posts(community_name);
+CREATE INDEX IF NOT EXISTS idx_scraped_posts_scraped_at ON scraped_posts(scraped_at);
+CREATE INDEX IF NOT EXISTS idx_comments_post_id ON scraped_comments(post_id);
+CREATE INDEX IF NOT EXISTS idx_comments_path ON scraped_comments(path);
+CREATE INDEX IF NOT EXISTS idx_media_posts_post_id ON media_posts(post_id);
+CREATE INDEX IF NOT EXISTS idx_scrape_runs_started_at ON scrape_runs(started_at);
+CREATE INDEX IF NOT EXISTS idx_scrape_run_communities_community ON scrape_run_communities(community);
+CREATE INDEX IF NOT EXISTS idx_score_history_post ON post_score_history(post_id, sampled_at);
+CREATE INDEX IF NOT EXISTS idx_media_tags_tag_id ON media_tags(tag_id);
+`
+
+// mediaPostsBackfill links media recorded before media_posts existed to their
+// original post. It runs once, when the table is created.
+const mediaPostsBackfill = `
+INSERT INTO media_posts (
+	media_id, post_id, post_title, community_name, community_id,
+	author_name, author_id, linked_at
+)
+SELECT id, post_id, post_title, community_name, community_id,
+	author_name, author_id, downloaded_at
+FROM scraped_media WHERE true
+ON CONFLICT DO NOTHING
+`
+
 // initSchema creates the database tables if they don't exist
 func (db *DB) initSchema() error {
-	schema := `
-	CREATE TABLE IF NOT EXISTS scraped_media (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		post_id INTEGER NOT NULL,
-		post_title TEXT NOT NULL,
-		community_name TEXT NOT NULL,
-		community_id INTEGER NOT NULL,
-		author_name TEXT NOT NULL,
-		author_id INTEGER NOT NULL,
-		media_url TEXT NOT NULL,
-		media_hash TEXT NOT NULL UNIQUE,
-		file_name TEXT NOT NULL,
-		file_path TEXT NOT NULL,
-		file_size INTEGER NOT NULL,
-		media_type TEXT NOT NULL,
-		post_url TEXT NOT NULL,
-		post_score INTEGER NOT NULL,
-		post_created DATETIME NOT NULL,
-		downloaded_at DATETIME NOT NULL,
-		UNIQUE(post_id, media_url)
-	);
-
-	CREATE TABLE IF NOT EXISTS scraped_posts (
-		post_id INTEGER PRIMARY KEY,
-		post_title TEXT NOT NULL,
-		community_name TEXT NOT NULL,
-		community_id INTEGER NOT NULL,
-		author_name TEXT NOT NULL,
-		author_id INTEGER NOT NULL,
-		post_created DATETIME NOT NULL,
-		scraped_at DATETIME NOT NULL,
-		had_media BOOLEAN NOT NULL,
-		media_count INTEGER NOT NULL
-	);
-
-	CREATE TABLE IF NOT EXISTS scraped_comments (
-		comment_id INTEGER PRIMARY KEY,
-		post_id INTEGER NOT NULL,
-		creator_id INTEGER NOT NULL,
-		creator_name TEXT NOT NULL,
-		content TEXT NOT NULL,
-		path TEXT NOT NULL,
-		score INTEGER NOT NULL,
-		upvotes INTEGER NOT NULL,
-		downvotes INTEGER NOT NULL,
-		child_count INTEGER NOT NULL,
-		published DATETIME NOT NULL,
-		updated DATETIME,
-		removed BOOLEAN NOT NULL,
-		deleted BOOLEAN NOT NULL,
-		distinguished BOOLEAN NOT NULL,
-		scraped_at DATETIME NOT NULL,
-		FOREIGN KEY (post_id) REFERENCES scraped_posts(post_id)
-	);
-
-	CREATE INDEX IF NOT EXISTS idx_media_hash ON scraped_media(media_hash);
-	CREATE INDEX IF NOT EXISTS idx_post_id ON scraped_media(post_id);
-	CREATE INDEX IF NOT EXISTS idx_community_name ON scraped_media(community_name);
-	CREATE INDEX IF NOT EXISTS idx_downloaded_at ON scraped_media(downloaded_at);
-	CREATE INDEX IF NOT EXISTS idx_scraped_posts_community ON scraped_posts(community_name);
-	CREATE INDEX IF NOT EXISTS idx_scraped_posts_scraped_at ON scraped_posts(scraped_at);
-	CREATE INDEX IF NOT EXISTS idx_comments_post_id ON scraped_comments(post_id);
-	CREATE INDEX IF NOT EXISTS idx_comments_path ON scraped_comments(path);
-	`
+	schema := sqliteSchema
+	if db.isPostgres() {
+		schema = postgresSchema.Replace(schema)
+	}
+
+	hadMediaPosts, err := db.tableExists("media_posts")
+	if err != nil {
+		return err
+	}
 
 	if _, err := db.Exec(schema); err != nil {
 		return fmt.Errorf("failed to create schema: %w", err)
 	}
 
+	if !hadMediaPosts {
+		if _, err := db.Exec(mediaPostsBackfill); err != nil {
+			return fmt.Errorf("failed to link existing media to their posts: %w", err)
+		}
+	}
+
+	if err := db.addMissingColumns(); err != nil {
+		return err
+	}
+	return db.setSchemaVersion(LatestSchemaVersion)
+}
+
+// addedColumns lists columns introduced after their table was first released.
+// Databases created before then are given them on startup. New columns go at
+// the end, as the schema version counts them in order.
+var addedColumns = []struct {
+	table      string
+	column     string
+	definition string
+}{
+	{"scraped_media", "is_favorite", "BOOLEAN NOT NULL DEFAULT FALSE"},
+	{"scraped_media", "thumbnail_file", "TEXT NOT NULL DEFAULT ''"},
+	{"scraped_media", "post_ap_id", "TEXT NOT NULL DEFAULT ''"},
+	{"scraped_media", "animated", "BOOLEAN NOT NULL DEFAULT FALSE"},
+	{"scraped_media", "post_upvotes", "INTEGER NOT NULL DEFAULT 0"},
+	{"scraped_media", "post_downvotes", "INTEGER NOT NULL DEFAULT 0"},
+	{"scraped_media", "post_comments", "INTEGER NOT NULL DEFAULT 0"},
+	{"scraped_media", "mime_type", "TEXT NOT NULL DEFAULT ''"},
+	{"scraped_media", "duration_seconds", "REAL NOT NULL DEFAULT 0"},
+	{"scraped_media", "download_ms", "INTEGER NOT NULL DEFAULT 0"},
+	{"scraped_posts", "rescrape_count", "INTEGER NOT NULL DEFAULT 0"},
+	{"communities", "description", "TEXT NOT NULL DEFAULT ''"},
+}
+
+// addMissingColumns adds any column from addedColumns that the database doesn't have yet
+func (db *DB) addMissingColumns() error {
+	for _, c := range addedColumns {
+		exists, err := db.columnExists(c.table, c.column)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+
+		query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", c.table, c.column, c.definition)
+		if _, err := db.Exec(query); err != nil {
+			return fmt.Errorf("failed to add column %s.%s: %w", c.table, c.column, err)
+		}
+		log.Infof("Added column %s.%s to the database", c.table, c.column)
+	}
 	return nil
 }
 
+// columnExists reports whether a table has the given column
+func (db *DB) columnExists(table, column string) (bool, error) {
+	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s LIMIT 0", table))
+	if err != nil {
+		return false, fmt.Errorf("failed to read columns of %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return false, fmt.Errorf("failed to read columns of %s: %w", table, err)
+	}
+	for _, c := range columns {
+		if c == column {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 // MediaExists checks if media with the given hash already exists
 func (db *DB) MediaExists(hash string) (bool, error) {
+	return mediaExists(db.DB, hash)
+}
+
+// mediaExists implements MediaExists for both DB and Tx
+func mediaExists(q sqlx.Ext, hash string) (bool, error) {
 	var exists bool
 	query := `SELECT EXISTS(SELECT 1 FROM scraped_media WHERE media_hash = ?)`
-	err := db.Get(&exists, query, hash)
+	err := sqlx.Get(q, &exists, q.Rebind(query), hash)
 	if err != nil {
 		return false, fmt.Errorf("failed to check media existence: %w", err)
 	}
@@ -122,9 +380,14 @@ func (db *DB) MediaExists(hash string) (bool, error) {
 
 // PostExists checks if a post has already been scraped
 func (db *DB) PostExists(postID int64) (bool, error) {
+	return postExists(db.DB, postID)
+}
+
+// postExists implements PostExists for both DB and Tx
+func postExists(q sqlx.Ext, postID int64) (bool, error) {
 	var exists bool
 	query := `SELECT EXISTS(SELECT 1 FROM scraped_posts WHERE post_id = ?)`
-	err := db.Get(&exists, query, postID)
+	err := sqlx.Get(q, &exists, q.Rebind(query), postID)
 	if err != nil {
 		return false, fmt.Errorf("failed to check post existence: %w", err)
 	}
@@ -133,15 +396,31 @@ func (db *DB) PostExists(postID int64) (bool, error) {
 
 // MarkPostAsScraped records that we've processed a post (with or without media)
 func (db *DB) MarkPostAsScraped(postView *models.PostView, mediaCount int) error {
+	return markPostAsScraped(db.DB, postView, mediaCount)
+}
+
+// markPostAsScraped implements MarkPostAsScraped for both DB and Tx
+func markPostAsScraped(q sqlx.Ext, postView *models.PostView, mediaCount int) error {
 	query := `
-		INSERT OR REPLACE INTO scraped_posts (
+		INSERT INTO scraped_posts (
 			post_id, post_title, community_name, community_id,
 			author_name, author_id, post_created, scraped_at,
 			had_media, media_count
-		) VALUES (?, ?, ?, ?, ?, ?, ?, datetime('now'), ?, ?)
+		) VALUES (?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, ?, ?)
+		ON CONFLICT(post_id) DO UPDATE SET
+			post_title = excluded.post_title,
+			community_name = excluded.community_name,
+			community_id = excluded.community_id,
+			author_name = excluded.author_name,
+			author_id = excluded.author_id,
+			post_created = excluded.post_created,
+			scraped_at = excluded.scraped_at,
+			had_media = excluded.had_media,
+			media_count = excluded.media_count,
+			rescrape_count = scraped_posts.rescrape_count + 1
 	`
 
-	_, err := db.Exec(query,
+	_, err := q.Exec(q.Rebind(query),
 		postView.Post.ID,
 		postView.Post.Name,
 		postView.Community.Name,
@@ -156,45 +435,321 @@ func (db *DB) MarkPostAsScraped(postView *models.PostView, mediaCount int) error
 		return fmt.Errorf("failed to mark post as scraped: %w", err)
 	}
 
+	// Keep the engagement counts of media archived from this post current
+	update := `
+		UPDATE scraped_media
+		SET post_score = ?, post_upvotes = ?, post_downvotes = ?, post_comments = ?
+		WHERE post_id = ?
+	`
+	counts := postView.Counts
+	if _, err := q.Exec(q.Rebind(update), counts.Score, counts.Upvotes, counts.Downvotes, counts.Comments, postView.Post.ID); err != nil {
+		return fmt.Errorf("failed to update post counts: %w", err)
+	}
+
 	return nil
 }
 
+// StartScrapeRun records the start of a scrape run and returns its ID
+func (db *DB) StartScrapeRun(instanceVersion string) (int64, error) {
+	query := `
+		INSERT INTO scrape_runs (started_at, status, instance_version)
+		VALUES (CURRENT_TIMESTAMP, 'running', ?)
+		RETURNING id
+	`
+
+	var id int64
+	if err := db.Get(&id, query, instanceVersion); err != nil {
+		return 0, fmt.Errorf("failed to record scrape run: %w", err)
+	}
+	return id, nil
+}
+
+// FinishScrapeRun marks a scrape run as finished, recording the error if it failed
+func (db *DB) FinishScrapeRun(id int64, runErr error) error {
+	status := "success"
+	var errMsg interface{}
+	if runErr != nil {
+		status = "failed"
+		errMsg = runErr.Error()
+	}
+
+	query := `
+		UPDATE scrape_runs
+		SET finished_at = CURRENT_TIMESTAMP, status = ?, error = ?
+		WHERE id = ?
+	`
+	if _, err := db.Exec(query, status, errMsg, id); err != nil {
+		return fmt.Errorf("failed to finish scrape run: %w", err)
+	}
+	return nil
+}
+
+// RecordCommunityScraped records that a scrape run finished scraping a
+// community. An empty name stands for the hot page.
+func (db *DB) RecordCommunityScraped(runID int64, community string) error {
+	query := `
+		INSERT INTO scrape_run_communities (run_id, community, finished_at)
+		VALUES (?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT DO NOTHING
+	`
+	if _, err := db.Exec(query, runID, community); err != nil {
+		return fmt.Errorf("failed to record scraped community: %w", err)
+	}
+	return nil
+}
+
+// GetLastCommunityScrapeTime returns when the most recent scrape run that
+// finished scraping community started, or the zero time if none has. Runs in
+// continuous mode often cover only some communities, so unlike
+// GetLastSuccessfulRunTime this is safe to use as a community's cutoff.
+func (db *DB) GetLastCommunityScrapeTime(community string) (time.Time, error) {
+	var startedAt time.Time
+	query := `
+		SELECT r.started_at
+		FROM scrape_runs r
+		JOIN scrape_run_communities c ON c.run_id = r.id
+		WHERE c.community = ?
+		ORDER BY r.started_at DESC
+		LIMIT 1
+	`
+	err := db.Get(&startedAt, query, community)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return time.Time{}, nil
+		}
+		return time.Time{}, fmt.Errorf("failed to get last scrape of community: %w", err)
+	}
+	return startedAt, nil
+}
+
+// GetLastSuccessfulRunTime returns when the most recent successful scrape run started,
+// or the zero time if no run has succeeded yet
+func (db *DB) GetLastSuccessfulRunTime() (time.Time, error) {
+	var startedAt time.Time
+	query := `SELECT started_at FROM scrape_runs WHERE status = 'success' ORDER BY started_at DESC LIMIT 1`
+	err := db.Get(&startedAt, query)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return time.Time{}, nil
+		}
+		return time.Time{}, fmt.Errorf("failed to get last successful run: %w", err)
+	}
+	return startedAt, nil
+}
+
 // SaveMedia saves a scraped media record to the database
 func (db *DB) SaveMedia(media *models.ScrapedMedia) error {
+	return saveMedia(db.DB, media)
+}
+
+// saveMedia implements SaveMedia for both DB and Tx
+func saveMedia(q sqlx.Ext, media *models.ScrapedMedia) error {
 	query := `
 		INSERT INTO scraped_media (
 			post_id, post_title, community_name, community_id,
 			author_name, author_id, media_url, media_hash,
 			file_name, file_path, file_size, media_type,
-			post_url, post_score, post_created, downloaded_at
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			post_url, post_score, post_created, downloaded_at,
+			thumbnail_file, post_ap_id, animated,
+			post_upvotes, post_downvotes, post_comments, mime_type,
+			duration_seconds, download_ms
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
 	`
 
-	result, err := db.Exec(query,
+	// SQLite compares timestamps as text, so store them in UTC like the date filters
+	var id int64
+	err := sqlx.Get(q, &id, q.Rebind(query),
 		media.PostID, media.PostTitle, media.CommunityName, media.CommunityID,
 		media.AuthorName, media.AuthorID, media.MediaURL, media.MediaHash,
 		media.FileName, media.FilePath, media.FileSize, media.MediaType,
-		media.PostURL, media.PostScore, media.PostCreated, media.DownloadedAt,
+		media.PostURL, media.PostScore, media.PostCreated.UTC(), media.DownloadedAt.UTC(),
+		media.ThumbnailFile, media.PostApID, media.Animated,
+		media.PostUpvotes, media.PostDownvotes, media.PostComments, media.MIMEType,
+		media.DurationSeconds, media.DownloadMS,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to save media: %w", err)
 	}
 
-	id, err := result.LastInsertId()
+	media.ID = id
+
+	// Record the originating post in the association table
+	link := `
+		INSERT INTO media_posts (
+			media_id, post_id, post_title, community_name, community_id,
+			author_name, author_id, linked_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT DO NOTHING
+	`
+	if _, err := q.Exec(q.Rebind(link),
+		media.ID, media.PostID, media.PostTitle, media.CommunityName,
+		media.CommunityID, media.AuthorName, media.AuthorID,
+	); err != nil {
+		return fmt.Errorf("failed to link media to post: %w", err)
+	}
+
+	return nil
+}
+
+// LinkMediaToPost associates an existing media record with another post (e.g. a crosspost)
+func (db *DB) LinkMediaToPost(mediaID int64, postView *models.PostView) error {
+	return linkMediaToPost(db.DB, mediaID, postView)
+}
+
+// linkMediaToPost implements LinkMediaToPost for both DB and Tx
+func linkMediaToPost(q sqlx.Ext, mediaID int64, postView *models.PostView) error {
+	query := `
+		INSERT INTO media_posts (
+			media_id, post_id, post_title, community_name, community_id,
+			author_name, author_id, linked_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT DO NOTHING
+	`
+
+	_, err := q.Exec(q.Rebind(query),
+		mediaID,
+		postView.Post.ID,
+		postView.Post.Name,
+		postView.Community.Name,
+		postView.Community.ID,
+		postView.Creator.Name,
+		postView.Creator.ID,
+	)
 	if err != nil {
-		return fmt.Errorf("failed to get last insert id: %w", err)
+		return fmt.Errorf("failed to link media to post: %w", err)
 	}
 
-	media.ID = id
 	return nil
 }
 
+// MediaPost represents a post a media file has been seen in
+type MediaPost struct {
+	MediaID       int64  `db:"media_id"`
+	PostID        int64  `db:"post_id"`
+	PostTitle     string `db:"post_title"`
+	CommunityName string `db:"community_name"`
+	CommunityID   int64  `db:"community_id"`
+	AuthorName    string `db:"author_name"`
+	AuthorID      int64  `db:"author_id"`
+	LinkedAt      string `db:"linked_at"`
+}
+
+// GetPostsForMedia retrieves every post a media file has been linked to, oldest first
+func (db *DB) GetPostsForMedia(mediaID int64) ([]MediaPost, error) {
+	query := `
+		SELECT media_id, post_id, post_title, community_name, community_id,
+			author_name, author_id, linked_at
+		FROM media_posts
+		WHERE media_id = ?
+		ORDER BY linked_at ASC, post_id ASC
+	`
+
+	var posts []MediaPost
+	if err := db.Select(&posts, query, mediaID); err != nil {
+		return nil, fmt.Errorf("failed to query media posts: %w", err)
+	}
+	return posts, nil
+}
+
+// Crosspost is another post of the same link as an archived post
+type Crosspost struct {
+	PostID        int64     `db:"post_id"`
+	CrosspostID   int64     `db:"crosspost_id"`
+	PostTitle     string    `db:"post_title"`
+	CommunityName string    `db:"community_name"`
+	PostApID      string    `db:"post_ap_id"` // ActivityPub ID of the crosspost on its home instance
+	PostCreated   time.Time `db:"post_created"`
+}
+
+// SaveCrossposts records the crossposts of a post
+func (db *DB) SaveCrossposts(postID int64, crossposts []models.PostView) error {
+	return saveCrossposts(db.DB, postID, crossposts)
+}
+
+func saveCrossposts(q sqlx.Ext, postID int64, crossposts []models.PostView) error {
+	query := `
+		INSERT INTO post_crossposts (
+			post_id, crosspost_id, post_title, community_name, post_ap_id,
+			post_created, recorded_at
+		) VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(post_id, crosspost_id) DO UPDATE SET
+			post_title = excluded.post_title,
+			community_name = excluded.community_name,
+			post_ap_id = excluded.post_ap_id
+	`
+
+	for _, crosspost := range crossposts {
+		if crosspost.Post.ID == postID {
+			continue
+		}
+		_, err := q.Exec(q.Rebind(query),
+			postID,
+			crosspost.Post.ID,
+			crosspost.Post.Name,
+			crosspost.Community.Name,
+			crosspost.Post.ApID,
+			crosspost.Post.Published,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to save crosspost: %w", err)
+		}
+	}
+	return nil
+}
+
+// GetCrossposts retrieves the recorded crossposts of a post, oldest first
+func (db *DB) GetCrossposts(postID int64) ([]Crosspost, error) {
+	query := `
+		SELECT post_id, crosspost_id, post_title, community_name, post_ap_id, post_created
+		FROM post_crossposts
+		WHERE post_id = ?
+		ORDER BY post_created ASC, crosspost_id ASC
+	`
+
+	var crossposts []Crosspost
+	if err := db.Select(&crossposts, query, postID); err != nil {
+		return nil, fmt.Errorf("failed to query crossposts: %w", err)
+	}
+	return crossposts, nil
+}
+
 // GetMediaByHash retrieves a media record by its hash
 func (db *DB) GetMediaByHash(hash string) (*models.ScrapedMedia, error) {
+	return getMediaByHash(db.DB, hash)
+}
+
+// hashPrefixMatchLimit caps how many media GetMediaByHashPrefix returns
+const hashPrefixMatchLimit = 100
+
+// NextUploadPostID returns the post ID for the next manually uploaded file.
+// Uploads count down from -1, so they never clash with Lemmy's post IDs.
+func (db *DB) NextUploadPostID() (int64, error) {
+	var postID int64
+	query := `SELECT COALESCE(MIN(post_id), 0) - 1 FROM scraped_media WHERE post_id < 0`
+	if err := db.Get(&postID, query); err != nil {
+		return 0, fmt.Errorf("failed to get next upload post ID: %w", err)
+	}
+	return postID, nil
+}
+
+// GetMediaByHashPrefix returns media whose hash starts with prefix, e.g. to look up
+// a file from a truncated hash in the logs. The prefix must already be validated as hex.
+func (db *DB) GetMediaByHashPrefix(prefix string) ([]models.ScrapedMedia, error) {
+	var media []models.ScrapedMedia
+	query := `SELECT * FROM scraped_media WHERE media_hash LIKE ? ORDER BY id LIMIT ?`
+	if err := db.Select(&media, query, prefix+"%", hashPrefixMatchLimit); err != nil {
+		return nil, fmt.Errorf("failed to get media by hash prefix: %w", err)
+	}
+	return media, nil
+}
+
+// getMediaByHash implements GetMediaByHash for both DB and Tx
+func getMediaByHash(q sqlx.Ext, hash string) (*models.ScrapedMedia, error) {
 	media := &models.ScrapedMedia{}
 	query := `SELECT * FROM scraped_media WHERE media_hash = ?`
 
-	err := db.Get(media, query, hash)
+	err := sqlx.Get(q, media, q.Rebind(query), hash)
 	if err != nil {
 		// sqlx returns sql.ErrNoRows for Get() when no rows found
 		if err.Error() == "sql: no rows in result set" {
@@ -214,7 +769,7 @@ func (db *DB) GetMediaByID(id int64) (*models.ScrapedMedia, error) {
 	err := db.Get(media, query, id)
 	if err != nil {
 		if err.Error() == "sql: no rows in result set" {
-			return nil, fmt.Errorf("media not found")
+			return nil, ErrMediaNotFound
 		}
 		return nil, fmt.Errorf("failed to get media by ID: %w", err)
 	}
@@ -222,6 +777,205 @@ func (db *DB) GetMediaByID(id int64) (*models.ScrapedMedia, error) {
 	return media, nil
 }
 
+// ForEachMedia calls fn for every media record in ID order. Records are loaded in
+// batches so fn may write to the database without holding a read cursor open.
+func (db *DB) ForEachMedia(fn func(media *models.ScrapedMedia) error) error {
+	const batchSize = 500
+	var lastID int64
+
+	for {
+		var batch []models.ScrapedMedia
+		query := `SELECT * FROM scraped_media WHERE id > ? ORDER BY id ASC LIMIT ?`
+		if err := db.Select(&batch, query, lastID, batchSize); err != nil {
+			return fmt.Errorf("failed to query media: %w", err)
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+
+		for i := range batch {
+			if err := fn(&batch[i]); err != nil {
+				return err
+			}
+		}
+		lastID = batch[len(batch)-1].ID
+	}
+}
+
+// UpdateMediaType changes the stored media type of a media record
+func (db *DB) UpdateMediaType(id int64, mediaType string) error {
+	_, err := db.Exec(`UPDATE scraped_media SET media_type = ? WHERE id = ?`, mediaType, id)
+	if err != nil {
+		return fmt.Errorf("failed to update media type: %w", err)
+	}
+	return nil
+}
+
+// SetAnimated records whether a media item is an animated image
+func (db *DB) SetAnimated(id int64, animated bool) error {
+	_, err := db.Exec(`UPDATE scraped_media SET animated = ? WHERE id = ?`, animated, id)
+	if err != nil {
+		return fmt.Errorf("failed to update animated flag: %w", err)
+	}
+	return nil
+}
+
+// SetMIMEType records the MIME type of a media item
+func (db *DB) SetMIMEType(id int64, mimeType string) error {
+	_, err := db.Exec(`UPDATE scraped_media SET mime_type = ? WHERE id = ?`, mimeType, id)
+	if err != nil {
+		return fmt.Errorf("failed to update MIME type: %w", err)
+	}
+	return nil
+}
+
+// GetMIMETypeByFileName returns the stored MIME type of the media file with the
+// given name, or "" if it isn't known. File names start with the post ID or are
+// the content hash, so they identify a file without its community directory.
+func (db *DB) GetMIMETypeByFileName(fileName string) (string, error) {
+	var mimeType string
+	query := `SELECT mime_type FROM scraped_media WHERE file_name = ? AND mime_type != '' LIMIT 1`
+	if err := db.Get(&mimeType, query, fileName); err != nil {
+		if err.Error() == "sql: no rows in result set" {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to get MIME type: %w", err)
+	}
+	return mimeType, nil
+}
+
+// GetMIMETypeByFilePath returns the stored MIME type of the media file recorded
+// at the given location, or "" if it isn't known
+func (db *DB) GetMIMETypeByFilePath(filePath string) (string, error) {
+	var mimeType string
+	query := `SELECT mime_type FROM scraped_media WHERE file_path = ? AND mime_type != '' LIMIT 1`
+	if err := db.Get(&mimeType, query, filePath); err != nil {
+		if err.Error() == "sql: no rows in result set" {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to get MIME type: %w", err)
+	}
+	return mimeType, nil
+}
+
+// SetFavorite marks or unmarks a media item as a favorite
+func (db *DB) SetFavorite(id int64, favorite bool) error {
+	result, err := db.Exec(`UPDATE scraped_media SET is_favorite = ? WHERE id = ?`, favorite, id)
+	if err != nil {
+		return fmt.Errorf("failed to update favorite: %w", err)
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update favorite: %w", err)
+	}
+	if updated == 0 {
+		return ErrMediaNotFound
+	}
+	return nil
+}
+
+// FixLegacyPostURLs points post_url at the post on instance for media saved when
+// post_url held a copy of the media URL, and returns how many records were fixed
+func (db *DB) FixLegacyPostURLs(instance string) (int64, error) {
+	result, err := db.Exec(`
+		UPDATE scraped_media
+		SET post_url = 'https://' || CAST(? AS TEXT) || '/post/' || CAST(post_id AS TEXT)
+		WHERE post_url = media_url
+	`, instance)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fix post URLs: %w", err)
+	}
+
+	fixed, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count fixed post URLs: %w", err)
+	}
+	return fixed, nil
+}
+
+// RepairFilePaths moves the file_path of media stored under the directory
+// oldBase to the same place under newBase, e.g. after the storage directory was
+// moved, and returns how many records were updated. Only the leading directory
+// is replaced, so "/data/media" doesn't match "/data/media2".
+func (db *DB) RepairFilePaths(oldBase, newBase string) (int64, error) {
+	oldBase = strings.TrimRight(oldBase, "/")
+	newBase = strings.TrimRight(newBase, "/")
+	if oldBase == "" || newBase == "" {
+		return 0, fmt.Errorf("old and new base directories must not be empty")
+	}
+
+	pattern := likeEscaper.Replace(oldBase) + "/%"
+	var repaired int64
+	err := db.WithTx(func(tx *Tx) error {
+		var rows []struct {
+			ID       int64  `db:"id"`
+			FilePath string `db:"file_path"`
+		}
+		query := `SELECT id, file_path FROM scraped_media WHERE file_path LIKE ? ESCAPE '\'`
+		if err := tx.Select(&rows, tx.Rebind(query), pattern); err != nil {
+			return fmt.Errorf("failed to find file paths to repair: %w", err)
+		}
+		for _, row := range rows {
+			log.Debugf("Repairing path of media %d: %s -> %s", row.ID, row.FilePath, newBase+row.FilePath[len(oldBase):])
+		}
+
+		result, err := tx.Exec(tx.Rebind(`
+			UPDATE scraped_media
+			SET file_path = CAST(? AS TEXT) || SUBSTR(file_path, ?)
+			WHERE file_path LIKE ? ESCAPE '\'
+		`), newBase, len(oldBase)+1, pattern)
+		if err != nil {
+			return fmt.Errorf("failed to repair file paths: %w", err)
+		}
+		if repaired, err = result.RowsAffected(); err != nil {
+			return fmt.Errorf("failed to count repaired file paths: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	log.Infof("Repaired the file path of %d media records from %s to %s", repaired, oldBase, newBase)
+	return repaired, nil
+}
+
+// integrityCheckWorkers bounds how many files GetMediaIntegrityStats checks at once
+const integrityCheckWorkers = 16
+
+// GetMediaIntegrityStats checks that the file recorded for each media item exists on
+// disk and returns how many records there are, how many files were found and how many
+// are missing. Only meaningful for local storage, where file_path is a filesystem path.
+func (db *DB) GetMediaIntegrityStats() (total int, onDisk int, missing int, err error) {
+	var paths []string
+	if err := db.Select(&paths, `SELECT file_path FROM scraped_media`); err != nil {
+		return 0, 0, 0, fmt.Errorf("failed to get file paths: %w", err)
+	}
+
+	var found atomic.Int64
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, integrityCheckWorkers)
+	for _, p := range paths {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(p string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if _, err := os.Stat(p); err == nil {
+				found.Add(1)
+			}
+		}(p)
+	}
+	wg.Wait()
+
+	total = len(paths)
+	onDisk = int(found.Load())
+	return total, onDisk, total - onDisk, nil
+}
+
 // GetStats returns statistics about scraped media
 func (db *DB) GetStats() (map[string]interface{}, error) {
 	stats := make(map[string]interface{})
@@ -234,6 +988,14 @@ func (db *DB) GetStats() (map[string]interface{}, error) {
 	}
 	stats["total_media"] = totalCount
 
+	// Total size of every file ever downloaded
+	var totalSize int64
+	err = db.Get(&totalSize, `SELECT COALESCE(SUM(file_size), 0) FROM scraped_media`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get total size: %w", err)
+	}
+	stats["total_size"] = totalSize
+
 	// Count by media type
 	type TypeCount struct {
 		MediaType string `db:"media_type"`
@@ -268,9 +1030,480 @@ func (db *DB) GetStats() (map[string]interface{}, error) {
 	}
 	stats["top_communities"] = communityMap
 
+	hostSpeeds, err := db.GetHostSpeeds(10)
+	if err != nil {
+		return nil, err
+	}
+	stats["slowest_hosts"] = hostSpeeds
+
+	return stats, nil
+}
+
+// HostSpeed is the average download speed of the media from one host
+type HostSpeed struct {
+	Host           string `json:"host"`
+	Downloads      int    `json:"downloads"`
+	Bytes          int64  `json:"bytes"`
+	DownloadMS     int64  `json:"download_ms"`      // Total time spent downloading
+	BytesPerSecond int64  `json:"bytes_per_second"` // Average speed
+}
+
+// GetHostSpeeds returns the average download speed of each media host, slowest
+// first, for media whose download time was recorded. A limit of 0 returns every
+// host. Sizes are of the stored files, so GIFs converted to MP4 count as smaller.
+func (db *DB) GetHostSpeeds(limit int) ([]HostSpeed, error) {
+	var rows []struct {
+		MediaURL   string `db:"media_url"`
+		FileSize   int64  `db:"file_size"`
+		DownloadMS int64  `db:"download_ms"`
+	}
+	if err := db.Select(&rows, `SELECT media_url, file_size, download_ms FROM scraped_media WHERE download_ms > 0`); err != nil {
+		return nil, fmt.Errorf("failed to get download times: %w", err)
+	}
+
+	// URLs are grouped by host here, as SQLite has no function to extract it
+	byHost := make(map[string]*HostSpeed)
+	for _, row := range rows {
+		u, err := url.Parse(row.MediaURL)
+		if err != nil || u.Hostname() == "" {
+			continue
+		}
+		host := strings.ToLower(u.Hostname())
+		speed, ok := byHost[host]
+		if !ok {
+			speed = &HostSpeed{Host: host}
+			byHost[host] = speed
+		}
+		speed.Downloads++
+		speed.Bytes += row.FileSize
+		speed.DownloadMS += row.DownloadMS
+	}
+
+	speeds := make([]HostSpeed, 0, len(byHost))
+	for _, speed := range byHost {
+		speed.BytesPerSecond = speed.Bytes * 1000 / speed.DownloadMS
+		speeds = append(speeds, *speed)
+	}
+	sort.Slice(speeds, func(i, j int) bool {
+		if speeds[i].BytesPerSecond != speeds[j].BytesPerSecond {
+			return speeds[i].BytesPerSecond < speeds[j].BytesPerSecond
+		}
+		return speeds[i].Host < speeds[j].Host
+	})
+	if limit > 0 && len(speeds) > limit {
+		speeds = speeds[:limit]
+	}
+	return speeds, nil
+}
+
+// CommunityCount is a community with the number of media items archived from it
+type CommunityCount struct {
+	Name  string `db:"community_name"`
+	Count int    `db:"count"`
+}
+
+// likeEscaper escapes LIKE wildcards so user input only matches literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// GetCommunityCounts returns communities with archived media, most media first,
+// and how many there are in total. search keeps communities whose name contains
+// it (case-insensitive); a limit of 0 returns all of them.
+func (db *DB) GetCommunityCounts(search string, limit, offset int) ([]CommunityCount, int, error) {
+	where := ""
+	var args []interface{}
+	if search != "" {
+		where = `WHERE LOWER(community_name) LIKE LOWER(?) ESCAPE '\'`
+		args = append(args, "%"+likeEscaper.Replace(search)+"%")
+	}
+
+	var total int
+	countQuery := `SELECT COUNT(DISTINCT community_name) FROM scraped_media ` + where
+	if err := db.Get(&total, countQuery, args...); err != nil {
+		return nil, 0, fmt.Errorf("failed to count communities: %w", err)
+	}
+
+	query := `
+		SELECT community_name, COUNT(*) as count
+		FROM scraped_media
+		` + where + `
+		GROUP BY community_name
+		ORDER BY count DESC, community_name
+	`
+	if limit > 0 {
+		query += ` LIMIT ? OFFSET ?`
+		args = append(args, limit, offset)
+	}
+
+	communities := []CommunityCount{}
+	if err := db.Select(&communities, query, args...); err != nil {
+		return nil, 0, fmt.Errorf("failed to get communities: %w", err)
+	}
+	return communities, total, nil
+}
+
+// AuthorCount is a post author with the number of media items archived from their posts
+type AuthorCount struct {
+	Name  string `db:"author_name"`
+	Count int    `db:"count"`
+}
+
+// GetAuthorCounts returns authors of posts with archived media, most media first,
+// and how many there are in total. search keeps authors whose name contains it
+// (case-insensitive); a limit of 0 returns all of them.
+func (db *DB) GetAuthorCounts(search string, limit, offset int) ([]AuthorCount, int, error) {
+	where := ""
+	var args []interface{}
+	if search != "" {
+		where = `WHERE LOWER(author_name) LIKE LOWER(?) ESCAPE '\'`
+		args = append(args, "%"+likeEscaper.Replace(search)+"%")
+	}
+
+	var total int
+	countQuery := `SELECT COUNT(DISTINCT author_name) FROM scraped_media ` + where
+	if err := db.Get(&total, countQuery, args...); err != nil {
+		return nil, 0, fmt.Errorf("failed to count authors: %w", err)
+	}
+
+	query := `
+		SELECT author_name, COUNT(*) as count
+		FROM scraped_media
+		` + where + `
+		GROUP BY author_name
+		ORDER BY count DESC, author_name
+	`
+	if limit > 0 {
+		query += ` LIMIT ? OFFSET ?`
+		args = append(args, limit, offset)
+	}
+
+	authors := []AuthorCount{}
+	if err := db.Select(&authors, query, args...); err != nil {
+		return nil, 0, fmt.Errorf("failed to get authors: %w", err)
+	}
+	return authors, total, nil
+}
+
+// AuthorProfile summarises what the archive holds from one author
+type AuthorProfile struct {
+	Name                string
+	MediaCount          int       // Media archived from their posts
+	CommentCount        int       // Stored comments they wrote
+	MostActiveCommunity string    // Community with the most of their scraped posts and comments ("" if none)
+	FirstSeen           time.Time // Publication time of their earliest scraped post or comment (zero if none)
+}
+
+// GetAuthorProfile returns the profile of the author with the given name. An
+// author with nothing archived gets a profile with zero counts.
+func (db *DB) GetAuthorProfile(name string) (AuthorProfile, error) {
+	profile := AuthorProfile{Name: name}
+
+	err := db.Get(&profile.MediaCount, `SELECT COUNT(*) FROM scraped_media WHERE author_name = ?`, name)
+	if err != nil {
+		return profile, fmt.Errorf("failed to count author media: %w", err)
+	}
+	err = db.Get(&profile.CommentCount, `SELECT COUNT(*) FROM scraped_comments WHERE creator_name = ?`, name)
+	if err != nil {
+		return profile, fmt.Errorf("failed to count author comments: %w", err)
+	}
+
+	// Comments only know their post, which knows the community
+	err = db.Get(&profile.MostActiveCommunity, `
+		SELECT community_name FROM (
+			SELECT p.community_name FROM scraped_comments c
+			JOIN scraped_posts p ON p.post_id = c.post_id
+			WHERE c.creator_name = ?
+			UNION ALL
+			SELECT community_name FROM scraped_posts WHERE author_name = ?
+		) activity
+		GROUP BY community_name
+		ORDER BY COUNT(*) DESC, community_name
+		LIMIT 1
+	`, name, name)
+	if err != nil && err != sql.ErrNoRows {
+		return profile, fmt.Errorf("failed to get most active community: %w", err)
+	}
+
+	// Selected per table rather than with MIN(), which SQLite returns as text
+	for _, query := range []string{
+		`SELECT post_created FROM scraped_posts WHERE author_name = ? ORDER BY post_created LIMIT 1`,
+		`SELECT published FROM scraped_comments WHERE creator_name = ? ORDER BY published LIMIT 1`,
+	} {
+		var first time.Time
+		err := db.Get(&first, query, name)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return profile, fmt.Errorf("failed to get author first seen: %w", err)
+		}
+		if profile.FirstSeen.IsZero() || first.Before(profile.FirstSeen) {
+			profile.FirstSeen = first
+		}
+	}
+
+	return profile, nil
+}
+
+// CommunityStats summarises the media archived for a single community
+type CommunityStats struct {
+	Name        string
+	TotalMedia  int
+	TotalSize   int64
+	ByType      map[string]int
+	TopPosts    []models.ScrapedMedia // First media item of the highest scoring posts
+	RecentMedia []models.ScrapedMedia // Most recently downloaded media
+}
+
+// Community is the stored metadata of a scraped community. IconPath and
+// BannerPath are storage keys of the downloaded images, empty until downloaded.
+type Community struct {
+	Name        string    `db:"name"`
+	CommunityID int64     `db:"community_id"`
+	Title       string    `db:"title"`
+	IconURL     string    `db:"icon_url"`
+	BannerURL   string    `db:"banner_url"`
+	IconPath    string    `db:"icon_path"`
+	BannerPath  string    `db:"banner_path"`
+	Description string    `db:"description"` // Sidebar Markdown
+	UpdatedAt   time.Time `db:"updated_at"`
+}
+
+// UpsertCommunity records a community's current metadata. When its icon or
+// banner URL changes, the stored path is cleared so the new image is downloaded.
+func (db *DB) UpsertCommunity(community *models.Community) error {
+	query := `
+		INSERT INTO communities (name, community_id, title, icon_url, banner_url, description, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET
+			community_id = excluded.community_id,
+			title = excluded.title,
+			description = excluded.description,
+			icon_path = CASE WHEN communities.icon_url = excluded.icon_url
+				THEN communities.icon_path ELSE '' END,
+			banner_path = CASE WHEN communities.banner_url = excluded.banner_url
+				THEN communities.banner_path ELSE '' END,
+			icon_url = excluded.icon_url,
+			banner_url = excluded.banner_url,
+			updated_at = excluded.updated_at
+	`
+	_, err := db.Exec(query, community.Name, community.ID, community.Title,
+		community.Icon, community.Banner, community.Description, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to save community: %w", err)
+	}
+	return nil
+}
+
+// GetCommunity returns the stored metadata of a community, or nil if it hasn't been recorded
+func (db *DB) GetCommunity(name string) (*Community, error) {
+	community := &Community{}
+	if err := db.Get(community, `SELECT * FROM communities WHERE name = ?`, name); err != nil {
+		if err.Error() == "sql: no rows in result set" {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get community: %w", err)
+	}
+	return community, nil
+}
+
+// SetCommunityAssetPaths records where a community's icon and banner were stored
+func (db *DB) SetCommunityAssetPaths(name, iconPath, bannerPath string) error {
+	query := `UPDATE communities SET icon_path = ?, banner_path = ? WHERE name = ?`
+	if _, err := db.Exec(query, iconPath, bannerPath, name); err != nil {
+		return fmt.Errorf("failed to save community asset paths: %w", err)
+	}
+	return nil
+}
+
+// GetCommunityStats returns aggregate statistics for a single community
+func (db *DB) GetCommunityStats(name string) (CommunityStats, error) {
+	stats := CommunityStats{Name: name, ByType: make(map[string]int)}
+
+	totals := struct {
+		Count int   `db:"count"`
+		Size  int64 `db:"size"`
+	}{}
+	err := db.Get(&totals, `SELECT COUNT(*) as count, COALESCE(SUM(file_size), 0) as size FROM scraped_media WHERE community_name = ?`, name)
+	if err != nil {
+		return stats, fmt.Errorf("failed to get community totals: %w", err)
+	}
+	stats.TotalMedia = totals.Count
+	stats.TotalSize = totals.Size
+
+	type TypeCount struct {
+		MediaType string `db:"media_type"`
+		Count     int    `db:"count"`
+	}
+	var typeCounts []TypeCount
+	err = db.Select(&typeCounts, `SELECT media_type, COUNT(*) as count FROM scraped_media WHERE community_name = ? GROUP BY media_type`, name)
+	if err != nil {
+		return stats, fmt.Errorf("failed to get media type counts: %w", err)
+	}
+	for _, tc := range typeCounts {
+		stats.ByType[tc.MediaType] = tc.Count
+	}
+
+	// One row per post so galleries don't crowd out other posts
+	err = db.Select(&stats.TopPosts, `
+		SELECT * FROM scraped_media
+		WHERE id IN (SELECT MIN(id) FROM scraped_media WHERE community_name = ? GROUP BY post_id)
+		ORDER BY post_score DESC
+		LIMIT 10
+	`, name)
+	if err != nil {
+		return stats, fmt.Errorf("failed to get top posts: %w", err)
+	}
+
+	err = db.Select(&stats.RecentMedia, `SELECT * FROM scraped_media WHERE community_name = ? ORDER BY downloaded_at DESC LIMIT 12`, name)
+	if err != nil {
+		return stats, fmt.Errorf("failed to get recent media: %w", err)
+	}
+
 	return stats, nil
 }
 
+// GetRescrapeStats returns how many times each post was scraped again after
+// the first time, for the posts that were
+func (db *DB) GetRescrapeStats() (map[int64]int, error) {
+	var rows []struct {
+		PostID        int64 `db:"post_id"`
+		RescrapeCount int   `db:"rescrape_count"`
+	}
+	err := db.Select(&rows, `SELECT post_id, rescrape_count FROM scraped_posts WHERE rescrape_count > 0`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rescrape counts: %w", err)
+	}
+
+	counts := make(map[int64]int, len(rows))
+	for _, row := range rows {
+		counts[row.PostID] = row.RescrapeCount
+	}
+	return counts, nil
+}
+
+// GetTopPostsByScore returns the first media item of each of the limit highest scoring posts
+func (db *DB) GetTopPostsByScore(limit int) ([]models.ScrapedMedia, error) {
+	var media []models.ScrapedMedia
+	// One row per post so galleries don't take several places
+	err := db.Select(&media, `
+		SELECT * FROM scraped_media
+		WHERE id IN (SELECT MIN(id) FROM scraped_media GROUP BY post_id)
+		ORDER BY post_score DESC, id
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get top posts: %w", err)
+	}
+	return media, nil
+}
+
+// DailyCount is the number and total size of media items downloaded on a single (UTC) day
+type DailyCount struct {
+	Date  time.Time
+	Count int
+	Bytes int64
+}
+
+// GetDailyDownloadCounts returns the number and size of media items downloaded per
+// day over the last days days, oldest first, for one community or, with an empty
+// name, the whole archive. Days without downloads are included with zero counts.
+func (db *DB) GetDailyDownloadCounts(name string, days int) ([]DailyCount, error) {
+	type dayCount struct {
+		Day   string `db:"day"`
+		Count int    `db:"count"`
+		Bytes int64  `db:"bytes"`
+	}
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	cutoff := today.AddDate(0, 0, -days).Format("2006-01-02")
+
+	day := db.dateExpr("downloaded_at")
+	where := day + ` > ?`
+	args := []interface{}{cutoff}
+	if name != "" {
+		where += ` AND community_name = ?`
+		args = append(args, name)
+	}
+
+	var rows []dayCount
+	query := `
+		SELECT ` + day + ` as day, COUNT(*) as count, COALESCE(SUM(file_size), 0) as bytes
+		FROM scraped_media
+		WHERE ` + where + `
+		GROUP BY day
+	`
+	if err := db.Select(&rows, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to get daily download counts: %w", err)
+	}
+
+	byDay := make(map[string]dayCount, len(rows))
+	for _, row := range rows {
+		byDay[row.Day] = row
+	}
+
+	counts := make([]DailyCount, days)
+	for i := range counts {
+		day := today.AddDate(0, 0, i-days+1)
+		row := byDay[day.Format("2006-01-02")]
+		counts[i] = DailyCount{Date: day, Count: row.Count, Bytes: row.Bytes}
+	}
+	return counts, nil
+}
+
+// GetRecentlyScrapedPostIDs returns the IDs of posts scraped within the last N days,
+// optionally limited to one community
+func (db *DB) GetRecentlyScrapedPostIDs(community string, days int) ([]int64, error) {
+	query := `SELECT post_id FROM scraped_posts WHERE scraped_at >= ?`
+	args := []interface{}{time.Now().UTC().AddDate(0, 0, -days)}
+
+	if community != "" {
+		query += ` AND community_name = ?`
+		args = append(args, community)
+	}
+
+	var postIDs []int64
+	if err := db.Select(&postIDs, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to get recently scraped posts: %w", err)
+	}
+	return postIDs, nil
+}
+
+// RecordScoreSample stores a post's current score if it differs from the last recorded one.
+// Returns true when a new history row was inserted.
+func (db *DB) RecordScoreSample(postID int64, score int) (bool, error) {
+	var lastScore int
+	query := `SELECT score FROM post_score_history WHERE post_id = ? ORDER BY sampled_at DESC, id DESC LIMIT 1`
+	err := db.Get(&lastScore, query, postID)
+	if err != nil && err != sql.ErrNoRows {
+		return false, fmt.Errorf("failed to get last score: %w", err)
+	}
+	if err == nil && lastScore == score {
+		return false, nil
+	}
+
+	insert := `INSERT INTO post_score_history (post_id, score, sampled_at) VALUES (?, ?, CURRENT_TIMESTAMP)`
+	if _, err := db.Exec(insert, postID, score); err != nil {
+		return false, fmt.Errorf("failed to record score sample: %w", err)
+	}
+	return true, nil
+}
+
+// ScorePoint is a single sample of a post's score
+type ScorePoint struct {
+	Score     int       `db:"score" json:"score"`
+	SampledAt time.Time `db:"sampled_at" json:"sampled_at"`
+}
+
+// GetScoreHistory returns the recorded score samples for a post, oldest first
+func (db *DB) GetScoreHistory(postID int64) ([]ScorePoint, error) {
+	query := `SELECT score, sampled_at FROM post_score_history WHERE post_id = ? ORDER BY sampled_at ASC, id ASC`
+
+	var points []ScorePoint
+	if err := db.Select(&points, query, postID); err != nil {
+		return nil, fmt.Errorf("failed to get score history: %w", err)
+	}
+	return points, nil
+}
+
 // HashContent computes the SHA256 hash of content
 func HashContent(content io.Reader) (string, error) {
 	hasher := sha256.New()
@@ -280,14 +1513,33 @@ func HashContent(content io.Reader) (string, error) {
 	return fmt.Sprintf("%x", hasher.Sum(nil)), nil
 }
 
-// SaveComment saves a comment to the database
+// SaveComment saves a comment to the database. When an already archived comment
+// comes back removed or deleted, its flags are updated but the archived content is kept.
 func (db *DB) SaveComment(commentView *models.CommentView) error {
+	return saveComment(db.DB, commentView)
+}
+
+// saveComment implements SaveComment for both DB and Tx
+func saveComment(q sqlx.Ext, commentView *models.CommentView) error {
 	query := `
-		INSERT OR REPLACE INTO scraped_comments (
+		INSERT INTO scraped_comments (
 			comment_id, post_id, creator_id, creator_name, content, path,
 			score, upvotes, downvotes, child_count, published, updated,
 			removed, deleted, distinguished, scraped_at
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, datetime('now'))
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(comment_id) DO UPDATE SET
+			creator_name = excluded.creator_name,
+			content = CASE WHEN excluded.removed OR excluded.deleted
+				THEN scraped_comments.content ELSE excluded.content END,
+			score = excluded.score,
+			upvotes = excluded.upvotes,
+			downvotes = excluded.downvotes,
+			child_count = excluded.child_count,
+			updated = excluded.updated,
+			removed = excluded.removed,
+			deleted = excluded.deleted,
+			distinguished = excluded.distinguished,
+			scraped_at = excluded.scraped_at
 	`
 
 	var updated interface{}
@@ -295,7 +1547,7 @@ func (db *DB) SaveComment(commentView *models.CommentView) error {
 		updated = commentView.Comment.Updated
 	}
 
-	_, err := db.Exec(query,
+	_, err := q.Exec(q.Rebind(query),
 		commentView.Comment.ID,
 		commentView.Comment.PostID,
 		commentView.Creator.ID,
@@ -321,35 +1573,38 @@ func (db *DB) SaveComment(commentView *models.CommentView) error {
 
 // Comment represents a comment record from the database
 type Comment struct {
-	CommentID     int64  `db:"comment_id"`
-	PostID        int64  `db:"post_id"`
-	CreatorID     int64  `db:"creator_id"`
-	CreatorName   string `db:"creator_name"`
-	Content       string `db:"content"`
-	Path          string `db:"path"`
-	Score         int64  `db:"score"`
-	Upvotes       int64  `db:"upvotes"`
-	Downvotes     int64  `db:"downvotes"`
-	ChildCount    int64  `db:"child_count"`
-	Published     string `db:"published"`
-	Updated       string `db:"updated"`
-	Removed       bool   `db:"removed"`
-	Deleted       bool   `db:"deleted"`
-	Distinguished bool   `db:"distinguished"`
-}
-
-// GetCommentsByPostID retrieves all comments for a post, ordered by path for proper threading
-func (db *DB) GetCommentsByPostID(postID int64) ([]map[string]interface{}, error) {
+	CommentID     int64          `db:"comment_id"`
+	PostID        int64          `db:"post_id"`
+	CreatorID     int64          `db:"creator_id"`
+	CreatorName   string         `db:"creator_name"`
+	Content       string         `db:"content"`
+	Path          string         `db:"path"`
+	Score         int64          `db:"score"`
+	Upvotes       int64          `db:"upvotes"`
+	Downvotes     int64          `db:"downvotes"`
+	ChildCount    int64          `db:"child_count"`
+	Published     string         `db:"published"`
+	Updated       sql.NullString `db:"updated"`
+	Removed       bool           `db:"removed"`
+	Deleted       bool           `db:"deleted"`
+	Distinguished bool           `db:"distinguished"`
+}
+
+// GetCommentsByPostID retrieves all comments for a post, ordered by path for proper threading.
+// Removed and deleted comments are only included when includeRemoved is set.
+func (db *DB) GetCommentsByPostID(postID int64, includeRemoved bool) ([]map[string]interface{}, error) {
 	query := `
 		SELECT
 			comment_id, post_id, creator_id, creator_name, content, path,
 			score, upvotes, downvotes, child_count, published,
-			COALESCE(updated, '') as updated,
+			updated,
 			removed, deleted, distinguished
 		FROM scraped_comments
-		WHERE post_id = ? AND removed = 0 AND deleted = 0
-		ORDER BY path ASC
-	`
+		WHERE post_id = ?`
+	if !includeRemoved {
+		query += ` AND NOT removed AND NOT deleted`
+	}
+	query += ` ORDER BY path ASC`
 
 	var comments []Comment
 	err := db.Select(&comments, query, postID)
@@ -374,19 +1629,84 @@ func (db *DB) GetCommentsByPostID(postID int64) ([]map[string]interface{}, error
 			"published":     c.Published,
 			"distinguished": c.Distinguished,
 		}
-		if c.Updated != "" {
-			result[i]["updated"] = c.Updated
+		if c.Updated.Valid {
+			result[i]["updated"] = c.Updated.String
+		}
+		if includeRemoved {
+			result[i]["removed"] = c.Removed
+			result[i]["deleted"] = c.Deleted
 		}
 	}
 
 	return result, nil
 }
 
+// GetOrphanedComments returns comments whose post is no longer in scraped_posts
+func (db *DB) GetOrphanedComments() ([]Comment, error) {
+	query := `
+		SELECT
+			sc.comment_id, sc.post_id, sc.creator_id, sc.creator_name, sc.content, sc.path,
+			sc.score, sc.upvotes, sc.downvotes, sc.child_count, sc.published,
+			sc.updated,
+			sc.removed, sc.deleted, sc.distinguished
+		FROM scraped_comments sc
+		LEFT JOIN scraped_posts sp ON sc.post_id = sp.post_id
+		WHERE sp.post_id IS NULL
+		ORDER BY sc.post_id, sc.path
+	`
+
+	var comments []Comment
+	if err := db.Select(&comments, query); err != nil {
+		return nil, fmt.Errorf("failed to query orphaned comments: %w", err)
+	}
+	return comments, nil
+}
+
+// DeleteOrphanedComments removes comments whose post is no longer in scraped_posts
+// and returns how many were deleted
+func (db *DB) DeleteOrphanedComments() (int64, error) {
+	result, err := db.Exec(`DELETE FROM scraped_comments WHERE post_id NOT IN (SELECT post_id FROM scraped_posts)`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete orphaned comments: %w", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count deleted comments: %w", err)
+	}
+	db.noteDeletedRows(deleted)
+	return deleted, nil
+}
+
+// GetPostsWithoutComments returns up to limit posts that had media but have no
+// stored comments, most recently scraped first
+func (db *DB) GetPostsWithoutComments(limit int) ([]int64, error) {
+	query := `
+		SELECT sp.post_id
+		FROM scraped_posts sp
+		WHERE sp.had_media
+			AND NOT EXISTS (SELECT 1 FROM scraped_comments sc WHERE sc.post_id = sp.post_id)
+		ORDER BY sp.scraped_at DESC
+		LIMIT ?
+	`
+
+	var postIDs []int64
+	if err := db.Select(&postIDs, query, limit); err != nil {
+		return nil, fmt.Errorf("failed to query posts without comments: %w", err)
+	}
+	return postIDs, nil
+}
+
 // CommentsExistForPost checks if comments have been scraped for a post
 func (db *DB) CommentsExistForPost(postID int64) (bool, error) {
+	return commentsExistForPost(db.DB, postID)
+}
+
+// commentsExistForPost implements CommentsExistForPost for both DB and Tx
+func commentsExistForPost(q sqlx.Ext, postID int64) (bool, error) {
 	var exists bool
 	query := `SELECT EXISTS(SELECT 1 FROM scraped_comments WHERE post_id = ? LIMIT 1)`
-	err := db.Get(&exists, query, postID)
+	err := sqlx.Get(q, &exists, q.Rebind(query), postID)
 	if err != nil {
 		return false, fmt.Errorf("failed to check comments existence: %w", err)
 	}
@@ -400,7 +1720,7 @@ func (db *DB) GetPostIDByMediaID(mediaID int64) (int64, error) {
 	err := db.Get(&postID, query, mediaID)
 	if err != nil {
 		if err.Error() == "sql: no rows in result set" {
-			return 0, fmt.Errorf("media not found")
+			return 0, ErrMediaNotFound
 		}
 		return 0, fmt.Errorf("failed to get post ID: %w", err)
 	}
@@ -411,71 +1731,129 @@ func (db *DB) GetPostIDByMediaID(mediaID int64) (int64, error) {
 type MediaFilter struct {
 	Community string
 	MediaType string
+	Author    string // Exact author name, case-insensitive
+	Favorites bool   // Only return media marked as a favorite
+
+	// SQL LIKE patterns for partial matches, e.g. "memes%"
+	CommunityLike string
+	AuthorLike    string
+
+	Dates    DateRange // Only return media within a date range
+	MinScore *int      // Only return media from posts scoring at least this
+
+	Tags         []string // Only return media with any of these tags
+	MatchAllTags bool     // Require every tag in Tags rather than any
+
 	SortBy    string
 	SortOrder string
 	Limit     int
 	Offset    int
+	AfterID   *int64 // Cursor: return media with an ID greater than this, ascending (ignores Offset)
+	BeforeID  *int64 // Cursor: return media with an ID less than this, still ascending (ignores Offset)
+}
+
+// mediaSortColumns maps the sort fields accepted by GetMediaWithFilters to the
+// column they order by. Unknown fields fall back to downloaded_at.
+var mediaSortColumns = map[string]string{
+	"downloaded_at":  "downloaded_at",
+	"post_created":   "post_created",
+	"file_size":      "file_size",
+	"post_score":     "post_score",
+	"post_upvotes":   "post_upvotes",
+	"post_downvotes": "post_downvotes",
+	"post_comments":  "post_comments",
+	"post_title":     "post_title",
+	"community_name": "community_name",
+	"author_name":    "author_name",
+	"media_type":     "media_type",
+	"instance":       "post_ap_id", // ActivityPub IDs start with the post's home instance
+}
+
+// DateRange limits media to a range of one of its timestamps. A zero From or
+// To leaves that end of the range open; both ends are inclusive.
+type DateRange struct {
+	Field string // "downloaded_at" (default) or "post_created"
+	From  time.Time
+	To    time.Time
+}
+
+// GetMediaByDateRange returns media downloaded between from and to (both
+// inclusive), newest first, with the total number of matches. A zero from or to
+// leaves that end open; community and mediaType are optional.
+func (db *DB) GetMediaByDateRange(from, to time.Time, community, mediaType string, limit, offset int) ([]models.ScrapedMedia, int, error) {
+	return db.GetMediaWithFilters(MediaFilter{
+		Community: community,
+		MediaType: mediaType,
+		Dates:     DateRange{Field: "downloaded_at", From: from, To: to},
+		SortBy:    "downloaded_at",
+		SortOrder: "DESC",
+		Limit:     limit,
+		Offset:    offset,
+	})
 }
 
 // GetMediaWithFilters retrieves media with optional filters
 func (db *DB) GetMediaWithFilters(filter MediaFilter) ([]models.ScrapedMedia, int, error) {
-	// Build query with filters
-	query := `SELECT * FROM scraped_media`
-	countQuery := `SELECT COUNT(*) FROM scraped_media`
-
-	var whereClauses []string
-	var args []interface{}
+	q := NewMediaQuery().
+		WithCommunity(filter.Community).
+		WithCommunityLike(filter.CommunityLike).
+		WithType(filter.MediaType).
+		WithAuthor(filter.Author).
+		WithAuthorLike(filter.AuthorLike).
+		WithFavorites(filter.Favorites).
+		MatchAllTags(filter.MatchAllTags)
 
-	if filter.Community != "" {
-		whereClauses = append(whereClauses, "community_name = ?")
-		args = append(args, filter.Community)
+	if filter.Dates.Field == "post_created" {
+		q.WithPostDateRange(filter.Dates.From, filter.Dates.To)
+	} else {
+		q.WithDateRange(filter.Dates.From, filter.Dates.To)
 	}
-
-	if filter.MediaType != "" {
-		whereClauses = append(whereClauses, "media_type = ?")
-		args = append(args, filter.MediaType)
+	if filter.MinScore != nil {
+		q.WithMinScore(*filter.MinScore)
 	}
 
-	// Add WHERE clause if needed
-	if len(whereClauses) > 0 {
-		whereClause := " WHERE " + strings.Join(whereClauses, " AND ")
-		query += whereClause
-		countQuery += whereClause
+	for _, tag := range filter.Tags {
+		q.WithTag(tag)
+	}
+	if len(filter.Tags) > 0 && len(q.tags) == 0 {
+		// Only blank tags were given, which nothing is tagged with
+		return []models.ScrapedMedia{}, 0, nil
 	}
 
 	// Get total count
 	var total int
-	if err := db.Get(&total, countQuery, args...); err != nil {
+	countQuery, countArgs := q.BuildCount()
+	if err := db.Get(&total, countQuery, countArgs...); err != nil {
 		return nil, 0, fmt.Errorf("failed to get count: %w", err)
 	}
 
-	// Add sorting and pagination
-	allowedSortFields := map[string]bool{
-		"downloaded_at": true,
-		"post_created":  true,
-		"file_size":     true,
-		"post_score":    true,
-	}
-
-	sortBy := filter.SortBy
-	if !allowedSortFields[sortBy] {
-		sortBy = "downloaded_at"
-	}
-
-	sortOrder := filter.SortOrder
-	if sortOrder != "ASC" && sortOrder != "DESC" {
-		sortOrder = "DESC"
+	// Cursor-based pagination is keyed on ID so rows inserted between
+	// requests can't shift pages and cause duplicates or gaps. Results are
+	// always returned in ascending ID order.
+	descending := false
+	switch {
+	case filter.AfterID != nil:
+		q.WithIDAfter(*filter.AfterID).OrderByID("ASC").Paginate(filter.Limit, 0)
+	case filter.BeforeID != nil:
+		// Walk backwards from the cursor, then flip to ascending order below
+		q.WithIDBefore(*filter.BeforeID).OrderByID("DESC").Paginate(filter.Limit, 0)
+		descending = true
+	default:
+		q.OrderBy(filter.SortBy, filter.SortOrder).Paginate(filter.Limit, filter.Offset)
 	}
 
-	query += fmt.Sprintf(" ORDER BY %s %s LIMIT ? OFFSET ?", sortBy, sortOrder)
-	args = append(args, filter.Limit, filter.Offset)
-
-	// Execute query
 	var media []models.ScrapedMedia
+	query, args := q.Build()
 	if err := db.Select(&media, query, args...); err != nil {
 		return nil, 0, fmt.Errorf("failed to query media: %w", err)
 	}
 
+	if descending {
+		for i, j := 0, len(media)-1; i < j; i, j = i+1, j-1 {
+			media[i], media[j] = media[j], media[i]
+		}
+	}
+
 	return media, total, nil
 }
 
@@ -0,0 +1,563 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/neo1908/lemmy-image-scraper/internal/config"
+	"github.com/neo1908/lemmy-image-scraper/pkg/models"
+)
+
+// newTestDB returns a fresh SQLite database in a temporary directory
+func newTestDB(t *testing.T) *DB {
+	t.Helper()
+	cfg := &config.Config{}
+	cfg.SetDefaults()
+	cfg.Database.Path = t.TempDir() + "/test.db"
+
+	db, err := New(&cfg.Database, false)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestRecordScoreSampleOnlyOnChange(t *testing.T) {
+	db := newTestDB(t)
+
+	samples := []struct {
+		score    int
+		inserted bool
+	}{
+		{10, true},
+		{10, false},
+		{12, true},
+		{12, false},
+		{10, true},
+	}
+	for i, s := range samples {
+		inserted, err := db.RecordScoreSample(1, s.score)
+		if err != nil {
+			t.Fatalf("sample %d: %v", i, err)
+		}
+		if inserted != s.inserted {
+			t.Errorf("sample %d (score %d): inserted = %v, want %v", i, s.score, inserted, s.inserted)
+		}
+	}
+
+	// Another post's history is separate
+	if inserted, err := db.RecordScoreSample(2, 10); err != nil || !inserted {
+		t.Errorf("first sample of another post: inserted = %v, err = %v", inserted, err)
+	}
+
+	points, err := db.GetScoreHistory(1)
+	if err != nil {
+		t.Fatalf("GetScoreHistory: %v", err)
+	}
+	var scores []int
+	for _, p := range points {
+		scores = append(scores, p.Score)
+	}
+	if len(scores) != 3 || scores[0] != 10 || scores[1] != 12 || scores[2] != 10 {
+		t.Errorf("history = %v, want [10 12 10]", scores)
+	}
+}
+
+// startRun records a scrape run that started at startedAt and finished with runErr
+func startRun(t *testing.T, db *DB, startedAt time.Time, runErr error) int64 {
+	t.Helper()
+	id, err := db.StartScrapeRun("0.19.3")
+	if err != nil {
+		t.Fatalf("StartScrapeRun: %v", err)
+	}
+	if _, err := db.Exec(`UPDATE scrape_runs SET started_at = ? WHERE id = ?`, startedAt, id); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.FinishScrapeRun(id, runErr); err != nil {
+		t.Fatalf("FinishScrapeRun: %v", err)
+	}
+	return id
+}
+
+func TestGetLastSuccessfulRunTime(t *testing.T) {
+	db := newTestDB(t)
+
+	if last, err := db.GetLastSuccessfulRunTime(); err != nil || !last.IsZero() {
+		t.Fatalf("with no runs: %v, err = %v, want the zero time", last, err)
+	}
+
+	first := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	second := first.Add(time.Hour)
+	startRun(t, db, first, nil)
+	startRun(t, db, second, nil)
+	startRun(t, db, second.Add(time.Hour), errors.New("instance unreachable"))
+
+	last, err := db.GetLastSuccessfulRunTime()
+	if err != nil {
+		t.Fatalf("GetLastSuccessfulRunTime: %v", err)
+	}
+	if !last.Equal(second) {
+		t.Errorf("last successful run = %v, want %v", last, second)
+	}
+}
+
+func TestGetLastCommunityScrapeTime(t *testing.T) {
+	db := newTestDB(t)
+
+	// pics is on a long interval; memes is scraped by later runs on its own
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	run := startRun(t, db, start, nil)
+	for _, community := range []string{"pics", "memes"} {
+		if err := db.RecordCommunityScraped(run, community); err != nil {
+			t.Fatalf("RecordCommunityScraped: %v", err)
+		}
+	}
+	for i := 1; i <= 3; i++ {
+		run := startRun(t, db, start.Add(time.Duration(i)*time.Minute), nil)
+		if err := db.RecordCommunityScraped(run, "memes"); err != nil {
+			t.Fatalf("RecordCommunityScraped: %v", err)
+		}
+	}
+	// A run that never finished the hot page doesn't count for it
+	startRun(t, db, start.Add(time.Hour), errors.New("instance unreachable"))
+
+	tests := []struct {
+		community string
+		want      time.Time
+	}{
+		{"pics", start},
+		{"memes", start.Add(3 * time.Minute)},
+		{"", time.Time{}},
+	}
+	for _, tt := range tests {
+		got, err := db.GetLastCommunityScrapeTime(tt.community)
+		if err != nil {
+			t.Fatalf("GetLastCommunityScrapeTime(%q): %v", tt.community, err)
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("GetLastCommunityScrapeTime(%q) = %v, want %v", tt.community, got, tt.want)
+		}
+	}
+}
+
+// saveMediaAt records media with the given hash stored at path and returns its ID
+func saveMediaAt(t *testing.T, db *DB, hash, path string) int64 {
+	t.Helper()
+	media := &models.ScrapedMedia{
+		PostID:        1,
+		CommunityName: "pics",
+		MediaURL:      "https://example.invalid/" + hash,
+		MediaHash:     hash,
+		FileName:      filepath.Base(path),
+		FilePath:      path,
+		MediaType:     "image",
+		PostCreated:   time.Now(),
+		DownloadedAt:  time.Now(),
+	}
+	if err := db.SaveMedia(media); err != nil {
+		t.Fatalf("SaveMedia: %v", err)
+	}
+	return media.ID
+}
+
+func TestRepairFilePaths(t *testing.T) {
+	db := newTestDB(t)
+
+	paths := map[string]string{
+		"moved":      "/data/my_media/pics/1.png",
+		"nested":     "/data/my_media/pics/2024/2.png",
+		"sibling":    "/data/my_media2/pics/3.png",
+		"midstring":  "/backup/data/my_media/pics/4.png",
+		"wildcard":   "/data/myXmedia/pics/5.png",
+		"unrelated":  "/srv/media/pics/6.png",
+		"basefolder": "/data/my_media",
+	}
+	for hash, path := range paths {
+		saveMediaAt(t, db, hash, path)
+	}
+
+	repaired, err := db.RepairFilePaths("/data/my_media/", "/mnt/nas/media")
+	if err != nil {
+		t.Fatalf("RepairFilePaths: %v", err)
+	}
+	if repaired != 2 {
+		t.Errorf("repaired = %d, want 2", repaired)
+	}
+
+	want := map[string]string{
+		"moved":      "/mnt/nas/media/pics/1.png",
+		"nested":     "/mnt/nas/media/pics/2024/2.png",
+		"sibling":    paths["sibling"],
+		"midstring":  paths["midstring"],
+		"wildcard":   paths["wildcard"],
+		"unrelated":  paths["unrelated"],
+		"basefolder": paths["basefolder"],
+	}
+	for hash, wantPath := range want {
+		var got string
+		if err := db.Get(&got, `SELECT file_path FROM scraped_media WHERE media_hash = ?`, hash); err != nil {
+			t.Fatalf("failed to get media %s: %v", hash, err)
+		}
+		if got != wantPath {
+			t.Errorf("%s: file path = %s, want %s", hash, got, wantPath)
+		}
+	}
+
+	if _, err := db.RepairFilePaths("", "/mnt/nas/media"); err == nil {
+		t.Error("RepairFilePaths with an empty old base succeeded")
+	}
+}
+
+func TestCursorPaginationWithInsertBetweenPages(t *testing.T) {
+	db := newTestDB(t)
+	for i := 1; i <= 5; i++ {
+		saveMediaAt(t, db, fmt.Sprintf("hash%d", i), fmt.Sprintf("/media/pics/%d.png", i))
+	}
+
+	// Page through two at a time, adding a row after the first page
+	var seen []int64
+	cursor := int64(0)
+	for page := 1; ; page++ {
+		media, total, err := db.GetMediaWithFilters(MediaFilter{Limit: 2, AfterID: &cursor})
+		if err != nil {
+			t.Fatalf("page %d: %v", page, err)
+		}
+		if len(media) == 0 {
+			break
+		}
+		for _, m := range media {
+			seen = append(seen, m.ID)
+		}
+		cursor = media[len(media)-1].ID
+
+		if page == 1 {
+			if total != 5 {
+				t.Errorf("page 1: total = %d, want 5", total)
+			}
+			saveMediaAt(t, db, "hash6", "/media/pics/6.png")
+		}
+		if page > 10 {
+			t.Fatal("pagination doesn't end")
+		}
+	}
+
+	// Every row exactly once, in ID order, including the one inserted mid-way
+	if len(seen) != 6 {
+		t.Fatalf("saw %d media (%v), want 6", len(seen), seen)
+	}
+	for i := 1; i < len(seen); i++ {
+		if seen[i] <= seen[i-1] {
+			t.Errorf("IDs out of order or repeated: %v", seen)
+			break
+		}
+	}
+
+	// Walking back from the end returns the preceding page, still ascending
+	before := seen[len(seen)-1]
+	media, _, err := db.GetMediaWithFilters(MediaFilter{Limit: 2, BeforeID: &before})
+	if err != nil {
+		t.Fatalf("before_id: %v", err)
+	}
+	if len(media) != 2 || media[0].ID != seen[3] || media[1].ID != seen[4] {
+		t.Errorf("page before %d = %v, want IDs %d, %d", before, media, seen[3], seen[4])
+	}
+}
+
+// testPostView returns a post in the community "pics"
+func testPostView(id int64) *models.PostView {
+	return &models.PostView{
+		Post:      models.Post{ID: id, Name: "A picture", Published: time.Now().UTC()},
+		Community: models.Community{ID: 1, Name: "pics"},
+		Creator:   models.Person{ID: 1, Name: "bob"},
+	}
+}
+
+// saveTestComment stores comment id on post postID
+func saveTestComment(t *testing.T, db *DB, id, postID int64) {
+	t.Helper()
+	err := db.SaveComment(&models.CommentView{
+		Comment: models.Comment{ID: id, PostID: postID, Content: "Nice", Path: fmt.Sprintf("0.%d", id), Published: time.Now().UTC()},
+	})
+	if err != nil {
+		t.Fatalf("SaveComment: %v", err)
+	}
+}
+
+func TestOrphanedComments(t *testing.T) {
+	db := newTestDB(t)
+	for _, postID := range []int64{1, 2} {
+		if err := db.MarkPostAsScraped(testPostView(postID), 1); err != nil {
+			t.Fatalf("MarkPostAsScraped: %v", err)
+		}
+	}
+	saveTestComment(t, db, 10, 1)
+	saveTestComment(t, db, 11, 1)
+	saveTestComment(t, db, 20, 2)
+	saveTestComment(t, db, 30, 3) // Post never marked as scraped
+
+	// Post 2 is deleted
+	if _, err := db.Exec(`DELETE FROM scraped_posts WHERE post_id = ?`, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	orphans, err := db.GetOrphanedComments()
+	if err != nil {
+		t.Fatalf("GetOrphanedComments: %v", err)
+	}
+	if len(orphans) != 2 || orphans[0].CommentID != 20 || orphans[1].CommentID != 30 {
+		t.Errorf("orphans = %+v, want comments 20 and 30", orphans)
+	}
+
+	deleted, err := db.DeleteOrphanedComments()
+	if err != nil || deleted != 2 {
+		t.Fatalf("DeleteOrphanedComments = %d, err = %v, want 2", deleted, err)
+	}
+	if orphans, err := db.GetOrphanedComments(); err != nil || len(orphans) != 0 {
+		t.Errorf("orphans after deleting = %d, err = %v", len(orphans), err)
+	}
+	comments, err := db.GetCommentsByPostID(1, false)
+	if err != nil || len(comments) != 2 {
+		t.Errorf("comments of post 1 = %d, err = %v, want 2", len(comments), err)
+	}
+}
+
+func TestMarkPostAsScrapedCountsRescrapes(t *testing.T) {
+	db := newTestDB(t)
+
+	for mediaCount := 1; mediaCount <= 3; mediaCount++ {
+		if err := db.MarkPostAsScraped(testPostView(1), mediaCount); err != nil {
+			t.Fatalf("MarkPostAsScraped (call %d): %v", mediaCount, err)
+		}
+	}
+
+	var post struct {
+		RescrapeCount int `db:"rescrape_count"`
+		MediaCount    int `db:"media_count"`
+	}
+	if err := db.Get(&post, `SELECT rescrape_count, media_count FROM scraped_posts WHERE post_id = ?`, 1); err != nil {
+		t.Fatalf("failed to get post: %v", err)
+	}
+	if post.RescrapeCount != 2 {
+		t.Errorf("rescrape_count = %d, want 2", post.RescrapeCount)
+	}
+	if post.MediaCount != 3 {
+		t.Errorf("media_count = %d, want the latest, 3", post.MediaCount)
+	}
+
+	// Another post starts from zero
+	if err := db.MarkPostAsScraped(testPostView(2), 1); err != nil {
+		t.Fatalf("MarkPostAsScraped: %v", err)
+	}
+	var rescrapes int
+	if err := db.Get(&rescrapes, `SELECT rescrape_count FROM scraped_posts WHERE post_id = ?`, 2); err != nil || rescrapes != 0 {
+		t.Errorf("rescrape_count of a new post = %d, err = %v, want 0", rescrapes, err)
+	}
+}
+
+func TestGetMediaByDateRangeBoundaries(t *testing.T) {
+	db := newTestDB(t)
+
+	// Stored from times in different zones; all are compared in UTC
+	cet := time.FixedZone("CET", 3600)
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	downloaded := map[string]time.Time{
+		"10:00": base.Add(-2 * time.Hour),
+		"12:00": base.In(cet),
+		"14:00": base.Add(2 * time.Hour),
+		"14:30": base.Add(150 * time.Minute).In(time.FixedZone("EST", -5*3600)),
+	}
+	ids := make(map[int64]string)
+	for name, at := range downloaded {
+		media := &models.ScrapedMedia{
+			PostID: 1, CommunityName: "pics", MediaHash: name, MediaURL: "https://example.invalid/" + name,
+			FileName: name + ".png", FilePath: "/media/" + name + ".png", MediaType: "image",
+			PostCreated: at, DownloadedAt: at,
+		}
+		if err := db.SaveMedia(media); err != nil {
+			t.Fatalf("SaveMedia: %v", err)
+		}
+		ids[media.ID] = name
+	}
+
+	tests := []struct {
+		name     string
+		from, to time.Time
+		want     []string // Newest first
+	}{
+		{"both ends inclusive", base, base.Add(2 * time.Hour), []string{"14:00", "12:00"}},
+		{"just after the start excludes it", base.Add(time.Nanosecond), base.Add(2 * time.Hour), []string{"14:00"}},
+		{"just after a second excludes it", base.Add(time.Second), base.Add(2 * time.Hour), []string{"14:00"}},
+		{"just before the end excludes it", base, base.Add(2*time.Hour - time.Second), []string{"12:00"}},
+		{"bounds in another zone", base.In(cet), base.Add(2 * time.Hour).In(cet), []string{"14:00", "12:00"}},
+		{"open start", time.Time{}, base, []string{"12:00", "10:00"}},
+		{"open end", base.Add(2 * time.Hour), time.Time{}, []string{"14:30", "14:00"}},
+		{"empty range", base.Add(time.Minute), base.Add(time.Hour), nil},
+	}
+	for _, tt := range tests {
+		media, total, err := db.GetMediaByDateRange(tt.from, tt.to, "", "", 50, 0)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var got []string
+		for _, m := range media {
+			got = append(got, ids[m.ID])
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) || total != len(tt.want) {
+			t.Errorf("%s: got %v (total %d), want %v", tt.name, got, total, tt.want)
+		}
+	}
+}
+
+func TestGetMediaIntegrityStats(t *testing.T) {
+	db := newTestDB(t)
+	dir := t.TempDir()
+
+	for i := 0; i < 3; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("present%d.jpg", i))
+		if err := os.WriteFile(path, []byte("image"), 0644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+		saveMediaAt(t, db, fmt.Sprintf("present%d", i), path)
+	}
+	for i := 0; i < 2; i++ {
+		saveMediaAt(t, db, fmt.Sprintf("missing%d", i), filepath.Join(dir, fmt.Sprintf("missing%d.jpg", i)))
+	}
+
+	total, onDisk, missing, err := db.GetMediaIntegrityStats()
+	if err != nil {
+		t.Fatalf("GetMediaIntegrityStats: %v", err)
+	}
+	if total != 5 || onDisk != 3 || missing != 2 {
+		t.Errorf("total, on disk, missing = %d, %d, %d, want 5, 3, 2", total, onDisk, missing)
+	}
+}
+
+func TestGetTopPostsByScore(t *testing.T) {
+	db := newTestDB(t)
+
+	// Post 2 is a gallery of two items, which takes one place
+	posts := []struct {
+		postID int64
+		score  int
+	}{{1, 5}, {2, 50}, {2, 50}, {3, 20}, {4, 1}}
+	for i, p := range posts {
+		hash := fmt.Sprintf("%064x", i)
+		err := db.SaveMedia(&models.ScrapedMedia{
+			PostID:        p.postID,
+			CommunityName: "pics",
+			MediaURL:      "https://example.invalid/" + hash,
+			MediaHash:     hash,
+			FileName:      hash + ".jpg",
+			FilePath:      "/data/pics/" + hash + ".jpg",
+			MediaType:     "image",
+			PostScore:     p.score,
+			PostCreated:   time.Now(),
+			DownloadedAt:  time.Now(),
+		})
+		if err != nil {
+			t.Fatalf("SaveMedia: %v", err)
+		}
+	}
+
+	top, err := db.GetTopPostsByScore(3)
+	if err != nil {
+		t.Fatalf("GetTopPostsByScore: %v", err)
+	}
+	var got []int64
+	for _, m := range top {
+		got = append(got, m.PostID)
+	}
+	if fmt.Sprint(got) != fmt.Sprint([]int64{2, 3, 1}) {
+		t.Errorf("top posts = %v, want [2 3 1]", got)
+	}
+}
+
+func TestGetDailyDownloadCounts(t *testing.T) {
+	db := newTestDB(t)
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+
+	downloads := []struct {
+		community    string
+		downloadedAt time.Time
+		size         int64
+	}{
+		{"pics", today, 100},
+		{"pics", today.Add(time.Minute), 200},
+		{"pics", today.AddDate(0, 0, -1).Add(23 * time.Hour), 50},
+		{"memes", today, 1000},
+		{"pics", today.AddDate(0, 0, -40), 7}, // Outside the range
+	}
+	for i, d := range downloads {
+		hash := fmt.Sprintf("%064x", i)
+		err := db.SaveMedia(&models.ScrapedMedia{
+			PostID:        int64(i),
+			CommunityName: d.community,
+			MediaURL:      "https://example.invalid/" + hash,
+			MediaHash:     hash,
+			FileName:      hash + ".jpg",
+			FilePath:      "/data/" + hash + ".jpg",
+			FileSize:      d.size,
+			MediaType:     "image",
+			PostCreated:   d.downloadedAt,
+			DownloadedAt:  d.downloadedAt,
+		})
+		if err != nil {
+			t.Fatalf("SaveMedia: %v", err)
+		}
+	}
+
+	tests := []struct {
+		community string
+		want      []DailyCount
+	}{
+		{"pics", []DailyCount{
+			{Date: today.AddDate(0, 0, -2)},
+			{Date: today.AddDate(0, 0, -1), Count: 1, Bytes: 50},
+			{Date: today, Count: 2, Bytes: 300},
+		}},
+		{"", []DailyCount{
+			{Date: today.AddDate(0, 0, -2)},
+			{Date: today.AddDate(0, 0, -1), Count: 1, Bytes: 50},
+			{Date: today, Count: 3, Bytes: 1300},
+		}},
+	}
+	for _, tt := range tests {
+		counts, err := db.GetDailyDownloadCounts(tt.community, 3)
+		if err != nil {
+			t.Fatalf("GetDailyDownloadCounts(%q): %v", tt.community, err)
+		}
+		if len(counts) != len(tt.want) {
+			t.Fatalf("GetDailyDownloadCounts(%q) returned %d days, want %d", tt.community, len(counts), len(tt.want))
+		}
+		for i, want := range tt.want {
+			got := counts[i]
+			if !got.Date.Equal(want.Date) || got.Count != want.Count || got.Bytes != want.Bytes {
+				t.Errorf("GetDailyDownloadCounts(%q)[%d] = %s %d %d, want %s %d %d", tt.community, i,
+					got.Date.Format("2006-01-02"), got.Count, got.Bytes, want.Date.Format("2006-01-02"), want.Count, want.Bytes)
+			}
+		}
+	}
+}
+
+func TestUpsertCommunityDescription(t *testing.T) {
+	db := newTestDB(t)
+
+	for _, description := range []string{"# Pics\n\nPictures only.", "# Pics\n\nNo memes."} {
+		community := &models.Community{ID: 1, Name: "pics", Title: "Pictures", Description: description}
+		if err := db.UpsertCommunity(community); err != nil {
+			t.Fatalf("UpsertCommunity: %v", err)
+		}
+		stored, err := db.GetCommunity("pics")
+		if err != nil {
+			t.Fatalf("GetCommunity: %v", err)
+		}
+		if stored == nil || stored.Description != description {
+			t.Errorf("stored community = %+v, want description %q", stored, description)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package database
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// postgresSchema rewrites the SQLite schema for PostgreSQL. The comments table
+// drops its foreign key because comments may be saved before their post is
+// marked as scraped, and orphans are cleaned up separately.
+var postgresSchema = strings.NewReplacer(
+	"INTEGER PRIMARY KEY AUTOINCREMENT", "BIGSERIAL PRIMARY KEY",
+	"INTEGER", "BIGINT",
+	"DATETIME", "TIMESTAMPTZ",
+	",\n\tFOREIGN KEY (post_id) REFERENCES scraped_posts(post_id)", "",
+)
+
+// isPostgres reports whether the database is PostgreSQL rather than SQLite
+func (db *DB) isPostgres() bool {
+	return db.DriverName() == "postgres"
+}
+
+// dateExpr returns a SQL expression for the UTC day (YYYY-MM-DD) of a timestamp column
+func (db *DB) dateExpr(column string) string {
+	if db.isPostgres() {
+		return "to_char(" + column + " AT TIME ZONE 'UTC', 'YYYY-MM-DD')"
+	}
+	return "date(" + column + ")"
+}
+
+// Get runs a query that returns a single row, rewriting ? placeholders for the driver
+func (db *DB) Get(dest interface{}, query string, args ...interface{}) error {
+	return db.DB.Get(dest, db.Rebind(query), args...)
+}
+
+// Select runs a query that returns multiple rows, rewriting ? placeholders for the driver
+func (db *DB) Select(dest interface{}, query string, args ...interface{}) error {
+	return db.DB.Select(dest, db.Rebind(query), args...)
+}
+
+// Exec runs a statement, rewriting ? placeholders for the driver
+func (db *DB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return db.DB.Exec(db.Rebind(query), args...)
+}
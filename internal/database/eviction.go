@@ -0,0 +1,68 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/neo1908/lemmy-image-scraper/pkg/models"
+)
+
+// evictionOrder maps each eviction policy to the order it removes media in
+var evictionOrder = map[string]string{
+	"oldest":       "downloaded_at ASC, id ASC",
+	"lowest_score": "post_score ASC, downloaded_at ASC, id ASC",
+	"largest":      "file_size DESC, id ASC",
+}
+
+// TotalMediaSize returns the combined size in bytes of every stored media file
+func (db *DB) TotalMediaSize() (int64, error) {
+	var total int64
+	if err := db.Get(&total, `SELECT COALESCE(SUM(file_size), 0) FROM scraped_media`); err != nil {
+		return 0, fmt.Errorf("failed to get total media size: %w", err)
+	}
+	return total, nil
+}
+
+// SelectForEviction returns up to limit media items in the order the eviction
+// policy removes them. Favorites are never selected.
+func (db *DB) SelectForEviction(policy string, limit int) ([]models.ScrapedMedia, error) {
+	order, ok := evictionOrder[policy]
+	if !ok {
+		return nil, fmt.Errorf("unknown eviction policy %q", policy)
+	}
+
+	media := []models.ScrapedMedia{}
+	query := `SELECT * FROM scraped_media WHERE is_favorite = FALSE ORDER BY ` + order + ` LIMIT ?`
+	if err := db.Select(&media, query, limit); err != nil {
+		return nil, fmt.Errorf("failed to select media for eviction: %w", err)
+	}
+	return media, nil
+}
+
+// DeleteMedia removes a media record and its links to posts. The file is left
+// to the caller. The post stays marked as scraped.
+func (db *DB) DeleteMedia(id int64) error {
+	var deleted int64
+	err := db.WithTx(func(tx *Tx) error {
+		if _, err := tx.Exec(tx.Rebind(`DELETE FROM media_posts WHERE media_id = ?`), id); err != nil {
+			return fmt.Errorf("failed to delete media links: %w", err)
+		}
+		if _, err := tx.Exec(tx.Rebind(`DELETE FROM media_tags WHERE media_id = ?`), id); err != nil {
+			return fmt.Errorf("failed to delete media tags: %w", err)
+		}
+		result, err := tx.Exec(tx.Rebind(`DELETE FROM scraped_media WHERE id = ?`), id)
+		if err != nil {
+			return fmt.Errorf("failed to delete media: %w", err)
+		}
+		deleted, err = result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to count deleted media: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	db.noteDeletedRows(deleted)
+	return nil
+}
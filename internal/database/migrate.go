@@ -0,0 +1,124 @@
+package database
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// schemaTablePattern finds the tables created by the schema
+var schemaTablePattern = regexp.MustCompile(`CREATE TABLE IF NOT EXISTS (\w+)`)
+
+// migrations lists every schema change in the order it was made: the tables
+// of the schema, then the columns added to them later. A database's schema
+// version is the number of them it has.
+var migrations = schemaMigrations()
+
+// LatestSchemaVersion is the schema version New and Migrate bring databases to
+var LatestSchemaVersion = len(migrations)
+
+// schemaMigrations builds migrations from the schema and addedColumns
+func schemaMigrations() []string {
+	var changes []string
+	for _, match := range schemaTablePattern.FindAllStringSubmatch(sqliteSchema, -1) {
+		changes = append(changes, fmt.Sprintf("create table %s", match[1]))
+	}
+	for _, c := range addedColumns {
+		changes = append(changes, fmt.Sprintf("add column %s.%s", c.table, c.column))
+	}
+	return changes
+}
+
+// schemaVersionTable records the schema version of the database. It is kept
+// out of sqliteSchema so it isn't counted as a migration itself.
+const schemaVersionTable = `CREATE TABLE IF NOT EXISTS schema_version (version INTEGER NOT NULL)`
+
+// SchemaVersion returns the schema version recorded in the database, or 0 for
+// a new database or one from before versions were recorded
+func (db *DB) SchemaVersion() (int, error) {
+	exists, err := db.tableExists("schema_version")
+	if err != nil || !exists {
+		return 0, err
+	}
+
+	var version int
+	if err := db.Get(&version, `SELECT COALESCE(MAX(version), 0) FROM schema_version`); err != nil {
+		return 0, fmt.Errorf("failed to get schema version: %w", err)
+	}
+	return version, nil
+}
+
+// setSchemaVersion records the schema version of the database
+func (db *DB) setSchemaVersion(version int) error {
+	if _, err := db.Exec(schemaVersionTable); err != nil {
+		return fmt.Errorf("failed to create schema version table: %w", err)
+	}
+	return db.WithTx(func(tx *Tx) error {
+		if _, err := tx.Exec(`DELETE FROM schema_version`); err != nil {
+			return fmt.Errorf("failed to clear schema version: %w", err)
+		}
+		if _, err := tx.Exec(tx.Rebind(`INSERT INTO schema_version (version) VALUES (?)`), version); err != nil {
+			return fmt.Errorf("failed to record schema version: %w", err)
+		}
+		return nil
+	})
+}
+
+// PendingMigrations lists the schema changes the database is missing, such as
+// tables and columns added by newer versions, without applying them
+func (db *DB) PendingMigrations() ([]string, error) {
+	var pending []string
+	missingTables := make(map[string]bool)
+	for _, match := range schemaTablePattern.FindAllStringSubmatch(sqliteSchema, -1) {
+		table := match[1]
+		exists, err := db.tableExists(table)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			missingTables[table] = true
+			pending = append(pending, fmt.Sprintf("create table %s", table))
+		}
+	}
+
+	for _, c := range addedColumns {
+		// New tables are created with all their columns
+		if missingTables[c.table] {
+			continue
+		}
+		exists, err := db.columnExists(c.table, c.column)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			pending = append(pending, fmt.Sprintf("add column %s.%s", c.table, c.column))
+		}
+	}
+	return pending, nil
+}
+
+// Migrate applies any pending schema changes and returns what was applied.
+// It runs the same code as opening the database with New.
+func (db *DB) Migrate() ([]string, error) {
+	pending, err := db.PendingMigrations()
+	if err != nil {
+		return nil, err
+	}
+	if err := db.initSchema(); err != nil {
+		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+	}
+	return pending, nil
+}
+
+// tableExists reports whether the database has the given table
+func (db *DB) tableExists(table string) (bool, error) {
+	query := `SELECT EXISTS(SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = ?)`
+	if db.isPostgres() {
+		query = `SELECT EXISTS(SELECT 1 FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?)`
+	}
+
+	var exists bool
+	if err := db.Get(&exists, query, table); err != nil {
+		return false, fmt.Errorf("failed to check for table %s: %w", table, err)
+	}
+	return exists, nil
+}
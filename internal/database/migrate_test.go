@@ -0,0 +1,96 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/neo1908/lemmy-image-scraper/internal/config"
+)
+
+// openTestDB opens a database in a temporary directory; with dryRun set its
+// schema is left untouched
+func openTestDB(t *testing.T, path string, dryRun bool) *DB {
+	t.Helper()
+	cfg := &config.Config{}
+	cfg.SetDefaults()
+	cfg.Database.Path = path
+
+	db, err := New(&cfg.Database, dryRun)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestMigrateFromVersionZero(t *testing.T) {
+	path := t.TempDir() + "/test.db"
+
+	// An older database: it has data, but lacks a column and a table added
+	// since, and no recorded version
+	old := openTestDB(t, path, false)
+	for _, stmt := range []string{
+		`ALTER TABLE scraped_posts DROP COLUMN rescrape_count`,
+		`DROP TABLE scrape_run_communities`,
+		`DROP TABLE schema_version`,
+		`INSERT INTO scraped_posts (post_id, post_title, community_name, community_id, author_name,
+			author_id, post_created, scraped_at, had_media, media_count)
+			VALUES (1, 'A picture', 'pics', 1, 'bob', 1, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, TRUE, 1)`,
+	} {
+		if _, err := old.Exec(stmt); err != nil {
+			t.Fatalf("failed to set up old database: %v", err)
+		}
+	}
+	old.Close()
+
+	// Opening it for a dry run changes nothing
+	db := openTestDB(t, path, true)
+	if version, err := db.SchemaVersion(); err != nil || version != 0 {
+		t.Fatalf("schema version = %d, err = %v, want 0", version, err)
+	}
+	pending, err := db.PendingMigrations()
+	if err != nil {
+		t.Fatalf("PendingMigrations: %v", err)
+	}
+	want := []string{"create table scrape_run_communities", "add column scraped_posts.rescrape_count"}
+	if len(pending) != len(want) || pending[0] != want[0] || pending[1] != want[1] {
+		t.Errorf("pending = %v, want %v", pending, want)
+	}
+	if exists, err := db.tableExists("scrape_run_communities"); err != nil || exists {
+		t.Errorf("dry run created a table: exists = %v, err = %v", exists, err)
+	}
+
+	applied, err := db.Migrate()
+	if err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if len(applied) != len(want) {
+		t.Errorf("applied = %v, want %v", applied, want)
+	}
+	if version, err := db.SchemaVersion(); err != nil || version != LatestSchemaVersion {
+		t.Errorf("schema version after migrating = %d, err = %v, want %d", version, err, LatestSchemaVersion)
+	}
+	if pending, err := db.PendingMigrations(); err != nil || len(pending) != 0 {
+		t.Errorf("pending after migrating = %v, err = %v", pending, err)
+	}
+
+	// The data survives, with the new column's default
+	var rescrapes int
+	if err := db.Get(&rescrapes, `SELECT rescrape_count FROM scraped_posts WHERE post_id = 1`); err != nil || rescrapes != 0 {
+		t.Errorf("rescrape_count = %d, err = %v, want 0", rescrapes, err)
+	}
+
+	// Migrating again is a no-op
+	if applied, err := db.Migrate(); err != nil || len(applied) != 0 {
+		t.Errorf("second Migrate applied %v, err = %v", applied, err)
+	}
+}
+
+func TestNewDatabaseIsAtLatestVersion(t *testing.T) {
+	db := newTestDB(t)
+	if version, err := db.SchemaVersion(); err != nil || version != LatestSchemaVersion {
+		t.Errorf("schema version = %d, err = %v, want %d", version, err, LatestSchemaVersion)
+	}
+	if LatestSchemaVersion != len(migrations) || LatestSchemaVersion == 0 {
+		t.Errorf("LatestSchemaVersion = %d with %d migrations", LatestSchemaVersion, len(migrations))
+	}
+}
@@ -0,0 +1,239 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MediaQueryBuilder assembles a parameterised query over scraped_media, so
+// every media listing combines the same filters the same way. Filters given
+// an empty or zero value are left out, and each method returns the builder so
+// calls can be chained:
+//
+//	query, args := NewMediaQuery().WithCommunity("pics").OrderBy("post_score", "DESC").Paginate(50, 0).Build()
+//
+// The media table is aliased as m. Queries use ? placeholders, which the DB
+// rebinds for PostgreSQL.
+type MediaQueryBuilder struct {
+	clauses  []string
+	args     []interface{}
+	tags     []string
+	matchAll bool
+	order    string // ORDER BY expression, "" for newest first
+	limit    int
+	offset   int
+	paginate bool
+}
+
+// NewMediaQuery returns a builder matching all media, newest first
+func NewMediaQuery() *MediaQueryBuilder {
+	return &MediaQueryBuilder{}
+}
+
+// where adds a condition that every result must meet
+func (b *MediaQueryBuilder) where(clause string, args ...interface{}) *MediaQueryBuilder {
+	b.clauses = append(b.clauses, clause)
+	b.args = append(b.args, args...)
+	return b
+}
+
+// WithCommunity limits results to one community
+func (b *MediaQueryBuilder) WithCommunity(name string) *MediaQueryBuilder {
+	if name == "" {
+		return b
+	}
+	return b.where("m.community_name = ?", name)
+}
+
+// WithCommunityLike limits results to communities matching a SQL LIKE pattern
+func (b *MediaQueryBuilder) WithCommunityLike(pattern string) *MediaQueryBuilder {
+	if pattern == "" {
+		return b
+	}
+	return b.where("m.community_name LIKE ?", pattern)
+}
+
+// WithType limits results to one media type, e.g. "image"
+func (b *MediaQueryBuilder) WithType(t string) *MediaQueryBuilder {
+	if t == "" {
+		return b
+	}
+	return b.where("m.media_type = ?", t)
+}
+
+// WithAuthor limits results to one author, ignoring case
+func (b *MediaQueryBuilder) WithAuthor(name string) *MediaQueryBuilder {
+	if name == "" {
+		return b
+	}
+	return b.where("LOWER(m.author_name) = LOWER(?)", name)
+}
+
+// WithAuthorLike limits results to authors matching a SQL LIKE pattern
+func (b *MediaQueryBuilder) WithAuthorLike(pattern string) *MediaQueryBuilder {
+	if pattern == "" {
+		return b
+	}
+	return b.where("m.author_name LIKE ?", pattern)
+}
+
+// WithFavorites limits results to favorites when only is set
+func (b *MediaQueryBuilder) WithFavorites(only bool) *MediaQueryBuilder {
+	if !only {
+		return b
+	}
+	return b.where("m.is_favorite = ?", true)
+}
+
+// WithTag limits results to media with a tag. With several tags, media with
+// any of them match unless MatchAllTags is set.
+func (b *MediaQueryBuilder) WithTag(tag string) *MediaQueryBuilder {
+	tag = NormalizeTag(tag)
+	if tag == "" {
+		return b
+	}
+	for _, t := range b.tags {
+		if t == tag {
+			return b
+		}
+	}
+	b.tags = append(b.tags, tag)
+	return b
+}
+
+// MatchAllTags makes media match only when they have every tag given to WithTag
+func (b *MediaQueryBuilder) MatchAllTags(all bool) *MediaQueryBuilder {
+	b.matchAll = all
+	return b
+}
+
+// WithDateRange limits results to media downloaded between from and to, both
+// inclusive. A zero from or to leaves that end open.
+func (b *MediaQueryBuilder) WithDateRange(from, to time.Time) *MediaQueryBuilder {
+	return b.dateRange("m.downloaded_at", from, to)
+}
+
+// WithPostDateRange is WithDateRange for the time the post was created
+func (b *MediaQueryBuilder) WithPostDateRange(from, to time.Time) *MediaQueryBuilder {
+	return b.dateRange("m.post_created", from, to)
+}
+
+// dateRange limits a timestamp column. Times are passed as time.Time, never
+// formatted strings, so the driver encodes them the same way it encoded the
+// stored values.
+func (b *MediaQueryBuilder) dateRange(column string, from, to time.Time) *MediaQueryBuilder {
+	if !from.IsZero() {
+		b.where(column+" >= ?", from.UTC())
+	}
+	if !to.IsZero() {
+		b.where(column+" <= ?", to.UTC())
+	}
+	return b
+}
+
+// WithMinScore limits results to posts scoring at least s. Unlike the other
+// filters it always applies, as 0 and negative scores are meaningful.
+func (b *MediaQueryBuilder) WithMinScore(s int) *MediaQueryBuilder {
+	return b.where("m.post_score >= ?", s)
+}
+
+// WithIDAfter limits results to media with an ID greater than id
+func (b *MediaQueryBuilder) WithIDAfter(id int64) *MediaQueryBuilder {
+	return b.where("m.id > ?", id)
+}
+
+// WithIDBefore limits results to media with an ID less than id
+func (b *MediaQueryBuilder) WithIDBefore(id int64) *MediaQueryBuilder {
+	return b.where("m.id < ?", id)
+}
+
+// OrderBy sorts by one of the fields in mediaSortColumns, falling back to
+// downloaded_at, in "ASC" or "DESC" (the default) order. Ties are broken by ID
+// so pages stay stable when many rows share a value.
+func (b *MediaQueryBuilder) OrderBy(field, dir string) *MediaQueryBuilder {
+	// The column is interpolated into the query, so only known names are used
+	column, ok := mediaSortColumns[field]
+	if !ok {
+		column = mediaSortColumns["downloaded_at"]
+	}
+	dir = sortDirection(dir)
+	b.order = fmt.Sprintf("m.%s %s, m.id %s", column, dir, dir)
+	return b
+}
+
+// OrderByID sorts by ID alone, for cursor pagination
+func (b *MediaQueryBuilder) OrderByID(dir string) *MediaQueryBuilder {
+	b.order = "m.id " + sortDirection(dir)
+	return b
+}
+
+// sortDirection returns dir if it's ASC or DESC, otherwise DESC
+func sortDirection(dir string) string {
+	if dir != "ASC" {
+		return "DESC"
+	}
+	return dir
+}
+
+// Paginate returns at most limit results, skipping the first offset
+func (b *MediaQueryBuilder) Paginate(limit, offset int) *MediaQueryBuilder {
+	b.limit, b.offset, b.paginate = limit, offset, true
+	return b
+}
+
+// Build returns the query selecting the matching media and its arguments
+func (b *MediaQueryBuilder) Build() (sql string, args []interface{}) {
+	sql, args = b.matches("m.*")
+
+	order := b.order
+	if order == "" {
+		order = "m.downloaded_at DESC, m.id DESC"
+	}
+	sql += " ORDER BY " + order
+
+	if b.paginate {
+		sql += " LIMIT ? OFFSET ?"
+		args = append(args, b.limit, b.offset)
+	}
+	return sql, args
+}
+
+// BuildCount returns the query counting the matching media, ignoring order and pagination
+func (b *MediaQueryBuilder) BuildCount() (sql string, args []interface{}) {
+	if len(b.tags) == 0 {
+		return b.matches("COUNT(*)")
+	}
+	sql, args = b.matches("m.id")
+	return "SELECT COUNT(*) FROM (" + sql + ") AS matches", args
+}
+
+// matches returns the query selecting columns from the matching media
+func (b *MediaQueryBuilder) matches(columns string) (string, []interface{}) {
+	sql := "SELECT " + columns + " FROM scraped_media m"
+	clauses := append([]string{}, b.clauses...)
+	args := append([]interface{}{}, b.args...)
+
+	if len(b.tags) > 0 {
+		sql += " JOIN media_tags mt ON mt.media_id = m.id JOIN tags t ON t.id = mt.tag_id"
+		clauses = append(clauses, "t.name IN ("+strings.TrimSuffix(strings.Repeat("?, ", len(b.tags)), ", ")+")")
+		for _, tag := range b.tags {
+			args = append(args, tag)
+		}
+	}
+
+	if len(clauses) > 0 {
+		sql += " WHERE " + strings.Join(clauses, " AND ")
+	}
+
+	// Grouping by media keeps items with several of the tags to one row, and
+	// counting their distinct tags tells which have every one
+	if len(b.tags) > 0 {
+		sql += " GROUP BY m.id"
+		if b.matchAll {
+			sql += " HAVING COUNT(DISTINCT t.name) = ?"
+			args = append(args, len(b.tags))
+		}
+	}
+	return sql, args
+}
@@ -0,0 +1,160 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/neo1908/lemmy-image-scraper/pkg/models"
+)
+
+func TestMediaQueryBuilder(t *testing.T) {
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.FixedZone("CET", 3600))
+	to := time.Date(2026, 3, 31, 23, 59, 59, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		builder  *MediaQueryBuilder
+		wantSQL  string
+		wantArgs []interface{}
+	}{
+		{
+			"no filters",
+			NewMediaQuery(),
+			"SELECT m.* FROM scraped_media m ORDER BY m.downloaded_at DESC, m.id DESC",
+			nil,
+		},
+		{
+			"empty values are left out",
+			NewMediaQuery().WithCommunity("").WithType("").WithAuthor("").WithCommunityLike("").WithFavorites(false).WithTag(" "),
+			"SELECT m.* FROM scraped_media m ORDER BY m.downloaded_at DESC, m.id DESC",
+			nil,
+		},
+		{
+			"community and type",
+			NewMediaQuery().WithCommunity("pics").WithType("image"),
+			"SELECT m.* FROM scraped_media m WHERE m.community_name = ? AND m.media_type = ? ORDER BY m.downloaded_at DESC, m.id DESC",
+			[]interface{}{"pics", "image"},
+		},
+		{
+			"partial matches, author and favorites",
+			NewMediaQuery().WithCommunityLike("pic%").WithAuthor("Bob").WithAuthorLike("b%").WithFavorites(true),
+			"SELECT m.* FROM scraped_media m WHERE m.community_name LIKE ? AND LOWER(m.author_name) = LOWER(?) AND m.author_name LIKE ? AND m.is_favorite = ? ORDER BY m.downloaded_at DESC, m.id DESC",
+			[]interface{}{"pic%", "Bob", "b%", true},
+		},
+		{
+			"date range in UTC and min score",
+			NewMediaQuery().WithDateRange(from, to).WithMinScore(0),
+			"SELECT m.* FROM scraped_media m WHERE m.downloaded_at >= ? AND m.downloaded_at <= ? AND m.post_score >= ? ORDER BY m.downloaded_at DESC, m.id DESC",
+			[]interface{}{from.UTC(), to, 0},
+		},
+		{
+			"open-ended post date range",
+			NewMediaQuery().WithPostDateRange(time.Time{}, to),
+			"SELECT m.* FROM scraped_media m WHERE m.post_created <= ? ORDER BY m.downloaded_at DESC, m.id DESC",
+			[]interface{}{to},
+		},
+		{
+			"sorted and paginated",
+			NewMediaQuery().WithCommunity("pics").OrderBy("post_score", "ASC").Paginate(20, 40),
+			"SELECT m.* FROM scraped_media m WHERE m.community_name = ? ORDER BY m.post_score ASC, m.id ASC LIMIT ? OFFSET ?",
+			[]interface{}{"pics", 20, 40},
+		},
+		{
+			"unknown sort field and direction fall back",
+			NewMediaQuery().OrderBy("file_path; DROP TABLE scraped_media", "sideways"),
+			"SELECT m.* FROM scraped_media m ORDER BY m.downloaded_at DESC, m.id DESC",
+			nil,
+		},
+		{
+			"cursor",
+			NewMediaQuery().WithType("video").WithIDAfter(100).OrderByID("ASC").Paginate(50, 0),
+			"SELECT m.* FROM scraped_media m WHERE m.media_type = ? AND m.id > ? ORDER BY m.id ASC LIMIT ? OFFSET ?",
+			[]interface{}{"video", int64(100), 50, 0},
+		},
+		{
+			"any of several tags",
+			NewMediaQuery().WithCommunity("pics").WithTag("Cat").WithTag("dog").WithTag("cat"),
+			"SELECT m.* FROM scraped_media m JOIN media_tags mt ON mt.media_id = m.id JOIN tags t ON t.id = mt.tag_id WHERE m.community_name = ? AND t.name IN (?, ?) GROUP BY m.id ORDER BY m.downloaded_at DESC, m.id DESC",
+			[]interface{}{"pics", "cat", "dog"},
+		},
+		{
+			"all of several tags",
+			NewMediaQuery().WithTag("cat").WithTag("dog").MatchAllTags(true).Paginate(10, 0),
+			"SELECT m.* FROM scraped_media m JOIN media_tags mt ON mt.media_id = m.id JOIN tags t ON t.id = mt.tag_id WHERE t.name IN (?, ?) GROUP BY m.id HAVING COUNT(DISTINCT t.name) = ? ORDER BY m.downloaded_at DESC, m.id DESC LIMIT ? OFFSET ?",
+			[]interface{}{"cat", "dog", 2, 10, 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, args := tt.builder.Build()
+			if sql != tt.wantSQL {
+				t.Errorf("SQL =\n\t%s\nwant\n\t%s", sql, tt.wantSQL)
+			}
+			if (len(args) != 0 || len(tt.wantArgs) != 0) && !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("args = %#v, want %#v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestMediaQueryBuilderCount(t *testing.T) {
+	tests := []struct {
+		name     string
+		builder  *MediaQueryBuilder
+		wantSQL  string
+		wantArgs []interface{}
+	}{
+		{
+			"ignores order and pagination",
+			NewMediaQuery().WithCommunity("pics").OrderBy("post_score", "ASC").Paginate(20, 40),
+			"SELECT COUNT(*) FROM scraped_media m WHERE m.community_name = ?",
+			[]interface{}{"pics"},
+		},
+		{
+			"counts grouped tag matches",
+			NewMediaQuery().WithTag("cat").WithTag("dog").MatchAllTags(true),
+			"SELECT COUNT(*) FROM (SELECT m.id FROM scraped_media m JOIN media_tags mt ON mt.media_id = m.id JOIN tags t ON t.id = mt.tag_id WHERE t.name IN (?, ?) GROUP BY m.id HAVING COUNT(DISTINCT t.name) = ?) AS matches",
+			[]interface{}{"cat", "dog", 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, args := tt.builder.BuildCount()
+			if sql != tt.wantSQL {
+				t.Errorf("SQL =\n\t%s\nwant\n\t%s", sql, tt.wantSQL)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("args = %#v, want %#v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestMediaQueryBuilderRunsOnSQLite(t *testing.T) {
+	db := newTestDB(t)
+	saveMediaAt(t, db, "hash1", "/media/pics/1.png")
+
+	builders := []*MediaQueryBuilder{
+		NewMediaQuery().WithCommunity("pics").WithCommunityLike("p%").WithType("image").WithDateRange(time.Now().Add(-time.Hour), time.Time{}).
+			WithMinScore(0).OrderBy("post_score", "ASC").Paginate(10, 0),
+		NewMediaQuery().WithAuthor("nobody").WithFavorites(true).WithIDAfter(0).OrderByID("ASC").Paginate(10, 0),
+		NewMediaQuery().WithTag("cat").WithTag("dog").MatchAllTags(true).Paginate(10, 0),
+	}
+	wantCounts := []int{1, 0, 0}
+	for i, b := range builders {
+		var media []models.ScrapedMedia
+		query, args := b.Build()
+		if err := db.Select(&media, query, args...); err != nil {
+			t.Errorf("builder %d: query failed: %v", i, err)
+		}
+		var count int
+		countQuery, countArgs := b.BuildCount()
+		if err := db.Get(&count, countQuery, countArgs...); err != nil {
+			t.Errorf("builder %d: count query failed: %v", i, err)
+		}
+		if len(media) != wantCounts[i] || count != wantCounts[i] {
+			t.Errorf("builder %d: %d media, count %d, want %d", i, len(media), count, wantCounts[i])
+		}
+	}
+}
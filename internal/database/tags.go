@@ -0,0 +1,68 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/neo1908/lemmy-image-scraper/pkg/models"
+)
+
+// NormalizeTag returns the form a tag is stored and matched in: trimmed and lower case
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// AddMediaTags tags a media item, creating tags that don't exist yet. Tags the
+// item already has are left as they are.
+func (db *DB) AddMediaTags(mediaID int64, tags []string) error {
+	return db.WithTx(func(tx *Tx) error {
+		for _, tag := range tags {
+			tag = NormalizeTag(tag)
+			if tag == "" {
+				continue
+			}
+			if _, err := tx.Exec(tx.Rebind(`INSERT INTO tags (name) VALUES (?) ON CONFLICT DO NOTHING`), tag); err != nil {
+				return fmt.Errorf("failed to save tag %q: %w", tag, err)
+			}
+			link := `INSERT INTO media_tags (media_id, tag_id)
+				SELECT ?, id FROM tags WHERE name = ?
+				ON CONFLICT DO NOTHING`
+			if _, err := tx.Exec(tx.Rebind(link), mediaID, tag); err != nil {
+				return fmt.Errorf("failed to tag media %d with %q: %w", mediaID, tag, err)
+			}
+		}
+		return nil
+	})
+}
+
+// GetMediaTags returns the tags of a media item in alphabetical order
+func (db *DB) GetMediaTags(mediaID int64) ([]string, error) {
+	tags := []string{}
+	query := `SELECT t.name FROM media_tags mt
+		JOIN tags t ON t.id = mt.tag_id
+		WHERE mt.media_id = ?
+		ORDER BY t.name`
+	if err := db.Select(&tags, query, mediaID); err != nil {
+		return nil, fmt.Errorf("failed to get media tags: %w", err)
+	}
+	return tags, nil
+}
+
+// GetMediaWithTags returns media tagged with any of the given tags, or with all
+// of them when matchAll is set, newest first, with the total number of matches.
+// community and mediaType are optional.
+func (db *DB) GetMediaWithTags(tags []string, matchAll bool, community, mediaType string, limit, offset int) ([]models.ScrapedMedia, int, error) {
+	if len(tags) == 0 {
+		return []models.ScrapedMedia{}, 0, nil
+	}
+	return db.GetMediaWithFilters(MediaFilter{
+		Community:    community,
+		MediaType:    mediaType,
+		Tags:         tags,
+		MatchAllTags: matchAll,
+		SortBy:       "downloaded_at",
+		SortOrder:    "DESC",
+		Limit:        limit,
+		Offset:       offset,
+	})
+}
@@ -0,0 +1,68 @@
+package database
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestGetMediaWithTagsAnyAndAll(t *testing.T) {
+	db := newTestDB(t)
+
+	tagged := map[string][]string{
+		"cat":        {"cat"},
+		"dog":        {"dog"},
+		"cat-dog":    {"cat", "dog"},
+		"cat-dog-ow": {"Cat", " dog ", "owl"},
+		"owl":        {"owl"},
+		"none":       nil,
+	}
+	ids := make(map[string]int64)
+	for name, tags := range tagged {
+		ids[name] = saveMediaAt(t, db, name, fmt.Sprintf("/media/pics/%s.png", name))
+		if err := db.AddMediaTags(ids[name], tags); err != nil {
+			t.Fatalf("AddMediaTags: %v", err)
+		}
+	}
+
+	tests := []struct {
+		tags     []string
+		matchAll bool
+		want     []string
+	}{
+		{[]string{"cat", "dog"}, false, []string{"cat", "dog", "cat-dog", "cat-dog-ow"}},
+		{[]string{"cat", "dog"}, true, []string{"cat-dog", "cat-dog-ow"}},
+		{[]string{"CAT", "dog", "owl"}, true, []string{"cat-dog-ow"}},
+		{[]string{"cat", "cat"}, true, []string{"cat", "cat-dog", "cat-dog-ow"}},
+		{[]string{"cat", "fox"}, true, nil},
+		{[]string{"cat", "fox"}, false, []string{"cat", "cat-dog", "cat-dog-ow"}},
+		{[]string{" "}, false, nil},
+	}
+	for _, tt := range tests {
+		media, total, err := db.GetMediaWithTags(tt.tags, tt.matchAll, "", "", 50, 0)
+		if err != nil {
+			t.Fatalf("GetMediaWithTags(%q, %v): %v", tt.tags, tt.matchAll, err)
+		}
+
+		want := make(map[int64]bool)
+		for _, name := range tt.want {
+			want[ids[name]] = true
+		}
+		got := make(map[int64]bool)
+		for _, m := range media {
+			if got[m.ID] {
+				t.Errorf("GetMediaWithTags(%q, %v) returned media %d twice", tt.tags, tt.matchAll, m.ID)
+			}
+			got[m.ID] = true
+		}
+		if len(got) != len(want) || total != len(want) {
+			t.Errorf("GetMediaWithTags(%q, %v) = %d media (total %d), want %v",
+				tt.tags, tt.matchAll, len(media), total, tt.want)
+			continue
+		}
+		for id := range want {
+			if !got[id] {
+				t.Errorf("GetMediaWithTags(%q, %v) is missing media %d, want %v", tt.tags, tt.matchAll, id, tt.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/neo1908/lemmy-image-scraper/pkg/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// Store is the set of operations used while scraping. Both DB and Tx implement it,
+// so the same code can run inside or outside a transaction.
+type Store interface {
+	MediaExists(hash string) (bool, error)
+	GetMediaByHash(hash string) (*models.ScrapedMedia, error)
+	SaveMedia(media *models.ScrapedMedia) error
+	LinkMediaToPost(mediaID int64, postView *models.PostView) error
+	PostExists(postID int64) (bool, error)
+	MarkPostAsScraped(postView *models.PostView, mediaCount int) error
+	SaveComment(commentView *models.CommentView) error
+	CommentsExistForPost(postID int64) (bool, error)
+	SaveCrossposts(postID int64, crossposts []models.PostView) error
+}
+
+// Tx is a database transaction. Reads through a Tx see its own uncommitted writes.
+type Tx struct {
+	*sqlx.Tx
+}
+
+// WithTx runs fn inside a transaction. The transaction is committed if fn returns
+// nil and rolled back otherwise.
+//
+// SQLite allows a single writer at a time, so writes from other connections wait
+// (up to the busy timeout) until the transaction ends. VacuumAndAnalyze waits
+// for every open transaction to end before it starts.
+func (db *DB) WithTx(fn func(tx *Tx) error) error {
+	db.txLock.RLock()
+	defer db.txLock.RUnlock()
+
+	sqlTx, err := db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	committed := false
+	defer func() {
+		if !committed {
+			if err := sqlTx.Rollback(); err != nil {
+				log.Errorf("Failed to roll back transaction: %v", err)
+			}
+		}
+	}()
+
+	if err := fn(&Tx{sqlTx}); err != nil {
+		return err
+	}
+
+	if err := sqlTx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	committed = true
+	return nil
+}
+
+// MediaExists checks if media with the given hash already exists
+func (tx *Tx) MediaExists(hash string) (bool, error) {
+	return mediaExists(tx.Tx, hash)
+}
+
+// GetMediaByHash retrieves a media record by its hash
+func (tx *Tx) GetMediaByHash(hash string) (*models.ScrapedMedia, error) {
+	return getMediaByHash(tx.Tx, hash)
+}
+
+// SaveMedia saves a scraped media record
+func (tx *Tx) SaveMedia(media *models.ScrapedMedia) error {
+	return saveMedia(tx.Tx, media)
+}
+
+// LinkMediaToPost associates an existing media record with another post
+func (tx *Tx) LinkMediaToPost(mediaID int64, postView *models.PostView) error {
+	return linkMediaToPost(tx.Tx, mediaID, postView)
+}
+
+// PostExists checks if a post has already been scraped
+func (tx *Tx) PostExists(postID int64) (bool, error) {
+	return postExists(tx.Tx, postID)
+}
+
+// MarkPostAsScraped records that we've processed a post
+func (tx *Tx) MarkPostAsScraped(postView *models.PostView, mediaCount int) error {
+	return markPostAsScraped(tx.Tx, postView, mediaCount)
+}
+
+// SaveComment saves a comment
+func (tx *Tx) SaveComment(commentView *models.CommentView) error {
+	return saveComment(tx.Tx, commentView)
+}
+
+// CommentsExistForPost checks if comments have been scraped for a post
+func (tx *Tx) CommentsExistForPost(postID int64) (bool, error) {
+	return commentsExistForPost(tx.Tx, postID)
+}
+
+// SaveCrossposts records the crossposts of a post
+func (tx *Tx) SaveCrossposts(postID int64, crossposts []models.PostView) error {
+	return saveCrossposts(tx.Tx, postID, crossposts)
+}
@@ -0,0 +1,82 @@
+package database
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// VacuumAndAnalyze rebuilds the database to reclaim the space left by deleted
+// rows and refreshes the query planner statistics. VACUUM cannot run inside a
+// transaction, so it waits until every transaction started with WithTx has ended.
+func (db *DB) VacuumAndAnalyze() error {
+	db.txLock.Lock()
+	defer db.txLock.Unlock()
+
+	before, err := db.size()
+	if err != nil {
+		return err
+	}
+
+	if db.isPostgres() {
+		if _, err := db.Exec(`VACUUM ANALYZE`); err != nil {
+			return fmt.Errorf("failed to vacuum database: %w", err)
+		}
+	} else {
+		if _, err := db.Exec(`VACUUM`); err != nil {
+			return fmt.Errorf("failed to vacuum database: %w", err)
+		}
+		if _, err := db.Exec(`ANALYZE`); err != nil {
+			return fmt.Errorf("failed to analyze database: %w", err)
+		}
+		// In WAL mode the rebuilt pages land in the log; copy them back so the file shrinks now
+		if _, err := db.Exec(`PRAGMA wal_checkpoint(TRUNCATE)`); err != nil {
+			return fmt.Errorf("failed to checkpoint database: %w", err)
+		}
+	}
+	db.deletedRows.Store(0)
+
+	after, err := db.size()
+	if err != nil {
+		return err
+	}
+	log.Infof("Vacuumed database: %d bytes before, %d bytes after", before, after)
+	return nil
+}
+
+// DeletedSinceVacuum returns how many rows bulk deletes have removed since the
+// last VacuumAndAnalyze
+func (db *DB) DeletedSinceVacuum() int64 {
+	return db.deletedRows.Load()
+}
+
+// noteDeletedRows records rows removed by a bulk delete and vacuums once
+// auto_vacuum_threshold is passed. Deletes made through DB run outside any
+// transaction, so the vacuum only has to wait for other callers' transactions.
+func (db *DB) noteDeletedRows(deleted int64) {
+	total := db.deletedRows.Add(deleted)
+	if db.autoVacuumThreshold <= 0 || total <= db.autoVacuumThreshold {
+		return
+	}
+
+	log.Infof("%d rows deleted since the last vacuum, vacuuming database", total)
+	if err := db.VacuumAndAnalyze(); err != nil {
+		log.Errorf("Automatic vacuum failed: %v", err)
+	}
+}
+
+// size returns the size of the database in bytes
+func (db *DB) size() (int64, error) {
+	var size int64
+	if db.isPostgres() {
+		if err := db.Get(&size, `SELECT pg_database_size(current_database())`); err != nil {
+			return 0, fmt.Errorf("failed to get database size: %w", err)
+		}
+		return size, nil
+	}
+
+	if err := db.Get(&size, `SELECT page_count * page_size FROM pragma_page_count(), pragma_page_size()`); err != nil {
+		return 0, fmt.Errorf("failed to get database size: %w", err)
+	}
+	return size, nil
+}
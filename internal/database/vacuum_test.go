@@ -0,0 +1,72 @@
+package database
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neo1908/lemmy-image-scraper/pkg/models"
+)
+
+func TestVacuumAndAnalyzeShrinksFile(t *testing.T) {
+	db := newTestDB(t)
+	var path string
+	if err := db.Get(&path, `SELECT file FROM pragma_database_list WHERE name = 'main'`); err != nil {
+		t.Fatalf("failed to get database path: %v", err)
+	}
+
+	err := db.WithTx(func(tx *Tx) error {
+		for i := 0; i < 1000; i++ {
+			hash := fmt.Sprintf("%064x", i)
+			err := tx.SaveMedia(&models.ScrapedMedia{
+				PostID:        int64(i),
+				CommunityName: "pics",
+				MediaURL:      "https://example.invalid/" + hash,
+				MediaHash:     hash,
+				FileName:      hash + ".jpg",
+				FilePath:      "/data/pics/" + strings.Repeat(hash, 4) + ".jpg",
+				MediaType:     "image",
+				PostCreated:   time.Now(),
+				DownloadedAt:  time.Now(),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to insert media: %v", err)
+	}
+	if _, err := db.Exec(`DELETE FROM scraped_media`); err != nil {
+		t.Fatalf("failed to delete media: %v", err)
+	}
+	// Copy the WAL back so the file holds every page the deletes freed
+	if _, err := db.Exec(`PRAGMA wal_checkpoint(TRUNCATE)`); err != nil {
+		t.Fatalf("failed to checkpoint: %v", err)
+	}
+	before := fileSize(t, path)
+
+	if err := db.VacuumAndAnalyze(); err != nil {
+		t.Fatalf("VacuumAndAnalyze: %v", err)
+	}
+	after := fileSize(t, path)
+
+	if after >= before {
+		t.Errorf("file size after vacuum = %d bytes, want less than %d", after, before)
+	}
+	if got := db.DeletedSinceVacuum(); got != 0 {
+		t.Errorf("DeletedSinceVacuum = %d, want 0", got)
+	}
+}
+
+func fileSize(t *testing.T, path string) int64 {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("failed to stat database: %v", err)
+	}
+	return info.Size()
+}
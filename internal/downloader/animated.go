@@ -0,0 +1,43 @@
+package downloader
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// isAnimated reports whether an image has more than one frame. Only GIF and
+// WebP are checked; anything else is treated as a still image.
+func isAnimated(content []byte) bool {
+	return isAnimatedGIF(content) || isAnimatedWebP(content)
+}
+
+// isAnimatedWebP reports whether content is an animated WebP. Animated files use
+// the extended format, whose VP8X chunk has an animation flag, and hold an ANIM chunk.
+func isAnimatedWebP(content []byte) bool {
+	if len(content) < 12 || string(content[0:4]) != "RIFF" || string(content[8:12]) != "WEBP" {
+		return false
+	}
+
+	// Walk the chunks: a 4-byte FourCC, a little-endian size, then the padded payload
+	for offset := 12; offset+8 <= len(content); {
+		fourCC := content[offset : offset+4]
+		size := int(binary.LittleEndian.Uint32(content[offset+4 : offset+8]))
+		payload := offset + 8
+
+		switch {
+		case bytes.Equal(fourCC, []byte("VP8X")):
+			// Bit 1 of the flags byte marks an animation
+			if payload < len(content) && content[payload]&0x02 != 0 {
+				return true
+			}
+		case bytes.Equal(fourCC, []byte("ANIM")), bytes.Equal(fourCC, []byte("ANMF")):
+			return true
+		}
+
+		if size < 0 || payload+size < payload {
+			return false
+		}
+		offset = payload + size + size%2
+	}
+	return false
+}
@@ -0,0 +1,25 @@
+package downloader
+
+import (
+	"fmt"
+	"path"
+)
+
+// CommunityAssetsDir is the storage directory community icons and banners are kept in
+const CommunityAssetsDir = ".community_assets"
+
+// SaveCommunityAsset downloads a community's icon or banner (asset is "icon" or
+// "banner") and stores it as {CommunityAssetsDir}/{community}/{asset}{ext}.
+// Unlike media it isn't deduplicated or filtered by type. It returns the storage key.
+func (d *Downloader) SaveCommunityAsset(communityName, asset, assetURL string) (string, error) {
+	content, contentType, ext, err := d.fetchImage(assetURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to download community %s: %w", asset, err)
+	}
+
+	key := path.Join(CommunityAssetsDir, sanitizePath(communityName), asset+ext)
+	if _, err := d.Storage.Put(key, content, contentType); err != nil {
+		return "", fmt.Errorf("failed to store community %s: %w", asset, err)
+	}
+	return key, nil
+}
@@ -0,0 +1,111 @@
+package downloader
+
+import (
+	"bytes"
+	"fmt"
+	"image/gif"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// execCommand creates the ffmpeg and ffprobe commands, so tests can stand in for them
+var execCommand = exec.Command
+
+// isAnimatedGIF reports whether content is a GIF with more than one frame
+func isAnimatedGIF(content []byte) bool {
+	if http.DetectContentType(content) != "image/gif" {
+		return false
+	}
+
+	decoded, err := gif.DecodeAll(bytes.NewReader(content))
+	if err != nil {
+		return false
+	}
+	return len(decoded.Image) > 1
+}
+
+// imageEncoding is how ffmpeg writes an image in one of the thumbnail formats
+type imageEncoding struct {
+	ext         string
+	contentType string
+	args        []string // ffmpeg output options
+}
+
+// imageEncodings are the formats convertImage can write, keyed by downloader.thumbnail_format
+var imageEncodings = map[string]imageEncoding{
+	"jpeg": {ext: ".jpg", contentType: "image/jpeg", args: []string{"-q:v", "3"}},
+	"webp": {ext: ".webp", contentType: "image/webp", args: []string{"-c:v", "libwebp", "-quality", "75"}},
+}
+
+// convertImage re-encodes an image in the given format using ffmpeg, returning
+// the new content, content type and file extension. Only the first frame of an
+// animated image is kept. Images already in the format are returned unchanged.
+func convertImage(content []byte, format string) ([]byte, string, string, error) {
+	encoding, ok := imageEncodings[format]
+	if !ok {
+		return nil, "", "", fmt.Errorf("unknown image format %q", format)
+	}
+	if http.DetectContentType(content) == encoding.contentType {
+		return content, encoding.contentType, encoding.ext, nil
+	}
+
+	tmpDir, err := os.MkdirTemp("", "lemmy-scraper-image-")
+	if err != nil {
+		return nil, "", "", fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	input := filepath.Join(tmpDir, "input")
+	output := filepath.Join(tmpDir, "output"+encoding.ext)
+	if err := os.WriteFile(input, content, 0644); err != nil {
+		return nil, "", "", fmt.Errorf("failed to write image: %w", err)
+	}
+
+	args := []string{"-y", "-loglevel", "error", "-i", input, "-frames:v", "1"}
+	args = append(args, encoding.args...)
+	args = append(args, output)
+	if out, err := execCommand("ffmpeg", args...).CombinedOutput(); err != nil {
+		return nil, "", "", fmt.Errorf("ffmpeg failed: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	converted, err := os.ReadFile(output)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("failed to read converted image: %w", err)
+	}
+	return converted, encoding.contentType, encoding.ext, nil
+}
+
+// convertGIFToMP4 transcodes an animated GIF to an MP4 video using ffmpeg
+func convertGIFToMP4(content []byte) ([]byte, error) {
+	tmpDir, err := os.MkdirTemp("", "lemmy-scraper-gif-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	input := filepath.Join(tmpDir, "input.gif")
+	output := filepath.Join(tmpDir, "output.mp4")
+	if err := os.WriteFile(input, content, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write GIF: %w", err)
+	}
+
+	// yuv420p needs even dimensions, so round odd sizes down
+	cmd := execCommand("ffmpeg", "-y", "-loglevel", "error",
+		"-i", input,
+		"-movflags", "faststart",
+		"-pix_fmt", "yuv420p",
+		"-vf", "scale=trunc(iw/2)*2:trunc(ih/2)*2",
+		output)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("ffmpeg failed: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	converted, err := os.ReadFile(output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read MP4: %w", err)
+	}
+	return converted, nil
+}
@@ -0,0 +1,144 @@
+package downloader
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/neo1908/lemmy-image-scraper/internal/database"
+)
+
+// mp4Video is the start of an MP4 file, enough to be detected as one
+var mp4Video = []byte("\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00mp42isom\x00\x00\x00\x08free")
+
+// fakeCommands replaces execCommand for the test with one that runs
+// TestHelperProcess in place of the program, and returns the arguments each
+// program was called with. The helper behaves as described by env.
+func fakeCommands(t *testing.T, env ...string) func() map[string][]string {
+	t.Helper()
+	var mu sync.Mutex
+	calls := map[string][]string{}
+
+	execCommand = func(name string, args ...string) *exec.Cmd {
+		mu.Lock()
+		calls[name] = args
+		mu.Unlock()
+		cmd := exec.Command(os.Args[0], append([]string{"-test.run=TestHelperProcess", "--", name}, args...)...)
+		cmd.Env = append(os.Environ(), append([]string{"GO_WANT_HELPER_PROCESS=1"}, env...)...)
+		return cmd
+	}
+	t.Cleanup(func() { execCommand = exec.Command })
+
+	return func() map[string][]string {
+		mu.Lock()
+		defer mu.Unlock()
+		return calls
+	}
+}
+
+// TestHelperProcess stands in for ffmpeg and ffprobe when run by fakeCommands
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_PROCESS") != "1" {
+		return
+	}
+	args := os.Args
+	for len(args) > 0 && args[0] != "--" {
+		args = args[1:]
+	}
+	if len(args) < 2 {
+		os.Exit(2)
+	}
+
+	switch name, args := args[1], args[2:]; name {
+	case "ffmpeg":
+		// The output file is the last argument
+		if err := os.WriteFile(args[len(args)-1], mp4Video, 0644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	case "ffprobe":
+		fmt.Print(os.Getenv("FFPROBE_OUTPUT"))
+	default:
+		os.Exit(2)
+	}
+	os.Exit(0)
+}
+
+// animatedGIF returns a two-frame GIF
+func animatedGIF(t *testing.T) []byte {
+	t.Helper()
+	palette := color.Palette{color.Black, color.White}
+	anim := &gif.GIF{Delay: []int{10, 10}}
+	for _, c := range []uint8{0, 1} {
+		frame := image.NewPaletted(image.Rect(0, 0, 2, 2), palette)
+		frame.SetColorIndex(0, 0, c)
+		anim.Image = append(anim.Image, frame)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		t.Fatalf("failed to encode GIF: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestDownloadConvertsAnimatedGIFToMP4(t *testing.T) {
+	calls := fakeCommands(t)
+	content := animatedGIF(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/gif")
+		w.Write(content)
+	}))
+	defer srv.Close()
+
+	d := newTestDownloader(t, nil)
+	d.ConvertGIFs = true
+
+	media, err := d.DownloadMedia(srv.URL+"/dance.gif", testPost(1))
+	if err != nil {
+		t.Fatalf("DownloadMedia: %v", err)
+	}
+
+	ffmpeg := strings.Join(calls()["ffmpeg"], " ")
+	for _, want := range []string{"-movflags faststart", "-pix_fmt yuv420p", ".mp4"} {
+		if !strings.Contains(ffmpeg, want) {
+			t.Errorf("ffmpeg arguments %q are missing %q", ffmpeg, want)
+		}
+	}
+
+	// The stored record describes the MP4, but keeps the GIF's hash for deduplication
+	gifHash, err := database.HashContent(bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("HashContent: %v", err)
+	}
+	if media.MediaHash != gifHash {
+		t.Errorf("media hash = %q, want the GIF's %q", media.MediaHash, gifHash)
+	}
+	stored, err := d.DB.GetMediaByHash(gifHash)
+	if err != nil || stored == nil {
+		t.Fatalf("GetMediaByHash = %v, %v, want the converted media", stored, err)
+	}
+	if stored.ID != media.ID {
+		t.Errorf("stored media ID = %d, want %d", stored.ID, media.ID)
+	}
+	if stored.FileName != "1_dance.mp4" || !strings.HasSuffix(stored.FilePath, "/1_dance.mp4") {
+		t.Errorf("file name, path = %q, %q, want 1_dance.mp4", stored.FileName, stored.FilePath)
+	}
+	if stored.MediaType != "video" || stored.MIMEType != "video/mp4" {
+		t.Errorf("media type, MIME type = %q, %q, want video, video/mp4", stored.MediaType, stored.MIMEType)
+	}
+	if stored.FileSize != int64(len(mp4Video)) {
+		t.Errorf("file size = %d, want %d", stored.FileSize, len(mp4Video))
+	}
+	if onDisk, err := os.ReadFile(stored.FilePath); err != nil || !bytes.Equal(onDisk, mp4Video) {
+		t.Errorf("stored file = %q, err = %v, want the MP4", onDisk, err)
+	}
+}
@@ -2,69 +2,216 @@ package downloader
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
-	"os"
+	"net/url"
+	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/neo1908/lemmy-image-scraper/internal/config"
 	"github.com/neo1908/lemmy-image-scraper/internal/database"
+	"github.com/neo1908/lemmy-image-scraper/internal/extractor"
+	"github.com/neo1908/lemmy-image-scraper/internal/format"
+	"github.com/neo1908/lemmy-image-scraper/internal/ratelimit"
+	"github.com/neo1908/lemmy-image-scraper/internal/singleflight"
+	"github.com/neo1908/lemmy-image-scraper/internal/storage"
 	"github.com/neo1908/lemmy-image-scraper/pkg/models"
 	log "github.com/sirupsen/logrus"
 )
 
 // Downloader handles downloading and storing media files
 type Downloader struct {
-	DB          *database.DB
-	HTTPClient  *http.Client
-	BaseDir     string
+	DB              *database.DB
+	HTTPClient      *http.Client
+	Storage         storage.Storage
+	ConvertGIFs     bool                        // Convert animated GIFs to MP4 with ffmpeg before storing
+	ProbeDuration   bool                        // Record the length of videos with ffprobe
+	Bandwidth       *ratelimit.BandwidthLimiter // Shared download bandwidth cap, nil for unlimited
+	Throttle        *ratelimit.RequestLimiter   // Request throttle shared with the API client, nil for none
+	SaveThumbnails  bool                        // Also store the post's instance-generated thumbnail with new media
+	ThumbnailFormat string                      // Re-encode saved thumbnails as "jpeg" or "webp" with ffmpeg, "" to keep them as served
+	Instance        string                      // Lemmy instance the posts were scraped from, used for post links
+	MaxFileSize     int64                       // Largest file to download in bytes (0 = unlimited)
+	SlowDownload    time.Duration               // Downloads taking longer than this are logged as slow (0 = never)
+	PreferOriginal  bool                        // Fetch the original of pict-rs images instead of a processed variant
+	NameByHash      bool                        // Name files by content hash in sharded subdirectories instead of postID_name
+	Layout          string                      // Directory layout: "community" (default), "date", "community_date" or a template
+	YtDlp           *YtDlp                      // Downloads videos from video platform pages, nil to skip them
+	UserAgent       string                      // User-Agent sent when fetching media, empty for Go's default
+
+	inflight  singleflight.Group[*models.ScrapedMedia] // Downloads in progress, keyed by media URL
+	saving    keyedMutex                               // Held by content hash from the duplicate check until the record is saved
+	uploading sync.Mutex                               // Held while an upload is given a post ID and saved
 }
 
 // New creates a new Downloader instance
-func New(db *database.DB, baseDir string) *Downloader {
+func New(db *database.DB, store storage.Storage) *Downloader {
 	return &Downloader{
 		DB: db,
 		HTTPClient: &http.Client{
 			Timeout: 60 * time.Second,
 		},
-		BaseDir: baseDir,
+		Storage: store,
 	}
 }
 
-// DownloadMedia downloads a media file from a URL and stores it with deduplication
+// NewFromConfig creates a Downloader with the settings of cfg that need no
+// external tools or shared clients: file naming, layout, post links, size
+// limits and the User-Agent. The scraper and the web server's uploads both use
+// it, so files end up in the same place whichever stored them.
+func NewFromConfig(cfg *config.Config, db *database.DB, store storage.Storage) *Downloader {
+	d := New(db, store)
+	d.SaveThumbnails = cfg.Downloader.SaveThumbnails
+	d.PreferOriginal = cfg.Downloader.PreferOriginal
+	d.NameByHash = cfg.Storage.NameByHash
+	d.Layout = cfg.Storage.Layout
+	d.Instance = cfg.Lemmy.Instance
+	d.MaxFileSize = cfg.Downloader.MaxFileSize
+	d.SlowDownload = time.Duration(cfg.Downloader.SlowDownloadThreshold)
+	d.UserAgent = cfg.Lemmy.UserAgent
+	return d
+}
+
+// DownloadMedia downloads a media file from a URL and stores it with deduplication.
+// Concurrent calls for the same URL make a single request: later callers wait
+// for the first download, have their post linked to the media it stored, and
+// get ErrMediaExists with that media, so the file is only counted once.
+//
+// The record is saved, and committed, before DownloadMedia returns, so it must
+// not be called inside a transaction: the file would be left behind if the
+// transaction rolled back, and other downloads of the same content wouldn't
+// see the record until it committed.
 func (d *Downloader) DownloadMedia(mediaURL string, postView models.PostView) (*models.ScrapedMedia, error) {
+	media, err, shared := d.inflight.Do(mediaURL, func() (*models.ScrapedMedia, error) {
+		return d.downloadMedia(mediaURL, postView)
+	})
+	if !shared || media == nil {
+		return media, err
+	}
+
+	// The media records the first caller's post; this one is only linked to it
+	log.Debugf("Shared in-progress download of %s", mediaURL)
+	if media.PostID != postView.Post.ID {
+		if err := d.DB.LinkMediaToPost(media.ID, &postView); err != nil {
+			log.Warnf("Failed to link media %d to post %d: %v", media.ID, postView.Post.ID, err)
+		}
+	}
+	if err == nil {
+		err = fmt.Errorf("%w (shared download of %s)", ErrMediaExists, mediaURL)
+	}
+	return media, err
+}
+
+// downloadMedia downloads and stores a single media file
+func (d *Downloader) downloadMedia(mediaURL string, postView models.PostView) (*models.ScrapedMedia, error) {
 	// Skip empty URLs
 	if mediaURL == "" {
-		return nil, fmt.Errorf("empty media URL")
+		return nil, fmt.Errorf("%w: empty media URL", ErrDownloadFailed)
 	}
 
 	log.Debugf("Attempting to download media from: %s", mediaURL)
 
+	// Video platform pages are handed to yt-dlp, which finds and downloads the video
+	if d.YtDlp != nil && extractor.IsVideoPageURL(mediaURL) {
+		start := time.Now()
+		content, contentType, err := d.YtDlp.Download(mediaURL, d.MaxFileSize)
+		if err != nil {
+			return nil, err
+		}
+		elapsed := time.Since(start)
+		d.logSlowDownload(mediaURL, len(content), elapsed)
+		return d.storeMedia(mediaURL, content, contentType, elapsed, postView)
+	}
+
+	// The record keeps the post's URL, so it's still recognised on later runs
+	fetchURL := mediaURL
+	if d.PreferOriginal {
+		if original, ok := extractor.PictrsOriginalURL(mediaURL); ok {
+			log.Infof("Downloading original of pict-rs image %s from %s", mediaURL, original)
+			fetchURL = original
+		}
+	}
+
 	// Download the file content
-	resp, err := d.HTTPClient.Get(mediaURL)
+	if err := d.Throttle.Wait(context.Background()); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDownloadFailed, err)
+	}
+	// Timed from the request to the last byte, after waiting for the throttle
+	start := time.Now()
+	resp, err := d.get(fetchURL)
 	if err != nil {
-		return nil, fmt.Errorf("failed to download media: %w", err)
+		return nil, fmt.Errorf("%w: %w", ErrDownloadFailed, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("download failed with status %d", resp.StatusCode)
+		return nil, fmt.Errorf("%w: status %d", ErrDownloadFailed, resp.StatusCode)
 	}
 
-	// Read content into memory for hashing and writing
-	content, err := io.ReadAll(resp.Body)
+	if d.MaxFileSize > 0 && resp.ContentLength > d.MaxFileSize {
+		return nil, fmt.Errorf("%w: %d bytes (limit %d)", ErrTooLarge, resp.ContentLength, d.MaxFileSize)
+	}
+
+	// Read content into memory for hashing and writing. The length header is
+	// optional, so reading stops one byte past the limit to catch larger files.
+	body := d.Bandwidth.Reader(resp.Request.Context(), resp.Body)
+	if d.MaxFileSize > 0 {
+		body = io.LimitReader(body, d.MaxFileSize+1)
+	}
+	content, err := io.ReadAll(body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read media content: %w", err)
+		return nil, fmt.Errorf("%w: failed to read media content: %w", ErrDownloadFailed, err)
+	}
+	if d.MaxFileSize > 0 && int64(len(content)) > d.MaxFileSize {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrTooLarge, d.MaxFileSize)
+	}
+	elapsed := time.Since(start)
+	d.logSlowDownload(fetchURL, len(content), elapsed)
+
+	if strings.HasPrefix(http.DetectContentType(content), "text/html") {
+		return nil, fmt.Errorf("%w: got an HTML page", ErrUnsupportedType)
 	}
 
+	return d.storeMedia(mediaURL, content, resp.Header.Get("Content-Type"), elapsed, postView)
+}
+
+// logSlowDownload warns about a download that took longer than SlowDownload,
+// naming the host so slow ones can be spotted
+func (d *Downloader) logSlowDownload(mediaURL string, size int, elapsed time.Duration) {
+	if d.SlowDownload <= 0 || elapsed <= d.SlowDownload {
+		return
+	}
+	host := mediaURL
+	if u, err := url.Parse(mediaURL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	speed := int64(float64(size) / elapsed.Seconds())
+	log.Warnf("Slow download from %s: %s in %s (%s/s): %s",
+		host, format.FileSize(int64(size)), elapsed.Round(time.Millisecond), format.FileSize(speed), mediaURL)
+}
+
+// storeMedia stores downloaded content and records it for the post, unless a
+// file with the same content is already archived. elapsed is how long the
+// download took.
+func (d *Downloader) storeMedia(mediaURL string, content []byte, contentType string, elapsed time.Duration, postView models.PostView) (*models.ScrapedMedia, error) {
 	// Calculate hash
 	hash, err := database.HashContent(bytes.NewReader(content))
 	if err != nil {
 		return nil, fmt.Errorf("failed to hash content: %w", err)
 	}
 
+	// The same file can arrive from different URLs at once. Only one download
+	// per hash gets past the duplicate check until its record is saved; the
+	// others then find it and are linked to it instead.
+	unlock := d.saving.Lock(hash)
+	defer unlock()
+
 	// Check if media already exists
 	exists, err := d.DB.MediaExists(hash)
 	if err != nil {
@@ -77,12 +224,19 @@ func (d *Downloader) DownloadMedia(mediaURL string, postView models.PostView) (*
 		if err != nil {
 			return nil, fmt.Errorf("failed to get existing media: %w", err)
 		}
-		return existing, nil
+		// Keep provenance when the same file shows up in another post
+		if existing != nil && existing.PostID != postView.Post.ID {
+			if err := d.DB.LinkMediaToPost(existing.ID, &postView); err != nil {
+				log.Warnf("Failed to link media %d to post %d: %v", existing.ID, postView.Post.ID, err)
+			}
+		}
+		return existing, fmt.Errorf("%w (hash: %s)", ErrMediaExists, hash[:16])
 	}
 
 	// Determine media type and file extension
-	mediaType := determineMediaType(resp.Header.Get("Content-Type"), mediaURL)
-	fileExt := getFileExtension(resp.Header.Get("Content-Type"), mediaURL)
+	mediaType := DetectMediaType(content, contentType, mediaURL)
+	mimeType := DetectMIMEType(content, contentType)
+	fileExt := getFileExtension(contentType, mediaURL)
 
 	// Create filename: postID_originalname or postID.ext
 	originalName := filepath.Base(mediaURL)
@@ -93,19 +247,51 @@ func (d *Downloader) DownloadMedia(mediaURL string, postView models.PostView) (*
 	if !strings.Contains(fileName, ".") {
 		fileName = fmt.Sprintf("%d%s", postView.Post.ID, fileExt)
 	}
+	if d.NameByHash {
+		fileName = database.HashFileName(hash, fileExt)
+	}
+
+	// Animated GIFs are stored as MP4, which is typically many times smaller.
+	// The hash stays that of the original GIF so re-downloads are still deduplicated.
+	if d.ConvertGIFs && isAnimatedGIF(content) {
+		converted, err := convertGIFToMP4(content)
+		if err != nil {
+			log.Warnf("Failed to convert GIF to MP4, keeping original: %v", err)
+		} else {
+			log.Infof("Converted GIF to MP4: %s (%d -> %d bytes)", fileName, len(content), len(converted))
+			content = converted
+			contentType = "video/mp4"
+			mimeType = "video/mp4"
+			mediaType = "video"
+			fileName = strings.TrimSuffix(fileName, filepath.Ext(fileName)) + ".mp4"
+		}
+	}
 
-	// Create community directory
-	communityDir := filepath.Join(d.BaseDir, sanitizePath(postView.Community.Name))
-	if err := os.MkdirAll(communityDir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create community directory: %w", err)
+	// A failed probe only leaves the duration unknown
+	var duration float64
+	if d.ProbeDuration && mediaType == "video" {
+		if duration, err = probeDuration(content); err != nil {
+			log.Warnf("Failed to get duration of %s: %v", fileName, err)
+		}
 	}
 
-	// Full file path
-	filePath := filepath.Join(communityDir, fileName)
+	// Files are grouped into directories by community and/or date within the storage backend
+	dir := d.mediaDir(postView.Community.Name, postView.Post.Published)
+	key := path.Join(dir, fileName)
+
+	// Write file to storage
+	filePath, err := d.Storage.Put(key, content, contentType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store file: %w", err)
+	}
 
-	// Write file to disk
-	if err := os.WriteFile(filePath, content, 0644); err != nil {
-		return nil, fmt.Errorf("failed to write file: %w", err)
+	// The instance's thumbnail lets the web UI show a small preview instead of the full file
+	thumbnailFile := ""
+	if d.SaveThumbnails && postView.Post.ThumbnailURL != "" && postView.Post.ThumbnailURL != mediaURL {
+		thumbnailFile, err = d.saveThumbnail(postView, dir, fileName)
+		if err != nil {
+			log.Warnf("Failed to save thumbnail for post %d: %v", postView.Post.ID, err)
+		}
 	}
 
 	// Create database record
@@ -122,16 +308,28 @@ func (d *Downloader) DownloadMedia(mediaURL string, postView models.PostView) (*
 		FilePath:      filePath,
 		FileSize:      int64(len(content)),
 		MediaType:     mediaType,
-		PostURL:       mediaURL,
+		PostURL:       fmt.Sprintf("https://%s/post/%d", d.Instance, postView.Post.ID),
 		PostScore:     postView.Counts.Score,
+		PostUpvotes:   postView.Counts.Upvotes,
+		PostDownvotes: postView.Counts.Downvotes,
+		PostComments:  postView.Counts.Comments,
+		MIMEType:      mimeType,
 		PostCreated:   postView.Post.Published,
-		DownloadedAt:  time.Now(),
+		DownloadedAt:  time.Now().UTC(),
+		ThumbnailFile: thumbnailFile,
+		PostApID:      postView.Post.ApID,
+		Animated:      mediaType == "image" && isAnimated(content),
+		DurationSeconds: duration,
+		DownloadMS:    elapsed.Milliseconds(),
 	}
 
 	// Save to database
 	if err := d.DB.SaveMedia(scrapedMedia); err != nil {
-		// Clean up file if database save fails
-		os.Remove(filePath)
+		// Clean up files if database save fails
+		d.Storage.Delete(key)
+		if thumbnailFile != "" {
+			d.Storage.Delete(path.Join(dir, thumbnailFile))
+		}
 		return nil, fmt.Errorf("failed to save media to database: %w", err)
 	}
 
@@ -139,6 +337,135 @@ func (d *Downloader) DownloadMedia(mediaURL string, postView models.PostView) (*
 	return scrapedMedia, nil
 }
 
+// thumbnailDir is the directory within each community that thumbnails are stored in
+const thumbnailDir = "thumbnails"
+
+// saveThumbnail downloads the post's thumbnail and stores it next to the media
+// file in dir. It returns the thumbnail's path relative to dir.
+func (d *Downloader) saveThumbnail(postView models.PostView, dir, mediaFileName string) (string, error) {
+	content, contentType, ext, err := d.fetchImage(postView.Post.ThumbnailURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to download thumbnail: %w", err)
+	}
+
+	// A thumbnail that fails to convert is still better than none
+	if d.ThumbnailFormat != "" {
+		converted, convertedType, convertedExt, err := convertImage(content, d.ThumbnailFormat)
+		if err != nil {
+			log.Warnf("Failed to convert thumbnail to %s, keeping original: %v", d.ThumbnailFormat, err)
+		} else {
+			content, contentType, ext = converted, convertedType, convertedExt
+		}
+	}
+
+	// Named after the media file, with the thumbnail's own extension
+	file := path.Join(thumbnailDir, strings.TrimSuffix(mediaFileName, filepath.Ext(mediaFileName))+ext)
+
+	key := path.Join(dir, file)
+	if _, err := d.Storage.Put(key, content, contentType); err != nil {
+		return "", fmt.Errorf("failed to store thumbnail: %w", err)
+	}
+	return file, nil
+}
+
+// get sends a GET request for a media file with the configured User-Agent
+func (d *Downloader) get(rawURL string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if d.UserAgent != "" {
+		req.Header.Set("User-Agent", d.UserAgent)
+	}
+	return d.HTTPClient.Do(req)
+}
+
+// fetchImage downloads a small image such as a thumbnail, returning its
+// content, content type and file extension. Anything but an image is an error.
+func (d *Downloader) fetchImage(imageURL string) ([]byte, string, string, error) {
+	if err := d.Throttle.Wait(context.Background()); err != nil {
+		return nil, "", "", err
+	}
+	resp, err := d.get(imageURL)
+	if err != nil {
+		return nil, "", "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", "", fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	content, err := io.ReadAll(d.Bandwidth.Reader(resp.Request.Context(), resp.Body))
+	if err != nil {
+		return nil, "", "", err
+	}
+	if sniffMediaType(content) != "image" {
+		return nil, "", "", fmt.Errorf("not an image")
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	return content, contentType, getFileExtension(contentType, strings.Split(imageURL, "?")[0]), nil
+}
+
+// DetectMediaType determines the media type from the file content, falling back to
+// the content type and URL when the content is not recognised
+func DetectMediaType(content []byte, contentType, url string) string {
+	if mediaType := sniffMediaType(content); mediaType != "" {
+		return mediaType
+	}
+	return determineMediaType(contentType, url)
+}
+
+// DetectMIMEType determines the MIME type from the file content, falling back to
+// the Content-Type header when the content is not recognised. It returns an empty
+// string if neither says more than "binary data".
+func DetectMIMEType(content []byte, contentType string) string {
+	// HEIF-based images share the ftyp box with MP4, which the standard sniffer reads as video
+	if len(content) >= 12 && string(content[4:8]) == "ftyp" {
+		switch string(content[8:12]) {
+		case "avif", "avis":
+			return "image/avif"
+		case "heic", "heix", "mif1", "msf1":
+			return "image/heic"
+		}
+	}
+
+	sniffed := http.DetectContentType(content)
+	if sniffed != "application/octet-stream" && !strings.HasPrefix(sniffed, "text/plain") {
+		return sniffed
+	}
+
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil && mediaType != "application/octet-stream" {
+		return mediaType
+	}
+	return ""
+}
+
+// sniffMediaType identifies images and videos from their magic bytes.
+// It returns an empty string if the content is not recognised.
+func sniffMediaType(content []byte) string {
+	// MP4, MOV and HEIF-based images all start with an ftyp box
+	if len(content) >= 12 && string(content[4:8]) == "ftyp" {
+		switch string(content[8:12]) {
+		case "avif", "avis", "heic", "heix", "mif1", "msf1":
+			return "image"
+		default:
+			return "video"
+		}
+	}
+
+	sniffed := http.DetectContentType(content)
+	switch {
+	case strings.HasPrefix(sniffed, "image/"):
+		return "image"
+	case strings.HasPrefix(sniffed, "video/"):
+		return "video"
+	default:
+		return ""
+	}
+}
+
 // determineMediaType determines the media type from content type and URL
 func determineMediaType(contentType, url string) string {
 	contentType = strings.ToLower(contentType)
@@ -147,11 +474,13 @@ func determineMediaType(contentType, url string) string {
 	if strings.Contains(contentType, "image") ||
 	   strings.HasSuffix(url, ".jpg") || strings.HasSuffix(url, ".jpeg") ||
 	   strings.HasSuffix(url, ".png") || strings.HasSuffix(url, ".gif") ||
-	   strings.HasSuffix(url, ".webp") || strings.HasSuffix(url, ".bmp") {
+	   strings.HasSuffix(url, ".webp") || strings.HasSuffix(url, ".bmp") ||
+	   strings.HasSuffix(url, ".avif") || strings.HasSuffix(url, ".heic") ||
+	   strings.HasSuffix(url, ".heif") {
 		return "image"
 	}
 
-	if strings.Contains(contentType, "video") ||
+	if strings.Contains(contentType, "video") || extractor.IsVideoPageURL(url) ||
 	   strings.HasSuffix(url, ".mp4") || strings.HasSuffix(url, ".webm") ||
 	   strings.HasSuffix(url, ".mov") || strings.HasSuffix(url, ".avi") ||
 	   strings.HasSuffix(url, ".mkv") || strings.HasSuffix(url, ".m4v") {
@@ -182,10 +511,20 @@ func getFileExtension(contentType, url string) string {
 		return ".gif"
 	case strings.Contains(contentType, "webp"):
 		return ".webp"
+	case strings.Contains(contentType, "avif"):
+		return ".avif"
+	case strings.Contains(contentType, "heic"):
+		return ".heic"
+	case strings.Contains(contentType, "heif"):
+		return ".heif"
 	case strings.Contains(contentType, "mp4"):
 		return ".mp4"
 	case strings.Contains(contentType, "webm"):
 		return ".webm"
+	case strings.Contains(contentType, "matroska"):
+		return ".mkv"
+	case strings.Contains(contentType, "quicktime"):
+		return ".mov"
 	default:
 		return ".bin"
 	}
@@ -0,0 +1,262 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/neo1908/lemmy-image-scraper/internal/config"
+	"github.com/neo1908/lemmy-image-scraper/internal/database"
+	"github.com/neo1908/lemmy-image-scraper/internal/storage"
+	"github.com/neo1908/lemmy-image-scraper/pkg/models"
+)
+
+// pngImage is a 1x1 PNG
+var pngImage = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x06\x00\x00\x00\x1f\x15\xc4\x89" +
+	"\x00\x00\x00\rIDATx\x9cc\xf8\x0f\x00\x00\x01\x01\x00\x05\x18\xd8N\x00\x00\x00\x00IEND\xaeB`\x82")
+
+// newTestDownloader returns a downloader configured by configure, if given,
+// with a fresh database and local storage in a temporary directory
+func newTestDownloader(t *testing.T, configure func(cfg *config.Config)) *Downloader {
+	t.Helper()
+	dir := t.TempDir()
+
+	cfg := &config.Config{}
+	cfg.Storage.BaseDirectory = dir
+	if configure != nil {
+		configure(cfg)
+	}
+	cfg.SetDefaults()
+	cfg.Database.Path = dir + "/test.db"
+
+	db, err := database.New(&cfg.Database, false)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	store, err := storage.NewLocal(dir)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	return NewFromConfig(cfg, db, store)
+}
+
+// slowStorage is storage that takes a while to store each file
+type slowStorage struct {
+	storage.Storage
+}
+
+func (s slowStorage) Put(key string, data []byte, contentType string) (string, error) {
+	time.Sleep(20 * time.Millisecond)
+	return s.Storage.Put(key, data, contentType)
+}
+
+// testPost returns a post in the community "pics"
+func testPost(id int64) models.PostView {
+	return models.PostView{
+		Post:      models.Post{ID: id, Name: "A picture", Published: time.Now().UTC()},
+		Community: models.Community{ID: 1, Name: "pics"},
+	}
+}
+
+func TestConcurrentDownloadsOfOneURLMakeOneRequest(t *testing.T) {
+	var requests atomic.Int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(pngImage)
+	}))
+	defer srv.Close()
+
+	// Each caller downloads the URL for a different post
+	d := newTestDownloader(t, nil)
+	const callers = 5
+	results := make([]*models.ScrapedMedia, callers)
+	errs := make([]error, callers)
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = d.DownloadMedia(srv.URL+"/image.png", testPost(int64(i+1)))
+		}(i)
+	}
+
+	// Hold the response until every caller has had time to join the download
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := requests.Load(); n != 1 {
+		t.Errorf("made %d requests, want 1", n)
+	}
+
+	// One caller downloaded it; the others are skips, so it's counted once
+	var stored *models.ScrapedMedia
+	for i := range results {
+		switch {
+		case errs[i] == nil:
+			if stored != nil {
+				t.Errorf("caller %d also stored the media", i)
+			}
+			stored = results[i]
+		case !errors.Is(errs[i], ErrMediaExists):
+			t.Errorf("caller %d: err = %v, want ErrMediaExists", i, errs[i])
+		}
+	}
+	if stored == nil {
+		t.Fatal("no caller stored the media")
+	}
+	for i := range results {
+		if results[i] == nil || results[i].ID != stored.ID {
+			t.Errorf("caller %d got media %v, want %d", i, results[i], stored.ID)
+		}
+	}
+
+	// Every post is linked to the one file
+	posts, err := d.DB.GetPostsForMedia(stored.ID)
+	if err != nil {
+		t.Fatalf("GetPostsForMedia: %v", err)
+	}
+	linked := make(map[int64]bool)
+	for _, p := range posts {
+		linked[p.PostID] = true
+	}
+	for id := int64(1); id <= callers; id++ {
+		if !linked[id] {
+			t.Errorf("post %d not linked to the media", id)
+		}
+	}
+}
+
+func TestUploadFollowsLayout(t *testing.T) {
+	d := newTestDownloader(t, func(cfg *config.Config) {
+		cfg.Storage.Layout = "community_date"
+	})
+
+	media, err := d.StoreUpload(pngImage, Upload{FileName: "pixel.png", ContentType: "image/png", CommunityName: "pics"})
+	if err != nil {
+		t.Fatalf("StoreUpload: %v", err)
+	}
+
+	want := d.Storage.Location(path.Join("pics", time.Now().UTC().Format("2006/01/02"), media.FileName))
+	if media.FilePath != want {
+		t.Errorf("file path = %s, want %s", media.FilePath, want)
+	}
+	if _, err := os.Stat(want); err != nil {
+		t.Errorf("uploaded file not stored: %v", err)
+	}
+}
+
+func TestConcurrentIdenticalDownloadsStoreOneRecord(t *testing.T) {
+	const callers = 8
+
+	// Every URL serves the same file, so each download is a separate request
+	// that only the hash lock can deduplicate. Responses are held until every
+	// request has arrived, so the files reach the duplicate check together.
+	var arrived sync.WaitGroup
+	arrived.Add(callers)
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived.Done()
+		<-release
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(pngImage)
+	}))
+	defer srv.Close()
+
+	// A slow write leaves time for the others to pass an unguarded duplicate check
+	d := newTestDownloader(t, nil)
+	d.Storage = slowStorage{d.Storage}
+	errs := make([]error, callers+1)
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = d.DownloadMedia(fmt.Sprintf("%s/image%d.png", srv.URL, i), testPost(int64(i+1)))
+		}(i)
+	}
+
+	// Uploading the same file at the same time must not add another record either
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		<-release
+		_, errs[callers] = d.StoreUpload(pngImage, Upload{FileName: "pixel.png", ContentType: "image/png", CommunityName: "pics"})
+	}()
+
+	arrived.Wait()
+	close(release)
+	wg.Wait()
+
+	stored := 0
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			stored++
+		case !errors.Is(err, ErrMediaExists):
+			t.Errorf("call %d: %v", i, err)
+		}
+	}
+	if stored != 1 {
+		t.Errorf("%d calls stored the file, want 1", stored)
+	}
+
+	var records int
+	if err := d.DB.Get(&records, `SELECT COUNT(*) FROM scraped_media`); err != nil {
+		t.Fatalf("failed to count media: %v", err)
+	}
+	if records != 1 {
+		t.Errorf("%d media records, want 1", records)
+	}
+}
+
+func TestDetectAVIFAndHEIC(t *testing.T) {
+	// HEIF-based images start with an ftyp box naming their brand
+	ftyp := func(brand string) []byte {
+		return []byte("\x00\x00\x00\x1cftyp" + brand + "\x00\x00\x00\x00mif1miaf")
+	}
+
+	tests := []struct {
+		name        string
+		content     []byte
+		contentType string
+		url         string
+		mediaType   string
+		mimeType    string
+		ext         string
+	}{
+		{"avif content", ftyp("avif"), "", "https://example.com/image", "image", "image/avif", ".bin"},
+		{"heic content", ftyp("heic"), "", "https://example.com/image", "image", "image/heic", ".bin"},
+		{"avif content type", nil, "image/avif", "https://example.com/image", "image", "image/avif", ".avif"},
+		{"heic content type", nil, "image/heic", "https://example.com/image", "image", "image/heic", ".heic"},
+		{"heif content type", nil, "image/heif", "https://example.com/image", "image", "image/heif", ".heif"},
+		{"avif url", nil, "application/octet-stream", "https://example.com/a.AVIF", "image", "", ".AVIF"},
+		{"heic url", nil, "", "https://example.com/a.heic", "image", "", ".heic"},
+		{"heif url", nil, "", "https://example.com/a.heif", "image", "", ".heif"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectMediaType(tt.content, tt.contentType, tt.url); got != tt.mediaType {
+				t.Errorf("DetectMediaType = %q, want %q", got, tt.mediaType)
+			}
+			if got := DetectMIMEType(tt.content, tt.contentType); got != tt.mimeType {
+				t.Errorf("DetectMIMEType = %q, want %q", got, tt.mimeType)
+			}
+			if got := getFileExtension(tt.contentType, tt.url); got != tt.ext {
+				t.Errorf("getFileExtension = %q, want %q", got, tt.ext)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package downloader
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// ffprobeOutput is the part of ffprobe's -show_format JSON that's used
+type ffprobeOutput struct {
+	Format struct {
+		Duration string `json:"duration"`
+	} `json:"format"`
+}
+
+// probeDuration returns the length of a video in seconds using ffprobe. The
+// content is written to a temp file, as MP4s with the index at the end can't
+// be probed from a pipe.
+func probeDuration(content []byte) (float64, error) {
+	tmpDir, err := os.MkdirTemp("", "lemmy-scraper-probe-")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	input := filepath.Join(tmpDir, "video")
+	if err := os.WriteFile(input, content, 0644); err != nil {
+		return 0, fmt.Errorf("failed to write video: %w", err)
+	}
+
+	out, err := execCommand("ffprobe", "-v", "quiet", "-print_format", "json", "-show_format", input).Output()
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe failed: %w", err)
+	}
+	return parseFFprobeDuration(out)
+}
+
+// parseFFprobeDuration reads format.duration from ffprobe's JSON output
+func parseFFprobeDuration(out []byte) (float64, error) {
+	var probe ffprobeOutput
+	if err := json.Unmarshal(out, &probe); err != nil {
+		return 0, fmt.Errorf("failed to parse ffprobe output: %w", err)
+	}
+	if probe.Format.Duration == "" {
+		return 0, fmt.Errorf("ffprobe reported no duration")
+	}
+
+	duration, err := strconv.ParseFloat(probe.Format.Duration, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q: %w", probe.Format.Duration, err)
+	}
+	return duration, nil
+}
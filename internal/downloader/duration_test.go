@@ -0,0 +1,80 @@
+package downloader
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// ffprobeJSON is the output of ffprobe -v quiet -print_format json -show_format for a short MP4
+const ffprobeJSON = `{
+    "format": {
+        "filename": "/tmp/lemmy-scraper-probe-1234/video",
+        "nb_streams": 2,
+        "nb_programs": 0,
+        "format_name": "mov,mp4,m4a,3gp,3g2,mj2",
+        "format_long_name": "QuickTime / MOV",
+        "start_time": "0.000000",
+        "duration": "12.345000",
+        "size": "1048576",
+        "bit_rate": "679522",
+        "probe_score": 100,
+        "tags": {
+            "major_brand": "isom",
+            "minor_version": "512",
+            "compatible_brands": "isomiso2avc1mp41",
+            "encoder": "Lavf60.16.100"
+        }
+    }
+}`
+
+func TestParseFFprobeDuration(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		want    float64
+		wantErr bool
+	}{
+		{"mp4", ffprobeJSON, 12.345, false},
+		{"no duration", `{"format": {"format_name": "png_pipe"}}`, 0, true},
+		{"invalid duration", `{"format": {"duration": "N/A"}}`, 0, true},
+		{"not json", "", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseFFprobeDuration([]byte(tt.output))
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("parseFFprobeDuration = %v, %v, want %v (error: %v)", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDownloadRecordsVideoDuration(t *testing.T) {
+	calls := fakeCommands(t, "FFPROBE_OUTPUT="+ffprobeJSON)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "video/mp4")
+		w.Write(mp4Video)
+	}))
+	defer srv.Close()
+
+	d := newTestDownloader(t, nil)
+	d.ProbeDuration = true
+
+	media, err := d.DownloadMedia(srv.URL+"/clip.mp4", testPost(1))
+	if err != nil {
+		t.Fatalf("DownloadMedia: %v", err)
+	}
+
+	if got := strings.Join(calls()["ffprobe"], " "); !strings.HasPrefix(got, "-v quiet -print_format json -show_format ") {
+		t.Errorf("ffprobe arguments = %q", got)
+	}
+	stored, err := d.DB.GetMediaByHash(media.MediaHash)
+	if err != nil || stored == nil {
+		t.Fatalf("GetMediaByHash = %v, %v, want the video", stored, err)
+	}
+	if stored.MediaType != "video" || stored.DurationSeconds != 12.345 {
+		t.Errorf("media type, duration = %q, %v, want video, 12.345", stored.MediaType, stored.DurationSeconds)
+	}
+}
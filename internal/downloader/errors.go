@@ -0,0 +1,22 @@
+package downloader
+
+import "errors"
+
+// Errors returned by DownloadMedia, wrapped with more detail. Check them with errors.Is.
+var (
+	// ErrMediaExists means the file's hash is already archived. The existing
+	// media is linked to the new post and returned with the error, but nothing
+	// new is stored.
+	ErrMediaExists = errors.New("media already exists")
+
+	// ErrTooLarge means the file is bigger than the downloader's MaxFileSize
+	ErrTooLarge = errors.New("media too large")
+
+	// ErrUnsupportedType means the URL returned something that isn't media,
+	// such as the HTML error page some hosts serve for deleted images
+	ErrUnsupportedType = errors.New("unsupported media type")
+
+	// ErrDownloadFailed means the file could not be fetched, e.g. a network
+	// error or a non-200 status
+	ErrDownloadFailed = errors.New("failed to download media")
+)
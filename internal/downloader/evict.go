@@ -0,0 +1,60 @@
+package downloader
+
+import (
+	"fmt"
+
+	"github.com/neo1908/lemmy-image-scraper/internal/format"
+	log "github.com/sirupsen/logrus"
+)
+
+// evictionBatchSize is how many eviction candidates are loaded at a time
+const evictionBatchSize = 100
+
+// Evict deletes media, file and record, in the order of the eviction policy
+// until the archive is no larger than maxTotalSize bytes. Favorites are kept,
+// so the archive can stay over the limit if they alone exceed it. It returns
+// how many media items were deleted and how many bytes they took up.
+func (d *Downloader) Evict(maxTotalSize int64, policy string) (evicted int, freed int64, err error) {
+	total, err := d.DB.TotalMediaSize()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for total > maxTotalSize {
+		candidates, err := d.DB.SelectForEviction(policy, evictionBatchSize)
+		if err != nil {
+			return evicted, freed, err
+		}
+		if len(candidates) == 0 {
+			log.Warnf("Archive is %s, over the %s limit, but only favorites are left",
+				format.FileSize(total), format.FileSize(maxTotalSize))
+			break
+		}
+
+		for _, media := range candidates {
+			if total <= maxTotalSize {
+				break
+			}
+
+			// The record goes first, so a file that fails to delete is only an orphan
+			if err := d.DB.DeleteMedia(media.ID); err != nil {
+				return evicted, freed, fmt.Errorf("failed to evict media %d: %w", media.ID, err)
+			}
+			if err := d.Storage.Delete(MediaKey(d.Storage, &media)); err != nil {
+				log.Warnf("Failed to delete evicted file %s: %v", media.FileName, err)
+			}
+			if thumbnail := ThumbnailKey(d.Storage, &media); thumbnail != "" {
+				if err := d.Storage.Delete(thumbnail); err != nil {
+					log.Warnf("Failed to delete thumbnail of evicted file %s: %v", media.FileName, err)
+				}
+			}
+
+			log.Debugf("Evicted %s (%s)", media.FileName, format.FileSize(media.FileSize))
+			total -= media.FileSize
+			freed += media.FileSize
+			evicted++
+		}
+	}
+
+	return evicted, freed, nil
+}
@@ -0,0 +1,61 @@
+package downloader
+
+import (
+	"path"
+	"strings"
+	"time"
+
+	"github.com/neo1908/lemmy-image-scraper/internal/storage"
+	"github.com/neo1908/lemmy-image-scraper/pkg/models"
+)
+
+// layoutTemplates are the named storage.layout values and the directory
+// template each one stands for
+var layoutTemplates = map[string]string{
+	"community":      "{community}",
+	"date":           "{year}/{month}/{day}",
+	"community_date": "{community}/{year}/{month}/{day}",
+}
+
+// mediaDir returns the directory below the storage root that media from a
+// community's post is stored in, following the configured layout. Dates are
+// those of the post, in UTC.
+func (d *Downloader) mediaDir(community string, posted time.Time) string {
+	layout := d.Layout
+	if template, ok := layoutTemplates[layout]; ok {
+		layout = template
+	}
+	if layout == "" {
+		layout = layoutTemplates["community"]
+	}
+
+	posted = posted.UTC()
+	dir := strings.NewReplacer(
+		"{community}", sanitizePath(community),
+		"{year}", posted.Format("2006"),
+		"{month}", posted.Format("01"),
+		"{day}", posted.Format("02"),
+	).Replace(layout)
+	return path.Clean(dir)
+}
+
+// MediaKey returns the storage key of a media record's file. Its directory
+// depends on the layout when it was downloaded, so the key is worked out from
+// the recorded location. Records whose location isn't in the storage, e.g.
+// after the base directory moved, fall back to the community layout.
+func MediaKey(store storage.Storage, media *models.ScrapedMedia) string {
+	if key, ok := store.Key(media.FilePath); ok {
+		return key
+	}
+	return path.Join(sanitizePath(media.CommunityName), media.FileName)
+}
+
+// ThumbnailKey returns the storage key of a media record's thumbnail, which is
+// stored relative to the media file's directory, or "" if it has none
+func ThumbnailKey(store storage.Storage, media *models.ScrapedMedia) string {
+	if media.ThumbnailFile == "" {
+		return ""
+	}
+	dir := strings.TrimSuffix(strings.TrimSuffix(MediaKey(store, media), media.FileName), "/")
+	return path.Join(dir, media.ThumbnailFile)
+}
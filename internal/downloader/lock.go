@@ -0,0 +1,44 @@
+package downloader
+
+import "sync"
+
+// keyedMutex is a set of mutexes, one per key, created on demand and dropped
+// once nobody holds or waits for them. The zero value is ready to use.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+// keyedLock is the mutex of one key and how many callers hold or wait for it
+type keyedLock struct {
+	sync.Mutex
+	refs int
+}
+
+// Lock locks key, waiting while another caller holds it, and returns the
+// function that unlocks it again
+func (k *keyedMutex) Lock(key string) (unlock func()) {
+	k.mu.Lock()
+	if k.locks == nil {
+		k.locks = make(map[string]*keyedLock)
+	}
+	lock, ok := k.locks[key]
+	if !ok {
+		lock = &keyedLock{}
+		k.locks[key] = lock
+	}
+	lock.refs++
+	k.mu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+
+		k.mu.Lock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(k.locks, key)
+		}
+		k.mu.Unlock()
+	}
+}
@@ -0,0 +1,105 @@
+package downloader
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/neo1908/lemmy-image-scraper/pkg/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// sniffLength is how much of a file is read to detect its type
+const sniffLength = 512
+
+// Reclassify re-detects the media type of every stored file from its content and
+// updates records whose type changed. Files whose content is not recognised keep
+// their current type. GIF and WebP images are also checked for animation, and
+// files without a recorded MIME type get one from their content.
+// It returns the number of records checked and fixed.
+func (d *Downloader) Reclassify() (checked, fixed int, err error) {
+	err = d.DB.ForEachMedia(func(media *models.ScrapedMedia) error {
+		checked++
+
+		key := MediaKey(d.Storage, media)
+		header, err := d.readHeader(key)
+		if err != nil {
+			log.Warnf("Skipping media %d: %v", media.ID, err)
+			return nil
+		}
+
+		if media.MediaType == "image" || sniffMediaType(header) == "image" {
+			animated, err := d.detectAnimation(key, header)
+			if err != nil {
+				log.Warnf("Skipping animation check of media %d: %v", media.ID, err)
+			} else if animated != media.Animated {
+				if err := d.DB.SetAnimated(media.ID, animated); err != nil {
+					return err
+				}
+				log.Infof("Marked %s as animated: %t", key, animated)
+				fixed++
+			}
+		}
+
+		// Files downloaded before MIME types were recorded
+		if media.MIMEType == "" {
+			if mimeType := DetectMIMEType(header, ""); mimeType != "" {
+				if err := d.DB.SetMIMEType(media.ID, mimeType); err != nil {
+					return err
+				}
+				log.Infof("Recorded MIME type of %s: %s", key, mimeType)
+				fixed++
+			}
+		}
+
+		mediaType := sniffMediaType(header)
+		if mediaType == "" || mediaType == media.MediaType {
+			return nil
+		}
+
+		if err := d.DB.UpdateMediaType(media.ID, mediaType); err != nil {
+			return err
+		}
+		log.Infof("Reclassified %s: %s -> %s", key, media.MediaType, mediaType)
+		fixed++
+		return nil
+	})
+	return checked, fixed, err
+}
+
+// detectAnimation reports whether a stored image is animated. GIF frames can only
+// be counted from the whole file, so GIFs are read in full; other formats are
+// checked from their header.
+func (d *Downloader) detectAnimation(key string, header []byte) (bool, error) {
+	if http.DetectContentType(header) != "image/gif" {
+		return isAnimated(header), nil
+	}
+
+	reader, err := d.Storage.Get(key)
+	if err != nil {
+		return false, fmt.Errorf("failed to open %s: %w", key, err)
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	return isAnimated(content), nil
+}
+
+// readHeader reads the first bytes of a stored file
+func (d *Downloader) readHeader(key string) ([]byte, error) {
+	reader, err := d.Storage.Get(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", key, err)
+	}
+	defer reader.Close()
+
+	header := make([]byte, sniffLength)
+	n, err := io.ReadFull(reader, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	return header[:n], nil
+}
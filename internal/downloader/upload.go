@@ -0,0 +1,101 @@
+package downloader
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/neo1908/lemmy-image-scraper/internal/database"
+	"github.com/neo1908/lemmy-image-scraper/pkg/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// Upload describes a media file added to the archive by hand rather than
+// downloaded from a post
+type Upload struct {
+	FileName      string // Name of the uploaded file
+	ContentType   string // Content-Type sent with the file
+	PostTitle     string
+	CommunityName string
+	PostURL       string
+	AuthorName    string
+	PostScore     int
+	MediaType     string // "image", "video" or "other"; detected from the content when empty
+}
+
+// StoreUpload stores an uploaded file and records it like downloaded media.
+// Each upload gets its own negative post ID, which sets manual uploads apart
+// from scraped posts. Content that is already archived is rejected with ErrMediaExists.
+func (d *Downloader) StoreUpload(content []byte, upload Upload) (*models.ScrapedMedia, error) {
+	hash, err := database.HashContent(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash content: %w", err)
+	}
+
+	unlock := d.saving.Lock(hash)
+	defer unlock()
+
+	existing, err := d.DB.GetMediaByHash(hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check media existence: %w", err)
+	}
+	if existing != nil {
+		return existing, fmt.Errorf("%w (hash: %s)", ErrMediaExists, hash[:16])
+	}
+
+	// Uploads are numbered one at a time so no two share a post ID
+	d.uploading.Lock()
+	defer d.uploading.Unlock()
+
+	postID, err := d.DB.NextUploadPostID()
+	if err != nil {
+		return nil, err
+	}
+
+	mediaType := upload.MediaType
+	if mediaType == "" {
+		mediaType = DetectMediaType(content, upload.ContentType, upload.FileName)
+	}
+	fileExt := getFileExtension(upload.ContentType, upload.FileName)
+
+	fileName := fmt.Sprintf("upload%d_%s", -postID, sanitizePath(filepath.Base(upload.FileName)))
+	if d.NameByHash {
+		fileName = database.HashFileName(hash, fileExt)
+	}
+
+	// Uploads have no post, so date layouts use the upload's date
+	now := time.Now().UTC()
+	key := path.Join(d.mediaDir(upload.CommunityName, now), fileName)
+	filePath, err := d.Storage.Put(key, content, upload.ContentType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store file: %w", err)
+	}
+
+	media := &models.ScrapedMedia{
+		PostID:        postID,
+		PostTitle:     upload.PostTitle,
+		CommunityName: upload.CommunityName,
+		AuthorName:    upload.AuthorName,
+		MediaHash:     hash,
+		FileName:      fileName,
+		FilePath:      filePath,
+		FileSize:      int64(len(content)),
+		MediaType:     mediaType,
+		PostURL:       upload.PostURL,
+		PostScore:     upload.PostScore,
+		MIMEType:      DetectMIMEType(content, upload.ContentType),
+		PostCreated:   now,
+		DownloadedAt:  now,
+		Animated:      mediaType == "image" && isAnimated(content),
+	}
+
+	if err := d.DB.SaveMedia(media); err != nil {
+		d.Storage.Delete(key)
+		return nil, fmt.Errorf("failed to save media to database: %w", err)
+	}
+
+	log.Infof("Stored uploaded media: %s (%s, %d bytes)", fileName, mediaType, len(content))
+	return media, nil
+}
@@ -0,0 +1,96 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ytdlpTimeout bounds a single yt-dlp download, which for long videos can take a while
+const ytdlpTimeout = 15 * time.Minute
+
+// YtDlp downloads the video on a video platform page with the yt-dlp program
+type YtDlp struct {
+	Path      string // yt-dlp executable
+	Proxy     string // Proxy URL for yt-dlp's requests, "" for a direct connection
+	RateLimit int64  // Download rate cap in bytes per second (0 = unlimited)
+}
+
+// Download runs yt-dlp for a video page and returns the video's content and
+// MIME type. Videos over maxSize bytes (0 = unlimited) are rejected with ErrTooLarge.
+func (y *YtDlp) Download(pageURL string, maxSize int64) ([]byte, string, error) {
+	tmpDir, err := os.MkdirTemp("", "lemmy-scraper-ytdlp-")
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	args := []string{
+		"--no-playlist", "--no-progress", "--quiet", "--no-warnings",
+		"--output", filepath.Join(tmpDir, "video.%(ext)s"),
+	}
+	if maxSize > 0 {
+		args = append(args, "--max-filesize", strconv.FormatInt(maxSize, 10))
+	}
+	if y.Proxy != "" {
+		args = append(args, "--proxy", y.Proxy)
+	}
+	if y.RateLimit > 0 {
+		args = append(args, "--limit-rate", strconv.FormatInt(y.RateLimit, 10))
+	}
+	args = append(args, "--", pageURL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), ytdlpTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, y.Path, args...).CombinedOutput()
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, "", fmt.Errorf("%w: yt-dlp timed out after %s", ErrDownloadFailed, ytdlpTimeout)
+		}
+		return nil, "", fmt.Errorf("%w: yt-dlp failed: %w: %s", ErrDownloadFailed, err, strings.TrimSpace(string(out)))
+	}
+
+	// With --max-filesize, yt-dlp skips larger videos without failing
+	files, err := filepath.Glob(filepath.Join(tmpDir, "video.*"))
+	if err != nil || len(files) == 0 {
+		if maxSize > 0 {
+			return nil, "", fmt.Errorf("%w: video larger than %d bytes", ErrTooLarge, maxSize)
+		}
+		return nil, "", fmt.Errorf("%w: yt-dlp produced no file", ErrDownloadFailed)
+	}
+
+	content, err := os.ReadFile(files[0])
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: failed to read yt-dlp output: %w", ErrDownloadFailed, err)
+	}
+	if maxSize > 0 && int64(len(content)) > maxSize {
+		return nil, "", fmt.Errorf("%w: %d bytes (limit %d)", ErrTooLarge, len(content), maxSize)
+	}
+
+	return content, videoContentType(filepath.Ext(files[0])), nil
+}
+
+// videoContentType returns the MIME type of a video file extension. Go's own
+// table doesn't cover video formats, so the common yt-dlp outputs are listed here.
+func videoContentType(ext string) string {
+	switch strings.ToLower(ext) {
+	case ".mp4", ".m4v":
+		return "video/mp4"
+	case ".webm":
+		return "video/webm"
+	case ".mkv":
+		return "video/x-matroska"
+	case ".mov":
+		return "video/quicktime"
+	default:
+		return mime.TypeByExtension(ext)
+	}
+}
@@ -0,0 +1,69 @@
+package extractor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// peerTubeWatchPath is the path prefix PeerTube instances serve video pages on
+const peerTubeWatchPath = "/videos/watch/"
+
+// oEmbedResponse is the part of a PeerTube oEmbed response that holds the video file
+type oEmbedResponse struct {
+	URL string `json:"url"`
+}
+
+// IsPeerTubeURL reports whether a URL looks like a PeerTube video page
+func IsPeerTubeURL(pageURL string) bool {
+	u, err := url.Parse(pageURL)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	return strings.HasPrefix(u.Path, peerTubeWatchPath) && len(u.Path) > len(peerTubeWatchPath)
+}
+
+// FetchPeerTubeVideoURL asks the PeerTube instance hosting pageURL for its oEmbed
+// data and returns the direct video URL from it
+func FetchPeerTubeVideoURL(pageURL string, client *http.Client) (string, error) {
+	page, err := url.Parse(pageURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse PeerTube URL: %w", err)
+	}
+
+	oEmbedURL := &url.URL{
+		Scheme:   page.Scheme,
+		Host:     page.Host,
+		Path:     "/services/oembed",
+		RawQuery: url.Values{"url": {pageURL}, "format": {"json"}}.Encode(),
+	}
+
+	resp, err := client.Get(oEmbedURL.String())
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch PeerTube oEmbed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("PeerTube oEmbed request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var oEmbed oEmbedResponse
+	if err := json.NewDecoder(resp.Body).Decode(&oEmbed); err != nil {
+		return "", fmt.Errorf("failed to decode PeerTube oEmbed: %w", err)
+	}
+	if oEmbed.URL == "" {
+		return "", fmt.Errorf("PeerTube oEmbed for %s has no video URL", pageURL)
+	}
+
+	// The video URL may be relative to the instance
+	videoURL, err := page.Parse(oEmbed.URL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse PeerTube video URL: %w", err)
+	}
+	return videoURL.String(), nil
+}
@@ -0,0 +1,75 @@
+package extractor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIsPeerTubeURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://peertube.social/videos/watch/9c9de5e8-0a1e-484a-b099-e80766180a6d", true},
+		{"https://peertube.social/videos/watch/", false},
+		{"https://peertube.social/a/user/videos", false},
+		{"/videos/watch/9c9de5e8", false},
+	}
+	for _, tt := range tests {
+		if got := IsPeerTubeURL(tt.url); got != tt.want {
+			t.Errorf("IsPeerTubeURL(%q) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestFetchPeerTubeVideoURL(t *testing.T) {
+	var pageURL string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/services/oembed" {
+			http.NotFound(w, r)
+			return
+		}
+		if got := r.URL.Query().Get("url"); got != pageURL {
+			t.Errorf("oEmbed url = %q, want %q", got, pageURL)
+		}
+		if got := r.URL.Query().Get("format"); got != "json" {
+			t.Errorf("oEmbed format = %q, want json", got)
+		}
+		// PeerTube gives the file relative to the instance
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"type": "video", "title": "A video", "url": "/static/web-videos/9c9de5e8-720.mp4"}`))
+	}))
+	defer srv.Close()
+
+	pageURL = srv.URL + "/videos/watch/9c9de5e8"
+	got, err := FetchPeerTubeVideoURL(pageURL, srv.Client())
+	if err != nil {
+		t.Fatalf("FetchPeerTubeVideoURL: %v", err)
+	}
+	if want := srv.URL + "/static/web-videos/9c9de5e8-720.mp4"; got != want {
+		t.Errorf("video URL = %q, want %q", got, want)
+	}
+}
+
+func TestFetchPeerTubeVideoURLErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("url") == "" || r.URL.Query().Get("format") != "json" {
+			t.Errorf("oEmbed query = %q", r.URL.RawQuery)
+		}
+		switch r.URL.Query().Get("url") {
+		case "http://" + r.Host + "/videos/watch/private":
+			http.Error(w, "video is private", http.StatusForbidden)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"type": "video", "title": "A video"}`))
+		}
+	}))
+	defer srv.Close()
+
+	for _, id := range []string{"private", "no-url"} {
+		if got, err := FetchPeerTubeVideoURL(srv.URL+"/videos/watch/"+id, srv.Client()); err == nil {
+			t.Errorf("FetchPeerTubeVideoURL(%s) = %q, want an error", id, got)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package extractor
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Paths pict-rs images are served on. Lemmy proxies pict-rs under /pictrs/image/,
+// and pict-rs itself serves processed variants from /image/process.{ext}.
+const (
+	pictrsLemmyPath   = "/pictrs/image/"
+	pictrsProcessPath = "/image/process."
+)
+
+// PictrsOriginalURL returns the URL of the original upload behind a pict-rs
+// URL that asks for a processed variant, e.g. a thumbnail or another format.
+// It reports false for URLs that aren't pict-rs or already point at the original.
+func PictrsOriginalURL(imageURL string) (string, bool) {
+	u, err := url.Parse(imageURL)
+	if err != nil || u.Host == "" {
+		return "", false
+	}
+
+	switch {
+	case strings.HasPrefix(u.Path, pictrsLemmyPath) && len(u.Path) > len(pictrsLemmyPath):
+		// Lemmy passes the processing options (thumbnail, format, ...) as the query
+		if u.RawQuery == "" {
+			return "", false
+		}
+		u.RawQuery = ""
+	case strings.HasPrefix(u.Path, pictrsProcessPath):
+		alias := u.Query().Get("src")
+		if alias == "" || strings.Contains(alias, "/") {
+			return "", false
+		}
+		u.Path = "/image/original/" + alias
+		u.RawPath = ""
+		u.RawQuery = ""
+	default:
+		return "", false
+	}
+
+	u.Fragment = ""
+	return u.String(), true
+}
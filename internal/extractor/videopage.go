@@ -0,0 +1,47 @@
+package extractor
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// videoPagePatterns match the paths of single video pages on video platforms,
+// keyed by host without any "www." or "m." prefix. Channel and playlist pages
+// are left out so a link post never downloads more than one video.
+var videoPagePatterns = map[string]*regexp.Regexp{
+	"youtube.com":      regexp.MustCompile(`^/(watch$|shorts/[\w-]+|embed/[\w-]+|live/[\w-]+)`),
+	"youtu.be":         regexp.MustCompile(`^/[\w-]+$`),
+	"vimeo.com":        regexp.MustCompile(`^/\d+`),
+	"player.vimeo.com": regexp.MustCompile(`^/video/\d+`),
+	"dailymotion.com":  regexp.MustCompile(`^/video/\w+`),
+	"dai.ly":           regexp.MustCompile(`^/\w+$`),
+	"streamable.com":   regexp.MustCompile(`^/\w+$`),
+	"clips.twitch.tv":  regexp.MustCompile(`^/[\w-]+$`),
+	"twitch.tv":        regexp.MustCompile(`^/(videos/\d+|\w+/clip/[\w-]+)`),
+	"tiktok.com":       regexp.MustCompile(`^/@[\w.-]+/video/\d+`),
+	"rumble.com":       regexp.MustCompile(`^/v\w+`),
+	"odysee.com":       regexp.MustCompile(`^/@[^/]+/[^/]+`),
+}
+
+// IsVideoPageURL reports whether a URL is a video page on a platform whose
+// videos can only be downloaded with a tool such as yt-dlp
+func IsVideoPageURL(pageURL string) bool {
+	u, err := url.Parse(pageURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+
+	host := strings.ToLower(u.Hostname())
+	host = strings.TrimPrefix(host, "www.")
+	host = strings.TrimPrefix(host, "m.")
+
+	pattern, ok := videoPagePatterns[host]
+	if !ok {
+		return false
+	}
+	if host == "youtube.com" && u.Path == "/watch" {
+		return u.Query().Get("v") != ""
+	}
+	return pattern.MatchString(u.Path)
+}
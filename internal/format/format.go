@@ -0,0 +1,18 @@
+// Package format renders values for logs, the CLI and the web UI
+package format
+
+import "fmt"
+
+// FileSize formats a byte count using binary units, e.g. "1.5 MB"
+func FileSize(bytes int64) string {
+	if bytes < 1024 {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	if bytes < 1024*1024 {
+		return fmt.Sprintf("%.1f KB", float64(bytes)/1024)
+	}
+	if bytes < 1024*1024*1024 {
+		return fmt.Sprintf("%.1f MB", float64(bytes)/(1024*1024))
+	}
+	return fmt.Sprintf("%.1f GB", float64(bytes)/(1024*1024*1024))
+}
@@ -0,0 +1,67 @@
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/neo1908/lemmy-image-scraper/internal/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// NewTransport builds the HTTP transport shared by the API client and the downloader,
+// applying the instance's TLS and proxy settings
+func NewTransport(cfg *config.LemmyConfig) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	if cfg.ProxyURL != "" {
+		proxy, err := url.Parse(cfg.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse proxy URL: %w", err)
+		}
+		// Replaces the default of honouring HTTP_PROXY/HTTPS_PROXY
+		transport.Proxy = http.ProxyURL(proxy)
+		log.Infof("Sending requests through proxy %s", proxy.Redacted())
+	}
+
+	return transport, nil
+}
+
+// newTLSConfig adds an extra trusted CA and/or disables verification as configured
+func newTLSConfig(cfg *config.LemmyConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+
+	if cfg.CACertFile != "" {
+		pem, err := os.ReadFile(cfg.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+		}
+
+		// Trust the system roots plus the extra CA
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no valid certificates found in %s", cfg.CACertFile)
+		}
+		tlsConfig.RootCAs = pool
+		log.Infof("Trusting additional CA certificate from %s", cfg.CACertFile)
+	}
+
+	if cfg.InsecureSkipVerify {
+		log.Warn("TLS certificate verification is DISABLED (lemmy.insecure_skip_verify); only use this for testing")
+		tlsConfig.InsecureSkipVerify = true
+	}
+
+	return tlsConfig, nil
+}
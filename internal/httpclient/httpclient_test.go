@@ -0,0 +1,51 @@
+package httpclient
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/neo1908/lemmy-image-scraper/internal/api"
+	"github.com/neo1908/lemmy-image-scraper/internal/config"
+)
+
+func TestNewTransportUsesProxy(t *testing.T) {
+	var mu sync.Mutex
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A proxy is sent the absolute URL of the target
+		mu.Lock()
+		proxied = append(proxied, r.URL.String())
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"site_view": {}, "version": "0.19.3"}`))
+	}))
+	t.Cleanup(proxy.Close)
+
+	transport, err := NewTransport(&config.LemmyConfig{ProxyURL: proxy.URL})
+	if err != nil {
+		t.Fatalf("NewTransport: %v", err)
+	}
+
+	client := api.NewClient("lemmy.invalid")
+	client.BaseURL = "http://lemmy.invalid/api/v3"
+	client.HTTPClient.Transport = transport
+	if _, err := client.GetSiteInfo(); err != nil {
+		t.Fatalf("GetSiteInfo through proxy: %v", err)
+	}
+
+	// The downloader shares the transport
+	resp, err := (&http.Client{Transport: transport}).Get("http://images.invalid/a.png")
+	if err != nil {
+		t.Fatalf("download through proxy: %v", err)
+	}
+	resp.Body.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"http://lemmy.invalid/api/v3/site", "http://images.invalid/a.png"}
+	if len(proxied) != len(want) || proxied[0] != want[0] || proxied[1] != want[1] {
+		t.Errorf("proxied requests = %v, want %v", proxied, want)
+	}
+}
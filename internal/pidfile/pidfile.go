@@ -0,0 +1,75 @@
+package pidfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Acquire writes the current process ID to path. It fails if the file already
+// names a process that is still running; a file left behind by a process that
+// has exited is replaced.
+func Acquire(path string) error {
+	for attempt := 0; attempt < 2; attempt++ {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_, writeErr := fmt.Fprintf(file, "%d\n", os.Getpid())
+			closeErr := file.Close()
+			if writeErr != nil || closeErr != nil {
+				os.Remove(path)
+				return fmt.Errorf("failed to write PID file: %w", errors.Join(writeErr, closeErr))
+			}
+			return nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("failed to create PID file: %w", err)
+		}
+
+		pid, err := read(path)
+		if err != nil {
+			return err
+		}
+		if pid > 0 && processRunning(pid) {
+			return fmt.Errorf("another instance is already running (PID %d, %s)", pid, path)
+		}
+
+		// Stale file from a process that is gone
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove stale PID file: %w", err)
+		}
+	}
+	return fmt.Errorf("failed to create PID file %s: it keeps reappearing", path)
+}
+
+// Release removes the PID file if it still belongs to the current process
+func Release(path string) error {
+	pid, err := read(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if pid != os.Getpid() {
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove PID file: %w", err)
+	}
+	return nil
+}
+
+// read returns the PID stored in path, or 0 if the file doesn't contain one
+func read(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read PID file: %w", err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, nil
+	}
+	return pid, nil
+}
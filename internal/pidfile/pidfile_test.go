@@ -0,0 +1,87 @@
+package pidfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// helperEnv makes the test binary act as a second instance acquiring the PID
+// file it names, exiting non-zero when that fails
+const helperEnv = "PIDFILE_TEST_ACQUIRE"
+
+func TestMain(m *testing.M) {
+	if path := os.Getenv(helperEnv); path != "" {
+		if err := Acquire(path); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		Release(path)
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runSecondInstance runs the test binary as another process acquiring path
+func runSecondInstance(t *testing.T, path string) error {
+	t.Helper()
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(), helperEnv+"="+path)
+	return cmd.Run()
+}
+
+func TestSecondProcessFailsWhileHeld(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scraper.pid")
+	if err := Acquire(path); err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+
+	err := runSecondInstance(t, path)
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() == 0 {
+		t.Fatalf("second instance: err = %v, want a non-zero exit", err)
+	}
+
+	// The file still names this process
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read PID file: %v", err)
+	}
+	if pid, _ := strconv.Atoi(strings.TrimSpace(string(data))); pid != os.Getpid() {
+		t.Errorf("PID file = %q, want %d", data, os.Getpid())
+	}
+
+	// Once released, another instance can start
+	if err := Release(path); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("PID file still exists after Release: %v", err)
+	}
+	if err := runSecondInstance(t, path); err != nil {
+		t.Errorf("second instance after release: %v", err)
+	}
+}
+
+func TestAcquireReplacesStaleFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scraper.pid")
+
+	// A process that has exited
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("failed to run a process: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(strconv.Itoa(cmd.Process.Pid)+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Acquire(path); err != nil {
+		t.Fatalf("Acquire over a stale file: %v", err)
+	}
+	defer Release(path)
+}
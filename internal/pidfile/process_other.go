@@ -0,0 +1,16 @@
+//go:build !unix
+
+package pidfile
+
+import "os"
+
+// processRunning reports whether a process with the given PID exists
+func processRunning(pid int) bool {
+	// FindProcess only succeeds for live processes outside Unix
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	process.Release()
+	return true
+}
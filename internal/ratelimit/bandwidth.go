@@ -0,0 +1,66 @@
+package ratelimit
+
+import (
+	"context"
+	"io"
+
+	"golang.org/x/time/rate"
+)
+
+// maxChunk is the largest read passed through in one go. It is also the
+// bucket size, so short bursts can't exceed the cap by much.
+const maxChunk = 32 * 1024
+
+// BandwidthLimiter caps the combined throughput of every reader it wraps,
+// using a token bucket where one token is one byte
+type BandwidthLimiter struct {
+	limiter *rate.Limiter
+	chunk   int
+}
+
+// NewBandwidthLimiter creates a limiter allowing bytesPerSecond in total.
+// It returns nil when bytesPerSecond is 0 or less, which disables limiting.
+func NewBandwidthLimiter(bytesPerSecond int64) *BandwidthLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+
+	chunk := maxChunk
+	if bytesPerSecond < int64(chunk) {
+		chunk = int(bytesPerSecond)
+	}
+	return &BandwidthLimiter{
+		limiter: rate.NewLimiter(rate.Limit(bytesPerSecond), chunk),
+		chunk:   chunk,
+	}
+}
+
+// Reader wraps r so reads from it draw from the shared bandwidth budget.
+// A nil limiter returns r unchanged.
+func (b *BandwidthLimiter) Reader(ctx context.Context, r io.Reader) io.Reader {
+	if b == nil {
+		return r
+	}
+	return &limitedReader{ctx: ctx, reader: r, limiter: b}
+}
+
+// limitedReader waits for bandwidth tokens after each read
+type limitedReader struct {
+	ctx     context.Context
+	reader  io.Reader
+	limiter *BandwidthLimiter
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if len(p) > l.limiter.chunk {
+		p = p[:l.limiter.chunk]
+	}
+
+	n, err := l.reader.Read(p)
+	if n > 0 {
+		if waitErr := l.limiter.limiter.WaitN(l.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,68 @@
+package ratelimit
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBandwidthLimiterCapsThroughput(t *testing.T) {
+	const size = 10 << 20          // 10 MB response
+	const bytesPerSecond = 5 << 20 // Read over about two seconds
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(bytes.Repeat([]byte{'x'}, size))
+	}))
+	defer srv.Close()
+
+	resp, err := srv.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	limiter := NewBandwidthLimiter(bytesPerSecond)
+	start := time.Now()
+	n, err := io.Copy(io.Discard, limiter.Reader(context.Background(), resp.Body))
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if n != size {
+		t.Fatalf("read %d bytes, want %d", n, size)
+	}
+
+	throughput := float64(n) / elapsed.Seconds()
+	if throughput < bytesPerSecond*0.9 || throughput > bytesPerSecond*1.1 {
+		t.Errorf("throughput = %.0f bytes/s over %s, want within 10%% of %d", throughput, elapsed, bytesPerSecond)
+	}
+}
+
+func TestBandwidthLimiterDisabled(t *testing.T) {
+	if limiter := NewBandwidthLimiter(0); limiter != nil {
+		t.Fatalf("NewBandwidthLimiter(0) = %v, want nil", limiter)
+	}
+
+	var limiter *BandwidthLimiter
+	r := strings.NewReader("data")
+	if got := limiter.Reader(context.Background(), r); got != io.Reader(r) {
+		t.Error("nil limiter wrapped the reader")
+	}
+}
+
+func TestBandwidthLimiterStopsOnCancel(t *testing.T) {
+	limiter := NewBandwidthLimiter(1024)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// The first read empties the bucket, the next has to wait and sees the cancellation
+	reader := limiter.Reader(ctx, bytes.NewReader(make([]byte, 4096)))
+	if _, err := io.Copy(io.Discard, reader); err == nil {
+		t.Error("read with a cancelled context succeeded")
+	}
+}
@@ -0,0 +1,42 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// RequestLimiter spaces out requests so that, across everything sharing it,
+// at most one request starts per delay. It is a token bucket holding one token.
+type RequestLimiter struct {
+	limiter *rate.Limiter
+}
+
+// NewRequestLimiter creates a limiter allowing one request per delay.
+// A delay of 0 or less lets requests through without waiting.
+func NewRequestLimiter(delay time.Duration) *RequestLimiter {
+	return &RequestLimiter{limiter: rate.NewLimiter(limitFor(delay), 1)}
+}
+
+// SetDelay changes the delay between requests
+func (l *RequestLimiter) SetDelay(delay time.Duration) {
+	l.limiter.SetLimit(limitFor(delay))
+}
+
+// Wait blocks until the next request may be sent or ctx is done.
+// A nil limiter never waits.
+func (l *RequestLimiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	return l.limiter.Wait(ctx)
+}
+
+// limitFor converts a delay between requests into a rate
+func limitFor(delay time.Duration) rate.Limit {
+	if delay <= 0 {
+		return rate.Inf
+	}
+	return rate.Every(delay)
+}
@@ -0,0 +1,174 @@
+package robots
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSize is how much of a robots.txt file is read; the rest is ignored
+const maxSize = 512 * 1024
+
+// Rules are the robots.txt directives that apply to one user agent
+type Rules struct {
+	CrawlDelay time.Duration
+	allow      []string
+	disallow   []string
+}
+
+// group is one set of records sharing the same User-agent lines
+type group struct {
+	agents     []string
+	crawlDelay time.Duration
+	allow      []string
+	disallow   []string
+}
+
+// Fetch downloads and parses a robots.txt file. A missing file (any 4xx
+// status) means everything is allowed and returns empty rules.
+func Fetch(client *http.Client, robotsURL, userAgent string) (*Rules, error) {
+	resp, err := client.Get(robotsURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch robots.txt: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+		return &Rules{}, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("robots.txt request failed with status %d", resp.StatusCode)
+	}
+
+	return Parse(io.LimitReader(resp.Body, maxSize), userAgent)
+}
+
+// Parse reads a robots.txt file and returns the rules for userAgent, falling
+// back to the "*" group when no group names it
+func Parse(r io.Reader, userAgent string) (*Rules, error) {
+	var groups []*group
+	var current *group
+	inAgentLines := false
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		if key == "user-agent" {
+			// Consecutive User-agent lines share one group
+			if !inAgentLines {
+				current = &group{}
+				groups = append(groups, current)
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+			inAgentLines = true
+			continue
+		}
+		inAgentLines = false
+		if current == nil {
+			continue
+		}
+
+		switch key {
+		case "allow":
+			if value != "" {
+				current.allow = append(current.allow, value)
+			}
+		case "disallow":
+			// An empty Disallow allows everything
+			if value != "" {
+				current.disallow = append(current.disallow, value)
+			}
+		case "crawl-delay":
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+				current.crawlDelay = time.Duration(seconds * float64(time.Second))
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read robots.txt: %w", err)
+	}
+
+	rules := &Rules{}
+	if g := selectGroup(groups, strings.ToLower(userAgent)); g != nil {
+		rules.CrawlDelay = g.crawlDelay
+		rules.allow = g.allow
+		rules.disallow = g.disallow
+	}
+	return rules, nil
+}
+
+// selectGroup returns the group naming userAgent, or the "*" group
+func selectGroup(groups []*group, userAgent string) *group {
+	var wildcard *group
+	for _, g := range groups {
+		for _, agent := range g.agents {
+			if agent == "*" {
+				if wildcard == nil {
+					wildcard = g
+				}
+			} else if userAgent != "" && strings.Contains(userAgent, agent) {
+				return g
+			}
+		}
+	}
+	return wildcard
+}
+
+// Allowed reports whether path may be fetched. The longest matching rule wins,
+// with Allow winning a tie.
+func (r *Rules) Allowed(path string) bool {
+	longestAllow := longestMatch(r.allow, path)
+	longestDisallow := longestMatch(r.disallow, path)
+	return longestDisallow < 0 || longestAllow >= longestDisallow
+}
+
+// longestMatch returns the length of the longest pattern matching path, or -1
+func longestMatch(patterns []string, path string) int {
+	longest := -1
+	for _, pattern := range patterns {
+		if len(pattern) > longest && matches(pattern, path) {
+			longest = len(pattern)
+		}
+	}
+	return longest
+}
+
+// matches reports whether a robots.txt path pattern matches path. Patterns are
+// prefixes and may use * for any characters and a trailing $ to anchor the end.
+func matches(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	rest := path[len(parts[0]):]
+	for _, part := range parts[1:] {
+		i := strings.Index(rest, part)
+		if i < 0 {
+			return false
+		}
+		rest = rest[i+len(part):]
+	}
+	if anchored && rest != "" {
+		// The last part must end the path; retry with it matched as a suffix
+		last := parts[len(parts)-1]
+		return len(parts) > 1 && strings.HasSuffix(path, last)
+	}
+	return true
+}
@@ -0,0 +1,44 @@
+package scraper
+
+import "time"
+
+// Schedule tracks when each community is next due in continuous mode. Every
+// community is due immediately at first, then again its interval after each
+// scrape.
+type Schedule struct {
+	targets  []string
+	interval func(community string) time.Duration
+	next     map[string]time.Time
+}
+
+// NewSchedule returns a schedule for targets, as of now. interval gives the
+// time to wait between scrapes of a community.
+func NewSchedule(targets []string, interval func(community string) time.Duration, now time.Time) *Schedule {
+	next := make(map[string]time.Time, len(targets))
+	for _, community := range targets {
+		next[community] = now
+	}
+	return &Schedule{targets: targets, interval: interval, next: next}
+}
+
+// Due returns the communities due at now, in target order, and when the next
+// of the others is due
+func (s *Schedule) Due(now time.Time) (due []string, next time.Time) {
+	for _, community := range s.targets {
+		at := s.next[community]
+		if !at.After(now) {
+			due = append(due, community)
+		} else if next.IsZero() || at.Before(next) {
+			next = at
+		}
+	}
+	return due, next
+}
+
+// Scraped records that communities were scraped, making each due again after
+// its interval from now
+func (s *Schedule) Scraped(communities []string, now time.Time) {
+	for _, community := range communities {
+		s.next[community] = now.Add(s.interval(community))
+	}
+}
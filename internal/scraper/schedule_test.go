@@ -0,0 +1,65 @@
+package scraper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/neo1908/lemmy-image-scraper/internal/config"
+)
+
+func TestScheduleRunsOverriddenCommunityMoreOften(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.RunMode.Interval = config.Duration(30 * time.Minute)
+	cfg.Lemmy.CommunityOverrides = map[string]config.CommunityOverride{
+		"pics": {ScrapeInterval: config.Duration(time.Minute)},
+	}
+
+	// Step through two hours, running whatever is due as soon as it is
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	now := start
+	schedule := NewSchedule([]string{"pics", "memes"}, cfg.ScrapeIntervalFor, now)
+	runs := make(map[string]int)
+	for now.Before(start.Add(2 * time.Hour)) {
+		due, next := schedule.Due(now)
+		if len(due) == 0 {
+			now = next
+			continue
+		}
+		for _, community := range due {
+			runs[community]++
+		}
+		schedule.Scraped(due, now)
+	}
+
+	if runs["pics"] != 120 {
+		t.Errorf("pics (1m override) scraped %d times, want 120", runs["pics"])
+	}
+	if runs["memes"] != 4 {
+		t.Errorf("memes (30m default) scraped %d times, want 4", runs["memes"])
+	}
+}
+
+func TestScheduleDue(t *testing.T) {
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	interval := func(community string) time.Duration {
+		if community == "pics" {
+			return time.Minute
+		}
+		return 30 * time.Minute
+	}
+	schedule := NewSchedule([]string{"pics", "memes"}, interval, start)
+
+	if due, _ := schedule.Due(start); len(due) != 2 {
+		t.Fatalf("due at start = %v, want both", due)
+	}
+	schedule.Scraped([]string{"pics", "memes"}, start)
+
+	due, next := schedule.Due(start.Add(30 * time.Second))
+	if len(due) != 0 || !next.Equal(start.Add(time.Minute)) {
+		t.Errorf("after 30s: due = %v, next = %v, want none until %v", due, next, start.Add(time.Minute))
+	}
+	due, next = schedule.Due(start.Add(time.Minute))
+	if len(due) != 1 || due[0] != "pics" || !next.Equal(start.Add(30*time.Minute)) {
+		t.Errorf("after 1m: due = %v, next = %v, want [pics] with memes next at %v", due, next, start.Add(30*time.Minute))
+	}
+}
@@ -1,12 +1,21 @@
 package scraper
 
 import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/neo1908/lemmy-image-scraper/internal/api"
 	"github.com/neo1908/lemmy-image-scraper/internal/config"
 	"github.com/neo1908/lemmy-image-scraper/internal/database"
 	"github.com/neo1908/lemmy-image-scraper/internal/downloader"
+	"github.com/neo1908/lemmy-image-scraper/internal/extractor"
+	"github.com/neo1908/lemmy-image-scraper/internal/format"
+	"github.com/neo1908/lemmy-image-scraper/internal/ratelimit"
+	"github.com/neo1908/lemmy-image-scraper/internal/robots"
 	"github.com/neo1908/lemmy-image-scraper/pkg/models"
 	log "github.com/sirupsen/logrus"
 )
@@ -17,6 +26,15 @@ type Scraper struct {
 	API        *api.Client
 	DB         *database.DB
 	Downloader *downloader.Downloader
+
+	// Optional time gate: only process posts published after a cutoff.
+	// SinceAuto uses the start of the last run that finished scraping the
+	// community, otherwise SinceDuration is subtracted from the current time
+	// on each run.
+	SinceDuration time.Duration
+	SinceAuto     bool
+
+	cutoff time.Time // Cutoff for the community being scraped, zero when not time-gated
 }
 
 // New creates a new Scraper instance
@@ -29,32 +47,290 @@ func New(cfg *config.Config, apiClient *api.Client, db *database.DB, dl *downloa
 	}
 }
 
-// Run executes the scraping process
+// communityListPageSize is how many communities are requested per page when
+// discovering communities (the Lemmy API maximum)
+const communityListPageSize = 50
+
+// backfillCommentsLimit is how many posts without comments are checked per run
+const backfillCommentsLimit = 50
+
+// Run executes the scraping process for all configured communities,
+// or the hot page if none are configured
 func (s *Scraper) Run() error {
+	targets, err := s.Targets()
+	if err != nil {
+		return err
+	}
+	return s.RunCommunities(targets)
+}
+
+// Targets returns the communities a run covers: the configured ones, every
+// community on the instance when scrape_all_communities is set, or otherwise
+// the hot page (an empty name)
+func (s *Scraper) Targets() ([]string, error) {
+	if len(s.Config.Lemmy.Communities) > 0 {
+		return s.Config.Lemmy.Communities, nil
+	}
+	if !s.Config.Scraper.ScrapeAllCommunities {
+		return []string{""}, nil
+	}
+
+	communities, err := s.listAllCommunities()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list communities: %w", err)
+	}
+	if len(communities) == 0 {
+		log.Warn("No communities found on the instance, scraping from hot page")
+		return []string{""}, nil
+	}
+	log.Infof("Discovered %d communities on the instance", len(communities))
+	return communities, nil
+}
+
+// listAllCommunities pages through the instance's community list and returns every name
+func (s *Scraper) listAllCommunities() ([]string, error) {
+	var names []string
+	for page := 1; ; page++ {
+		resp, err := s.API.GetCommunityList(page, communityListPageSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, view := range resp.Communities {
+			names = append(names, view.Community.Name)
+		}
+		if len(resp.Communities) < communityListPageSize {
+			return names, nil
+		}
+	}
+}
+
+// RunCommunities executes the scraping process for the given communities.
+// An empty community name stands for the instance's hot page.
+func (s *Scraper) RunCommunities(communities []string) (err error) {
 	log.Info("Starting scrape run")
 
-	if len(s.Config.Lemmy.Communities) == 0 {
-		// Scrape from hot page
-		log.Info("No communities specified, scraping from hot page")
-		return s.scrapeHotPage()
+	if s.Config.Scraper.RespectRobots {
+		s.applyRobots()
+	}
+
+	if s.Config.Scraper.AutoCleanOrphans {
+		deleted, cleanErr := s.DB.DeleteOrphanedComments()
+		if cleanErr != nil {
+			log.Errorf("Failed to clean orphaned comments: %v", cleanErr)
+		} else if deleted > 0 {
+			log.Infof("Deleted %d orphaned comments", deleted)
+		}
+	}
+
+	// Record the run so its outcome and the instance version are tracked
+	runID, startErr := s.DB.StartScrapeRun(s.API.Version)
+	if startErr != nil {
+		log.Errorf("Failed to record scrape run: %v", startErr)
+	} else {
+		defer func() {
+			if finishErr := s.DB.FinishScrapeRun(runID, err); finishErr != nil {
+				log.Errorf("Failed to finish scrape run: %v", finishErr)
+			}
+		}()
 	}
 
-	// Scrape specific communities
-	for _, community := range s.Config.Lemmy.Communities {
+	for _, community := range communities {
+		if err := s.setCutoff(community); err != nil {
+			return err
+		}
+
+		if community == "" {
+			// Scrape from hot page
+			log.Info("No communities specified, scraping from hot page")
+			if err := s.scrapeHotPage(); err != nil {
+				return err
+			}
+			s.recordScraped(runID, community)
+			s.updateScoreHistory("")
+			continue
+		}
+
 		log.Infof("Scraping community: %s", community)
 		if err := s.scrapeCommunity(community); err != nil {
 			log.Errorf("Failed to scrape community %s: %v", community, err)
 			continue
 		}
+		s.recordScraped(runID, community)
+		// Posts are stored under the community's local name, without the instance suffix
+		s.updateScoreHistory(strings.SplitN(community, "@", 2)[0])
+	}
+
+	if s.Config.Scraper.BackfillComments {
+		s.backfillComments()
+	}
+
+	if s.Config.Storage.MaxTotalSize > 0 {
+		s.evict()
 	}
 
 	return nil
 }
 
+// setCutoff works out the time gate for scraping community. With SinceAuto it
+// is the start of the last run that finished scraping the same community, so
+// continuous mode runs covering other communities don't move it.
+func (s *Scraper) setCutoff(community string) error {
+	s.cutoff = time.Time{}
+	if s.SinceAuto {
+		lastRun, err := s.DB.GetLastCommunityScrapeTime(community)
+		if err != nil {
+			return err
+		}
+		if lastRun.IsZero() {
+			log.Info("No previous successful scrape found, scraping without a time cutoff")
+		}
+		s.cutoff = lastRun
+	} else if s.SinceDuration > 0 {
+		s.cutoff = time.Now().Add(-s.SinceDuration)
+	}
+	if !s.cutoff.IsZero() {
+		log.Infof("Only processing posts published after %s", s.cutoff.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// recordScraped records that the run finished scraping community, for the
+// SinceAuto cutoff of later runs
+func (s *Scraper) recordScraped(runID int64, community string) {
+	if runID == 0 {
+		return
+	}
+	if err := s.DB.RecordCommunityScraped(runID, community); err != nil {
+		log.Errorf("Failed to record scrape of community %s: %v", community, err)
+	}
+}
+
+// evict deletes media by the eviction policy until the archive is back under
+// storage.max_total_size
+func (s *Scraper) evict() {
+	evicted, freed, err := s.Downloader.Evict(s.Config.Storage.MaxTotalSize, s.Config.Storage.EvictionPolicy)
+	if err != nil {
+		log.Errorf("Failed to evict media: %v", err)
+	}
+	if evicted > 0 {
+		log.Infof("Evicted %d media items (%s) to stay under %s",
+			evicted, format.FileSize(freed), format.FileSize(s.Config.Storage.MaxTotalSize))
+	}
+}
+
+// backfillComments fetches comments for posts that had media but have none
+// stored, such as posts whose media was already downloaded when they were scraped
+func (s *Scraper) backfillComments() {
+	postIDs, err := s.DB.GetPostsWithoutComments(backfillCommentsLimit)
+	if err != nil {
+		log.Errorf("Failed to find posts without comments: %v", err)
+		return
+	}
+	if len(postIDs) == 0 {
+		return
+	}
+
+	log.Infof("Backfilling comments for %d posts", len(postIDs))
+	for _, postID := range postIDs {
+		comments := s.fetchComments(postID)
+		if len(comments) == 0 {
+			continue
+		}
+		err := s.DB.WithTx(func(tx *database.Tx) error {
+			return s.saveComments(tx, postID, comments)
+		})
+		if err != nil {
+			log.Errorf("Failed to save comments for post %d: %v", postID, err)
+		}
+	}
+}
+
+// robotsUserAgent is the product token looked up in robots.txt before falling back to "*"
+const robotsUserAgent = "lemmy-image-scraper"
+
+// robotsCheckedEndpoints are the API endpoints a run depends on
+var robotsCheckedEndpoints = []string{"/post/list", "/comment/list", "/community", "/community/list"}
+
+// applyRobots fetches the instance's robots.txt, spaces requests by its
+// Crawl-delay and warns if the API paths the scraper uses are disallowed
+func (s *Scraper) applyRobots() {
+	base, err := url.Parse(s.API.BaseURL)
+	if err != nil {
+		log.Warnf("Failed to parse API URL for robots.txt: %v", err)
+		return
+	}
+	robotsURL := &url.URL{Scheme: base.Scheme, Host: base.Host, Path: "/robots.txt"}
+
+	rules, err := robots.Fetch(s.API.HTTPClient, robotsURL.String(), robotsUserAgent)
+	if err != nil {
+		// Keep the delay from the last successful fetch
+		log.Warnf("Failed to check robots.txt: %v", err)
+		return
+	}
+
+	// The crawl delay only ever slows requests down further than request_delay
+	delay := time.Duration(s.Config.Scraper.RequestDelay)
+	if rules.CrawlDelay > 0 {
+		log.Infof("robots.txt asks for a crawl delay of %s between requests", rules.CrawlDelay)
+		delay = max(delay, rules.CrawlDelay)
+	}
+	if s.API.Throttle == nil {
+		s.API.Throttle = ratelimit.NewRequestLimiter(delay)
+	} else {
+		s.API.Throttle.SetDelay(delay)
+	}
+
+	var disallowed []string
+	for _, endpoint := range robotsCheckedEndpoints {
+		if p := base.Path + endpoint; !rules.Allowed(p) {
+			disallowed = append(disallowed, p)
+		}
+	}
+	if len(disallowed) > 0 {
+		log.Warnf("*** robots.txt on %s disallows API paths used by the scraper: %s. The instance admins may not want automated access. ***",
+			base.Host, strings.Join(disallowed, ", "))
+	}
+}
+
+// updateScoreHistory re-fetches recently scraped posts and records score changes.
+// An empty community covers all recently scraped posts.
+func (s *Scraper) updateScoreHistory(community string) {
+	if !s.Config.Scraper.TrackScoreHistory {
+		return
+	}
+
+	postIDs, err := s.DB.GetRecentlyScrapedPostIDs(community, s.Config.Scraper.ScoreHistoryDays)
+	if err != nil {
+		log.Errorf("Failed to get posts for score tracking: %v", err)
+		return
+	}
+
+	changed := 0
+	for _, postID := range postIDs {
+		postView, err := s.API.GetPostByID(postID)
+		if err != nil {
+			log.Debugf("Failed to refresh score for post %d: %v", postID, err)
+			continue
+		}
+
+		inserted, err := s.DB.RecordScoreSample(postID, postView.Counts.Score)
+		if err != nil {
+			log.Errorf("Failed to record score for post %d: %v", postID, err)
+			continue
+		}
+		if inserted {
+			changed++
+		}
+	}
+
+	log.Debugf("Score history: %d of %d recent posts changed", changed, len(postIDs))
+}
+
 // scrapeHotPage scrapes posts from the instance's hot page
 func (s *Scraper) scrapeHotPage() error {
 	return s.scrapeWithPagination("hot", api.GetPostsParams{
 		Sort: s.Config.Scraper.SortType,
+		Type: s.Config.Scraper.ListingType,
 	})
 }
 
@@ -63,17 +339,71 @@ func (s *Scraper) scrapeCommunity(communityName string) error {
 	return s.scrapeWithPagination(communityName, api.GetPostsParams{
 		Sort:          s.Config.Scraper.SortType,
 		CommunityName: communityName,
+		Type:          s.Config.ListingTypeFor(communityName),
 	})
 }
 
+// ScrapePost archives a single post by ID, whether or not it was scraped before
+func (s *Scraper) ScrapePost(postID int64) error {
+	postView, err := s.API.GetPostByID(postID)
+	if err != nil {
+		return fmt.Errorf("failed to get post %d: %w", postID, err)
+	}
+
+	downloaded, skipped, failed, bytes := s.archivePost(*postView)
+	log.Infof("Post %d (%s): %d downloaded (%s), %d skipped, %d errors",
+		postID, postView.Community.Name, downloaded, format.FileSize(bytes), skipped, failed)
+	return nil
+}
+
+// updateCommunity stores a community's metadata and, if enabled, downloads its
+// icon and banner when they haven't been downloaded yet
+func (s *Scraper) updateCommunity(community models.Community) {
+	if err := s.DB.UpsertCommunity(&community); err != nil {
+		log.Warnf("Failed to save community %s: %v", community.Name, err)
+		return
+	}
+	if !s.Config.Scraper.DownloadCommunityAssets {
+		return
+	}
+
+	stored, err := s.DB.GetCommunity(community.Name)
+	if err != nil || stored == nil {
+		log.Warnf("Failed to load community %s: %v", community.Name, err)
+		return
+	}
+
+	iconPath, bannerPath := stored.IconPath, stored.BannerPath
+	if stored.IconURL != "" && iconPath == "" {
+		if iconPath, err = s.Downloader.SaveCommunityAsset(community.Name, "icon", stored.IconURL); err != nil {
+			log.Warnf("Failed to save icon of %s: %v", community.Name, err)
+		}
+	}
+	if stored.BannerURL != "" && bannerPath == "" {
+		if bannerPath, err = s.Downloader.SaveCommunityAsset(community.Name, "banner", stored.BannerURL); err != nil {
+			log.Warnf("Failed to save banner of %s: %v", community.Name, err)
+		}
+	}
+
+	if iconPath != stored.IconPath || bannerPath != stored.BannerPath {
+		if err := s.DB.SetCommunityAssetPaths(community.Name, iconPath, bannerPath); err != nil {
+			log.Warnf("Failed to save asset paths of %s: %v", community.Name, err)
+		}
+	}
+}
+
 // scrapeWithPagination handles paginated scraping to get more than 50 posts
 func (s *Scraper) scrapeWithPagination(source string, baseParams api.GetPostsParams) error {
 	totalDownloaded := 0
 	totalSkipped := 0
+	totalExcluded := 0
 	totalErrors := 0
+	var totalBytes int64
 	totalProcessed := 0
-	consecutiveSeenPosts := 0
+	seen := newSeenTracker(s.Config.Scraper.SeenPostsWindowSize)
 	page := 1
+	failedPages := 0                    // Pages in a row that couldn't be fetched
+	seenPageIDs := make(map[int64]bool) // Post IDs returned by earlier pages of this run
 
 	for {
 		// Calculate how many more posts we can fetch
@@ -90,27 +420,70 @@ func (s *Scraper) scrapeWithPagination(source string, baseParams api.GetPostsPar
 
 		log.Debugf("Fetching page %d with limit %d", page, params.Limit)
 
-		downloaded, skipped, errors, postsReturned, seenInRow, shouldStop := s.scrapePosts(params, source, consecutiveSeenPosts)
+		result := s.scrapePosts(params, source, seen)
+		postsReturned := len(result.postIDs)
 
-		totalDownloaded += downloaded
-		totalSkipped += skipped
-		totalErrors += errors
+		totalDownloaded += result.downloaded
+		totalBytes += result.bytes
+		totalSkipped += result.skipped
+		totalExcluded += result.excluded
+		totalErrors += result.failed
 		totalProcessed += postsReturned
 
-		consecutiveSeenPosts = seenInRow
+		// A page that still fails after its retries is skipped, unless the
+		// instance has stopped answering altogether
+		if result.fetchErr != nil {
+			if !api.IsTransient(result.fetchErr) {
+				log.Errorf("Stopping %s, retrying wouldn't fix the error", source)
+				break
+			}
+			failedPages++
+			if failedPages >= maxFailedPages {
+				log.Errorf("Stopping %s after %d pages in a row failed", source, failedPages)
+				break
+			}
+			if !s.Config.Scraper.EnablePagination {
+				break
+			}
+			log.Warnf("Skipping page %d of %s, continuing with the next page", page, source)
+			page++
+			continue
+		}
+		failedPages = 0
 
 		// Check if we should stop
-		if shouldStop {
+		if result.stop {
 			log.Infof("Stopping pagination due to idempotency rules")
 			break
 		}
 
-		// If we got fewer posts than requested, we've reached the end
-		if postsReturned < params.Limit {
+		// An empty page means there is nothing left to fetch
+		if postsReturned == 0 {
+			log.Debug("Received an empty page, reached end of available posts")
+			break
+		}
+
+		// Legacy behavior: treat a short page as the end. Lemmy can return fewer
+		// posts than requested when some are filtered out, so this is opt-in.
+		if s.Config.Scraper.StopOnShortPage && postsReturned < params.Limit {
 			log.Debugf("Received fewer posts than requested (%d < %d), reached end of available posts", postsReturned, params.Limit)
 			break
 		}
 
+		// A page made up entirely of posts we've already been given means the
+		// instance is repeating itself past the end of the listing
+		newOnPage := 0
+		for _, id := range result.postIDs {
+			if !seenPageIDs[id] {
+				seenPageIDs[id] = true
+				newOnPage++
+			}
+		}
+		if newOnPage == 0 {
+			log.Debugf("Page %d only contained posts from earlier pages, reached end of available posts", page)
+			break
+		}
+
 		// Only continue to next page if pagination is enabled
 		if !s.Config.Scraper.EnablePagination {
 			log.Debug("Pagination disabled, stopping after first page")
@@ -120,8 +493,8 @@ func (s *Scraper) scrapeWithPagination(source string, baseParams api.GetPostsPar
 		page++
 	}
 
-	log.Infof("Scrape complete for %s: %d downloaded, %d skipped, %d errors (total %d posts processed)",
-		source, totalDownloaded, totalSkipped, totalErrors, totalProcessed)
+	log.Infof("Scrape complete for %s: %d downloaded (%s), %d skipped, %d from filtered communities, %d errors (total %d posts processed)",
+		source, totalDownloaded, format.FileSize(totalBytes), totalSkipped, totalExcluded, totalErrors, totalProcessed)
 	return nil
 }
 
@@ -133,24 +506,97 @@ func min(a, b int) int {
 	return b
 }
 
-// scrapePosts fetches and processes posts based on the given parameters
-// Returns: downloaded, skipped, errors, postsReturned, consecutiveSeenPosts, shouldStop
-func (s *Scraper) scrapePosts(params api.GetPostsParams, source string, currentConsecutiveSeen int) (int, int, int, int, int, bool) {
-	postsResp, err := s.API.GetPosts(params)
+// pageResult is the outcome of scraping one page of posts
+type pageResult struct {
+	downloaded int
+	skipped    int
+	excluded   int // Posts from communities left out by lemmy.skip_communities or scraper.community_filter
+	failed     int
+	bytes      int64   // Bytes downloaded
+	postIDs    []int64 // Posts returned by the API
+	stop       bool    // The seen-post or time cutoff rules call for no further pages
+	fetchErr   error   // The page couldn't be fetched, even after retrying
+}
+
+// Retries of a page of posts whose request failed with a transient error.
+// The delay doubles after each attempt.
+const (
+	pageRetries    = 3
+	pageRetryDelay = 2 * time.Second
+)
+
+// maxFailedPages is how many pages in a row may fail before a source is given up on
+const maxFailedPages = 3
+
+// getPosts fetches a page of posts, retrying transient failures
+func (s *Scraper) getPosts(params api.GetPostsParams, source string) (*models.GetPostsResponse, error) {
+	delay := pageRetryDelay
+	for attempt := 0; ; attempt++ {
+		postsResp, err := s.API.GetPosts(params)
+		if err == nil || attempt == pageRetries || !api.IsTransient(err) {
+			return postsResp, err
+		}
+
+		log.Warnf("Failed to get page %d of %s (attempt %d of %d), retrying in %s: %v",
+			params.Page, source, attempt+1, pageRetries+1, delay, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// scrapePosts fetches and processes posts based on the given parameters,
+// recording which posts were already seen in seen
+func (s *Scraper) scrapePosts(params api.GetPostsParams, source string, seen *seenTracker) pageResult {
+	var result pageResult
+
+	postsResp, err := s.getPosts(params, source)
 	if err != nil {
 		log.Errorf("Failed to get posts: %v", err)
-		return 0, 0, 1, 0, currentConsecutiveSeen, true
+		result.failed = 1
+		result.fetchErr = err
+		return result
 	}
 
-	postsReturned := len(postsResp.Posts)
-	log.Debugf("Retrieved %d posts from %s (page %d)", postsReturned, source, params.Page)
+	result.postIDs = make([]int64, len(postsResp.Posts))
+	for i, postView := range postsResp.Posts {
+		result.postIDs[i] = postView.Post.ID
+	}
+	log.Debugf("Retrieved %d posts from %s (page %d)", len(result.postIDs), source, params.Page)
 
-	downloaded := 0
-	skipped := 0
-	errors := 0
-	consecutiveSeenPosts := currentConsecutiveSeen
+	// Every post in a community listing carries the community's metadata
+	if params.Page == 1 && params.CommunityName != "" && len(postsResp.Posts) > 0 {
+		s.updateCommunity(postsResp.Posts[0].Community)
+	}
 
+	// Posts from skipped communities are dropped before anything else looks at
+	// them, so they aren't marked as seen and a later config change picks them up
+	posts := make([]models.PostView, 0, len(postsResp.Posts))
 	for _, postView := range postsResp.Posts {
+		if s.skipsCommunity(postView.Community.Name) {
+			log.Debugf("Skipping post from filtered community %s: %s", postView.Community.Name, postView.Post.Name)
+			result.excluded++
+			continue
+		}
+		posts = append(posts, postView)
+	}
+
+	// The page's posts are written together once all of them are fetched
+	var fetched []fetchedPost
+	for _, postView := range posts {
+		// Skip posts older than the time cutoff
+		if !s.cutoff.IsZero() && postView.Post.Published.Before(s.cutoff) {
+			log.Debugf("Skipping post published before cutoff (ID: %d)", postView.Post.ID)
+			result.skipped++
+
+			// With newest-first sorting every following post is older too
+			if params.Sort == "New" {
+				log.Info("Reached posts older than the time cutoff, stopping")
+				result.stop = true
+				break
+			}
+			continue
+		}
+
 		// Check if we've already scraped this post
 		exists, err := s.DB.PostExists(postView.Post.ID)
 		if err != nil {
@@ -158,122 +604,281 @@ func (s *Scraper) scrapePosts(params api.GetPostsParams, source string, currentC
 			continue
 		}
 
-		if exists {
-			consecutiveSeenPosts++
+		seen.record(exists)
 
+		if exists {
 			// Check if we should stop based on threshold
-			if s.Config.Scraper.StopAtSeenPosts {
-				if consecutiveSeenPosts >= s.Config.Scraper.SeenPostsThreshold {
-					log.Infof("Encountered %d previously seen posts in a row (threshold: %d), stopping",
-						consecutiveSeenPosts, s.Config.Scraper.SeenPostsThreshold)
-					return downloaded, skipped, errors, postsReturned, consecutiveSeenPosts, true
-				}
+			if s.Config.Scraper.StopAtSeenPosts && s.reachedSeenPosts(seen) {
+				result.stop = true
+				break
 			}
 
 			// Skip this post if configured to do so
 			if s.Config.Scraper.SkipSeenPosts || s.Config.Scraper.StopAtSeenPosts {
 				log.Debugf("Skipping previously seen post (ID: %d)", postView.Post.ID)
-				skipped++
+				result.skipped++
 				continue
 			}
-		} else {
-			// Reset counter when we find a new post
-			consecutiveSeenPosts = 0
-		}
-
-		// Extract media URLs from the post
-		mediaURLs := s.extractMediaURLs(postView)
-		mediaDownloaded := 0
-
-		if len(mediaURLs) == 0 {
-			log.Debugf("No media found in post: %s (ID: %d)", postView.Post.Name, postView.Post.ID)
-		} else {
-			// Download each media URL
-			for _, mediaURL := range mediaURLs {
-				// Check if we should download this type of media
-				if !downloader.ShouldDownload(
-					mediaURL,
-					s.Config.Scraper.IncludeImages,
-					s.Config.Scraper.IncludeVideos,
-					s.Config.Scraper.IncludeOtherMedia,
-				) {
-					log.Debugf("Skipping media (type not enabled): %s", mediaURL)
-					skipped++
-					continue
-				}
+		}
 
-				_, err := s.Downloader.DownloadMedia(mediaURL, postView)
-				if err != nil {
-					if strings.Contains(err.Error(), "already exists") {
-						log.Debugf("Media already exists: %s", mediaURL)
-						skipped++
-					} else {
-						log.Errorf("Failed to download media from %s: %v", mediaURL, err)
-						errors++
-					}
-					continue
-				}
+		post, d, sk, f, b := s.fetchPost(postView)
+		fetched = append(fetched, post)
+		result.downloaded += d
+		result.skipped += sk
+		result.failed += f
+		result.bytes += b
+	}
+
+	// A failed write leaves the page's posts unmarked, so they're tried again next run
+	if err := s.savePosts(fetched); err != nil {
+		log.Errorf("Failed to save %d posts from %s (page %d): %v", len(fetched), source, params.Page, err)
+		result.failed += len(fetched)
+	}
+
+	return result
+}
+
+// skipsCommunity reports whether posts from a community are left out by
+// lemmy.skip_communities or, when it's set, scraper.community_filter
+func (s *Scraper) skipsCommunity(name string) bool {
+	if containsFold(s.Config.Lemmy.SkipCommunities, name) {
+		return true
+	}
+	filter := s.Config.Scraper.CommunityFilter
+	return len(filter) > 0 && !containsFold(filter, name)
+}
+
+// containsFold reports whether names contains name, ignoring case
+func containsFold(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchedPost is a post whose media has been downloaded, with the rows still
+// to be written for it
+type fetchedPost struct {
+	view          models.PostView
+	mediaArchived int // Media downloaded now or already archived from another post
+	comments      []models.CommentView
+	crossposts    []models.PostView
+}
+
+// archivePost downloads the media of a single post, marks the post as scraped
+// and saves its comments if it had media.
+// Returns: downloaded, skipped, errors, bytes downloaded
+func (s *Scraper) archivePost(postView models.PostView) (downloaded, skipped, failed int, bytes int64) {
+	post, downloaded, skipped, failed, bytes := s.fetchPost(postView)
+
+	// A failed write leaves the post unmarked, so it's tried again next run
+	if err := s.savePosts([]fetchedPost{post}); err != nil {
+		log.Errorf("Failed to save post %d: %v", postView.Post.ID, err)
+		failed++
+	}
+	return downloaded, skipped, failed, bytes
+}
+
+// fetchPost downloads the media of a post and, if it had media, fetches its
+// comments and crossposts. Media records are saved as each file is stored, so
+// a failed write of the post's other rows never leaves files without a record.
+// Returns: the post, downloaded, skipped, errors, bytes downloaded
+func (s *Scraper) fetchPost(postView models.PostView) (post fetchedPost, downloaded, skipped, failed int, bytes int64) {
+	post.view = postView
+
+	// Extract media URLs from the post
+	mediaURLs := s.extractMediaURLs(postView)
+
+	if len(mediaURLs) == 0 {
+		log.Debugf("No media found in post: %s (ID: %d)", postView.Post.Name, postView.Post.ID)
+	} else {
+		// Download each media URL
+		for _, mediaURL := range mediaURLs {
+			// Check if we should download this type of media
+			if !downloader.ShouldDownload(
+				mediaURL,
+				s.Config.Scraper.IncludeImages,
+				s.Config.Scraper.IncludeVideos,
+				s.Config.Scraper.IncludeOtherMedia,
+			) {
+				log.Debugf("Skipping media (type not enabled): %s", mediaURL)
+				skipped++
+				continue
+			}
 
+			media, err := s.Downloader.DownloadMedia(mediaURL, postView)
+			switch {
+			case err == nil:
 				downloaded++
-				mediaDownloaded++
+				bytes += media.FileSize
+				post.mediaArchived++
+			case errors.Is(err, downloader.ErrMediaExists):
+				log.Debugf("Media already exists: %s", mediaURL)
+				skipped++
+				post.mediaArchived++
+			case errors.Is(err, downloader.ErrTooLarge), errors.Is(err, downloader.ErrUnsupportedType):
+				log.Infof("Skipping media from %s: %v", mediaURL, err)
+				skipped++
+			default:
+				log.Errorf("Failed to download media from %s: %v", mediaURL, err)
+				failed++
 			}
 		}
+	}
+
+	// Fetch comments and crossposts if the post had media
+	if post.mediaArchived > 0 {
+		post.comments = s.fetchComments(postView.Post.ID)
+		if s.Config.Scraper.TrackCrossposts {
+			post.crossposts = s.fetchCrossposts(postView.Post.ID)
+		}
+	}
+
+	return post, downloaded, skipped, failed, bytes
+}
+
+// savePosts marks fetched posts as scraped (even those without media) and saves
+// their comments and crossposts in one transaction. Everything was fetched
+// beforehand, so the database isn't locked while waiting on the network.
+func (s *Scraper) savePosts(posts []fetchedPost) error {
+	if len(posts) == 0 {
+		return nil
+	}
 
-		// Mark this post as scraped (even if it had no media)
-		if err := s.DB.MarkPostAsScraped(&postView, mediaDownloaded); err != nil {
-			log.Errorf("Failed to mark post %d as scraped: %v", postView.Post.ID, err)
+	return s.DB.WithTx(func(tx *database.Tx) error {
+		for _, post := range posts {
+			postID := post.view.Post.ID
+			if err := tx.MarkPostAsScraped(&post.view, post.mediaArchived); err != nil {
+				return err
+			}
+			if err := s.saveComments(tx, postID, post.comments); err != nil {
+				return err
+			}
+			if len(post.crossposts) > 0 {
+				if err := tx.SaveCrossposts(postID, post.crossposts); err != nil {
+					return err
+				}
+				log.Debugf("Recorded %d crosspost(s) of post %d", len(post.crossposts), postID)
+			}
 		}
+		return nil
+	})
+}
 
-		// Fetch and store comments if the post had media
-		if mediaDownloaded > 0 {
-			s.scrapeComments(postView.Post.ID)
+// reachedSeenPosts reports whether enough recent posts were already scraped to
+// stop paginating. With seen_posts_density_threshold set, that is when the share
+// of seen posts in a full window exceeds it; otherwise it is seen_posts_threshold
+// seen posts in a row.
+func (s *Scraper) reachedSeenPosts(seen *seenTracker) bool {
+	if threshold := s.Config.Scraper.SeenPostsDensityThreshold; threshold > 0 {
+		if seen.full() && seen.density() > threshold {
+			log.Infof("%.0f%% of the last %d posts were previously seen (threshold: %.0f%%), stopping",
+				seen.density()*100, s.Config.Scraper.SeenPostsWindowSize, threshold*100)
+			return true
 		}
+		return false
+	}
+
+	if seen.consecutive >= s.Config.Scraper.SeenPostsThreshold {
+		log.Infof("Encountered %d previously seen posts in a row (threshold: %d), stopping",
+			seen.consecutive, s.Config.Scraper.SeenPostsThreshold)
+		return true
 	}
+	return false
+}
 
-	return downloaded, skipped, errors, postsReturned, consecutiveSeenPosts, false
+// fetchCrossposts fetches the other posts of a post's link. Posts listings
+// don't include them, so this costs one request per post.
+func (s *Scraper) fetchCrossposts(postID int64) []models.PostView {
+	postResp, err := s.API.GetPost(postID)
+	if err != nil {
+		log.Warnf("Failed to fetch crossposts for post %d: %v", postID, err)
+		return nil
+	}
+	return postResp.CrossPosts
 }
 
-// scrapeComments fetches and stores comments for a post
-func (s *Scraper) scrapeComments(postID int64) {
+// fetchComments fetches the comments of a post that are to be archived, or
+// none when comments for the post are already stored
+func (s *Scraper) fetchComments(postID int64) []models.CommentView {
 	// Check if we already have comments for this post
 	exists, err := s.DB.CommentsExistForPost(postID)
 	if err != nil {
 		log.Errorf("Failed to check if comments exist for post %d: %v", postID, err)
-		return
+		return nil
 	}
 	if exists {
 		log.Debugf("Comments already exist for post %d, skipping", postID)
-		return
+		return nil
 	}
 
 	// Fetch comments from API (max_depth=10, limit=500 to get most comments)
-	commentsResp, err := s.API.GetComments(postID, 10, 500)
+	commentsResp, err := s.API.GetComments(postID, 10, 500, s.Config.Scraper.CommentSort)
 	if err != nil {
 		log.Errorf("Failed to fetch comments for post %d: %v", postID, err)
-		return
+		return nil
 	}
 
 	if len(commentsResp.Comments) == 0 {
 		log.Debugf("No comments found for post %d", postID)
-		return
+		return nil
 	}
 
-	// Save each comment to the database
-	savedCount := 0
+	var keep map[int64]bool
+	if minScore := s.Config.Scraper.MinCommentScore; minScore != 0 {
+		keep = commentsAboveScore(commentsResp.Comments, minScore)
+	}
+
+	comments := make([]models.CommentView, 0, len(commentsResp.Comments))
 	for _, commentView := range commentsResp.Comments {
-		// Skip removed or deleted comments
-		if commentView.Comment.Removed || commentView.Comment.Deleted {
+		// Skip removed or deleted comments unless they are being archived
+		if (commentView.Comment.Removed || commentView.Comment.Deleted) && !s.Config.Scraper.KeepRemovedComments {
 			continue
 		}
-
-		if err := s.DB.SaveComment(&commentView); err != nil {
-			log.Errorf("Failed to save comment %d: %v", commentView.Comment.ID, err)
+		if keep != nil && !keep[commentView.Comment.ID] {
 			continue
 		}
-		savedCount++
+		comments = append(comments, commentView)
 	}
 
-	log.Debugf("Saved %d/%d comments for post %d", savedCount, len(commentsResp.Comments), postID)
+	log.Debugf("Keeping %d/%d comments for post %d", len(comments), len(commentsResp.Comments), postID)
+	return comments
+}
+
+// saveComments stores comments fetched for a post. It stops at the first
+// failure, which on PostgreSQL aborts the rest of the transaction anyway.
+func (s *Scraper) saveComments(store database.Store, postID int64, comments []models.CommentView) error {
+	for _, commentView := range comments {
+		if err := store.SaveComment(&commentView); err != nil {
+			return fmt.Errorf("failed to save comment %d: %w", commentView.Comment.ID, err)
+		}
+	}
+	if len(comments) > 0 {
+		log.Debugf("Saved %d comments for post %d", len(comments), postID)
+	}
+	return nil
+}
+
+// commentsAboveScore returns the IDs of comments scoring at least minScore, plus
+// the parents of those comments so that kept replies are never orphaned
+func commentsAboveScore(comments []models.CommentView, minScore int) map[int64]bool {
+	keep := make(map[int64]bool)
+	for _, commentView := range comments {
+		if commentView.Counts.Score < minScore {
+			continue
+		}
+		keep[commentView.Comment.ID] = true
+
+		// The path lists the comment's ancestors from the root ("0") down, then the comment itself
+		for _, part := range strings.Split(commentView.Comment.Path, ".") {
+			if id, err := strconv.ParseInt(part, 10, 64); err == nil && id != 0 {
+				keep[id] = true
+			}
+		}
+	}
+	return keep
 }
 
 // extractMediaURLs extracts all media URLs from a post
@@ -282,8 +887,8 @@ func (s *Scraper) extractMediaURLs(postView models.PostView) []string {
 	var urls []string
 
 	// Priority 1: Main post URL (highest quality, direct link to media)
-	if postView.Post.URL != "" && isMediaURL(postView.Post.URL) {
-		urls = append(urls, postView.Post.URL)
+	if mainURL := s.resolveMediaURL(postView.Post.URL); mainURL != "" {
+		urls = append(urls, mainURL)
 		// If we have a main URL, skip the thumbnail as it's lower quality
 
 		// However, still check for embedded video as it might be different content
@@ -295,12 +900,15 @@ func (s *Scraper) extractMediaURLs(postView models.PostView) []string {
 	}
 
 	// Priority 2: Embedded video URL (if no main URL)
-	if postView.Post.EmbedVideoURL != "" && isMediaURL(postView.Post.EmbedVideoURL) {
+	if embed := postView.Post.EmbedVideoURL; embed != "" && (isMediaURL(embed) || s.isVideoPage(embed)) {
 		urls = append(urls, postView.Post.EmbedVideoURL)
 		return urls
 	}
 
 	// Priority 3: Thumbnail URL (fallback, only if no other media found)
+	if s.Config.Scraper.SkipThumbnails {
+		return urls
+	}
 	if postView.Post.ThumbnailURL != "" && isMediaURL(postView.Post.ThumbnailURL) {
 		urls = append(urls, postView.Post.ThumbnailURL)
 	}
@@ -308,12 +916,41 @@ func (s *Scraper) extractMediaURLs(postView models.PostView) []string {
 	return urls
 }
 
+// resolveMediaURL returns the URL to download for a post's link, or "" if it
+// isn't media. PeerTube video pages are resolved to their video file, and other
+// video platform pages are kept for yt-dlp when it is enabled.
+func (s *Scraper) resolveMediaURL(link string) string {
+	if s.isVideoPage(link) {
+		return link
+	}
+	if link == "" || !isMediaURL(link) {
+		return ""
+	}
+	if !extractor.IsPeerTubeURL(link) {
+		return link
+	}
+
+	videoURL, err := extractor.FetchPeerTubeVideoURL(link, s.Downloader.HTTPClient)
+	if err != nil {
+		log.Warnf("Failed to resolve PeerTube video %s: %v", link, err)
+		return ""
+	}
+	log.Debugf("Resolved PeerTube video %s to %s", link, videoURL)
+	return videoURL
+}
+
+// isVideoPage reports whether a link is a video platform page that yt-dlp will
+// download, which is only when downloader.use_ytdlp is enabled
+func (s *Scraper) isVideoPage(link string) bool {
+	return s.Downloader.YtDlp != nil && extractor.IsVideoPageURL(link)
+}
+
 // isMediaURL checks if a URL points to a media file
 func isMediaURL(url string) bool {
 	url = strings.ToLower(url)
 
 	// Image extensions
-	imageExts := []string{".jpg", ".jpeg", ".png", ".gif", ".webp", ".bmp", ".svg"}
+	imageExts := []string{".jpg", ".jpeg", ".png", ".gif", ".webp", ".bmp", ".svg", ".avif", ".heic", ".heif"}
 	for _, ext := range imageExts {
 		if strings.Contains(url, ext) {
 			return true
@@ -346,5 +983,10 @@ func isMediaURL(url string) bool {
 		}
 	}
 
+	// PeerTube video pages, resolved to the video file before downloading
+	if strings.Contains(url, "/videos/watch/") {
+		return true
+	}
+
 	return false
 }
@@ -0,0 +1,455 @@
+package scraper
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/neo1908/lemmy-image-scraper/internal/api"
+	"github.com/neo1908/lemmy-image-scraper/internal/config"
+	"github.com/neo1908/lemmy-image-scraper/internal/database"
+	"github.com/neo1908/lemmy-image-scraper/internal/downloader"
+	"github.com/neo1908/lemmy-image-scraper/internal/storage"
+	"github.com/neo1908/lemmy-image-scraper/pkg/models"
+)
+
+// pngImage is a 1x1 PNG
+var pngImage = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x06\x00\x00\x00\x1f\x15\xc4\x89" +
+	"\x00\x00\x00\rIDATx\x9cc\xf8\x0f\x00\x00\x01\x01\x00\x05\x18\xd8N\x00\x00\x00\x00IEND\xaeB`\x82")
+
+// testInstance is a fake Lemmy instance serving one post with an image and
+// two comments, and recording the post listings requested
+type testInstance struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	listings []url.Values      // Query of every /post/list request
+	posts    []models.PostView // Posts listed, newest first; post 1 if nil
+
+	communities    []string // Communities hosted on the instance, oldest first
+	communityPages []string // Page of every /community/list request
+
+	onImage func() // Called while the image is being served, if set
+}
+
+// newTestScraper returns a scraper for a fake instance, with a fresh database
+// and local storage in a temporary directory
+func newTestScraper(t *testing.T, configure func(cfg *config.Config)) (*Scraper, *testInstance) {
+	t.Helper()
+	dir := t.TempDir()
+
+	cfg := &config.Config{}
+	cfg.Storage.BaseDirectory = dir
+	cfg.Database.Path = dir + "/test.db"
+	cfg.Scraper.MaxPostsPerRun = 1
+	if configure != nil {
+		configure(cfg)
+	}
+	cfg.SetDefaults()
+
+	db, err := database.New(&cfg.Database, false)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	store, err := storage.NewLocal(dir)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+
+	inst := &testInstance{}
+	inst.Server = httptest.NewServer(http.HandlerFunc(inst.serve))
+	t.Cleanup(inst.Close)
+
+	client := api.NewClient("example.invalid")
+	client.BaseURL = inst.URL + "/api/v3"
+	client.HTTPClient = inst.Client()
+
+	return New(cfg, client, db, downloader.New(db, store)), inst
+}
+
+func (inst *testInstance) serve(w http.ResponseWriter, r *http.Request) {
+	post := models.PostView{
+		Post:      models.Post{ID: 1, Name: "A picture", URL: inst.URL + "/image.png", Published: time.Now().UTC()},
+		Community: models.Community{ID: 1, Name: "pics"},
+		Creator:   models.Person{ID: 1, Name: "bob"},
+	}
+
+	var resp interface{}
+	switch r.URL.Path {
+	case "/api/v3/post/list":
+		inst.mu.Lock()
+		inst.listings = append(inst.listings, r.URL.Query())
+		posts := inst.posts
+		inst.mu.Unlock()
+		if posts == nil {
+			posts = []models.PostView{post}
+		}
+		resp = models.GetPostsResponse{Posts: posts}
+	case "/api/v3/post":
+		id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid id", http.StatusBadRequest)
+			return
+		}
+		post.Post.ID = id
+		resp = models.GetPostResponse{PostView: post}
+	case "/api/v3/community/list":
+		query := r.URL.Query()
+		page, _ := strconv.Atoi(query.Get("page"))
+		limit, _ := strconv.Atoi(query.Get("limit"))
+		inst.mu.Lock()
+		inst.communityPages = append(inst.communityPages, query.Get("page"))
+		list := models.ListCommunitiesResponse{Communities: []models.CommunityView{}}
+		for i := (page - 1) * limit; i < page*limit && i < len(inst.communities); i++ {
+			list.Communities = append(list.Communities, models.CommunityView{
+				Community: models.Community{ID: int64(i + 1), Name: inst.communities[i]},
+			})
+		}
+		inst.mu.Unlock()
+		resp = list
+	case "/api/v3/comment/list":
+		resp = models.GetCommentsResponse{Comments: []models.CommentView{
+			{Comment: models.Comment{ID: 10, PostID: 1, Content: "Nice", Path: "0.10"}},
+			{Comment: models.Comment{ID: 11, PostID: 1, Content: "Thanks", Path: "0.10.11"}},
+		}}
+	case "/image.png":
+		if inst.onImage != nil {
+			inst.onImage()
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(pngImage)
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func TestScrapeCommunityArchivesPost(t *testing.T) {
+	s, inst := newTestScraper(t, nil)
+
+	// The database must stay writable while media downloads
+	var writeErr error
+	inst.onImage = func() {
+		_, writeErr = s.DB.RecordScoreSample(99, 1)
+	}
+
+	if err := s.scrapeCommunity("pics"); err != nil {
+		t.Fatalf("scrapeCommunity: %v", err)
+	}
+	if writeErr != nil {
+		t.Errorf("database write during download failed: %v", writeErr)
+	}
+
+	if exists, err := s.DB.PostExists(1); err != nil || !exists {
+		t.Errorf("post marked as scraped = %v, err = %v", exists, err)
+	}
+	var media int
+	if err := s.DB.Get(&media, `SELECT COUNT(*) FROM scraped_media WHERE post_id = ?`, 1); err != nil || media != 1 {
+		t.Errorf("media of post = %d, err = %v, want 1", media, err)
+	}
+	comments, err := s.DB.GetCommentsByPostID(1, false)
+	if err != nil || len(comments) != 2 {
+		t.Errorf("comments = %d, err = %v, want 2", len(comments), err)
+	}
+}
+
+func TestListingTypePerCommunity(t *testing.T) {
+	all := "all"
+	s, inst := newTestScraper(t, func(cfg *config.Config) {
+		cfg.Scraper.ListingType = "Local"
+		cfg.Lemmy.CommunityOverrides = map[string]config.CommunityOverride{
+			"pics": {ListingType: &all},
+		}
+	})
+
+	if err := s.scrapeCommunity("pics"); err != nil {
+		t.Fatalf("scrapeCommunity(pics): %v", err)
+	}
+	if err := s.scrapeCommunity("memes"); err != nil {
+		t.Fatalf("scrapeCommunity(memes): %v", err)
+	}
+	if err := s.scrapeHotPage(); err != nil {
+		t.Fatalf("scrapeHotPage: %v", err)
+	}
+
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+	if len(inst.listings) != 3 {
+		t.Fatalf("post listings requested = %d, want 3", len(inst.listings))
+	}
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"community with override", "All"},
+		{"community without override", "Local"},
+		{"hot page", "Local"},
+	}
+	for i, tt := range tests {
+		if got := inst.listings[i].Get("type_"); got != tt.want {
+			t.Errorf("%s: type_ = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestListingTypeReachesCommunityListings(t *testing.T) {
+	tests := []struct {
+		listingType string
+		want        string
+	}{
+		{"", "Local"},
+		{"local", "Local"},
+		{"All", "All"},
+		{"subscribed", "Subscribed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			s, inst := newTestScraper(t, func(cfg *config.Config) {
+				cfg.Scraper.ListingType = tt.listingType
+			})
+
+			if err := s.scrapeCommunity("pics"); err != nil {
+				t.Fatalf("scrapeCommunity: %v", err)
+			}
+			if err := s.scrapeHotPage(); err != nil {
+				t.Fatalf("scrapeHotPage: %v", err)
+			}
+
+			inst.mu.Lock()
+			defer inst.mu.Unlock()
+			for i, query := range inst.listings {
+				if got := query.Get("type_"); got != tt.want {
+					t.Errorf("listing %d: type_ = %q, want %q", i, got, tt.want)
+				}
+			}
+			if len(inst.listings) != 2 {
+				t.Errorf("post listings requested = %d, want 2", len(inst.listings))
+			}
+		})
+	}
+}
+
+func TestSinceAutoCutoffIsPerCommunity(t *testing.T) {
+	s, _ := newTestScraper(t, nil)
+	s.SinceAuto = true
+
+	if err := s.RunCommunities([]string{"pics"}); err != nil {
+		t.Fatalf("RunCommunities(pics): %v", err)
+	}
+	picsRun := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	if _, err := s.DB.Exec(`UPDATE scrape_runs SET started_at = ?`, picsRun); err != nil {
+		t.Fatal(err)
+	}
+
+	// A later run covering only another community, as in continuous mode
+	if err := s.RunCommunities([]string{"memes"}); err != nil {
+		t.Fatalf("RunCommunities(memes): %v", err)
+	}
+
+	if err := s.setCutoff("pics"); err != nil {
+		t.Fatalf("setCutoff: %v", err)
+	}
+	if !s.cutoff.Equal(picsRun) {
+		t.Errorf("cutoff for pics = %v, want %v", s.cutoff, picsRun)
+	}
+	if err := s.setCutoff("news"); err != nil {
+		t.Fatalf("setCutoff: %v", err)
+	}
+	if !s.cutoff.IsZero() {
+		t.Errorf("cutoff for a community never scraped = %v, want none", s.cutoff)
+	}
+}
+
+func TestTargetsListsEveryCommunityPage(t *testing.T) {
+	s, inst := newTestScraper(t, func(cfg *config.Config) {
+		cfg.Scraper.ScrapeAllCommunities = true
+	})
+	for i := 0; i < 2*communityListPageSize+20; i++ {
+		inst.communities = append(inst.communities, fmt.Sprintf("community%d", i))
+	}
+
+	targets, err := s.Targets()
+	if err != nil {
+		t.Fatalf("Targets: %v", err)
+	}
+	if fmt.Sprint(targets) != fmt.Sprint(inst.communities) {
+		t.Errorf("Targets returned %d communities, want all %d in order", len(targets), len(inst.communities))
+	}
+	if got := fmt.Sprint(inst.communityPages); got != "[1 2 3]" {
+		t.Errorf("pages requested = %s, want [1 2 3]", got)
+	}
+}
+
+func TestScrapePostFetchesThePost(t *testing.T) {
+	s, inst := newTestScraper(t, nil)
+
+	if err := s.ScrapePost(7); err != nil {
+		t.Fatalf("ScrapePost: %v", err)
+	}
+
+	if exists, err := s.DB.PostExists(7); err != nil || !exists {
+		t.Errorf("post 7 marked as scraped = %v, err = %v", exists, err)
+	}
+	if exists, err := s.DB.PostExists(1); err != nil || exists {
+		t.Errorf("post 1 marked as scraped = %v, err = %v", exists, err)
+	}
+	var media int
+	if err := s.DB.Get(&media, `SELECT COUNT(*) FROM scraped_media WHERE post_id = ?`, 7); err != nil || media != 1 {
+		t.Errorf("media of post 7 = %d, err = %v, want 1", media, err)
+	}
+
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+	if len(inst.listings) != 0 {
+		t.Errorf("post listings requested = %d, want 0", len(inst.listings))
+	}
+}
+
+func TestSkippedCommunityPostIsNotDownloaded(t *testing.T) {
+	s, inst := newTestScraper(t, func(cfg *config.Config) {
+		cfg.Scraper.MaxPostsPerRun = 10
+		cfg.Lemmy.SkipCommunities = []string{"Memes"}
+	})
+	// The skipped post is NSFW and scores highly, so only the skip keeps it out
+	skipped := models.PostView{
+		Post:      models.Post{ID: 2, Name: "A meme", URL: inst.URL + "/image.png", NSFW: true, Published: time.Now().UTC()},
+		Community: models.Community{ID: 2, Name: "memes"},
+		Creator:   models.Person{ID: 1, Name: "bob"},
+		Counts:    models.PostAggregates{Score: 1000},
+	}
+	kept := models.PostView{
+		Post:      models.Post{ID: 1, Name: "A picture", URL: inst.URL + "/image.png", Published: time.Now().UTC()},
+		Community: models.Community{ID: 1, Name: "pics"},
+		Creator:   models.Person{ID: 1, Name: "bob"},
+		Counts:    models.PostAggregates{Score: 1},
+	}
+	inst.posts = []models.PostView{skipped, kept}
+	var images int
+	inst.onImage = func() { images++ }
+
+	result := s.scrapePosts(api.GetPostsParams{Sort: "Hot"}, "hot", newSeenTracker(1))
+
+	if result.excluded != 1 || result.downloaded != 1 {
+		t.Errorf("excluded, downloaded = %d, %d, want 1, 1", result.excluded, result.downloaded)
+	}
+	if images != 1 {
+		t.Errorf("image requests = %d, want 1", images)
+	}
+	if exists, err := s.DB.PostExists(2); err != nil || exists {
+		t.Errorf("skipped post marked as scraped = %v, err = %v", exists, err)
+	}
+	var media int
+	if err := s.DB.Get(&media, `SELECT COUNT(*) FROM scraped_media WHERE post_id = ?`, 2); err != nil || media != 0 {
+		t.Errorf("media of skipped post = %d, err = %v, want 0", media, err)
+	}
+	if exists, err := s.DB.PostExists(1); err != nil || !exists {
+		t.Errorf("kept post marked as scraped = %v, err = %v", exists, err)
+	}
+}
+
+func TestUpdateCommunityDownloadsAssets(t *testing.T) {
+	s, inst := newTestScraper(t, func(cfg *config.Config) {
+		cfg.Scraper.DownloadCommunityAssets = true
+	})
+	var images int
+	inst.onImage = func() { images++ }
+
+	community := models.Community{ID: 1, Name: "pics", Icon: inst.URL + "/image.png", Banner: inst.URL + "/image.png?banner"}
+	s.updateCommunity(community)
+
+	stored, err := s.DB.GetCommunity("pics")
+	if err != nil || stored == nil {
+		t.Fatalf("GetCommunity = %v, %v", stored, err)
+	}
+	if stored.IconPath != ".community_assets/pics/icon.png" || stored.BannerPath != ".community_assets/pics/banner.png" {
+		t.Errorf("icon, banner paths = %q, %q", stored.IconPath, stored.BannerPath)
+	}
+	for _, key := range []string{stored.IconPath, stored.BannerPath} {
+		content, err := os.ReadFile(s.Downloader.Storage.Location(key))
+		if err != nil || !bytes.Equal(content, pngImage) {
+			t.Errorf("%s = %d bytes, err = %v, want the image", key, len(content), err)
+		}
+	}
+	if images != 2 {
+		t.Errorf("image requests = %d, want 2", images)
+	}
+
+	// Stored assets are kept until their URL changes
+	s.updateCommunity(community)
+	if images != 2 {
+		t.Errorf("image requests after an unchanged update = %d, want 2", images)
+	}
+	community.Icon = inst.URL + "/image.png?v=2"
+	s.updateCommunity(community)
+	if images != 3 {
+		t.Errorf("image requests after the icon changed = %d, want 3", images)
+	}
+}
+
+func TestPageIsSavedInOneTransaction(t *testing.T) {
+	s, inst := newTestScraper(t, func(cfg *config.Config) {
+		cfg.Scraper.MaxPostsPerRun = 10
+	})
+	inst.posts = []models.PostView{
+		{
+			Post:      models.Post{ID: 2, Name: "A question", Published: time.Now().UTC()},
+			Community: models.Community{ID: 1, Name: "pics"},
+			Creator:   models.Person{ID: 1, Name: "bob"},
+		},
+		{
+			Post:      models.Post{ID: 1, Name: "A picture", URL: inst.URL + "/image.png", Published: time.Now().UTC()},
+			Community: models.Community{ID: 1, Name: "pics"},
+			Creator:   models.Person{ID: 1, Name: "bob"},
+		},
+	}
+
+	// Marking post 1 fails, which must not leave post 2, written first, marked either
+	_, err := s.DB.Exec(`
+		CREATE TRIGGER fail_post_1 BEFORE INSERT ON scraped_posts WHEN NEW.post_id = 1
+		BEGIN SELECT RAISE(ABORT, 'disk full'); END
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := s.scrapePosts(api.GetPostsParams{Sort: "New"}, "pics", newSeenTracker(1))
+
+	if result.downloaded != 1 || result.failed != 2 {
+		t.Errorf("downloaded, failed = %d, %d, want 1, 2", result.downloaded, result.failed)
+	}
+	for _, id := range []int64{1, 2} {
+		if exists, err := s.DB.PostExists(id); err != nil || exists {
+			t.Errorf("post %d marked as scraped = %v, err = %v, want neither post", id, exists, err)
+		}
+	}
+	// The media record was saved when the file was stored
+	var media int
+	if err := s.DB.Get(&media, `SELECT COUNT(*) FROM scraped_media WHERE post_id = ?`, 1); err != nil || media != 1 {
+		t.Errorf("media of post 1 = %d, err = %v, want 1", media, err)
+	}
+
+	// Both posts are written on the next run
+	if _, err := s.DB.Exec(`DROP TRIGGER fail_post_1`); err != nil {
+		t.Fatal(err)
+	}
+	if result := s.scrapePosts(api.GetPostsParams{Sort: "New"}, "pics", newSeenTracker(1)); result.failed != 0 {
+		t.Errorf("failed on the next run = %d, want 0", result.failed)
+	}
+	for _, id := range []int64{1, 2} {
+		if exists, err := s.DB.PostExists(id); err != nil || !exists {
+			t.Errorf("post %d marked as scraped on the next run = %v, err = %v", id, exists, err)
+		}
+	}
+}
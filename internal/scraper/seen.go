@@ -0,0 +1,55 @@
+package scraper
+
+// seenTracker follows which of the most recent posts were already scraped by an
+// earlier run. It counts seen posts in a row and keeps the last windowSize
+// seen flags in a ring buffer to work out how dense seen posts are.
+type seenTracker struct {
+	consecutive int    // Seen posts in a row
+	window      []bool // Ring buffer of the most recent seen flags
+	next        int    // Index the next flag is written to
+	filled      int    // Number of flags in the buffer
+	seenCount   int    // Number of true flags in the buffer
+}
+
+// newSeenTracker creates a tracker with a sliding window of windowSize posts
+func newSeenTracker(windowSize int) *seenTracker {
+	if windowSize < 1 {
+		windowSize = 1
+	}
+	return &seenTracker{window: make([]bool, windowSize)}
+}
+
+// record adds the next post, replacing the oldest one once the window is full
+func (t *seenTracker) record(seen bool) {
+	if seen {
+		t.consecutive++
+	} else {
+		t.consecutive = 0
+	}
+
+	if t.filled == len(t.window) {
+		if t.window[t.next] {
+			t.seenCount--
+		}
+	} else {
+		t.filled++
+	}
+	t.window[t.next] = seen
+	if seen {
+		t.seenCount++
+	}
+	t.next = (t.next + 1) % len(t.window)
+}
+
+// full reports whether the window holds windowSize posts yet
+func (t *seenTracker) full() bool {
+	return t.filled == len(t.window)
+}
+
+// density returns the fraction of posts in the window that were seen
+func (t *seenTracker) density() float64 {
+	if t.filled == 0 {
+		return 0
+	}
+	return float64(t.seenCount) / float64(t.filled)
+}
@@ -0,0 +1,102 @@
+package scraper
+
+import (
+	"math"
+	"testing"
+
+	"github.com/neo1908/lemmy-image-scraper/internal/config"
+)
+
+// seenSequence parses a sequence of posts, "s" for seen and "n" for new
+func seenSequence(seq string) []bool {
+	flags := make([]bool, len(seq))
+	for i, c := range seq {
+		flags[i] = c == 's'
+	}
+	return flags
+}
+
+func TestSeenTrackerDensity(t *testing.T) {
+	tests := []struct {
+		name        string
+		window      int
+		seq         string
+		full        bool
+		density     float64
+		consecutive int
+	}{
+		{"empty", 4, "", false, 0, 0},
+		{"all seen", 4, "ssss", true, 1, 4},
+		{"none seen", 4, "nnnn", true, 0, 0},
+		{"window not yet full", 4, "ssn", false, 2.0 / 3, 0},
+		{"wrap-around drops the oldest", 4, "nnnnss", true, 0.5, 2},
+		{"wrap-around past seen posts", 4, "ssssnnn", true, 0.25, 0},
+		{"several wraps", 3, "snsnsnsns", true, 2.0 / 3, 1},
+		{"window of one", 1, "sns", true, 1, 1},
+		{"window size below one", 0, "ns", true, 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := newSeenTracker(tt.window)
+			for _, seen := range seenSequence(tt.seq) {
+				tracker.record(seen)
+			}
+			if tracker.full() != tt.full {
+				t.Errorf("full = %v, want %v", tracker.full(), tt.full)
+			}
+			if math.Abs(tracker.density()-tt.density) > 1e-9 {
+				t.Errorf("density = %v, want %v", tracker.density(), tt.density)
+			}
+			if tracker.consecutive != tt.consecutive {
+				t.Errorf("consecutive = %d, want %d", tracker.consecutive, tt.consecutive)
+			}
+		})
+	}
+}
+
+func TestReachedSeenPostsByDensity(t *testing.T) {
+	tests := []struct {
+		name string
+		seq  string
+		stop bool
+	}{
+		{"all seen", "ssss", true},
+		{"window not yet full", "sss", false},
+		{"exactly at threshold", "ssnn", false},
+		{"above threshold", "snss", true},
+		{"below threshold after wrap-around", "ssssnnn", false},
+		{"above threshold after wrap-around", "nnnnsss", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Scraper{Config: &config.Config{}}
+			s.Config.Scraper.SeenPostsDensityThreshold = 0.5
+			s.Config.Scraper.SeenPostsWindowSize = 4
+
+			tracker := newSeenTracker(4)
+			for _, seen := range seenSequence(tt.seq) {
+				tracker.record(seen)
+			}
+			if got := s.reachedSeenPosts(tracker); got != tt.stop {
+				t.Errorf("reachedSeenPosts = %v, want %v", got, tt.stop)
+			}
+		})
+	}
+}
+
+func TestReachedSeenPostsInARow(t *testing.T) {
+	s := &Scraper{Config: &config.Config{}}
+	s.Config.Scraper.SeenPostsThreshold = 3
+
+	tracker := newSeenTracker(20)
+	for i, seen := range seenSequence("ssnss") {
+		tracker.record(seen)
+		if s.reachedSeenPosts(tracker) {
+			t.Fatalf("stopped after post %d with only %d seen in a row", i+1, tracker.consecutive)
+		}
+	}
+	tracker.record(true)
+	if !s.reachedSeenPosts(tracker) {
+		t.Error("didn't stop after 3 seen posts in a row")
+	}
+}
@@ -0,0 +1,41 @@
+package scraper
+
+import (
+	"github.com/neo1908/lemmy-image-scraper/pkg/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// SubscribeCommunities follows every configured community the account isn't
+// subscribed to yet. An instance only receives the posts of a community on
+// another instance once someone on it follows the community, so without this
+// a newly configured remote community can come back empty. Failures are
+// logged and don't stop the run.
+func (s *Scraper) SubscribeCommunities() {
+	for _, name := range s.Config.Lemmy.Communities {
+		view, err := s.API.GetCommunity(name)
+		if err != nil {
+			log.Warnf("Failed to look up community %s to subscribe: %v", name, err)
+			continue
+		}
+
+		switch view.Subscribed {
+		case models.SubscribedTypeSubscribed:
+			log.Debugf("Already subscribed to %s", name)
+			continue
+		case models.SubscribedTypePending:
+			log.Debugf("Subscription to %s is still pending", name)
+			continue
+		}
+
+		followed, err := s.API.FollowCommunity(view.Community.ID)
+		if err != nil {
+			log.Warnf("Failed to subscribe to %s: %v", name, err)
+			continue
+		}
+		if followed.Subscribed == models.SubscribedTypePending {
+			log.Infof("Subscribed to %s, waiting for its instance to accept; new posts arrive once it does", name)
+		} else {
+			log.Infof("Subscribed to %s", name)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package scraper
+
+import (
+	"context"
+	"time"
+
+	"github.com/neo1908/lemmy-image-scraper/internal/api"
+	"github.com/neo1908/lemmy-image-scraper/internal/format"
+	log "github.com/sirupsen/logrus"
+)
+
+// watchPageSize is how many of the newest posts are scraped when a new post is detected
+const watchPageSize = 50
+
+// Watch scrapes new posts as they appear. It catches up with one normal run,
+// then every pollInterval asks each community for only its newest post and
+// scrapes the newest page of posts when that post is one it hasn't seen yet.
+// Quiet communities cost one small request per poll. Watch returns when ctx is done.
+func (s *Scraper) Watch(ctx context.Context, pollInterval time.Duration) error {
+	targets, err := s.Targets()
+	if err != nil {
+		return err
+	}
+
+	if err := s.RunCommunities(targets); err != nil {
+		log.Errorf("Scraper error: %v", err)
+	}
+
+	// Highest post ID seen per community; an empty name is the hot page
+	newest := make(map[string]int64, len(targets))
+	for _, community := range targets {
+		if id, err := s.newestPostID(community); err != nil {
+			log.Warnf("Failed to check newest post in %s: %v", sourceName(community), err)
+		} else {
+			newest[community] = id
+		}
+	}
+
+	log.Infof("Watching %d source(s) for new posts every %s", len(targets), pollInterval)
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		for _, community := range targets {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			id, err := s.newestPostID(community)
+			if err != nil {
+				log.Warnf("Failed to check newest post in %s: %v", sourceName(community), err)
+				continue
+			}
+			if id <= newest[community] {
+				continue
+			}
+
+			log.Debugf("New post %d detected in %s", id, sourceName(community))
+			newest[community] = id
+			s.scrapeNewest(community)
+		}
+	}
+}
+
+// newestPostID returns the ID of the newest post in a community, or 0 if it has none
+func (s *Scraper) newestPostID(community string) (int64, error) {
+	resp, err := s.API.GetPosts(s.newPostsParams(community, 1))
+	if err != nil {
+		return 0, err
+	}
+	if len(resp.Posts) == 0 {
+		return 0, nil
+	}
+	return resp.Posts[0].Post.ID, nil
+}
+
+// scrapeNewest scrapes the newest page of posts in a community
+func (s *Scraper) scrapeNewest(community string) {
+	source := sourceName(community)
+	result := s.scrapePosts(s.newPostsParams(community, watchPageSize), source,
+		newSeenTracker(s.Config.Scraper.SeenPostsWindowSize))
+	log.Infof("Watch scrape for %s: %d downloaded (%s), %d skipped, %d from filtered communities, %d errors",
+		source, result.downloaded, format.FileSize(result.bytes), result.skipped, result.excluded, result.failed)
+}
+
+// newPostsParams lists a community's posts newest first
+func (s *Scraper) newPostsParams(community string, limit int) api.GetPostsParams {
+	return api.GetPostsParams{
+		Sort:          "New",
+		Page:          1,
+		Limit:         limit,
+		CommunityName: community,
+		Type:          s.Config.ListingTypeFor(community),
+	}
+}
+
+// sourceName names a scrape target in logs, where an empty community is the hot page
+func sourceName(community string) string {
+	if community == "" {
+		return "hot"
+	}
+	return community
+}
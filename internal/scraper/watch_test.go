@@ -0,0 +1,84 @@
+package scraper
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/neo1908/lemmy-image-scraper/internal/config"
+	"github.com/neo1908/lemmy-image-scraper/pkg/models"
+)
+
+// countListings returns how many listings of the newest posts were requested
+// with the given limit: 1 for polls, watchPageSize for scrapes
+func (inst *testInstance) countListings(limit string) int {
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+	n := 0
+	for _, query := range inst.listings {
+		if query.Get("sort") == "New" && query.Get("limit") == limit {
+			n++
+		}
+	}
+	return n
+}
+
+// waitFor polls cond until it holds, failing the test after a few seconds
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWatchScrapesOnlyWhenANewPostAppears(t *testing.T) {
+	s, inst := newTestScraper(t, func(cfg *config.Config) {
+		cfg.Lemmy.Communities = []string{"pics"}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Watch(ctx, 10*time.Millisecond) }()
+
+	// The initial newest-post check and two polls that find nothing new
+	waitFor(t, "polls without a new post", func() bool { return inst.countListings("1") >= 3 })
+	if n := inst.countListings("50"); n != 0 {
+		t.Fatalf("scraped the newest page %d times without a new post", n)
+	}
+
+	// Post 2 appears
+	inst.mu.Lock()
+	inst.posts = []models.PostView{
+		{
+			Post:      models.Post{ID: 2, Name: "Another picture", URL: inst.URL + "/image.png?2", Published: time.Now().UTC()},
+			Community: models.Community{ID: 1, Name: "pics"},
+			Creator:   models.Person{ID: 1, Name: "bob"},
+		},
+	}
+	inst.mu.Unlock()
+
+	waitFor(t, "the new post to be scraped", func() bool { return inst.countListings("50") >= 1 })
+	polls := inst.countListings("1")
+	waitFor(t, "more polls", func() bool { return inst.countListings("1") >= polls+2 })
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Watch: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Watch didn't return after the context was cancelled")
+	}
+
+	if n := inst.countListings("50"); n != 1 {
+		t.Errorf("scraped the newest page %d times, want 1", n)
+	}
+	if exists, err := s.DB.PostExists(2); err != nil || !exists {
+		t.Errorf("new post scraped = %v, err = %v", exists, err)
+	}
+}
@@ -0,0 +1,65 @@
+package singleflight
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"testing/synctest"
+)
+
+func TestDoSharesRunningCall(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		var g Group[int]
+		var calls int
+		release := make(chan struct{})
+
+		const callers = 5
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		sharedCount := 0
+		for i := 0; i < callers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				value, err, shared := g.Do("key", func() (int, error) {
+					calls++
+					<-release
+					return 42, nil
+				})
+				if value != 42 || err != nil {
+					t.Errorf("Do = %d, %v, want 42, nil", value, err)
+				}
+				if shared {
+					mu.Lock()
+					sharedCount++
+					mu.Unlock()
+				}
+			}()
+		}
+
+		// Every caller is now running or waiting on the one call
+		synctest.Wait()
+		close(release)
+		wg.Wait()
+
+		if calls != 1 {
+			t.Errorf("fn ran %d times, want 1", calls)
+		}
+		if sharedCount != callers-1 {
+			t.Errorf("%d callers shared the result, want %d", sharedCount, callers-1)
+		}
+	})
+}
+
+func TestDoRunsAgainAfterFinishing(t *testing.T) {
+	var g Group[int]
+	errFailed := errors.New("failed")
+
+	if _, err, _ := g.Do("key", func() (int, error) { return 0, errFailed }); !errors.Is(err, errFailed) {
+		t.Fatalf("first call: err = %v, want %v", err, errFailed)
+	}
+	value, err, shared := g.Do("key", func() (int, error) { return 7, nil })
+	if value != 7 || err != nil || shared {
+		t.Errorf("second call = %d, %v, shared %v, want 7, nil, false", value, err, shared)
+	}
+}
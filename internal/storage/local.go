@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrInvalidKey is returned for a key that would resolve outside the base
+// directory, e.g. one containing ".." elements
+var ErrInvalidKey = errors.New("storage key outside base directory")
+
+// Local stores media files on the local filesystem
+type Local struct {
+	BaseDir string
+}
+
+// NewLocal creates a local filesystem storage rooted at baseDir
+func NewLocal(baseDir string) (*Local, error) {
+	if err := os.MkdirAll(baseDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+	return &Local{BaseDir: baseDir}, nil
+}
+
+// Path returns the full filesystem path for a key
+func (l *Local) Path(key string) string {
+	return filepath.Join(l.BaseDir, filepath.FromSlash(key))
+}
+
+// resolve returns the full filesystem path for a key, or ErrInvalidKey if it
+// isn't below the base directory
+func (l *Local) resolve(key string) (string, error) {
+	fullPath := l.Path(key)
+	if _, ok := l.Key(fullPath); !ok {
+		return "", fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	return fullPath, nil
+}
+
+// Put writes data to disk, creating parent directories as needed
+func (l *Local) Put(key string, data []byte, contentType string) (string, error) {
+	fullPath, err := l.resolve(key)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := os.WriteFile(fullPath, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write file: %w", err)
+	}
+	return fullPath, nil
+}
+
+// Location returns the full filesystem path for a key, as recorded by Put
+func (l *Local) Location(key string) string {
+	return l.Path(key)
+}
+
+// Key returns the key of a full filesystem path below the base directory
+func (l *Local) Key(location string) (string, bool) {
+	if location == "" {
+		return "", false
+	}
+	rel, err := filepath.Rel(l.BaseDir, location)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// Get opens the file stored under key
+func (l *Local) Get(key string) (io.ReadCloser, error) {
+	fullPath, err := l.resolve(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	return f, nil
+}
+
+// Exists reports whether a file is stored under key
+func (l *Local) Exists(key string) (bool, error) {
+	fullPath, err := l.resolve(key)
+	if err != nil {
+		return false, err
+	}
+	_, err = os.Stat(fullPath)
+	if err == nil {
+		return true, nil
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return false, fmt.Errorf("failed to stat file: %w", err)
+}
+
+// Delete removes the file stored under key
+func (l *Local) Delete(key string) error {
+	fullPath, err := l.resolve(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(fullPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+	return nil
+}
+
+// URL returns an empty string; local files are served directly by the web server
+func (l *Local) URL(key string) (string, error) {
+	return "", nil
+}
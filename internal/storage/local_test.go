@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalRejectsKeysOutsideBase(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "media")
+	l, err := NewLocal(base)
+	if err != nil {
+		t.Fatalf("NewLocal: %v", err)
+	}
+
+	for _, key := range []string{"..", "../escaped.png", "pics/../../escaped.png", "."} {
+		if _, err := l.Put(key, []byte("data"), "image/png"); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Put(%q): err = %v, want ErrInvalidKey", key, err)
+		}
+		if _, err := l.Get(key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Get(%q): err = %v, want ErrInvalidKey", key, err)
+		}
+		if err := l.Delete(key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Delete(%q): err = %v, want ErrInvalidKey", key, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escaped.png")); !os.IsNotExist(err) {
+		t.Errorf("file written outside the base directory: %v", err)
+	}
+
+	// Keys that stay inside, even through "..", are fine
+	path, err := l.Put("pics/../other/1_a.png", []byte("data"), "image/png")
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if want := filepath.Join(base, "other", "1_a.png"); path != want {
+		t.Errorf("Put stored at %s, want %s", path, want)
+	}
+}
@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/neo1908/lemmy-image-scraper/internal/config"
+)
+
+// S3 stores media files in an S3-compatible bucket (AWS S3, MinIO, etc.)
+type S3 struct {
+	Client    *minio.Client
+	Bucket    string
+	Prefix    string
+	URLExpiry time.Duration
+}
+
+// NewS3 creates an S3 storage backend from configuration
+func NewS3(cfg config.S3Config) (*S3, error) {
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKeyID, cfg.SecretAccessKey, ""),
+		Secure: !cfg.DisableSSL,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client: %w", err)
+	}
+
+	return &S3{
+		Client:    client,
+		Bucket:    cfg.Bucket,
+		Prefix:    cfg.Prefix,
+		URLExpiry: time.Duration(cfg.URLExpiry),
+	}, nil
+}
+
+// objectName returns the bucket object name for a key
+func (s *S3) objectName(key string) string {
+	return path.Join(s.Prefix, key)
+}
+
+// Put uploads data to the bucket and returns an s3:// URI for the object
+func (s *S3) Put(key string, data []byte, contentType string) (string, error) {
+	name := s.objectName(key)
+	_, err := s.Client.PutObject(context.Background(), s.Bucket, name,
+		bytes.NewReader(data), int64(len(data)),
+		minio.PutObjectOptions{ContentType: contentType},
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload object: %w", err)
+	}
+	return s.Location(key), nil
+}
+
+// Location returns the s3:// URI of the object for a key, as recorded by Put
+func (s *S3) Location(key string) string {
+	return fmt.Sprintf("s3://%s/%s", s.Bucket, s.objectName(key))
+}
+
+// Key returns the key of an s3:// URI for an object below the bucket's prefix
+func (s *S3) Key(location string) (string, bool) {
+	name, ok := strings.CutPrefix(location, fmt.Sprintf("s3://%s/", s.Bucket))
+	if !ok {
+		return "", false
+	}
+	if prefix := s.objectName(""); prefix != "" {
+		if name, ok = strings.CutPrefix(name, strings.TrimSuffix(prefix, "/")+"/"); !ok {
+			return "", false
+		}
+	}
+	if name == "" {
+		return "", false
+	}
+	return name, true
+}
+
+// Get opens the object stored under key
+func (s *S3) Get(key string) (io.ReadCloser, error) {
+	obj, err := s.Client.GetObject(context.Background(), s.Bucket, s.objectName(key), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object: %w", err)
+	}
+	return obj, nil
+}
+
+// Exists reports whether an object is stored under key
+func (s *S3) Exists(key string) (bool, error) {
+	_, err := s.Client.StatObject(context.Background(), s.Bucket, s.objectName(key), minio.StatObjectOptions{})
+	if err == nil {
+		return true, nil
+	}
+	if minio.ToErrorResponse(err).Code == minio.NoSuchKey {
+		return false, nil
+	}
+	return false, fmt.Errorf("failed to stat object: %w", err)
+}
+
+// Delete removes the object stored under key
+func (s *S3) Delete(key string) error {
+	if err := s.Client.RemoveObject(context.Background(), s.Bucket, s.objectName(key), minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("failed to delete object: %w", err)
+	}
+	return nil
+}
+
+// URL returns a presigned GET URL for the object
+func (s *S3) URL(key string) (string, error) {
+	u, err := s.Client.PresignedGetObject(context.Background(), s.Bucket, s.objectName(key), s.URLExpiry, url.Values{})
+	if err != nil {
+		return "", fmt.Errorf("failed to presign URL: %w", err)
+	}
+	return u.String(), nil
+}
@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/neo1908/lemmy-image-scraper/internal/config"
+)
+
+// Storage abstracts where downloaded media files are kept.
+// Keys are slash-separated paths relative to the storage root, e.g. "community/123_image.jpg".
+type Storage interface {
+	// Put stores data under key and returns the location to record in the database
+	Put(key string, data []byte, contentType string) (string, error)
+	// Location returns the location Put records for key, without storing anything
+	Location(key string) string
+	// Key returns the key of a location recorded by Put, or false if the
+	// location isn't in this storage, e.g. because the base directory moved
+	Key(location string) (string, bool)
+	// Get opens the object stored under key
+	Get(key string) (io.ReadCloser, error)
+	// Exists reports whether an object is stored under key
+	Exists(key string) (bool, error)
+	// Delete removes the object stored under key
+	Delete(key string) error
+	// URL returns a URL clients can fetch the object from directly,
+	// or an empty string if the backend has no externally reachable URL
+	URL(key string) (string, error)
+}
+
+// New creates the storage backend selected in the configuration
+func New(cfg *config.StorageConfig) (Storage, error) {
+	switch cfg.Backend {
+	case "", "local":
+		return NewLocal(cfg.BaseDirectory)
+	case "s3":
+		return NewS3(cfg.S3)
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %s", cfg.Backend)
+	}
+}
@@ -0,0 +1,93 @@
+package tokencache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Cache stores login tokens in a JSON file readable only by its owner,
+// keyed by instance and username
+type Cache struct {
+	Path string
+}
+
+// New creates a token cache backed by the file at path
+func New(path string) *Cache {
+	return &Cache{Path: path}
+}
+
+// key identifies the account a token belongs to
+func key(instance, username string) string {
+	return username + "@" + instance
+}
+
+// Get returns the cached token for an account, or "" if there is none
+func (c *Cache) Get(instance, username string) (string, error) {
+	tokens, err := c.load()
+	if err != nil {
+		return "", err
+	}
+	return tokens[key(instance, username)], nil
+}
+
+// Put stores the token for an account, replacing any previous one
+func (c *Cache) Put(instance, username, token string) error {
+	tokens, err := c.load()
+	if err != nil {
+		return err
+	}
+	tokens[key(instance, username)] = token
+	return c.save(tokens)
+}
+
+// load reads every cached token. A missing file is an empty cache.
+func (c *Cache) load() (map[string]string, error) {
+	tokens := make(map[string]string)
+
+	data, err := os.ReadFile(c.Path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return tokens, nil
+		}
+		return nil, fmt.Errorf("failed to read token cache: %w", err)
+	}
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("failed to parse token cache: %w", err)
+	}
+	return tokens, nil
+}
+
+// save replaces the cache file. The new file is written next to it and renamed
+// into place, so a crash never leaves a half-written cache.
+func (c *Cache) save(tokens map[string]string) error {
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode token cache: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.Path), filepath.Base(c.Path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to write token cache: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	// CreateTemp already uses 0600; make sure of it in case of an unusual umask
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write token cache: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write token cache: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write token cache: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), c.Path); err != nil {
+		return fmt.Errorf("failed to write token cache: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+// Package version holds the build version, set at link time with
+//
+//	go build -ldflags "-X github.com/neo1908/lemmy-image-scraper/internal/version.Version=v1.2.3" ./cmd/scraper
+package version
+
+// Version is the release the binary was built from, "dev" for local builds
+var Version = "dev"
+
+// UserAgent is the default User-Agent sent with API requests and downloads
+func UserAgent() string {
+	return "lemmy-image-scraper/" + Version
+}
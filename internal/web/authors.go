@@ -0,0 +1,189 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/neo1908/lemmy-image-scraper/internal/database"
+	log "github.com/sirupsen/logrus"
+)
+
+// Authors listed per page of the authors page, and the most /api/authors returns
+const (
+	authorsPageSize = 100
+	maxAuthorsLimit = 500
+)
+
+// handleAuthorsPage lists the authors of archived posts with their media counts,
+// each linking to the grid filtered to their media
+func (s *Server) handleAuthorsPage(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	search := strings.TrimSpace(query.Get("q"))
+
+	page := 1
+	if p := query.Get("page"); p != "" {
+		if parsed, err := strconv.Atoi(p); err == nil && parsed > 0 {
+			page = parsed
+		}
+	}
+
+	authors, total, err := s.DB.GetAuthorCounts(search, authorsPageSize, (page-1)*authorsPageSize)
+	if err != nil {
+		log.Errorf("Failed to get authors: %v", err)
+		http.Error(w, "Failed to get authors", http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Authors": authorCountItems(authors),
+		"Total":   total,
+		"Search":  search,
+		"Page":    page,
+		"HasPrev": page > 1,
+		"HasNext": page*authorsPageSize < total,
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := s.templates.ExecuteTemplate(w, "authors", data); err != nil {
+		log.Errorf("Template error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// handleAuthorPage serves the media grid filtered to one author, with a
+// summary of their activity above it
+func (s *Server) handleAuthorPage(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/author/")
+	if name == "" || strings.Contains(name, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	profile, err := s.DB.GetAuthorProfile(name)
+	if err != nil {
+		log.Errorf("Failed to get author profile: %v", err)
+		http.Error(w, "Failed to get author", http.StatusInternalServerError)
+		return
+	}
+	if profile.MediaCount == 0 && profile.CommentCount == 0 {
+		http.Error(w, "Author not found", http.StatusNotFound)
+		return
+	}
+
+	// The configured community and type filters would hide some of their media
+	defaults := s.Config.WebServer
+	defaults.DefaultCommunity = ""
+	defaults.DefaultType = ""
+
+	stats, _ := s.DB.GetStats()
+	data := map[string]interface{}{
+		"Stats":            stats,
+		"Communities":      s.getCommunityList(communitySuggestionsLimit),
+		"SuggestionsLimit": communitySuggestionsLimit,
+		"Defaults":         defaults,
+		"Author":           name,
+		"Profile":          profile,
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := s.templates.ExecuteTemplate(w, "index", data); err != nil {
+		log.Errorf("Template error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// handleGetAuthors returns the authors of archived posts with their media
+// counts, optionally filtered by name and paginated
+func (s *Server) handleGetAuthors(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	// Without a limit every author is returned
+	limit := 0
+	if l := query.Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= maxAuthorsLimit {
+			limit = parsed
+		}
+	}
+
+	offset := 0
+	if o := query.Get("offset"); o != "" {
+		if parsed, err := strconv.Atoi(o); err == nil && parsed >= 0 {
+			offset = parsed
+		}
+	}
+
+	authors, total, err := s.DB.GetAuthorCounts(strings.TrimSpace(query.Get("q")), limit, offset)
+	if err != nil {
+		log.Errorf("Failed to query authors: %v", err)
+		http.Error(w, "Failed to query authors", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"authors": authorCountItems(authors),
+		"total":   total,
+	})
+}
+
+// authorCountItems converts author counts to the map format used by templates and the API
+func authorCountItems(authors []database.AuthorCount) []map[string]interface{} {
+	result := make([]map[string]interface{}, len(authors))
+	for i, a := range authors {
+		result[i] = map[string]interface{}{
+			"name":  a.Name,
+			"count": a.Count,
+		}
+	}
+	return result
+}
+
+const authorsTemplate = `{{define "authors"}}
+<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Authors - Lemmy Media Browser</title>
+    <style>
+{{template "base-styles"}}
+{{template "report-styles"}}
+        .author-search { display: flex; gap: 8px; margin-bottom: 16px; }
+        .author-search input { flex: 1; max-width: 320px; }
+        .pager { display: flex; justify-content: space-between; margin-top: 12px; font-size: 14px; }
+        .pager a { color: #4a9eff; text-decoration: none; }
+    </style>
+</head>
+<body>
+    <div class="header">
+        <div class="header-content">
+            <h1><a href="/">Lemmy Media</a> <span class="community-name">/ authors</span></h1>
+        </div>
+    </div>
+
+    <div class="content">
+        <div class="section">
+            <form class="author-search" method="get" action="/authors">
+                <input type="search" name="q" placeholder="Search authors" value="{{.Search}}">
+                <button type="submit">Search</button>
+            </form>
+            <h2>{{.Total}} author{{if ne .Total 1}}s{{end}}{{if .Search}} matching "{{.Search}}"{{end}}</h2>
+            <ul class="post-list">
+                {{range .Authors}}
+                    <li>
+                        <a href="/author/{{.name}}" title="Show media by {{.name}}">{{.name}}</a>
+                        <span class="score">{{.count}} items</span>
+                    </li>
+                {{end}}
+            </ul>
+            <div class="pager">
+                <span>{{if .HasPrev}}<a href="/authors?page={{sub .Page 1}}{{if .Search}}&q={{.Search}}{{end}}">&larr; Previous</a>{{end}}</span>
+                <span>{{if .HasNext}}<a href="/authors?page={{add .Page 1}}{{if .Search}}&q={{.Search}}{{end}}">Next &rarr;</a>{{end}}</span>
+            </div>
+        </div>
+    </div>
+</body>
+</html>
+{{end}}`
@@ -0,0 +1,63 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neo1908/lemmy-image-scraper/pkg/models"
+)
+
+func TestAuthorPage(t *testing.T) {
+	s := newTestServer(t, nil)
+	published := time.Date(2024, 3, 9, 12, 0, 0, 0, time.UTC)
+
+	saveMedia(t, s, models.ScrapedMedia{PostID: 1, CommunityName: "pics", AuthorName: "alice", PostCreated: published})
+	saveMedia(t, s, models.ScrapedMedia{PostID: 2, CommunityName: "memes", AuthorName: "bob"})
+	post := &models.PostView{
+		Post:      models.Post{ID: 1, Name: "A picture", Published: published},
+		Community: models.Community{ID: 1, Name: "pics"},
+		Creator:   models.Person{ID: 1, Name: "alice"},
+	}
+	if err := s.DB.MarkPostAsScraped(post, 1); err != nil {
+		t.Fatalf("MarkPostAsScraped: %v", err)
+	}
+	err := s.DB.SaveComment(&models.CommentView{
+		Comment: models.Comment{ID: 10, PostID: 1, Content: "Thanks", Path: "0.10", Published: published.AddDate(0, 0, 1)},
+		Creator: models.Person{ID: 1, Name: "alice"},
+	})
+	if err != nil {
+		t.Fatalf("SaveComment: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	s.handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/author/alice", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /author/alice = %d, want 200", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Content-Type = %q, want text/html", ct)
+	}
+
+	body := w.Body.String()
+	for _, want := range []string{
+		"<title>alice - Lemmy Media Browser</title>",
+		`<div class="value">1</div><div class="label">Media files</div>`,
+		`<div class="value">1</div><div class="label">Comments</div>`,
+		`<a href="/community/pics">pics</a>`,
+		"Mar 9, 2024",
+		`name="author" placeholder="Author" value="alice"`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("author page is missing %q", want)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	s.handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/author/carol", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("GET /author/carol = %d, want 404", w.Code)
+	}
+}
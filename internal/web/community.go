@@ -0,0 +1,336 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/neo1908/lemmy-image-scraper/internal/database"
+	log "github.com/sirupsen/logrus"
+)
+
+// sparklineDays is how many days of downloads the community sparkline covers
+const sparklineDays = 30
+
+// Sparkline dimensions in SVG user units
+const (
+	sparklineWidth  = 600
+	sparklineHeight = 60
+)
+
+// handleCommunityPage serves the statistics page for a single community
+func (s *Server) handleCommunityPage(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/community/")
+	if name == "" || strings.Contains(name, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	stats, daily, ok := s.loadCommunityStats(w, name)
+	if !ok {
+		return
+	}
+
+	// The sidebar is only known for communities that have been scraped directly
+	description := ""
+	if community, err := s.DB.GetCommunity(name); err != nil {
+		log.Warnf("Failed to get community %s: %v", name, err)
+	} else if community != nil {
+		description = community.Description
+	}
+
+	data := map[string]interface{}{
+		"Name":        stats.Name,
+		"Description": description,
+		"Stats":       stats,
+		"TopPosts":    s.mediaListItems(stats.TopPosts),
+		"Recent":      s.mediaListItems(stats.RecentMedia),
+		"Downloads":   downloadsSparkline(daily),
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := s.templates.ExecuteTemplate(w, "community", data); err != nil {
+		log.Errorf("Template error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// handleGetCommunityStats returns the statistics for a single community as JSON
+func (s *Server) handleGetCommunityStats(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/api/communities/")
+	name := strings.TrimSuffix(rest, "/stats")
+	if name == rest || name == "" || strings.Contains(name, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	stats, daily, ok := s.loadCommunityStats(w, name)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"name":         stats.Name,
+		"total_media":  stats.TotalMedia,
+		"total_size":   stats.TotalSize,
+		"by_type":      stats.ByType,
+		"top_posts":    s.mediaListItems(stats.TopPosts),
+		"recent_media": s.mediaListItems(stats.RecentMedia),
+		"daily":        dailyCountItems(daily),
+	})
+}
+
+// handleGetCommunityDescription returns a community's sidebar as the raw
+// Markdown it was written in
+func (s *Server) handleGetCommunityDescription(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/api/communities/")
+	name := strings.TrimSuffix(rest, "/description")
+	if name == rest || name == "" || strings.Contains(name, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	community, err := s.DB.GetCommunity(name)
+	if err != nil {
+		log.Errorf("Failed to get community: %v", err)
+		http.Error(w, "Failed to get community", http.StatusInternalServerError)
+		return
+	}
+	if community == nil {
+		http.Error(w, "Community not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	w.Write([]byte(community.Description))
+}
+
+// loadCommunityStats fetches the statistics shown for a community, writing an
+// error response and returning false if they can't be loaded
+func (s *Server) loadCommunityStats(w http.ResponseWriter, name string) (database.CommunityStats, []database.DailyCount, bool) {
+	stats, err := s.DB.GetCommunityStats(name)
+	if err != nil {
+		log.Errorf("Failed to get community stats: %v", err)
+		http.Error(w, "Failed to get community stats", http.StatusInternalServerError)
+		return stats, nil, false
+	}
+	if stats.TotalMedia == 0 {
+		http.Error(w, "Community not found", http.StatusNotFound)
+		return stats, nil, false
+	}
+
+	daily, err := s.DB.GetDailyDownloadCounts(name, sparklineDays)
+	if err != nil {
+		log.Errorf("Failed to get daily download counts: %v", err)
+		http.Error(w, "Failed to get community stats", http.StatusInternalServerError)
+		return stats, nil, false
+	}
+
+	return stats, daily, true
+}
+
+// dailyCountItems converts daily download counts to the API format
+func dailyCountItems(daily []database.DailyCount) []map[string]interface{} {
+	items := make([]map[string]interface{}, len(daily))
+	for i, day := range daily {
+		items[i] = map[string]interface{}{
+			"date":  day.Date.Format("2006-01-02"),
+			"count": day.Count,
+			"bytes": day.Bytes,
+		}
+	}
+	return items
+}
+
+// downloadsSparkline is the data shown by the downloads-sparkline template
+func downloadsSparkline(daily []database.DailyCount) map[string]interface{} {
+	total := 0
+	peak := 0
+	var bytes int64
+	for _, day := range daily {
+		total += day.Count
+		bytes += day.Bytes
+		if day.Count > peak {
+			peak = day.Count
+		}
+	}
+
+	return map[string]interface{}{
+		"Points": sparklinePoints(daily),
+		"Days":   len(daily),
+		"Total":  total,
+		"Bytes":  bytes,
+		"Peak":   peak,
+	}
+}
+
+// sparklinePoints converts daily counts into SVG polyline points
+func sparklinePoints(daily []database.DailyCount) string {
+	if len(daily) == 0 {
+		return ""
+	}
+
+	peak := 1
+	for _, day := range daily {
+		if day.Count > peak {
+			peak = day.Count
+		}
+	}
+
+	step := 0.0
+	if len(daily) > 1 {
+		step = float64(sparklineWidth) / float64(len(daily)-1)
+	}
+
+	points := make([]string, len(daily))
+	for i, day := range daily {
+		// Leave a pixel at the top and bottom so the line isn't clipped
+		y := float64(sparklineHeight-1) - float64(day.Count)/float64(peak)*float64(sparklineHeight-2)
+		points[i] = fmt.Sprintf("%.1f,%.1f", float64(i)*step, y)
+	}
+	return strings.Join(points, " ")
+}
+
+const communityTemplate = `{{define "community"}}
+<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>{{.Name}} - Lemmy Media Browser</title>
+    <style>
+{{template "base-styles"}}
+{{template "report-styles"}}
+        .recent {
+            display: grid;
+            grid-template-columns: repeat(auto-fill, minmax(140px, 1fr));
+            gap: 8px;
+        }
+        .recent a {
+            aspect-ratio: 1;
+            background: #2a2a2a;
+            border-radius: 4px;
+            overflow: hidden;
+            display: flex;
+            align-items: center;
+            justify-content: center;
+            color: #999;
+            font-size: 12px;
+            text-decoration: none;
+        }
+        .recent img, .recent video { width: 100%; height: 100%; object-fit: cover; }
+        .description { white-space: pre-wrap; overflow-wrap: anywhere; font-family: inherit; font-size: 14px; color: #ccc; margin: 0; }
+    </style>
+</head>
+<body>
+    <div class="header">
+        <div class="header-content">
+            <h1><a href="/">Lemmy Media</a> <span class="community-name">/ {{.Name}}</span></h1>
+            <div class="stats">
+                <div><span>{{.Stats.TotalMedia}}</span> items</div>
+                {{range $type, $count := .Stats.ByType}}
+                    <div><span>{{$count}}</span> {{$type}}</div>
+                {{end}}
+            </div>
+        </div>
+    </div>
+
+    <div class="content">
+        <div class="section">
+            <div class="summary">
+                <div class="summary-item"><div class="value">{{.Stats.TotalMedia}}</div><div class="label">Media files</div></div>
+                <div class="summary-item"><div class="value">{{formatFileSize .Stats.TotalSize}}</div><div class="label">Total size</div></div>
+                {{range $type, $count := .Stats.ByType}}
+                    <div class="summary-item"><div class="value">{{$count}}</div><div class="label">{{$type}}</div></div>
+                {{end}}
+            </div>
+        </div>
+
+{{with .Description}}
+        <div class="section">
+            <h2>About</h2>
+            <pre class="description">{{.}}</pre>
+        </div>
+{{end}}
+
+{{template "downloads-sparkline" .Downloads}}
+
+        <div class="section">
+            <h2>Top posts</h2>
+            <ul class="post-list">
+                {{range .TopPosts}}
+                    <li>
+                        <a href="{{.serve_url}}" target="_blank" title="{{.post_title}}">{{.post_title}}</a>
+                        <span class="score">{{.post_score}} pts</span>
+                    </li>
+                {{end}}
+            </ul>
+        </div>
+
+        <div class="section">
+            <h2>Recent downloads</h2>
+            <div class="recent">
+                {{range .Recent}}
+                    <a href="{{.serve_url}}" target="_blank" title="{{.post_title}}">
+                        {{if eq .media_type "image"}}
+                            <img src="{{or .thumbnail_url .serve_url}}" alt="{{.post_title}}" loading="lazy">
+                        {{else if eq .media_type "video"}}
+                            <video src="{{.serve_url}}"{{with .thumbnail_url}} poster="{{.}}"{{end}} muted preload="metadata"></video>
+                        {{else}}
+                            {{.media_type}}
+                        {{end}}
+                    </a>
+                {{end}}
+            </div>
+        </div>
+    </div>
+</body>
+</html>
+{{end}}`
+
+// reportStylesTemplate holds the styles shared by the statistics pages
+const reportStylesTemplate = `{{define "report-styles"}}
+        .header h1 a { color: inherit; text-decoration: none; }
+        .header h1 .community-name { color: #999; font-weight: 400; }
+        .section { margin-bottom: 32px; }
+        .section h2 { font-size: 16px; font-weight: 600; color: #fff; margin-bottom: 12px; }
+        .summary {
+            display: grid;
+            grid-template-columns: repeat(auto-fill, minmax(160px, 1fr));
+            gap: 12px;
+        }
+        .summary-item { background: #1a1a1a; border-radius: 8px; padding: 12px 16px; }
+        .summary-item .value { font-size: 22px; font-weight: 600; color: #fff; }
+        .summary-item .label { font-size: 13px; color: #999; }
+        .post-list { list-style: none; background: #1a1a1a; border-radius: 8px; }
+        .post-list li {
+            display: flex;
+            justify-content: space-between;
+            gap: 16px;
+            padding: 8px 16px;
+            border-bottom: 1px solid #2a2a2a;
+            font-size: 14px;
+        }
+        .post-list li:last-child { border-bottom: none; }
+        .post-list a { color: #e0e0e0; text-decoration: none; overflow: hidden; text-overflow: ellipsis; white-space: nowrap; }
+        .post-list a:hover { color: #fff; text-decoration: underline; }
+        .post-list .score { color: #999; white-space: nowrap; }
+        .sparkline { background: #1a1a1a; border-radius: 8px; padding: 16px; }
+        .sparkline svg { width: 100%; height: 60px; display: block; }
+        .sparkline .caption { font-size: 13px; color: #999; margin-top: 8px; }
+{{end}}`
+
+// downloadsSparklineTemplate charts daily downloads; it takes the data from downloadsSparkline
+const downloadsSparklineTemplate = `{{define "downloads-sparkline"}}
+        <div class="section">
+            <h2>Downloads, last {{.Days}} days</h2>
+            <div class="sparkline">
+                <svg viewBox="0 0 600 60" preserveAspectRatio="none">
+                    <polyline points="{{.Points}}" fill="none" stroke="#4a9eff" stroke-width="2" vector-effect="non-scaling-stroke"/>
+                </svg>
+                <div class="caption">{{.Total}} downloaded ({{formatFileSize .Bytes}}), peak {{.Peak}} in a day</div>
+            </div>
+        </div>
+{{end}}`
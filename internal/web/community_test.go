@@ -0,0 +1,114 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/neo1908/lemmy-image-scraper/pkg/models"
+)
+
+func TestGetCommunityStats(t *testing.T) {
+	s := newTestServer(t, nil)
+	saveMedia(t, s, models.ScrapedMedia{PostID: 1, CommunityName: "pics", PostScore: 5, FileSize: 100})
+	saveMedia(t, s, models.ScrapedMedia{PostID: 2, CommunityName: "pics", PostScore: 50, FileSize: 200, MediaType: "video"})
+	saveMedia(t, s, models.ScrapedMedia{PostID: 3, CommunityName: "memes", PostScore: 500, FileSize: 1000})
+
+	var stats struct {
+		Name       string         `json:"name"`
+		TotalMedia int            `json:"total_media"`
+		TotalSize  int64          `json:"total_size"`
+		ByType     map[string]int `json:"by_type"`
+		TopPosts   []struct {
+			PostID int64 `json:"post_id"`
+		} `json:"top_posts"`
+		RecentMedia []struct {
+			CommunityName string `json:"community_name"`
+		} `json:"recent_media"`
+		Daily []struct {
+			Count int   `json:"count"`
+			Bytes int64 `json:"bytes"`
+		} `json:"daily"`
+	}
+	if code := getJSON(t, s, "/api/communities/pics/stats", &stats); code != http.StatusOK {
+		t.Fatalf("GET /api/communities/pics/stats = %d, want 200", code)
+	}
+
+	if stats.Name != "pics" || stats.TotalMedia != 2 || stats.TotalSize != 300 {
+		t.Errorf("name, total media, total size = %q, %d, %d, want pics, 2, 300", stats.Name, stats.TotalMedia, stats.TotalSize)
+	}
+	if stats.ByType["image"] != 1 || stats.ByType["video"] != 1 || len(stats.ByType) != 2 {
+		t.Errorf("by_type = %v, want 1 image and 1 video", stats.ByType)
+	}
+	if len(stats.TopPosts) != 2 || stats.TopPosts[0].PostID != 2 || stats.TopPosts[1].PostID != 1 {
+		t.Errorf("top_posts = %+v, want posts 2 then 1", stats.TopPosts)
+	}
+	if len(stats.RecentMedia) != 2 {
+		t.Errorf("recent_media has %d items, want 2", len(stats.RecentMedia))
+	}
+	for _, m := range stats.RecentMedia {
+		if m.CommunityName != "pics" {
+			t.Errorf("recent_media includes community %q", m.CommunityName)
+		}
+	}
+	if len(stats.Daily) != sparklineDays {
+		t.Fatalf("daily has %d days, want %d", len(stats.Daily), sparklineDays)
+	}
+	if today := stats.Daily[len(stats.Daily)-1]; today.Count != 2 || today.Bytes != 300 {
+		t.Errorf("today's downloads = %d, %d bytes, want 2, 300 bytes", today.Count, today.Bytes)
+	}
+
+	if code := getJSON(t, s, "/api/communities/news/stats", nil); code != http.StatusNotFound {
+		t.Errorf("GET /api/communities/news/stats = %d, want 404", code)
+	}
+}
+
+func TestCommunityPage(t *testing.T) {
+	s := newTestServer(t, nil)
+	saveMedia(t, s, models.ScrapedMedia{PostID: 1, PostTitle: "Sunset over the bay", CommunityName: "pics"})
+
+	w := httptest.NewRecorder()
+	s.handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/community/pics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /community/pics = %d, want 200", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Content-Type = %q, want text/html", ct)
+	}
+	if body := w.Body.String(); !strings.Contains(body, "Sunset over the bay") {
+		t.Error("community page doesn't list the community's top post")
+	}
+
+	w = httptest.NewRecorder()
+	s.handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/community/news", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("GET /community/news = %d, want 404", w.Code)
+	}
+}
+
+func TestGetCommunityDescription(t *testing.T) {
+	s := newTestServer(t, nil)
+	description := "# Pics\n\n**Pictures** only, no memes."
+	if err := s.DB.UpsertCommunity(&models.Community{ID: 1, Name: "pics", Description: description}); err != nil {
+		t.Fatalf("UpsertCommunity: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	s.handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/communities/pics/description", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /api/communities/pics/description = %d, want 200", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/markdown") {
+		t.Errorf("Content-Type = %q, want text/markdown", ct)
+	}
+	if got := w.Body.String(); got != description {
+		t.Errorf("description = %q, want %q", got, description)
+	}
+
+	w = httptest.NewRecorder()
+	s.handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/communities/news/description", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("GET /api/communities/news/description = %d, want 404", w.Code)
+	}
+}
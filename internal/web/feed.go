@@ -0,0 +1,136 @@
+package web
+
+import (
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/neo1908/lemmy-image-scraper/internal/database"
+	log "github.com/sirupsen/logrus"
+)
+
+// rssFeed is the root element of an RSS 2.0 document
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string       `xml:"title"`
+	Link        string       `xml:"link"`
+	Description string       `xml:"description"`
+	Category    string       `xml:"category,omitempty"`
+	GUID        rssGUID      `xml:"guid"`
+	PubDate     string       `xml:"pubDate"`
+	Enclosure   rssEnclosure `xml:"enclosure"`
+}
+
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// handleFeed serves the most recently downloaded media as an RSS feed
+func (s *Server) handleFeed(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	limit := 50
+	if l := query.Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 200 {
+			limit = parsed
+		}
+	}
+	community := query.Get("community")
+
+	mediaItems, _, err := s.DB.GetMediaWithFilters(database.MediaFilter{
+		Community: community,
+		SortBy:    "downloaded_at",
+		SortOrder: "DESC",
+		Limit:     limit,
+	})
+	if err != nil {
+		log.Errorf("Failed to get media for feed: %v", err)
+		http.Error(w, "Failed to query media", http.StatusInternalServerError)
+		return
+	}
+
+	// Feed readers need absolute URLs
+	baseURL := requestBaseURL(r)
+
+	title := "Lemmy Media"
+	if community != "" {
+		title = fmt.Sprintf("Lemmy Media: %s", community)
+	}
+	channel := rssChannel{
+		Title:       title,
+		Link:        baseURL + "/",
+		Description: fmt.Sprintf("Media archived from %s", s.Config.Lemmy.Instance),
+	}
+
+	for _, item := range mediaItems {
+		serveURL := baseURL + (&url.URL{Path: s.serveURL(&item)}).EscapedPath()
+		postLink := fmt.Sprintf("https://%s/post/%d", s.Config.Lemmy.Instance, item.PostID)
+
+		contentType := mime.TypeByExtension(path.Ext(item.FileName))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+
+		channel.Items = append(channel.Items, rssItem{
+			Title:       item.PostTitle,
+			Link:        postLink,
+			Description: fmt.Sprintf("%s in %s by %s (%d points)", item.MediaType, item.CommunityName, item.AuthorName, item.PostScore),
+			Category:    item.CommunityName,
+			GUID:        rssGUID{Value: item.MediaHash},
+			PubDate:     item.DownloadedAt.Format(time.RFC1123Z),
+			Enclosure: rssEnclosure{
+				URL:    serveURL,
+				Length: item.FileSize,
+				Type:   contentType,
+			},
+		})
+	}
+	if len(mediaItems) > 0 {
+		channel.LastBuildDate = mediaItems[0].DownloadedAt.Format(time.RFC1123Z)
+	}
+
+	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(rssFeed{Version: "2.0", Channel: channel}); err != nil {
+		log.Errorf("Failed to encode feed: %v", err)
+	}
+}
+
+// requestBaseURL returns the scheme and host the client used to reach the server
+func requestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+		scheme = proto
+	}
+	return fmt.Sprintf("%s://%s", scheme, r.Host)
+}
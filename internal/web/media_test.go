@@ -0,0 +1,147 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neo1908/lemmy-image-scraper/pkg/models"
+)
+
+func TestGetMediaLikeFilters(t *testing.T) {
+	s := newTestServer(t, nil)
+	for _, m := range []models.ScrapedMedia{
+		{PostID: 1, CommunityName: "pics", AuthorName: "bob"},
+		{PostID: 2, CommunityName: "picsofcats", AuthorName: "bobby"},
+		{PostID: 3, CommunityName: "memes", AuthorName: "alice"},
+		{PostID: 4, CommunityName: "earthpics", AuthorName: "carol_b"},
+	} {
+		saveMedia(t, s, m)
+	}
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"community_like=pics", 1},
+		{"community_like=pics%25", 2},
+		{"community_like=%25pics%25", 3},
+		{"community_like=%25pics", 2},
+		{"author_like=bob%25", 2},
+		{"author_like=%25o%25", 3},
+		{"author_like=carol_b", 1},
+		{"community_like=%25pics%25&author_like=bob", 1},
+		{"community_like=nothing%25", 0},
+	}
+	for _, tt := range tests {
+		var list mediaList
+		if status := getJSON(t, s, "/api/media?"+tt.query, &list); status != http.StatusOK {
+			t.Errorf("%s: status = %d", tt.query, status)
+			continue
+		}
+		if list.Total != tt.want || len(list.Media) != tt.want {
+			t.Errorf("%s: got %d media (total %d), want %d", tt.query, len(list.Media), list.Total, tt.want)
+		}
+	}
+}
+
+func TestGetMediaLikeFiltersRejectSQL(t *testing.T) {
+	s := newTestServer(t, nil)
+	saveMedia(t, s, models.ScrapedMedia{PostID: 1, CommunityName: "pics", AuthorName: "bob"})
+
+	for _, param := range []string{"community_like", "author_like"} {
+		for _, pattern := range []string{"pics;", "pics'; DROP TABLE scraped_media; --", "a b", `pics\`} {
+			target := "/api/media?" + url.Values{param: {pattern}}.Encode()
+			if status := getJSON(t, s, target, nil); status != http.StatusBadRequest {
+				t.Errorf("%s=%q: status = %d, want %d", param, pattern, status, http.StatusBadRequest)
+			}
+		}
+	}
+
+	// The table is still there
+	var list mediaList
+	if status := getJSON(t, s, "/api/media", &list); status != http.StatusOK || list.Total != 1 {
+		t.Errorf("after rejected patterns: status = %d, total = %d", status, list.Total)
+	}
+}
+
+func TestGetMediaByHashPrefix(t *testing.T) {
+	s := newTestServer(t, nil)
+	first := "abcdef01" + strings.Repeat("1", 56)
+	second := "abcdef01" + strings.Repeat("2", 56)
+	other := "12345678" + strings.Repeat("3", 56)
+	for i, hash := range []string{first, second, other} {
+		saveMedia(t, s, models.ScrapedMedia{PostID: int64(i + 1), CommunityName: "pics", MediaHash: hash})
+	}
+
+	tests := []struct {
+		prefix string
+		want   []string
+	}{
+		{first, []string{first}},
+		{"abcdef01", []string{first, second}},
+		{"ABCDEF011", []string{first}},
+		{"00000000", nil},
+	}
+	for _, tt := range tests {
+		var resp struct {
+			Media []struct {
+				MediaHash string `json:"media_hash"`
+			} `json:"media"`
+			Total int `json:"total"`
+		}
+		if code := getJSON(t, s, "/api/media/by-hash/"+tt.prefix, &resp); code != http.StatusOK {
+			t.Errorf("GET by-hash/%s = %d, want 200", tt.prefix, code)
+			continue
+		}
+		var got []string
+		for _, m := range resp.Media {
+			got = append(got, m.MediaHash)
+		}
+		sort.Strings(got)
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") || resp.Total != len(tt.want) {
+			t.Errorf("by-hash/%s = %v (total %d), want %v", tt.prefix, got, resp.Total, tt.want)
+		}
+	}
+
+	for _, prefix := range []string{"abcdef0", "abcdefgh", "abcdef0%25", "abcdef01_", strings.Repeat("a", 65)} {
+		if code := getJSON(t, s, "/api/media/by-hash/"+prefix, nil); code != http.StatusBadRequest {
+			t.Errorf("GET by-hash/%s = %d, want 400", prefix, code)
+		}
+	}
+}
+
+func TestGetMediaSortFields(t *testing.T) {
+	s := newTestServer(t, nil)
+	now := time.Now().UTC()
+	// Titles and scores run opposite to download order
+	oldest := saveMedia(t, s, models.ScrapedMedia{PostID: 1, PostTitle: "c", PostScore: 30, CommunityName: "pics", DownloadedAt: now.Add(-2 * time.Hour)})
+	middle := saveMedia(t, s, models.ScrapedMedia{PostID: 2, PostTitle: "b", PostScore: 20, CommunityName: "pics", DownloadedAt: now.Add(-time.Hour)})
+	newest := saveMedia(t, s, models.ScrapedMedia{PostID: 3, PostTitle: "a", PostScore: 10, CommunityName: "pics", DownloadedAt: now})
+
+	tests := []struct {
+		query string
+		want  []int64
+	}{
+		{"sort=post_title&order=ASC", []int64{newest, middle, oldest}},
+		{"sort=post_score&order=DESC", []int64{oldest, middle, newest}},
+		// Unknown fields, including attempts at SQL, fall back to downloaded_at
+		{"sort=favorite_color&order=ASC", []int64{oldest, middle, newest}},
+		{"sort=" + url.QueryEscape("post_title; DROP TABLE scraped_media") + "&order=ASC", []int64{oldest, middle, newest}},
+		{"sort=" + url.QueryEscape("post_title ASC, id") + "&order=DESC", []int64{newest, middle, oldest}},
+	}
+	for _, tt := range tests {
+		var list mediaList
+		if code := getJSON(t, s, "/api/media?"+tt.query, &list); code != http.StatusOK {
+			t.Errorf("GET /api/media?%s = %d, want 200", tt.query, code)
+			continue
+		}
+		if got := list.ids(); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("GET /api/media?%s = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// corsMiddleware lets pages on the origins in web_server.cors_allow_origins call
+// the API from the browser, and answers their preflight requests. With no
+// origins configured it returns next unchanged, so no CORS headers are sent.
+func (s *Server) corsMiddleware(next http.Handler) http.Handler {
+	origins := s.Config.WebServer.CORSAllowOrigins
+	if len(origins) == 0 {
+		return next
+	}
+
+	allowAll := false
+	allowed := make(map[string]bool, len(origins))
+	for _, origin := range origins {
+		if origin == "*" {
+			allowAll = true
+		}
+		allowed[origin] = true
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+
+		// Only one origin can be named per response, so a list is matched
+		// against the request and the header varies with it
+		if allowAll {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Add("Vary", "Origin")
+			if allowed[origin] {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			}
+		}
+		if w.Header().Get("Access-Control-Allow-Origin") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+		}
+
+		// Preflight requests are answered here rather than by the API handler
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// maxBodyMiddleware caps request bodies at web_server.max_request_body_bytes.
+// Requests declaring a larger body get 413 straight away; for the rest, reads
+// past the limit fail with *http.MaxBytesError, which handlers should answer
+// with 413 too. Media is only ever fetched, so /media/ is left alone, and
+// uploads have their own limit, web_server.max_upload_bytes.
+func (s *Server) maxBodyMiddleware(next http.Handler) http.Handler {
+	limit := s.Config.WebServer.MaxRequestBodyBytes
+	if limit <= 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/media/") || r.URL.Path == uploadPath {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.ContentLength > limit {
+			http.Error(w, fmt.Sprintf("Request body larger than %d bytes", limit), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		next.ServeHTTP(w, r)
+	})
+}
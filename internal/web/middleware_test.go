@@ -0,0 +1,94 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/neo1908/lemmy-image-scraper/internal/config"
+)
+
+func TestOversizedPostGets413(t *testing.T) {
+	const limit = 1024
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.WebServer.MaxRequestBodyBytes = limit
+	})
+	id := seedMedia(t, s)
+	url := fmt.Sprintf("/api/media/%d/tags", id)
+
+	tests := []struct {
+		name     string
+		body     string
+		declared bool // Whether the request states its length up front
+		want     int
+	}{
+		{"declared length over limit", `{"tags": ["` + strings.Repeat("a", limit) + `"]}`, true, http.StatusRequestEntityTooLarge},
+		{"undeclared length over limit", `{"tags": ["` + strings.Repeat("a", limit) + `"]}`, false, http.StatusRequestEntityTooLarge},
+		{"within limit", `{"tags": ["cats"]}`, true, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, url, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if !tt.declared {
+				req.ContentLength = -1
+			}
+			w := httptest.NewRecorder()
+			s.handler.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d (body: %s)", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestCORSHeaders(t *testing.T) {
+	const app = "https://app.example.com"
+	tests := []struct {
+		name       string
+		origins    []string
+		origin     string
+		wantOrigin string
+	}{
+		{"listed origin", []string{app, "https://other.example.com"}, app, app},
+		{"unlisted origin", []string{app}, "https://evil.example.com", ""},
+		{"any origin", []string{"*"}, app, "*"},
+		{"unconfigured", nil, app, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, func(cfg *config.Config) {
+				cfg.WebServer.CORSAllowOrigins = tt.origins
+			})
+
+			get := httptest.NewRequest(http.MethodGet, "/api/stats", nil)
+			get.Header.Set("Origin", tt.origin)
+			preflight := httptest.NewRequest(http.MethodOptions, "/api/stats", nil)
+			preflight.Header.Set("Origin", tt.origin)
+			preflight.Header.Set("Access-Control-Request-Method", http.MethodGet)
+
+			for _, req := range []*http.Request{get, preflight} {
+				w := httptest.NewRecorder()
+				s.handler.ServeHTTP(w, req)
+
+				if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+					t.Errorf("%s: Access-Control-Allow-Origin = %q, want %q", req.Method, got, tt.wantOrigin)
+				}
+				methods := w.Header().Get("Access-Control-Allow-Methods")
+				if (methods != "") != (tt.wantOrigin != "") {
+					t.Errorf("%s: Access-Control-Allow-Methods = %q", req.Method, methods)
+				}
+				if tt.origins == nil && w.Header().Get("Vary") != "" {
+					t.Errorf("%s: Vary = %q, want none when CORS is unconfigured", req.Method, w.Header().Get("Vary"))
+				}
+				// Preflights are answered by the middleware once CORS is configured
+				if req == preflight && tt.origins != nil && w.Code != http.StatusNoContent {
+					t.Errorf("preflight status = %d, want 204", w.Code)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package web
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// openAPISpec is the hand-maintained OpenAPI 3.0 description of the /api/* endpoints
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// handleAPI registers an API handler, with CORS headers when configured, and
+// records the OpenAPI paths it serves so the embedded spec can be checked
+// against the real routes
+func (s *Server) handleAPI(mux *http.ServeMux, pattern string, specPaths []string, handler http.HandlerFunc) {
+	mux.Handle(pattern, s.corsMiddleware(handler))
+	s.apiPaths = append(s.apiPaths, specPaths...)
+}
+
+// validateOpenAPISpec checks that the embedded spec is an OpenAPI 3.0 document
+// and documents exactly the API paths registered on the server
+func (s *Server) validateOpenAPISpec() error {
+	var spec struct {
+		OpenAPI string                     `json:"openapi"`
+		Paths   map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		return fmt.Errorf("failed to parse OpenAPI spec: %w", err)
+	}
+	if !strings.HasPrefix(spec.OpenAPI, "3.0") {
+		return fmt.Errorf("unexpected OpenAPI version %q", spec.OpenAPI)
+	}
+
+	registered := make(map[string]bool)
+	for _, p := range s.apiPaths {
+		registered[p] = true
+	}
+
+	var undocumented, unregistered []string
+	for p := range registered {
+		if _, ok := spec.Paths[p]; !ok {
+			undocumented = append(undocumented, p)
+		}
+	}
+	for p := range spec.Paths {
+		if !registered[p] {
+			unregistered = append(unregistered, p)
+		}
+	}
+	sort.Strings(undocumented)
+	sort.Strings(unregistered)
+
+	if len(undocumented) > 0 || len(unregistered) > 0 {
+		return fmt.Errorf("OpenAPI spec out of sync with routes (undocumented: %v, not registered: %v)", undocumented, unregistered)
+	}
+	return nil
+}
+
+// handleOpenAPISpec serves the OpenAPI document
+func (s *Server) handleOpenAPISpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPISpec)
+}
+
+// handleAPIDocs serves a Swagger UI page for the OpenAPI document
+func (s *Server) handleAPIDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, apiDocsTemplate)
+}
+
+const apiDocsTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Lemmy Media API</title>
+    <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+    <div id="swagger-ui"></div>
+    <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+    <script>
+        window.ui = SwaggerUIBundle({
+            url: '/api/openapi.json',
+            dom_id: '#swagger-ui',
+        });
+    </script>
+</body>
+</html>`
@@ -0,0 +1,13 @@
+package web
+
+import "testing"
+
+func TestOpenAPISpecMatchesRoutes(t *testing.T) {
+	s := newTestServer(t, nil)
+	if len(s.apiPaths) == 0 {
+		t.Fatal("no API paths registered")
+	}
+	if err := s.validateOpenAPISpec(); err != nil {
+		t.Error(err)
+	}
+}
@@ -1,48 +1,144 @@
 package web
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
+	"io"
+	"mime"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/neo1908/lemmy-image-scraper/internal/config"
 	"github.com/neo1908/lemmy-image-scraper/internal/database"
+	"github.com/neo1908/lemmy-image-scraper/internal/downloader"
+	"github.com/neo1908/lemmy-image-scraper/internal/format"
+	"github.com/neo1908/lemmy-image-scraper/internal/storage"
+	"github.com/neo1908/lemmy-image-scraper/pkg/models"
 	log "github.com/sirupsen/logrus"
 )
 
+// Go's built-in MIME table knows AVIF but not HEIC/HEIF, so register them for
+// serving archived files and feed enclosures on systems without a mime.types file
+func init() {
+	mime.AddExtensionType(".heic", "image/heic")
+	mime.AddExtensionType(".heif", "image/heif")
+}
+
+// likePattern matches the SQL LIKE patterns accepted by the community_like and author_like filters
+var likePattern = regexp.MustCompile(`^[A-Za-z0-9_%]+$`)
+
+// hashPrefixPattern matches the media hash prefixes accepted by /api/media/by-hash/{prefix}
+var hashPrefixPattern = regexp.MustCompile(`^[0-9a-fA-F]{8,64}$`)
+
+// Number of communities suggested by the community filter, and the most
+// /api/communities returns per page
+const (
+	communitySuggestionsLimit = 20
+	maxCommunitiesLimit       = 500
+)
+
+// parseDateRange reads the from, to and date_field params. Dates may be RFC3339
+// timestamps or plain YYYY-MM-DD dates, where a plain "to" date covers the whole
+// day. Malformed dates are ignored.
+func parseDateRange(query url.Values) database.DateRange {
+	dates := database.DateRange{Field: query.Get("date_field")}
+	if from, ok := parseDateParam(query.Get("from")); ok {
+		dates.From = from
+	}
+	if to, ok := parseDateParam(query.Get("to")); ok {
+		if !strings.Contains(query.Get("to"), "T") {
+			to = to.AddDate(0, 0, 1).Add(-time.Nanosecond)
+		}
+		dates.To = to
+	}
+	return dates
+}
+
+// parseDateParam parses an RFC3339 timestamp or a YYYY-MM-DD date (as UTC midnight)
+func parseDateParam(value string) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, false
+	}
+	// An unencoded "+" in a timezone offset arrives as a space
+	value = strings.ReplaceAll(value, " ", "+")
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, true
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
 // Server represents the web server
 type Server struct {
 	Config    *config.Config
 	DB        *database.DB
+	Storage   storage.Storage
 	handler   http.Handler
+	server    *http.Server
+	redirect  *http.Server // Plain HTTP server redirecting to HTTPS, nil when disabled
 	templates *template.Template
+	apiPaths  []string // OpenAPI paths served by registered API handlers
+	uploader  *downloader.Downloader // Stores files sent to the upload endpoint
 }
 
-// New creates a new web server
-func New(cfg *config.Config, db *database.DB) *Server {
+// New creates a new web server. Uploads are stored with uploader, which should
+// be the scraper's downloader so the two never store the same file at once.
+// With TLS configured the certificate is loaded here, so a bad certificate or
+// key fails at startup instead of when serving.
+func New(cfg *config.Config, db *database.DB, store storage.Storage, uploader *downloader.Downloader) (*Server, error) {
 	s := &Server{
-		Config: cfg,
-		DB:     db,
+		Config:   cfg,
+		DB:       db,
+		Storage:  store,
+		uploader: uploader,
 	}
 	s.setupRoutes()
-	return s
+	s.server = &http.Server{
+		Addr:    fmt.Sprintf("%s:%d", cfg.WebServer.Host, cfg.WebServer.Port),
+		Handler: s.handler,
+	}
+
+	if cfg.WebServer.TLSCert != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.WebServer.TLSCert, cfg.WebServer.TLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+		}
+		s.server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+
+		if cfg.WebServer.HTTPRedirectPort != 0 {
+			s.redirect = &http.Server{
+				Addr:    fmt.Sprintf("%s:%d", cfg.WebServer.Host, cfg.WebServer.HTTPRedirectPort),
+				Handler: http.HandlerFunc(s.handleHTTPSRedirect),
+			}
+		}
+	}
+	return s, nil
 }
 
 // setupRoutes configures the HTTP routes
 func (s *Server) setupRoutes() {
 	// Parse embedded templates
 	s.templates = template.Must(template.New("").Funcs(template.FuncMap{
-		"formatFileSize": formatFileSize,
+		"formatFileSize": format.FileSize,
 		"formatDate":     formatDate,
+		"formatDuration": formatDuration,
 		"add": func(a, b int) int { return a + b },
 		"sub": func(a, b int) int { return a - b },
-	}).Parse(indexTemplate + mediaGridTemplate + mediaModalTemplate))
+	}).Parse(baseStylesTemplate + indexTemplate + mediaGridTemplate + mediaModalTemplate +
+		reportStylesTemplate + downloadsSparklineTemplate + communityTemplate + statsTemplate + authorsTemplate))
 
 	mux := http.NewServeMux()
 
@@ -52,32 +148,129 @@ func (s *Server) setupRoutes() {
 	// HTMX endpoints
 	mux.HandleFunc("/media-grid", s.handleMediaGrid)
 
+	// Statistics pages
+	mux.HandleFunc("/stats", s.handleStatsPage)
+	mux.HandleFunc("/community/", s.handleCommunityPage)
+	mux.HandleFunc("/authors", s.handleAuthorsPage)
+	mux.HandleFunc("/author/", s.handleAuthorPage)
+
+	// RSS feed of new media
+	mux.HandleFunc("/feed.xml", s.handleFeed)
+
 	// API routes (kept for compatibility)
-	mux.HandleFunc("/api/media/", func(w http.ResponseWriter, r *http.Request) {
+	s.handleAPI(mux, "/api/media/", []string{"/api/media/{id}", "/api/media/{id}/score-history", "/api/media/{id}/favorite", "/api/media/{id}/tags", "/api/media/by-hash/{prefix}"}, func(w http.ResponseWriter, r *http.Request) {
 		// Check if this is a request for a specific media item (has ID after /api/media/)
 		idPart := strings.TrimPrefix(r.URL.Path, "/api/media/")
+		if strings.HasPrefix(idPart, "by-hash/") {
+			s.handleGetMediaByHashPrefix(w, r)
+			return
+		}
+		if strings.HasSuffix(idPart, "/score-history") {
+			s.handleGetScoreHistory(w, r)
+			return
+		}
+		if strings.HasSuffix(idPart, "/favorite") {
+			s.handleToggleFavorite(w, r)
+			return
+		}
+		if strings.HasSuffix(idPart, "/tags") {
+			s.handleMediaTags(w, r)
+			return
+		}
 		if idPart != "" && idPart != "/" {
 			s.handleGetMediaByID(w, r)
 			return
 		}
 		s.handleGetMedia(w, r)
 	})
-	mux.HandleFunc("/api/media", s.handleGetMedia)
-	mux.HandleFunc("/api/stats", s.handleGetStats)
-	mux.HandleFunc("/api/communities", s.handleGetCommunities)
-	mux.HandleFunc("/api/comments/", s.handleGetComments)
+	s.handleAPI(mux, "/api/media", []string{"/api/media"}, s.handleGetMedia)
+	s.handleAPI(mux, uploadPath, []string{uploadPath}, s.handleUploadMedia)
+	s.handleAPI(mux, "/api/stats", []string{"/api/stats"}, s.handleGetStats)
+	s.handleAPI(mux, "/api/stats/top-posts", []string{"/api/stats/top-posts"}, s.handleGetTopPosts)
+	s.handleAPI(mux, "/api/stats/daily", []string{"/api/stats/daily"}, s.handleGetDailyStats)
+	s.handleAPI(mux, "/api/stats/rescrapes", []string{"/api/stats/rescrapes"}, s.handleGetRescrapes)
+	s.handleAPI(mux, "/api/communities", []string{"/api/communities"}, s.handleGetCommunities)
+	s.handleAPI(mux, "/api/communities/", []string{"/api/communities/{name}/stats", "/api/communities/{name}/description"}, func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/description") {
+			s.handleGetCommunityDescription(w, r)
+			return
+		}
+		s.handleGetCommunityStats(w, r)
+	})
+	s.handleAPI(mux, "/api/authors", []string{"/api/authors"}, s.handleGetAuthors)
+	s.handleAPI(mux, "/api/comments/", []string{"/api/comments/{id}"}, s.handleGetComments)
+
+	// API documentation
+	s.handleAPI(mux, "/api/openapi.json", []string{"/api/openapi.json"}, s.handleOpenAPISpec)
+	mux.HandleFunc("/api/docs", s.handleAPIDocs)
 
 	// Serve media files
 	mux.HandleFunc("/media/", s.handleServeMedia)
 
-	s.handler = mux
+	// Community icons and banners
+	mux.HandleFunc("/community-assets/", s.handleServeCommunityAsset)
+
+	s.handler = s.maxBodyMiddleware(mux)
+
+	// Make sure the API documentation still matches the registered routes
+	if err := s.validateOpenAPISpec(); err != nil {
+		log.Warnf("API documentation problem: %v", err)
+	}
 }
 
-// Start starts the web server
+// Start starts the web server. It blocks until the server fails or is shut
+// down, and returns nil after Shutdown.
 func (s *Server) Start() error {
-	addr := fmt.Sprintf("%s:%d", s.Config.WebServer.Host, s.Config.WebServer.Port)
-	log.Infof("Starting web server on http://%s", addr)
-	return http.ListenAndServe(addr, s.handler)
+	if s.server.TLSConfig == nil {
+		log.Infof("Starting web server on http://%s", s.server.Addr)
+		return ignoreServerClosed(s.server.ListenAndServe())
+	}
+
+	if s.redirect != nil {
+		go func() {
+			log.Infof("Redirecting http://%s to HTTPS", s.redirect.Addr)
+			if err := ignoreServerClosed(s.redirect.ListenAndServe()); err != nil {
+				log.Errorf("HTTP redirect server error: %v", err)
+			}
+		}()
+	}
+
+	log.Infof("Starting web server on https://%s", s.server.Addr)
+	// The certificate was already loaded into TLSConfig by New
+	return ignoreServerClosed(s.server.ListenAndServeTLS("", ""))
+}
+
+// ignoreServerClosed drops the error a server returns after being shut down
+func ignoreServerClosed(err error) error {
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// handleHTTPSRedirect sends plain HTTP requests to the same URL over HTTPS
+func (s *Server) handleHTTPSRedirect(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if port := s.Config.WebServer.Port; port != 443 {
+		host = net.JoinHostPort(host, strconv.Itoa(port))
+	}
+
+	target := url.URL{Scheme: "https", Host: host, Path: r.URL.Path, RawQuery: r.URL.RawQuery}
+	http.Redirect(w, r, target.String(), http.StatusMovedPermanently)
+}
+
+// Shutdown stops accepting connections and waits for in-flight requests, such
+// as large downloads, to finish until ctx is done
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s.redirect != nil {
+		if err := s.redirect.Shutdown(ctx); err != nil {
+			log.Warnf("HTTP redirect server did not shut down cleanly: %v", err)
+		}
+	}
+	return s.server.Shutdown(ctx)
 }
 
 // handleIndex serves the main HTML page
@@ -89,11 +282,14 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
 
 	// Get initial data
 	stats, _ := s.DB.GetStats()
-	communities := s.getCommunityList()
+	communities := s.getCommunityList(communitySuggestionsLimit)
 
 	data := map[string]interface{}{
-		"Stats":       stats,
-		"Communities": communities,
+		"Stats":            stats,
+		"Communities":      communities,
+		"SuggestionsLimit": communitySuggestionsLimit,
+		"Defaults":         s.Config.WebServer,
+		"Author":           strings.TrimSpace(r.URL.Query().Get("author")), // Set by links from the authors page
 	}
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
@@ -122,19 +318,30 @@ func (s *Server) handleMediaGrid(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Parse filters
-	community := query.Get("community")
-	mediaType := query.Get("type")
+	// Parse filters, falling back to the configured defaults when a param is absent
+	defaults := s.Config.WebServer
+	community := defaults.DefaultCommunity
+	if _, ok := query["community"]; ok {
+		community = query.Get("community")
+	}
+	mediaType := defaults.DefaultType
+	if _, ok := query["type"]; ok {
+		mediaType = query.Get("type")
+	}
+	author := strings.TrimSpace(query.Get("author"))
+	favorites := query.Get("favorites") == "true"
 	sortBy := query.Get("sort")
 	if sortBy == "" {
-		sortBy = "downloaded_at"
+		sortBy = defaults.DefaultSort
 	}
 	sortOrder := query.Get("order")
 	if sortOrder == "" {
-		sortOrder = "DESC"
+		sortOrder = defaults.DefaultOrder
 	}
 
-	media, total := s.getMediaList(community, mediaType, sortBy, sortOrder, limit, offset)
+	dates := parseDateRange(query)
+
+	media, total := s.getMediaList(community, mediaType, author, favorites, dates, sortBy, sortOrder, limit, offset)
 
 	data := map[string]interface{}{
 		"Media":      media,
@@ -143,6 +350,11 @@ func (s *Server) handleMediaGrid(w http.ResponseWriter, r *http.Request) {
 		"Offset":     offset,
 		"Community":  community,
 		"Type":       mediaType,
+		"Author":     author,
+		"Favorites":  favorites,
+		"From":       query.Get("from"),
+		"To":         query.Get("to"),
+		"DateField":  query.Get("date_field"),
 		"Sort":       sortBy,
 		"SortOrder":  sortOrder,
 		"HasPrev":    offset > 0,
@@ -160,7 +372,12 @@ func (s *Server) handleMediaGrid(w http.ResponseWriter, r *http.Request) {
 
 // handleGetMedia returns a paginated list of media
 func (s *Server) handleGetMedia(w http.ResponseWriter, r *http.Request) {
-	query := r.URL.Query()
+	// r.URL.Query() silently drops malformed pairs, which would turn a bad filter into no filter
+	query, err := url.ParseQuery(r.URL.RawQuery)
+	if err != nil {
+		http.Error(w, "Invalid query string", http.StatusBadRequest)
+		return
+	}
 
 	// Parse pagination params
 	limit := 50
@@ -177,25 +394,83 @@ func (s *Server) handleGetMedia(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Optional ID cursors; when present they replace offset pagination
+	var afterID, beforeID *int64
+	if a := query.Get("after_id"); a != "" {
+		parsed, err := strconv.ParseInt(a, 10, 64)
+		if err != nil || parsed < 0 {
+			http.Error(w, "Invalid after_id", http.StatusBadRequest)
+			return
+		}
+		afterID = &parsed
+	}
+	if b := query.Get("before_id"); b != "" {
+		parsed, err := strconv.ParseInt(b, 10, 64)
+		if err != nil || parsed < 0 {
+			http.Error(w, "Invalid before_id", http.StatusBadRequest)
+			return
+		}
+		beforeID = &parsed
+	}
+	if afterID != nil && beforeID != nil {
+		http.Error(w, "after_id and before_id cannot be combined", http.StatusBadRequest)
+		return
+	}
+
 	// Parse filter params
 	sortBy := query.Get("sort")
 	if sortBy == "" {
 		sortBy = "downloaded_at"
 	}
 
+	// Partial-match patterns are restricted to the characters names can contain plus wildcards
+	communityLike := query.Get("community_like")
+	authorLike := query.Get("author_like")
+	for param, pattern := range map[string]string{"community_like": communityLike, "author_like": authorLike} {
+		if pattern != "" && !likePattern.MatchString(pattern) {
+			http.Error(w, fmt.Sprintf("Invalid %s: only letters, digits, '_' and '%%' are allowed", param), http.StatusBadRequest)
+			return
+		}
+	}
+
 	sortOrder := query.Get("order")
 	if sortOrder == "" {
 		sortOrder = "DESC"
 	}
 
+	if tagMatch := query.Get("tag_match"); tagMatch != "" && tagMatch != "any" && tagMatch != "all" {
+		http.Error(w, "tag_match must be 'any' or 'all'", http.StatusBadRequest)
+		return
+	}
+
+	var minScore *int
+	if m := query.Get("min_score"); m != "" {
+		parsed, err := strconv.Atoi(m)
+		if err != nil {
+			http.Error(w, "Invalid min_score", http.StatusBadRequest)
+			return
+		}
+		minScore = &parsed
+	}
+
 	// Use database layer method for querying
 	filter := database.MediaFilter{
-		Community: query.Get("community"),
-		MediaType: query.Get("type"),
-		SortBy:    sortBy,
-		SortOrder: sortOrder,
-		Limit:     limit,
-		Offset:    offset,
+		Community:     query.Get("community"),
+		CommunityLike: communityLike,
+		MediaType:     query.Get("type"),
+		Author:        strings.TrimSpace(query.Get("author")),
+		AuthorLike:    authorLike,
+		Favorites:     query.Get("favorites") == "true",
+		Dates:         parseDateRange(query),
+		MinScore:      minScore,
+		Tags:          query["tag"],
+		MatchAllTags:  query.Get("tag_match") == "all",
+		SortBy:        sortBy,
+		SortOrder:     sortOrder,
+		Limit:         limit,
+		Offset:        offset,
+		AfterID:       afterID,
+		BeforeID:      beforeID,
 	}
 
 	mediaItems, total, err := s.DB.GetMediaWithFilters(filter)
@@ -208,7 +483,7 @@ func (s *Server) handleGetMedia(w http.ResponseWriter, r *http.Request) {
 	// Convert to map format for API response
 	media := make([]map[string]interface{}, len(mediaItems))
 	for i, item := range mediaItems {
-		serveURL := fmt.Sprintf("/media/%s", filepath.Join(item.CommunityName, item.FileName))
+		serveURL := s.serveURL(&item)
 
 		media[i] = map[string]interface{}{
 			"id":             item.ID,
@@ -224,11 +499,21 @@ func (s *Server) handleGetMedia(w http.ResponseWriter, r *http.Request) {
 			"file_path":      item.FilePath,
 			"file_size":      item.FileSize,
 			"media_type":     item.MediaType,
+			"mime_type":      item.MIMEType,
 			"post_url":       item.PostURL,
+			"post_ap_id":     item.PostApID,
+			"animated":       item.Animated,
+			"duration_seconds": item.DurationSeconds,
+			"download_ms":    item.DownloadMS,
 			"post_score":     item.PostScore,
+			"post_upvotes":   item.PostUpvotes,
+			"post_downvotes": item.PostDownvotes,
+			"post_comments":  item.PostComments,
 			"post_created":   item.PostCreated.Format(time.RFC3339),
 			"downloaded_at":  item.DownloadedAt.Format(time.RFC3339),
+			"is_favorite":    item.IsFavorite,
 			"serve_url":      serveURL,
+			"thumbnail_url":  s.thumbnailURL(item),
 		}
 	}
 
@@ -239,6 +524,47 @@ func (s *Server) handleGetMedia(w http.ResponseWriter, r *http.Request) {
 		"offset": offset,
 	}
 
+	// Pagination metadata is repeated in headers for generic HTTP clients
+	var links []string
+	pageLink := func(rel string, set map[string]string) {
+		linkQuery := url.Values{}
+		for key, values := range query {
+			linkQuery[key] = values
+		}
+		for _, key := range []string{"offset", "after_id", "before_id"} {
+			linkQuery.Del(key)
+		}
+		for key, value := range set {
+			linkQuery.Set(key, value)
+		}
+		links = append(links, fmt.Sprintf(`<%s?%s>; rel="%s"`, r.URL.Path, linkQuery.Encode(), rel))
+	}
+
+	// Cursors: pass next_cursor as after_id and prev_cursor as before_id
+	if afterID != nil || beforeID != nil {
+		var nextCursor, prevCursor interface{}
+		if len(mediaItems) > 0 {
+			prevCursor = mediaItems[0].ID
+			nextCursor = mediaItems[len(mediaItems)-1].ID
+			pageLink("next", map[string]string{"after_id": strconv.FormatInt(mediaItems[len(mediaItems)-1].ID, 10)})
+			pageLink("prev", map[string]string{"before_id": strconv.FormatInt(mediaItems[0].ID, 10)})
+		}
+		response["next_cursor"] = nextCursor
+		response["prev_cursor"] = prevCursor
+	} else {
+		if offset+limit < total {
+			pageLink("next", map[string]string{"offset": strconv.Itoa(offset + limit)})
+		}
+		if offset > 0 {
+			pageLink("prev", map[string]string{"offset": strconv.Itoa(max(offset-limit, 0))})
+		}
+		w.Header().Set("X-Page", strconv.Itoa(offset/limit+1))
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
@@ -255,7 +581,7 @@ func (s *Server) handleGetMediaByID(w http.ResponseWriter, r *http.Request) {
 
 	media, err := s.DB.GetMediaByID(id)
 	if err != nil {
-		if err.Error() == "media not found" {
+		if errors.Is(err, database.ErrMediaNotFound) {
 			http.Error(w, "Media not found", http.StatusNotFound)
 			return
 		}
@@ -264,7 +590,50 @@ func (s *Server) handleGetMediaByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	serveURL := fmt.Sprintf("/media/%s", filepath.Join(media.CommunityName, media.FileName))
+	serveURL := s.serveURL(media)
+
+	// All posts this file has appeared in (original post plus crossposts)
+	linkedPosts, err := s.DB.GetPostsForMedia(media.ID)
+	if err != nil {
+		log.Errorf("Failed to get posts for media: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	posts := make([]map[string]interface{}, len(linkedPosts))
+	for i, p := range linkedPosts {
+		posts[i] = map[string]interface{}{
+			"post_id":        p.PostID,
+			"post_title":     p.PostTitle,
+			"community_name": p.CommunityName,
+			"author_name":    p.AuthorName,
+			"linked_at":      p.LinkedAt,
+		}
+	}
+
+	tags, err := s.DB.GetMediaTags(media.ID)
+	if err != nil {
+		log.Errorf("Failed to get tags for media: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Other posts of the same link, recorded with scraper.track_crossposts
+	postCrossposts, err := s.DB.GetCrossposts(media.PostID)
+	if err != nil {
+		log.Errorf("Failed to get crossposts for media: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	crossposts := make([]map[string]interface{}, len(postCrossposts))
+	for i, c := range postCrossposts {
+		crossposts[i] = map[string]interface{}{
+			"post_id":        c.CrosspostID,
+			"post_title":     c.PostTitle,
+			"community_name": c.CommunityName,
+			"post_ap_id":     c.PostApID,
+			"post_created":   c.PostCreated.Format(time.RFC3339),
+		}
+	}
 
 	response := map[string]interface{}{
 		"id":             media.ID,
@@ -280,17 +649,144 @@ func (s *Server) handleGetMediaByID(w http.ResponseWriter, r *http.Request) {
 		"file_path":      media.FilePath,
 		"file_size":      media.FileSize,
 		"media_type":     media.MediaType,
+		"mime_type":      media.MIMEType,
 		"post_url":       media.PostURL,
+		"post_ap_id":     media.PostApID,
+		"animated":       media.Animated,
+		"duration_seconds": media.DurationSeconds,
+		"download_ms":    media.DownloadMS,
 		"post_score":     media.PostScore,
+		"post_upvotes":   media.PostUpvotes,
+		"post_downvotes": media.PostDownvotes,
+		"post_comments":  media.PostComments,
 		"post_created":   media.PostCreated.Format(time.RFC3339),
 		"downloaded_at":  media.DownloadedAt.Format(time.RFC3339),
+		"is_favorite":    media.IsFavorite,
 		"serve_url":      serveURL,
+		"thumbnail_url":  s.thumbnailURL(*media),
+		"posts":          posts,
+		"crossposts":     crossposts,
+		"tags":           tags,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
+// handleGetScoreHistory returns the recorded score samples for a media item's post
+func (s *Server) handleGetScoreHistory(w http.ResponseWriter, r *http.Request) {
+	idStr := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/media/"), "/score-history")
+	mediaID, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid media ID", http.StatusBadRequest)
+		return
+	}
+
+	postID, err := s.DB.GetPostIDByMediaID(mediaID)
+	if err != nil {
+		if errors.Is(err, database.ErrMediaNotFound) {
+			http.Error(w, "Media not found", http.StatusNotFound)
+			return
+		}
+		log.Errorf("Failed to get post ID for media: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	history, err := s.DB.GetScoreHistory(postID)
+	if err != nil {
+		log.Errorf("Failed to get score history: %v", err)
+		http.Error(w, "Failed to get score history", http.StatusInternalServerError)
+		return
+	}
+	if history == nil {
+		history = []database.ScorePoint{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"post_id": postID,
+		"history": history,
+	})
+}
+
+// handleGetMediaByHashPrefix returns the media whose hash starts with a prefix of at least 8 hex digits
+func (s *Server) handleGetMediaByHashPrefix(w http.ResponseWriter, r *http.Request) {
+	prefix := strings.TrimPrefix(r.URL.Path, "/api/media/by-hash/")
+	if !hashPrefixPattern.MatchString(prefix) {
+		http.Error(w, "Invalid hash prefix: must be 8 to 64 hex digits", http.StatusBadRequest)
+		return
+	}
+	prefix = strings.ToLower(prefix)
+
+	mediaItems, err := s.DB.GetMediaByHashPrefix(prefix)
+	if err != nil {
+		log.Errorf("Failed to get media by hash prefix: %v", err)
+		http.Error(w, "Failed to query media", http.StatusInternalServerError)
+		return
+	}
+
+	media := make([]map[string]interface{}, len(mediaItems))
+	for i, item := range mediaItems {
+		media[i] = s.mediaListItem(item)
+		media[i]["media_hash"] = item.MediaHash
+		media[i]["media_url"] = item.MediaURL
+		media[i]["file_path"] = item.FilePath
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"prefix": prefix,
+		"media":  media,
+		"total":  len(media),
+	})
+}
+
+// handleToggleFavorite flips the favorite flag of a media item and returns the new state
+func (s *Server) handleToggleFavorite(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	idStr := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/media/"), "/favorite")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid media ID", http.StatusBadRequest)
+		return
+	}
+
+	media, err := s.DB.GetMediaByID(id)
+	if err != nil {
+		if errors.Is(err, database.ErrMediaNotFound) {
+			http.Error(w, "Media not found", http.StatusNotFound)
+			return
+		}
+		log.Errorf("Failed to get media by ID: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	favorite := !media.IsFavorite
+	if err := s.DB.SetFavorite(id, favorite); err != nil {
+		// Deleted since it was read
+		if errors.Is(err, database.ErrMediaNotFound) {
+			http.Error(w, "Media not found", http.StatusNotFound)
+			return
+		}
+		log.Errorf("Failed to update favorite: %v", err)
+		http.Error(w, "Failed to update favorite", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":          id,
+		"is_favorite": favorite,
+	})
+}
+
 // handleGetStats returns statistics about scraped media
 func (s *Server) handleGetStats(w http.ResponseWriter, r *http.Request) {
 	stats, err := s.DB.GetStats()
@@ -300,44 +796,56 @@ func (s *Server) handleGetStats(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// File paths can only be checked when media is stored on the local filesystem
+	if _, ok := s.Storage.(*storage.Local); ok {
+		total, onDisk, missing, err := s.DB.GetMediaIntegrityStats()
+		if err != nil {
+			log.Errorf("Failed to get integrity stats: %v", err)
+			http.Error(w, "Failed to get stats", http.StatusInternalServerError)
+			return
+		}
+		stats["integrity"] = map[string]int{
+			"total":   total,
+			"on_disk": onDisk,
+			"missing": missing,
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(stats)
 }
 
-// handleGetCommunities returns a list of communities with media counts
+// handleGetCommunities returns a list of communities with media counts,
+// optionally filtered by name and paginated
 func (s *Server) handleGetCommunities(w http.ResponseWriter, r *http.Request) {
-	type CommunityCount struct {
-		Name  string `db:"community_name"`
-		Count int    `db:"count"`
+	query := r.URL.Query()
+
+	// Without a limit every community is returned
+	limit := 0
+	if l := query.Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= maxCommunitiesLimit {
+			limit = parsed
+		}
 	}
 
-	query := `
-		SELECT community_name, COUNT(*) as count
-		FROM scraped_media
-		GROUP BY community_name
-		ORDER BY count DESC
-	`
+	offset := 0
+	if o := query.Get("offset"); o != "" {
+		if parsed, err := strconv.Atoi(o); err == nil && parsed >= 0 {
+			offset = parsed
+		}
+	}
 
-	var communities []CommunityCount
-	err := s.DB.Select(&communities, query)
+	communities, total, err := s.DB.GetCommunityCounts(strings.TrimSpace(query.Get("q")), limit, offset)
 	if err != nil {
 		log.Errorf("Failed to query communities: %v", err)
 		http.Error(w, "Failed to query communities", http.StatusInternalServerError)
 		return
 	}
 
-	// Convert to map format for API response
-	result := make([]map[string]interface{}, len(communities))
-	for i, c := range communities {
-		result[i] = map[string]interface{}{
-			"name":  c.Name,
-			"count": c.Count,
-		}
-	}
-
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"communities": result,
+		"communities": communityCountItems(communities),
+		"total":       total,
 	})
 }
 
@@ -354,7 +862,7 @@ func (s *Server) handleGetComments(w http.ResponseWriter, r *http.Request) {
 	// Get the post_id for this media item
 	postID, err := s.DB.GetPostIDByMediaID(mediaID)
 	if err != nil {
-		if err.Error() == "media not found" {
+		if errors.Is(err, database.ErrMediaNotFound) {
 			http.Error(w, "Media not found", http.StatusNotFound)
 			return
 		}
@@ -363,8 +871,11 @@ func (s *Server) handleGetComments(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Removed and deleted comments are hidden unless explicitly requested
+	includeRemoved := r.URL.Query().Get("include_removed") == "true"
+
 	// Get comments for the post
-	comments, err := s.DB.GetCommentsByPostID(postID)
+	comments, err := s.DB.GetCommentsByPostID(postID, includeRemoved)
 	if err != nil {
 		log.Errorf("Failed to get comments: %v", err)
 		http.Error(w, "Failed to get comments", http.StatusInternalServerError)
@@ -378,7 +889,7 @@ func (s *Server) handleGetComments(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// handleServeMedia serves media files from the storage directory
+// handleServeMedia serves media files from the storage backend
 func (s *Server) handleServeMedia(w http.ResponseWriter, r *http.Request) {
 	// Extract path after /media/
 	mediaPath := strings.TrimPrefix(r.URL.Path, "/media/")
@@ -389,41 +900,150 @@ func (s *Server) handleServeMedia(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Construct full file path
-	fullPath := filepath.Join(s.Config.Storage.BaseDirectory, mediaPath)
+	// The type recorded at download time beats guessing from the extension,
+	// which is wrong for files saved with a .bin fallback name. Records are
+	// found by their location, or for those whose location is out of date by
+	// their file's path below the community directory.
+	mimeType, err := s.DB.GetMIMETypeByFilePath(s.Storage.Location(mediaPath))
+	if err == nil && mimeType == "" {
+		_, fileName, _ := strings.Cut(mediaPath, "/")
+		mimeType, err = s.DB.GetMIMETypeByFileName(fileName)
+	}
+	if err != nil {
+		log.Warnf("Failed to look up MIME type of %s: %v", mediaPath, err)
+	} else if mimeType != "" {
+		w.Header().Set("Content-Type", mimeType)
+	}
+
+	s.serveStoredFile(w, r, mediaPath)
+}
+
+// handleServeCommunityAsset serves a community's downloaded icon or banner at
+// /community-assets/{name}/icon or /community-assets/{name}/banner
+func (s *Server) handleServeCommunityAsset(w http.ResponseWriter, r *http.Request) {
+	name, asset, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/community-assets/"), "/")
+	if !ok || name == "" || (asset != "icon" && asset != "banner") {
+		http.NotFound(w, r)
+		return
+	}
 
-	// Check if file exists
-	if _, err := os.Stat(fullPath); os.IsNotExist(err) {
+	community, err := s.DB.GetCommunity(name)
+	if err != nil {
+		log.Errorf("Failed to get community: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	var assetPath string
+	if community != nil {
+		assetPath = community.IconPath
+		if asset == "banner" {
+			assetPath = community.BannerPath
+		}
+	}
+	if assetPath == "" {
 		http.Error(w, "File not found", http.StatusNotFound)
 		return
 	}
 
-	// Serve the file
-	http.ServeFile(w, r, fullPath)
+	s.serveStoredFile(w, r, assetPath)
 }
 
-// Helper functions
+// serveStoredFile serves a file from the storage backend by its key. A
+// Content-Type already set on w is kept; otherwise it comes from the extension.
+func (s *Server) serveStoredFile(w http.ResponseWriter, r *http.Request, mediaPath string) {
+	// Local files are served directly so range requests work for video seeking
+	if local, ok := s.Storage.(*storage.Local); ok {
+		fullPath := local.Path(mediaPath)
+		if _, err := os.Stat(fullPath); os.IsNotExist(err) {
+			s.serveFromAdditionalDirs(w, r, mediaPath)
+			return
+		}
+		http.ServeFile(w, r, fullPath)
+		return
+	}
 
-func (s *Server) getCommunityList() []map[string]interface{} {
-	type CommunityCount struct {
-		Name  string `db:"community_name"`
-		Count int    `db:"count"`
+	exists, err := s.Storage.Exists(mediaPath)
+	if err != nil {
+		log.Errorf("Failed to check media in storage: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		s.serveFromAdditionalDirs(w, r, mediaPath)
+		return
 	}
 
-	query := `
-		SELECT community_name, COUNT(*) as count
-		FROM scraped_media
-		GROUP BY community_name
-		ORDER BY count DESC
-	`
+	// Redirect to the backend directly if configured
+	if s.Config.Storage.S3.RedirectServe {
+		target, err := s.Storage.URL(mediaPath)
+		if err != nil {
+			log.Errorf("Failed to get media URL: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if target != "" {
+			http.Redirect(w, r, target, http.StatusFound)
+			return
+		}
+	}
 
-	var communities []CommunityCount
-	err := s.DB.Select(&communities, query)
+	// Otherwise proxy the object through the web server
+	obj, err := s.Storage.Get(mediaPath)
+	if err != nil {
+		log.Errorf("Failed to get media from storage: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer obj.Close()
+
+	if w.Header().Get("Content-Type") == "" {
+		if contentType := mime.TypeByExtension(filepath.Ext(mediaPath)); contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+	}
+	if _, err := io.Copy(w, obj); err != nil {
+		log.Debugf("Failed to stream media %s: %v", mediaPath, err)
+	}
+}
+
+// serveFromAdditionalDirs serves a file missing from storage from the first
+// additional media directory that has it, e.g. after moving old media to another disk
+func (s *Server) serveFromAdditionalDirs(w http.ResponseWriter, r *http.Request, mediaPath string) {
+	for _, dir := range s.Config.WebServer.AdditionalMediaDirs {
+		root, err := filepath.Abs(dir)
+		if err != nil {
+			continue
+		}
+		fullPath := filepath.Join(root, filepath.FromSlash(mediaPath))
+
+		// Each directory is a root of its own: never serve anything outside it
+		if rel, err := filepath.Rel(root, fullPath); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+
+		if info, err := os.Stat(fullPath); err == nil && !info.IsDir() {
+			http.ServeFile(w, r, fullPath)
+			return
+		}
+	}
+	http.Error(w, "File not found", http.StatusNotFound)
+}
+
+// Helper functions
+
+// getCommunityList returns the communities with the most media, up to limit (0 = all)
+func (s *Server) getCommunityList(limit int) []map[string]interface{} {
+	communities, _, err := s.DB.GetCommunityCounts("", limit, 0)
 	if err != nil {
 		return []map[string]interface{}{}
 	}
+	return communityCountItems(communities)
+}
 
-	// Convert to map format for template compatibility
+// communityCountItems converts community counts to the map format used by
+// templates and the API
+func communityCountItems(communities []database.CommunityCount) []map[string]interface{} {
 	result := make([]map[string]interface{}, len(communities))
 	for i, c := range communities {
 		result[i] = map[string]interface{}{
@@ -434,11 +1054,14 @@ func (s *Server) getCommunityList() []map[string]interface{} {
 	return result
 }
 
-func (s *Server) getMediaList(community, mediaType, sortBy, sortOrder string, limit, offset int) ([]map[string]interface{}, int) {
+func (s *Server) getMediaList(community, mediaType, author string, favorites bool, dates database.DateRange, sortBy, sortOrder string, limit, offset int) ([]map[string]interface{}, int) {
 	// Use database layer method for querying
 	filter := database.MediaFilter{
 		Community: community,
 		MediaType: mediaType,
+		Author:    author,
+		Favorites: favorites,
+		Dates:     dates,
 		SortBy:    sortBy,
 		SortOrder: sortOrder,
 		Limit:     limit,
@@ -452,40 +1075,68 @@ func (s *Server) getMediaList(community, mediaType, sortBy, sortOrder string, li
 	}
 
 	// Convert to map format for template compatibility
-	media := make([]map[string]interface{}, len(mediaItems))
-	for i, item := range mediaItems {
-		serveURL := fmt.Sprintf("/media/%s", filepath.Join(item.CommunityName, item.FileName))
+	return s.mediaListItems(mediaItems), total
+}
 
-		media[i] = map[string]interface{}{
-			"id":             item.ID,
-			"post_id":        item.PostID,
-			"post_title":     item.PostTitle,
-			"community_name": item.CommunityName,
-			"author_name":    item.AuthorName,
-			"media_type":     item.MediaType,
-			"file_size":      item.FileSize,
-			"post_score":     item.PostScore,
-			"post_url":       item.PostURL,
-			"serve_url":      serveURL,
-			"downloaded_at":  item.DownloadedAt.Format(time.RFC3339),
-			"post_created":   item.PostCreated.Format(time.RFC3339),
-		}
+// mediaListItems converts media records to the map format used by templates
+func (s *Server) mediaListItems(items []models.ScrapedMedia) []map[string]interface{} {
+	result := make([]map[string]interface{}, len(items))
+	for i, item := range items {
+		result[i] = s.mediaListItem(item)
 	}
+	return result
+}
 
-	return media, total
+// serveURL returns the URL a media item's file is served at. The path is the
+// file's storage key, whose directories depend on storage.layout.
+func (s *Server) serveURL(item *models.ScrapedMedia) string {
+	return "/media/" + downloader.MediaKey(s.Storage, item)
 }
 
-func formatFileSize(bytes int64) string {
-	if bytes < 1024 {
-		return fmt.Sprintf("%d B", bytes)
+// thumbnailURL returns the URL of a media item's stored thumbnail, or "" if it has none
+func (s *Server) thumbnailURL(item models.ScrapedMedia) string {
+	key := downloader.ThumbnailKey(s.Storage, &item)
+	if key == "" {
+		return ""
 	}
-	if bytes < 1024*1024 {
-		return fmt.Sprintf("%.1f KB", float64(bytes)/1024)
+	return "/media/" + key
+}
+
+// mediaListItem converts a media record to the map format used by templates
+func (s *Server) mediaListItem(item models.ScrapedMedia) map[string]interface{} {
+	serveURL := s.serveURL(&item)
+
+	return map[string]interface{}{
+		"id":             item.ID,
+		"post_id":        item.PostID,
+		"post_title":     item.PostTitle,
+		"community_name": item.CommunityName,
+		"author_name":    item.AuthorName,
+		"media_type":     item.MediaType,
+		"file_size":      item.FileSize,
+		"post_score":     item.PostScore,
+		"post_upvotes":   item.PostUpvotes,
+		"post_comments":  item.PostComments,
+		"post_url":       item.PostURL,
+		"post_ap_id":     item.PostApID,
+		"animated":       item.Animated,
+		"duration_seconds": item.DurationSeconds,
+		"download_ms":    item.DownloadMS,
+		"is_favorite":    item.IsFavorite,
+		"serve_url":      serveURL,
+		"thumbnail_url":  s.thumbnailURL(item),
+		"downloaded_at":  item.DownloadedAt.Format(time.RFC3339),
+		"post_created":   item.PostCreated.Format(time.RFC3339),
 	}
-	if bytes < 1024*1024*1024 {
-		return fmt.Sprintf("%.1f MB", float64(bytes)/(1024*1024))
+}
+
+// formatDuration formats a video length as m:ss, or h:mm:ss for an hour or more
+func formatDuration(seconds float64) string {
+	total := int(seconds + 0.5)
+	if total >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", total/3600, total%3600/60, total%60)
 	}
-	return fmt.Sprintf("%.1f GB", float64(bytes)/(1024*1024*1024))
+	return fmt.Sprintf("%d:%02d", total/60, total%60)
 }
 
 func formatDate(dateStr string) string {
@@ -504,39 +1155,16 @@ const indexTemplate = `{{define "index"}}
 <head>
     <meta charset="UTF-8">
     <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>Lemmy Media Browser</title>
+    <title>{{if .Profile}}{{.Author}} - {{end}}Lemmy Media Browser</title>
+    <link rel="alternate" type="application/rss+xml" title="Lemmy Media" href="/feed.xml">
     <script src="https://unpkg.com/htmx.org@1.9.10"></script>
     <style>
-        * { margin: 0; padding: 0; box-sizing: border-box; }
-        body {
-            font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, 'Helvetica Neue', Arial, sans-serif;
-            background: #0f0f0f;
-            color: #e0e0e0;
-            line-height: 1.6;
-        }
-        .header {
-            background: #1a1a1a;
-            border-bottom: 1px solid #2a2a2a;
-            padding: 12px 16px;
-            position: sticky;
-            top: 0;
-            z-index: 100;
-        }
-        .header-content {
-            max-width: 1400px;
-            margin: 0 auto;
-            display: flex;
-            justify-content: space-between;
-            align-items: center;
-        }
-        .header h1 { font-size: 24px; font-weight: 600; color: #fff; }
-        .stats {
-            display: flex;
-            gap: 24px;
-            font-size: 14px;
-            color: #999;
-        }
-        .stats span { font-weight: 600; color: #e0e0e0; }
+{{template "base-styles"}}
+{{if .Profile}}
+{{template "report-styles"}}
+        .header h1 .community-name a { color: inherit; }
+        .summary-item .value a { color: inherit; text-decoration: none; }
+{{end}}
         .filters {
             background: #1a1a1a;
             border-bottom: 1px solid #2a2a2a;
@@ -559,11 +1187,62 @@ const indexTemplate = `{{define "index"}}
             cursor: pointer;
         }
         select:hover { background: #333; }
-        .content {
+        input[type="search"] {
+            background: #2a2a2a;
+            color: #e0e0e0;
+            border: 1px solid #3a3a3a;
+            padding: 6px 12px;
+            border-radius: 4px;
+            font-size: 14px;
+        }
+        .stats .missing-badge {
+            background: #c62828;
+            color: #fff;
+            border-radius: 4px;
+            padding: 0 8px;
+        }
+        .stats .missing-badge span { color: #fff; }
+        .stats-link { color: #4a9eff; text-decoration: none; }
+        .hash-search-results {
             max-width: 1400px;
-            margin: 0 auto;
-            padding: 24px 16px;
+            margin: 6px auto 0;
+            font-size: 13px;
+            color: #999;
+        }
+        .hash-search-results a {
+            display: block;
+            color: #4a9eff;
+            cursor: pointer;
+            font-family: monospace;
+        }
+        .favorites-filter {
+            display: flex;
+            align-items: center;
+            gap: 6px;
+            font-size: 14px;
+            color: #999;
+            cursor: pointer;
         }
+        .favorite-btn {
+            background: rgba(0, 0, 0, 0.5);
+            border: none;
+            color: #999;
+            font-size: 18px;
+            line-height: 1;
+            width: 32px;
+            height: 32px;
+            border-radius: 4px;
+            cursor: pointer;
+        }
+        .favorite-btn:hover { color: #fff; }
+        .favorite-btn.active { color: #ffc107; }
+        .card-image .favorite-btn {
+            position: absolute;
+            top: 8px;
+            right: 8px;
+            z-index: 1;
+        }
+        .modal-header .favorite-btn { background: #2a2a2a; margin-right: 8px; }
         .grid {
             display: grid;
             grid-template-columns: repeat(auto-fill, minmax(280px, 1fr));
@@ -595,6 +1274,18 @@ const indexTemplate = `{{define "index"}}
             transition: transform 0.2s;
         }
         .card:hover .card-image img, .card:hover .card-image video { transform: scale(1.05); }
+        .card-image .animated-badge {
+            position: absolute;
+            left: 8px;
+            bottom: 8px;
+            background: rgba(0, 0, 0, 0.6);
+            color: #fff;
+            font-size: 11px;
+            font-weight: 600;
+            padding: 2px 6px;
+            border-radius: 4px;
+            pointer-events: none;
+        }
         .card-image .play-overlay {
             position: absolute;
             inset: 0;
@@ -726,6 +1417,7 @@ const indexTemplate = `{{define "index"}}
             width: 100%;
             max-height: 70vh;
         }
+        .animation-controls { text-align: center; margin-top: 8px; }
         .modal-meta {
             margin-top: 16px;
             display: grid;
@@ -801,61 +1493,110 @@ const indexTemplate = `{{define "index"}}
 <body>
     <div class="header">
         <div class="header-content">
+            {{if .Profile}}
+            <h1><a href="/">Lemmy Media</a> <span class="community-name">/ <a href="/authors">authors</a> / {{.Author}}</span></h1>
+            {{else}}
             <h1>Lemmy Media</h1>
-            <div class="stats">
+            {{end}}
+            <div class="stats" id="stats">
                 {{if .Stats.total_media}}
                     <div><span>{{.Stats.total_media}}</span> items</div>
                     {{range $type, $count := .Stats.by_type}}
                         <div><span>{{$count}}</span> {{$type}}</div>
                     {{end}}
                 {{end}}
+                <div><a href="/stats" class="stats-link">Statistics</a></div>
+                <div><a href="/authors" class="stats-link">Authors</a></div>
             </div>
         </div>
     </div>
 
     <div class="filters">
         <div class="filters-content">
-            <select id="community" name="community">
-                <option value="">All Communities</option>
+            <input type="search" id="community" name="community" list="community-options" placeholder="All Communities" value="{{.Defaults.DefaultCommunity}}" autocomplete="off">
+            <datalist id="community-options">
                 {{range .Communities}}
                     <option value="{{.name}}">{{.name}} ({{.count}})</option>
                 {{end}}
-            </select>
+            </datalist>
             <select id="type" name="type">
                 <option value="">All Types</option>
-                <option value="image">Images</option>
-                <option value="video">Videos</option>
-                <option value="other">Other</option>
+                <option value="image" {{if eq .Defaults.DefaultType "image"}}selected{{end}}>Images</option>
+                <option value="video" {{if eq .Defaults.DefaultType "video"}}selected{{end}}>Videos</option>
+                <option value="other" {{if eq .Defaults.DefaultType "other"}}selected{{end}}>Other</option>
             </select>
+            <input type="search" id="author" name="author" placeholder="Author" value="{{.Author}}" autocomplete="off">
+            <label class="favorites-filter"><input type="checkbox" id="favorites" name="favorites" value="true"> Favorites only</label>
             <select id="sort" name="sort">
-                <option value="downloaded_at">Downloaded</option>
-                <option value="post_created">Posted</option>
-                <option value="file_size">File Size</option>
-                <option value="post_score">Score</option>
+                <option value="downloaded_at" {{if eq .Defaults.DefaultSort "downloaded_at"}}selected{{end}}>Downloaded</option>
+                <option value="post_created" {{if eq .Defaults.DefaultSort "post_created"}}selected{{end}}>Posted</option>
+                <option value="file_size" {{if eq .Defaults.DefaultSort "file_size"}}selected{{end}}>File Size</option>
+                <option value="post_score" {{if eq .Defaults.DefaultSort "post_score"}}selected{{end}}>Score</option>
+                <option value="post_upvotes" {{if eq .Defaults.DefaultSort "post_upvotes"}}selected{{end}}>Upvotes</option>
+                <option value="post_comments" {{if eq .Defaults.DefaultSort "post_comments"}}selected{{end}}>Comments</option>
+                <option value="post_downvotes" {{if eq .Defaults.DefaultSort "post_downvotes"}}selected{{end}}>Downvotes</option>
+                <option value="post_title" {{if eq .Defaults.DefaultSort "post_title"}}selected{{end}}>Title</option>
+                <option value="community_name" {{if eq .Defaults.DefaultSort "community_name"}}selected{{end}}>Community</option>
+                <option value="author_name" {{if eq .Defaults.DefaultSort "author_name"}}selected{{end}}>Author</option>
+                <option value="media_type" {{if eq .Defaults.DefaultSort "media_type"}}selected{{end}}>Type</option>
+                <option value="instance" {{if eq .Defaults.DefaultSort "instance"}}selected{{end}}>Instance</option>
             </select>
             <select id="order" name="order">
-                <option value="DESC">Newest</option>
-                <option value="ASC">Oldest</option>
+                <option value="DESC" {{if eq .Defaults.DefaultOrder "DESC"}}selected{{end}}>Newest</option>
+                <option value="ASC" {{if eq .Defaults.DefaultOrder "ASC"}}selected{{end}}>Oldest</option>
             </select>
         </div>
     </div>
-
+{{if .Defaults.DebugMode}}
+    <div class="filters">
+        <div class="filters-content">
+            <input type="search" id="hash-search" placeholder="Media hash prefix (debug)" autocomplete="off">
+        </div>
+        <div id="hash-search-results" class="hash-search-results"></div>
+    </div>
+{{end}}
     <div class="content">
+        {{with .Profile}}
+        <div class="section">
+            <div class="summary">
+                <div class="summary-item"><div class="value">{{.MediaCount}}</div><div class="label">Media files</div></div>
+                <div class="summary-item"><div class="value">{{.CommentCount}}</div><div class="label">Comments</div></div>
+                {{if .MostActiveCommunity}}
+                <div class="summary-item"><div class="value"><a href="/community/{{.MostActiveCommunity}}">{{.MostActiveCommunity}}</a></div><div class="label">Most active in</div></div>
+                {{end}}
+                {{if not .FirstSeen.IsZero}}
+                <div class="summary-item"><div class="value">{{.FirstSeen.Format "Jan 2, 2006"}}</div><div class="label">First seen</div></div>
+                {{end}}
+            </div>
+        </div>
+        {{end}}
         <div id="media-container"
              hx-get="/media-grid"
              hx-trigger="load, filterChange from:body"
-             hx-include="[name='community'],[name='type'],[name='sort'],[name='order']">
+             hx-include="[name='community'],[name='type'],[name='author'],[name='favorites'],[name='sort'],[name='order']">
             <div class="loading">Loading...</div>
         </div>
     </div>
 
-    <div id="modal" class="modal" onclick="if(event.target === this) this.classList.remove('active')">
+    <div id="modal" class="modal" onclick="if(event.target === this) closeModal()">
         <div class="modal-content" onclick="event.stopPropagation()">
             <div id="modal-body"></div>
         </div>
     </div>
 
     <script>
+        // Checking files on disk can be slow, so the missing-files warning loads after the page
+        fetch('/api/stats')
+            .then(r => r.json())
+            .then(stats => {
+                if (!stats.integrity || stats.integrity.missing === 0) return;
+                const badge = document.createElement('div');
+                badge.className = 'missing-badge';
+                badge.title = stats.integrity.missing + ' of ' + stats.integrity.total + ' media files are missing from disk';
+                badge.innerHTML = '<span>' + stats.integrity.missing + '</span> missing';
+                document.getElementById('stats').appendChild(badge);
+            });
+
         // Trigger filter updates
         document.querySelectorAll('select').forEach(select => {
             select.addEventListener('change', () => {
@@ -863,21 +1604,176 @@ const indexTemplate = `{{define "index"}}
             });
         });
 
+        document.getElementById('favorites').addEventListener('change', () => {
+            document.body.dispatchEvent(new CustomEvent('filterChange'));
+        });
+
+        // Communities are suggested as you type instead of all being listed up front.
+        // The filter is an exact match, so it applies once a name is picked or entered.
+        const communityInput = document.getElementById('community');
+        let communityTimer = null;
+        communityInput.addEventListener('input', () => {
+            clearTimeout(communityTimer);
+            communityTimer = setTimeout(() => {
+                fetch('/api/communities?limit={{.SuggestionsLimit}}&q=' + encodeURIComponent(communityInput.value.trim()))
+                    .then(r => r.json())
+                    .then(data => {
+                        document.getElementById('community-options').innerHTML = data.communities.map(c =>
+                            '<option value="' + escapeHtml(c.name) + '">' + escapeHtml(c.name) + ' (' + c.count + ')</option>'
+                        ).join('');
+                    });
+            }, 200);
+        });
+        communityInput.addEventListener('change', () => {
+            document.body.dispatchEvent(new CustomEvent('filterChange'));
+        });
+
+        // Author is matched server-side, so wait for typing to pause
+        let authorTimer = null;
+        document.getElementById('author').addEventListener('input', () => {
+            clearTimeout(authorTimer);
+            authorTimer = setTimeout(() => {
+                document.body.dispatchEvent(new CustomEvent('filterChange'));
+            }, 400);
+        });
+
+        function filterByAuthor(name) {
+            document.getElementById('author').value = name;
+            closeModal();
+            document.body.dispatchEvent(new CustomEvent('filterChange'));
+        }
+
+        // toggleFavorite flips an item's favorite flag and updates every star shown for it
+        function toggleFavorite(id) {
+            fetch('/api/media/' + id + '/favorite', { method: 'POST' })
+                .then(r => r.json())
+                .then(result => {
+                    if (currentItem && currentItem.id === result.id) {
+                        currentItem.is_favorite = result.is_favorite;
+                    }
+                    document.querySelectorAll('.favorite-btn[data-id="' + result.id + '"]').forEach(btn => {
+                        btn.classList.toggle('active', result.is_favorite);
+                    });
+                });
+        }
+
+        // Current modal state, used by keyboard navigation
+        let currentItem = null;
+        let currentIndex = -1;
+
         // Modal functions
         window.openModal = function(id) {
             fetch('/api/media/' + id)
                 .then(r => r.json())
                 .then(item => {
                     if (item) {
+                        currentItem = item;
+                        currentIndex = pageMediaIds().indexOf(item.id);
                         showModal(item);
                     }
                 });
         };
 
+        window.closeModal = function() {
+            const video = document.querySelector('#modal-body video');
+            if (video) video.pause();
+            document.getElementById('modal').classList.remove('active');
+            currentItem = null;
+            currentIndex = -1;
+        };
+
+        // pageMediaIds returns the media IDs on the current page in display order
+        function pageMediaIds() {
+            return Array.from(document.querySelectorAll('#media-container .card[data-id]'))
+                .map(card => parseInt(card.dataset.id, 10));
+        }
+
+        // navigateModal moves to the next/previous item, wrapping around the current page
+        function navigateModal(step) {
+            const ids = pageMediaIds();
+            if (ids.length === 0) return;
+            const index = currentIndex < 0 ? 0 : (currentIndex + step + ids.length) % ids.length;
+            openModal(ids[index]);
+        }
+
+        function downloadCurrent() {
+            if (!currentItem) return;
+            const link = document.createElement('a');
+            link.href = currentItem.serve_url;
+            link.download = (currentItem.file_name || '').split('/').pop();
+            document.body.appendChild(link);
+            link.click();
+            link.remove();
+        }
+
+        function toggleFullscreen() {
+            if (document.fullscreenElement) {
+                document.exitFullscreen();
+                return;
+            }
+            const el = document.querySelector('#modal-body .modal-image, #modal-body .modal-video');
+            if (el && el.requestFullscreen) el.requestFullscreen();
+        }
+
+        // Keyboard shortcuts while the modal is open
+        document.addEventListener('keydown', event => {
+            if (!document.getElementById('modal').classList.contains('active')) return;
+            if (event.ctrlKey || event.metaKey || event.altKey) return;
+            if (['INPUT', 'SELECT', 'TEXTAREA'].includes(event.target.tagName)) return;
+
+            switch (event.key) {
+                case 'ArrowRight': case 'l': case 'L':
+                    navigateModal(1);
+                    break;
+                case 'ArrowLeft': case 'h': case 'H':
+                    navigateModal(-1);
+                    break;
+                case 'Escape':
+                    if (!document.fullscreenElement) closeModal();
+                    break;
+                case 'd': case 'D':
+                    downloadCurrent();
+                    break;
+                case 'f': case 'F':
+                    toggleFullscreen();
+                    break;
+                case 's': case 'S':
+                    if (currentItem) toggleFavorite(currentItem.id);
+                    break;
+                default:
+                    return;
+            }
+            event.preventDefault();
+        });
+
+        // Browsers can't pause an animated image, so pausing swaps it for a
+        // canvas holding the current frame until it is played again
+        function toggleAnimation(button) {
+            const img = document.querySelector('#modal-body img.modal-image');
+            const frozen = document.querySelector('#modal-body canvas.modal-image');
+            if (frozen) {
+                frozen.remove();
+                img.style.display = '';
+                button.textContent = 'Pause';
+                return;
+            }
+            const canvas = document.createElement('canvas');
+            canvas.className = 'modal-image';
+            canvas.width = img.naturalWidth;
+            canvas.height = img.naturalHeight;
+            canvas.getContext('2d').drawImage(img, 0, 0);
+            img.style.display = 'none';
+            img.after(canvas);
+            button.textContent = 'Play';
+        }
+
         function showModal(item) {
             let mediaHTML = '';
             if (item.media_type === 'image') {
                 mediaHTML = '<img src="' + item.serve_url + '" class="modal-image" alt="' + item.post_title + '">';
+                if (item.animated) {
+                    mediaHTML += '<div class="animation-controls"><button class="btn" onclick="toggleAnimation(this)">Pause</button></div>';
+                }
             } else if (item.media_type === 'video') {
                 mediaHTML = '<video src="' + item.serve_url + '" class="modal-video" controls></video>';
             } else {
@@ -887,16 +1783,22 @@ const indexTemplate = `{{define "index"}}
             document.getElementById('modal-body').innerHTML =
                 '<div class="modal-header">' +
                     '<div class="modal-title">' + item.post_title + '</div>' +
-                    '<button class="modal-close" onclick="document.getElementById(\'modal\').classList.remove(\'active\')">&times;</button>' +
+                    '<button class="favorite-btn' + (item.is_favorite ? ' active' : '') + '" data-id="' + item.id + '" onclick="toggleFavorite(' + item.id + ')" title="Favorite (S)">&#9733;</button>' +
+                    '<button class="modal-close" onclick="closeModal()" title="Close (Esc)">&times;</button>' +
                 '</div>' +
                 '<div class="modal-body">' +
                     mediaHTML +
                     '<div class="modal-meta">' +
-                        '<div><strong>Author:</strong> ' + item.author_name + '</div>' +
-                        '<div><strong>Community:</strong> ' + item.community_name + '</div>' +
-                        '<div><strong>Score:</strong> ' + item.post_score + '</div>' +
-                        '<div><strong>Type:</strong> ' + item.media_type + '</div>' +
+                        '<div><strong>Author:</strong> <a href="#" class="modal-link" title="Show media by this author" onclick="filterByAuthor(this.textContent); return false;">' + escapeHtml(item.author_name) + '</a></div>' +
+                        '<div><strong>Community:</strong> <a href="/community/' + encodeURIComponent(item.community_name) + '" class="modal-link" title="Community statistics">' + escapeHtml(item.community_name) + '</a></div>' +
+                        '<div><strong>Score:</strong> ' + item.post_score + ' (+' + item.post_upvotes + ' / -' + item.post_downvotes + ')</div>' +
+                        '<div><strong>Comments:</strong> ' + item.post_comments + '</div>' +
+                        '<div><strong>Type:</strong> ' + item.media_type + (item.animated ? ' (animated)' : '') + (item.duration_seconds ? ', ' + formatDuration(item.duration_seconds) : '') + '</div>' +
                         '<div style="grid-column: 1/-1"><strong>Post:</strong> <a href="' + item.post_url + '" target="_blank" class="modal-link">' + item.post_url + '</a></div>' +
+                        (item.post_ap_id && item.post_ap_id !== item.post_url ?
+                            '<div style="grid-column: 1/-1"><strong>Original:</strong> <a href="' + escapeHtml(item.post_ap_id) + '" target="_blank" class="modal-link" title="The post on its home instance">' + escapeHtml(item.post_ap_id) + '</a></div>' : '') +
+                        renderAlsoPostedIn(item) +
+                        renderCrossposts(item) +
                     '</div>' +
                     '<div class="comments-section" id="comments-section">' +
                         '<div class="loading-comments">Loading comments...</div>' +
@@ -909,6 +1811,33 @@ const indexTemplate = `{{define "index"}}
             loadComments(item.id);
         }
 
+        // renderAlsoPostedIn lists the other posts the same file was found in
+        function renderAlsoPostedIn(item) {
+            const others = (item.posts || []).filter(p => p.post_id !== item.post_id);
+            if (others.length === 0) return '';
+            return '<div style="grid-column: 1/-1"><strong>Also posted in:</strong> ' +
+                others.map(p => escapeHtml(p.community_name) + ' (' + escapeHtml(p.post_title) + ')').join(', ') +
+                '</div>';
+        }
+
+        // renderCrossposts links the other posts of the same link, split into
+        // those made before this post and those made after it
+        function renderCrossposts(item) {
+            const crossposts = item.crossposts || [];
+            const created = new Date(item.post_created);
+            const link = c => '<a href="' + escapeHtml(c.post_ap_id) + '" target="_blank" class="modal-link" title="' + escapeHtml(c.post_title) + '">' + escapeHtml(c.community_name) + '</a>';
+            const from = crossposts.filter(c => new Date(c.post_created) < created);
+            const to = crossposts.filter(c => new Date(c.post_created) >= created);
+            let html = '';
+            if (from.length > 0) {
+                html += '<div style="grid-column: 1/-1"><strong>Crossposted from:</strong> ' + from.map(link).join(', ') + '</div>';
+            }
+            if (to.length > 0) {
+                html += '<div style="grid-column: 1/-1"><strong>Crossposted to:</strong> ' + to.map(link).join(', ') + '</div>';
+            }
+            return html;
+        }
+
         function loadComments(mediaId) {
             fetch('/api/comments/' + mediaId)
                 .then(r => r.json())
@@ -967,6 +1896,16 @@ const indexTemplate = `{{define "index"}}
             return html;
         }
 
+        // Same format as the grid: m:ss, or h:mm:ss for an hour or more
+        function formatDuration(seconds) {
+            const total = Math.round(seconds);
+            const pad = n => String(n).padStart(2, '0');
+            if (total >= 3600) {
+                return Math.floor(total / 3600) + ':' + pad(Math.floor(total % 3600 / 60)) + ':' + pad(total % 60);
+            }
+            return Math.floor(total / 60) + ':' + pad(total % 60);
+        }
+
         function formatTimeAgo(dateStr) {
             const date = new Date(dateStr);
             const now = new Date();
@@ -984,6 +1923,31 @@ const indexTemplate = `{{define "index"}}
             div.textContent = text;
             return div.innerHTML;
         }
+
+        // Debug mode: look up media by a hash prefix, e.g. one copied from the logs
+        const hashSearch = document.getElementById('hash-search');
+        if (hashSearch) {
+            const results = document.getElementById('hash-search-results');
+            hashSearch.addEventListener('change', () => {
+                const prefix = hashSearch.value.trim();
+                if (prefix === '') {
+                    results.innerHTML = '';
+                    return;
+                }
+                fetch('/api/media/by-hash/' + encodeURIComponent(prefix))
+                    .then(r => r.ok ? r.json() : r.text().then(msg => { throw new Error(msg); }))
+                    .then(data => {
+                        if (data.total === 0) {
+                            results.textContent = 'No media matches that hash prefix';
+                            return;
+                        }
+                        results.innerHTML = data.media.map(m =>
+                            '<a onclick="openModal(' + m.id + ')">' + escapeHtml(m.media_hash) + '</a>'
+                        ).join('');
+                    })
+                    .catch(err => { results.textContent = err.message; });
+            });
+        }
     </script>
 </body>
 </html>
@@ -992,12 +1956,14 @@ const indexTemplate = `{{define "index"}}
 const mediaGridTemplate = `{{define "media-grid"}}
 <div class="grid">
     {{range .Media}}
-    <div class="card" onclick="openModal({{.id}})">
+    <div class="card" data-id="{{.id}}" onclick="openModal({{.id}})">
         <div class="card-image">
+            <button class="favorite-btn{{if .is_favorite}} active{{end}}" data-id="{{.id}}" onclick="event.stopPropagation(); toggleFavorite({{.id}})" title="Favorite">&#9733;</button>
             {{if eq .media_type "image"}}
-                <img src="{{.serve_url}}" alt="{{.post_title}}" loading="lazy">
+                <img src="{{or .thumbnail_url .serve_url}}" alt="{{.post_title}}" loading="lazy">
+                {{if .animated}}<span class="animated-badge">ANIMATED</span>{{end}}
             {{else if eq .media_type "video"}}
-                <video src="{{.serve_url}}" preload="metadata" muted playsinline loading="lazy"></video>
+                <video src="{{.serve_url}}"{{with .thumbnail_url}} poster="{{.}}"{{end}} preload="metadata" muted playsinline loading="lazy"></video>
                 <div class="play-overlay">
                     <svg viewBox="0 0 24 24"><path d="M8 5v14l11-7z"/></svg>
                 </div>
@@ -1011,8 +1977,10 @@ const mediaGridTemplate = `{{define "media-grid"}}
             <div class="card-title" title="{{.post_title}}">{{.post_title}}</div>
             <div class="card-meta">
                 <span>{{.community_name}}</span>
+                <span>{{.author_name}}</span>
                 <span>{{.post_score}} pts</span>
                 <span>{{.media_type}}</span>
+                {{if .duration_seconds}}<span title="Duration">{{formatDuration .duration_seconds}}</span>{{end}}
             </div>
         </div>
     </div>
@@ -1023,7 +1991,7 @@ const mediaGridTemplate = `{{define "media-grid"}}
 <div class="pagination">
     <button class="btn"
             {{if .HasPrev}}
-            hx-get="/media-grid?offset={{sub .Offset .Limit}}&limit={{.Limit}}&community={{.Community}}&type={{.Type}}&sort={{.Sort}}&order={{.SortOrder}}"
+            hx-get="/media-grid?offset={{sub .Offset .Limit}}&limit={{.Limit}}&community={{.Community}}&type={{.Type}}&author={{.Author}}{{if .Favorites}}&favorites=true{{end}}{{if .From}}&from={{.From}}{{end}}{{if .To}}&to={{.To}}{{end}}{{if .DateField}}&date_field={{.DateField}}{{end}}&sort={{.Sort}}&order={{.SortOrder}}"
             hx-target="#media-container"
             {{else}}disabled{{end}}>
         ← Previous
@@ -1031,7 +1999,7 @@ const mediaGridTemplate = `{{define "media-grid"}}
     <span style="color: #999; font-size: 14px;">Page {{.Page}} of {{.TotalPages}}</span>
     <button class="btn"
             {{if .HasNext}}
-            hx-get="/media-grid?offset={{add .Offset .Limit}}&limit={{.Limit}}&community={{.Community}}&type={{.Type}}&sort={{.Sort}}&order={{.SortOrder}}"
+            hx-get="/media-grid?offset={{add .Offset .Limit}}&limit={{.Limit}}&community={{.Community}}&type={{.Type}}&author={{.Author}}{{if .Favorites}}&favorites=true{{end}}{{if .From}}&from={{.From}}{{end}}{{if .To}}&to={{.To}}{{end}}{{if .DateField}}&date_field={{.DateField}}{{end}}&sort={{.Sort}}&order={{.SortOrder}}"
             hx-target="#media-container"
             {{else}}disabled{{end}}>
         Next →
@@ -1041,3 +2009,42 @@ const mediaGridTemplate = `{{define "media-grid"}}
 {{end}}`
 
 const mediaModalTemplate = ``
+
+// baseStylesTemplate holds the dark theme styles shared by all pages
+const baseStylesTemplate = `{{define "base-styles"}}
+        * { margin: 0; padding: 0; box-sizing: border-box; }
+        body {
+            font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, 'Helvetica Neue', Arial, sans-serif;
+            background: #0f0f0f;
+            color: #e0e0e0;
+            line-height: 1.6;
+        }
+        .header {
+            background: #1a1a1a;
+            border-bottom: 1px solid #2a2a2a;
+            padding: 12px 16px;
+            position: sticky;
+            top: 0;
+            z-index: 100;
+        }
+        .header-content {
+            max-width: 1400px;
+            margin: 0 auto;
+            display: flex;
+            justify-content: space-between;
+            align-items: center;
+        }
+        .header h1 { font-size: 24px; font-weight: 600; color: #fff; }
+        .stats {
+            display: flex;
+            gap: 24px;
+            font-size: 14px;
+            color: #999;
+        }
+        .stats span { font-weight: 600; color: #e0e0e0; }
+        .content {
+            max-width: 1400px;
+            margin: 0 auto;
+            padding: 24px 16px;
+        }
+{{end}}`
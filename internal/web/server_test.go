@@ -0,0 +1,137 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/neo1908/lemmy-image-scraper/internal/config"
+	"github.com/neo1908/lemmy-image-scraper/internal/database"
+	"github.com/neo1908/lemmy-image-scraper/internal/downloader"
+	"github.com/neo1908/lemmy-image-scraper/internal/storage"
+	"github.com/neo1908/lemmy-image-scraper/pkg/models"
+)
+
+// newTestServer returns a server configured by configure, if given, with a
+// fresh SQLite database and local storage in a temporary directory
+func newTestServer(t *testing.T, configure func(cfg *config.Config)) *Server {
+	t.Helper()
+	dir := t.TempDir()
+
+	cfg := &config.Config{}
+	cfg.Storage.BaseDirectory = dir
+	cfg.Database.Path = dir + "/test.db"
+	if configure != nil {
+		configure(cfg)
+	}
+	cfg.SetDefaults()
+
+	db, err := database.New(&cfg.Database, false)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	store, err := storage.NewLocal(dir)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+
+	s, err := New(cfg, db, store, downloader.NewFromConfig(cfg, db, store))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	return s
+}
+
+// seedMedia records a media item of post 1 in the community "pics" and returns its ID
+func seedMedia(t *testing.T, s *Server) int64 {
+	t.Helper()
+	media := &models.ScrapedMedia{
+		PostID:        1,
+		PostTitle:     "A picture",
+		CommunityName: "pics",
+		MediaURL:      "https://example.com/a.png",
+		MediaHash:     "0123456789abcdef",
+		FileName:      "1_a.png",
+		FilePath:      s.Storage.Location("pics/1_a.png"),
+		MediaType:     "image",
+		PostCreated:   time.Now().UTC(),
+		DownloadedAt:  time.Now().UTC(),
+	}
+	if err := s.DB.SaveMedia(media); err != nil {
+		t.Fatalf("failed to save media: %v", err)
+	}
+	return media.ID
+}
+
+// saveMedia records media, filling in a unique hash, URL and file and the
+// current time where they're unset, and returns its ID
+func saveMedia(t *testing.T, s *Server, media models.ScrapedMedia) int64 {
+	t.Helper()
+	var count int
+	if err := s.DB.Get(&count, `SELECT COUNT(*) FROM scraped_media`); err != nil {
+		t.Fatal(err)
+	}
+	if media.MediaHash == "" {
+		media.MediaHash = fmt.Sprintf("%064x", count+1)
+	}
+	if media.MediaURL == "" {
+		media.MediaURL = fmt.Sprintf("https://example.com/%d.png", count+1)
+	}
+	if media.FileName == "" {
+		media.FileName = fmt.Sprintf("%d_%d.png", media.PostID, count+1)
+		media.FilePath = s.Storage.Location(media.CommunityName + "/" + media.FileName)
+	}
+	if media.MediaType == "" {
+		media.MediaType = "image"
+	}
+	if media.PostCreated.IsZero() {
+		media.PostCreated = time.Now().UTC()
+	}
+	if media.DownloadedAt.IsZero() {
+		media.DownloadedAt = time.Now().UTC()
+	}
+	if err := s.DB.SaveMedia(&media); err != nil {
+		t.Fatalf("failed to save media: %v", err)
+	}
+	return media.ID
+}
+
+// getJSON requests target from the server, decoding a 200 response into v,
+// and returns the status
+func getJSON(t *testing.T, s *Server, target string, v interface{}) int {
+	t.Helper()
+	w := httptest.NewRecorder()
+	s.handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	if w.Code == http.StatusOK && v != nil {
+		if err := json.NewDecoder(w.Body).Decode(v); err != nil {
+			t.Fatalf("GET %s: failed to decode response: %v", target, err)
+		}
+	}
+	return w.Code
+}
+
+// mediaList is the part of a /api/media response the tests check
+type mediaList struct {
+	Media []struct {
+		ID            int64  `json:"id"`
+		CommunityName string `json:"community_name"`
+		AuthorName    string `json:"author_name"`
+		PostScore     int    `json:"post_score"`
+	} `json:"media"`
+	Total      int   `json:"total"`
+	NextCursor int64 `json:"next_cursor"`
+}
+
+// ids returns the IDs of the listed media, in order
+func (l mediaList) ids() []int64 {
+	ids := make([]int64, len(l.Media))
+	for i, m := range l.Media {
+		ids[i] = m.ID
+	}
+	return ids
+}
@@ -0,0 +1,197 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Number of top posts shown on the statistics page and returned by default
+// by /api/stats/top-posts, and the most the API returns
+const (
+	topPostsLimit    = 10
+	maxTopPostsLimit = 100
+)
+
+// Most days of download counts /api/stats/daily returns
+const maxDailyStatsDays = 365
+
+// handleStatsPage serves the statistics page for the whole archive
+func (s *Server) handleStatsPage(w http.ResponseWriter, r *http.Request) {
+	stats, err := s.DB.GetStats()
+	if err != nil {
+		log.Errorf("Failed to get stats: %v", err)
+		http.Error(w, "Failed to get stats", http.StatusInternalServerError)
+		return
+	}
+
+	topPosts, err := s.DB.GetTopPostsByScore(topPostsLimit)
+	if err != nil {
+		log.Errorf("Failed to get top posts: %v", err)
+		http.Error(w, "Failed to get stats", http.StatusInternalServerError)
+		return
+	}
+
+	daily, err := s.DB.GetDailyDownloadCounts("", sparklineDays)
+	if err != nil {
+		log.Errorf("Failed to get daily download counts: %v", err)
+		http.Error(w, "Failed to get stats", http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Stats":     stats,
+		"TopPosts":  s.mediaListItems(topPosts),
+		"Downloads": downloadsSparkline(daily),
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := s.templates.ExecuteTemplate(w, "stats", data); err != nil {
+		log.Errorf("Template error: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// handleGetTopPosts returns the highest scoring posts, one media item per post
+func (s *Server) handleGetTopPosts(w http.ResponseWriter, r *http.Request) {
+	limit := topPostsLimit
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= maxTopPostsLimit {
+			limit = parsed
+		}
+	}
+
+	topPosts, err := s.DB.GetTopPostsByScore(limit)
+	if err != nil {
+		log.Errorf("Failed to get top posts: %v", err)
+		http.Error(w, "Failed to get top posts", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"top_posts": s.mediaListItems(topPosts),
+	})
+}
+
+// handleGetDailyStats returns the number and size of files downloaded on each of
+// the last days days, for charting download activity
+func (s *Server) handleGetDailyStats(w http.ResponseWriter, r *http.Request) {
+	days := sparklineDays
+	if d := r.URL.Query().Get("days"); d != "" {
+		if parsed, err := strconv.Atoi(d); err == nil && parsed > 0 && parsed <= maxDailyStatsDays {
+			days = parsed
+		}
+	}
+
+	daily, err := s.DB.GetDailyDownloadCounts("", days)
+	if err != nil {
+		log.Errorf("Failed to get daily download counts: %v", err)
+		http.Error(w, "Failed to get daily stats", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"days":  days,
+		"daily": dailyCountItems(daily),
+	})
+}
+
+// handleGetRescrapes returns how many times each post was scraped again after
+// the first time, for the posts that were
+func (s *Server) handleGetRescrapes(w http.ResponseWriter, r *http.Request) {
+	rescrapes, err := s.DB.GetRescrapeStats()
+	if err != nil {
+		log.Errorf("Failed to get rescrape counts: %v", err)
+		http.Error(w, "Failed to get rescrape counts", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"rescrapes": rescrapes,
+		"total":     len(rescrapes),
+	})
+}
+
+const statsTemplate = `{{define "stats"}}
+<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Statistics - Lemmy Media Browser</title>
+    <style>
+{{template "base-styles"}}
+{{template "report-styles"}}
+        .post-list .post { display: flex; gap: 12px; min-width: 0; }
+        .post-list .community { color: #999; white-space: nowrap; }
+    </style>
+</head>
+<body>
+    <div class="header">
+        <div class="header-content">
+            <h1><a href="/">Lemmy Media</a> <span class="community-name">/ statistics</span></h1>
+        </div>
+    </div>
+
+    <div class="content">
+        <div class="section">
+            <div class="summary">
+                <div class="summary-item"><div class="value">{{.Stats.total_media}}</div><div class="label">Media files</div></div>
+                <div class="summary-item"><div class="value">{{formatFileSize .Stats.total_size}}</div><div class="label">Total size</div></div>
+                {{range $type, $count := .Stats.by_type}}
+                    <div class="summary-item"><div class="value">{{$count}}</div><div class="label">{{$type}}</div></div>
+                {{end}}
+            </div>
+        </div>
+
+{{template "downloads-sparkline" .Downloads}}
+
+        <div class="section">
+            <h2>Top communities</h2>
+            <ul class="post-list">
+                {{range $name, $count := .Stats.top_communities}}
+                    <li>
+                        <a href="/community/{{$name}}">{{$name}}</a>
+                        <span class="score">{{$count}} items</span>
+                    </li>
+                {{end}}
+            </ul>
+        </div>
+
+        {{with .Stats.slowest_hosts}}
+        <div class="section">
+            <h2>Slowest hosts</h2>
+            <ul class="post-list">
+                {{range .}}
+                    <li>
+                        <span class="post">{{.Host}} <span class="community">{{.Downloads}} files, {{formatFileSize .Bytes}}</span></span>
+                        <span class="score">{{formatFileSize .BytesPerSecond}}/s</span>
+                    </li>
+                {{end}}
+            </ul>
+        </div>
+        {{end}}
+
+        <div class="section">
+            <h2>Top posts</h2>
+            <ul class="post-list">
+                {{range .TopPosts}}
+                    <li>
+                        <span class="post">
+                            <a href="{{.post_url}}" target="_blank" rel="noopener" title="{{.post_title}}">{{.post_title}}</a>
+                            <a class="community" href="/community/{{.community_name}}">{{.community_name}}</a>
+                        </span>
+                        <span class="score">{{.post_score}} pts</span>
+                    </li>
+                {{end}}
+            </ul>
+        </div>
+    </div>
+</body>
+</html>
+{{end}}`
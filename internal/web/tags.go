@@ -0,0 +1,82 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/neo1908/lemmy-image-scraper/internal/database"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxTagLength is the longest tag accepted, in bytes
+const maxTagLength = 64
+
+// handleMediaTags returns the tags of a media item, or with POST adds the tags
+// in a {"tags": [...]} body and returns the item's updated tags
+func (s *Server) handleMediaTags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	idStr := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/media/"), "/tags")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid media ID", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := s.DB.GetMediaByID(id); err != nil {
+		if errors.Is(err, database.ErrMediaNotFound) {
+			http.Error(w, "Media not found", http.StatusNotFound)
+			return
+		}
+		log.Errorf("Failed to get media by ID: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		var body struct {
+			Tags []string `json:"tags"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		for _, tag := range body.Tags {
+			if len(tag) > maxTagLength {
+				http.Error(w, "Tags can be at most 64 bytes long", http.StatusBadRequest)
+				return
+			}
+		}
+
+		if err := s.DB.AddMediaTags(id, body.Tags); err != nil {
+			log.Errorf("Failed to add tags: %v", err)
+			http.Error(w, "Failed to add tags", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	tags, err := s.DB.GetMediaTags(id)
+	if err != nil {
+		log.Errorf("Failed to get tags: %v", err)
+		http.Error(w, "Failed to get tags", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":   id,
+		"tags": tags,
+	})
+}
@@ -0,0 +1,135 @@
+package web
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/neo1908/lemmy-image-scraper/internal/downloader"
+	log "github.com/sirupsen/logrus"
+)
+
+// uploadPath is the endpoint media files are uploaded to by hand
+const uploadPath = "/api/media/upload"
+
+// uploadMemory is how much of a multipart upload is held in memory before
+// the rest is spooled to a temp file
+const uploadMemory = 32 << 20
+
+// handleUploadMedia adds a file sent as multipart/form-data to the archive,
+// recorded with the post details given in the form. It requires the basic auth
+// credentials from web_server.upload_username and upload_password.
+func (s *Server) handleUploadMedia(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	username, password := s.Config.WebServer.UploadUsername, s.Config.WebServer.UploadPassword
+	if username == "" || password == "" {
+		http.Error(w, "Uploads are disabled", http.StatusForbidden)
+		return
+	}
+	user, pass, ok := r.BasicAuth()
+	if !ok || subtle.ConstantTimeCompare([]byte(user), []byte(username)) != 1 ||
+		subtle.ConstantTimeCompare([]byte(pass), []byte(password)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Basic realm="upload"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	limit := s.Config.WebServer.MaxUploadBytes
+	if limit > 0 {
+		if r.ContentLength > limit {
+			http.Error(w, fmt.Sprintf("Upload larger than %d bytes", limit), http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+	}
+
+	if err := r.ParseMultipartForm(uploadMemory); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("Upload larger than %d bytes", limit), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Invalid multipart form", http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "Missing file", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	upload := downloader.Upload{
+		FileName:      header.Filename,
+		ContentType:   header.Header.Get("Content-Type"),
+		PostTitle:     strings.TrimSpace(r.FormValue("post_title")),
+		CommunityName: strings.TrimSpace(r.FormValue("community_name")),
+		PostURL:       strings.TrimSpace(r.FormValue("post_url")),
+		AuthorName:    strings.TrimSpace(r.FormValue("author_name")),
+		MediaType:     r.FormValue("media_type"),
+	}
+	if upload.CommunityName == "" {
+		http.Error(w, "community_name is required", http.StatusBadRequest)
+		return
+	}
+	// The community name becomes a directory of the stored file
+	if upload.CommunityName == "." || upload.CommunityName == ".." || strings.ContainsAny(upload.CommunityName, `/\`) {
+		http.Error(w, "Invalid community_name", http.StatusBadRequest)
+		return
+	}
+	if score := r.FormValue("post_score"); score != "" {
+		if upload.PostScore, err = strconv.Atoi(score); err != nil {
+			http.Error(w, "Invalid post_score", http.StatusBadRequest)
+			return
+		}
+	}
+	switch upload.MediaType {
+	case "", "image", "video", "other":
+	default:
+		http.Error(w, "media_type must be image, video or other", http.StatusBadRequest)
+		return
+	}
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		log.Errorf("Failed to read upload: %v", err)
+		http.Error(w, "Failed to read file", http.StatusInternalServerError)
+		return
+	}
+	if len(content) == 0 {
+		http.Error(w, "Empty file", http.StatusBadRequest)
+		return
+	}
+
+	media, err := s.uploader.StoreUpload(content, upload)
+	if err != nil {
+		if errors.Is(err, downloader.ErrMediaExists) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error": "Media already exists",
+				"id":    media.ID,
+			})
+			return
+		}
+		log.Errorf("Failed to store upload: %v", err)
+		http.Error(w, "Failed to store upload", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(s.mediaListItem(*media))
+}
@@ -0,0 +1,138 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/neo1908/lemmy-image-scraper/internal/config"
+)
+
+// testPNG returns a PNG of about 1 KB
+func testPNG(t *testing.T) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+	for i := range img.Pix {
+		img.Pix[i] = byte(i * 7919 % 251)
+	}
+	img.Set(0, 0, color.NRGBA{A: 255})
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("failed to encode PNG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// uploadRequest builds a multipart upload of content with the given form fields
+func uploadRequest(t *testing.T, content []byte, fields map[string]string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for name, value := range fields {
+		form.WriteField(name, value)
+	}
+	part, err := form.CreateFormFile("file", "pixel.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(content)
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, uploadPath, &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.SetBasicAuth("admin", "secret")
+	return req
+}
+
+func TestUploadMedia(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.WebServer.UploadUsername = "admin"
+		cfg.WebServer.UploadPassword = "secret"
+	})
+	content := testPNG(t)
+	fields := map[string]string{"community_name": "pics", "post_title": "A pixel", "post_score": "5"}
+
+	w := httptest.NewRecorder()
+	s.handler.ServeHTTP(w, uploadRequest(t, content, fields))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d (body: %s)", w.Code, http.StatusCreated, w.Body.String())
+	}
+	var created struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	media, err := s.DB.GetMediaByID(created.ID)
+	if err != nil {
+		t.Fatalf("GetMediaByID: %v", err)
+	}
+	if media.PostID >= 0 {
+		t.Errorf("post ID = %d, want a negative upload ID", media.PostID)
+	}
+	if media.CommunityName != "pics" || media.PostTitle != "A pixel" || media.PostScore != 5 {
+		t.Errorf("recorded community %q, title %q, score %d", media.CommunityName, media.PostTitle, media.PostScore)
+	}
+	if media.MediaType != "image" || media.MIMEType != "image/png" || media.FileSize != int64(len(content)) {
+		t.Errorf("recorded type %q, MIME type %q, size %d", media.MediaType, media.MIMEType, media.FileSize)
+	}
+
+	stored, err := os.ReadFile(media.FilePath)
+	if err != nil {
+		t.Fatalf("uploaded file not stored: %v", err)
+	}
+	if !bytes.Equal(stored, content) {
+		t.Error("stored file differs from the upload")
+	}
+
+	// The same file again is a conflict
+	w = httptest.NewRecorder()
+	s.handler.ServeHTTP(w, uploadRequest(t, content, fields))
+	if w.Code != http.StatusConflict {
+		t.Errorf("second upload: status = %d, want %d", w.Code, http.StatusConflict)
+	}
+}
+
+func TestUploadMediaRequiresCredentials(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.WebServer.UploadUsername = "admin"
+		cfg.WebServer.UploadPassword = "secret"
+	})
+
+	req := uploadRequest(t, testPNG(t), map[string]string{"community_name": "pics"})
+	req.SetBasicAuth("admin", "wrong")
+	w := httptest.NewRecorder()
+	s.handler.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestUploadMediaRejectsPathInCommunityName(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.WebServer.UploadUsername = "admin"
+		cfg.WebServer.UploadPassword = "secret"
+	})
+
+	for _, name := range []string{"..", ".", "../pics", `pics\..`} {
+		w := httptest.NewRecorder()
+		s.handler.ServeHTTP(w, uploadRequest(t, testPNG(t), map[string]string{"community_name": name}))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("community_name %q: status = %d, want %d", name, w.Code, http.StatusBadRequest)
+		}
+	}
+
+	var count int
+	if err := s.DB.Get(&count, `SELECT COUNT(*) FROM scraped_media`); err != nil || count != 0 {
+		t.Errorf("media recorded = %d, err = %v, want 0", count, err)
+	}
+}
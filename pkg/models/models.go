@@ -17,10 +17,20 @@ type ScrapedMedia struct {
 	FilePath      string    `db:"file_path"`
 	FileSize      int64     `db:"file_size"`
 	MediaType     string    `db:"media_type"`  // "image", "video", "other"
-	PostURL       string    `db:"post_url"`
+	PostURL       string    `db:"post_url"`     // Link to the post on the scraped instance
 	PostScore     int       `db:"post_score"`
 	PostCreated   time.Time `db:"post_created"`
 	DownloadedAt  time.Time `db:"downloaded_at"`
+	IsFavorite    bool      `db:"is_favorite"`
+	ThumbnailFile string    `db:"thumbnail_file"` // Instance thumbnail, relative to the directory the media was stored in by storage.layout ("" if none)
+	PostApID      string    `db:"post_ap_id"`     // ActivityPub ID of the post on its home instance ("" for older records)
+	Animated      bool      `db:"animated"`       // Image with more than one frame (animated GIF or WebP)
+	PostUpvotes   int       `db:"post_upvotes"`
+	PostDownvotes int       `db:"post_downvotes"`
+	PostComments  int       `db:"post_comments"`  // Comment count of the post when last scraped
+	MIMEType      string    `db:"mime_type"`      // MIME type detected from the content or Content-Type header ("" if unknown)
+	DurationSeconds float64 `db:"duration_seconds"` // Length of a video in seconds (0 if unknown or not a video)
+	DownloadMS    int64     `db:"download_ms"`    // Time the download took in milliseconds (0 if unknown, e.g. uploads)
 }
 
 // Post represents a Lemmy post from the API
@@ -44,6 +54,7 @@ type Post struct {
 	LanguageID         int       `json:"language_id"`
 	FeaturedCommunity  bool      `json:"featured_community"`
 	FeaturedLocal      bool      `json:"featured_local"`
+	ApID               string    `json:"ap_id"`  // Canonical ActivityPub URL of the post on its home instance
 }
 
 // Community represents a Lemmy community
@@ -63,6 +74,47 @@ type Community struct {
 	Banner      string `json:"banner,omitempty"`
 }
 
+// CommunityAggregates represents community statistics
+type CommunityAggregates struct {
+	CommunityID  int64 `json:"community_id"`
+	Subscribers  int   `json:"subscribers"`
+	Posts        int   `json:"posts"`
+	Comments     int   `json:"comments"`
+}
+
+// CommunityView represents a community with its statistics from the API
+type CommunityView struct {
+	Community  Community           `json:"community"`
+	Subscribed string              `json:"subscribed"`
+	Blocked    bool                `json:"blocked"`
+	Counts     CommunityAggregates `json:"counts"`
+}
+
+// Subscription states of a CommunityView. Following a community on another
+// instance stays pending until that instance accepts the follow.
+const (
+	SubscribedTypeSubscribed    = "Subscribed"
+	SubscribedTypeNotSubscribed = "NotSubscribed"
+	SubscribedTypePending       = "Pending"
+)
+
+// CommunityResponse represents the API response for getting or following a community
+type CommunityResponse struct {
+	CommunityView CommunityView `json:"community_view"`
+}
+
+// FollowCommunityRequest represents the request to subscribe to a community
+type FollowCommunityRequest struct {
+	CommunityID int64  `json:"community_id"`
+	Follow      bool   `json:"follow"`
+	Auth        string `json:"auth,omitempty"` // Login token, only for Lemmy before 0.19
+}
+
+// ListCommunitiesResponse represents the API response for listing communities
+type ListCommunitiesResponse struct {
+	Communities []CommunityView `json:"communities"`
+}
+
 // Person represents a Lemmy user
 type Person struct {
 	ID        int64  `json:"id"`
@@ -110,6 +162,12 @@ type GetPostsResponse struct {
 	Posts []PostView `json:"posts"`
 }
 
+// GetPostResponse represents the API response for getting a single post
+type GetPostResponse struct {
+	PostView   PostView   `json:"post_view"`
+	CrossPosts []PostView `json:"cross_posts"`  // Other posts of the same link
+}
+
 // LoginRequest represents the login API request
 type LoginRequest struct {
 	UsernameOrEmail string `json:"username_or_email"`
@@ -171,3 +229,76 @@ type CommentView struct {
 type GetCommentsResponse struct {
 	Comments []CommentView `json:"comments"`
 }
+
+// Site represents a Lemmy instance's public site information
+type Site struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Sidebar     string `json:"sidebar,omitempty"`
+	Description string `json:"description,omitempty"`
+	Icon        string `json:"icon,omitempty"`
+	Banner      string `json:"banner,omitempty"`
+	ActorID     string `json:"actor_id"`
+	Published   string `json:"published"`
+}
+
+// LocalSite represents the local instance settings
+type LocalSite struct {
+	ID                     int64  `json:"id"`
+	EnableNSFW             bool   `json:"enable_nsfw"`
+	EnableDownvotes        bool   `json:"enable_downvotes"`
+	PrivateInstance        bool   `json:"private_instance"`
+	FederationEnabled      bool   `json:"federation_enabled"`
+	DefaultPostListingType string `json:"default_post_listing_type"`
+}
+
+// LocalSiteRateLimit represents the instance's API rate limits
+type LocalSiteRateLimit struct {
+	Message          int `json:"message"`
+	MessagePerSecond int `json:"message_per_second"`
+	Post             int `json:"post"`
+	PostPerSecond    int `json:"post_per_second"`
+	Image            int `json:"image"`
+	ImagePerSecond   int `json:"image_per_second"`
+	Comment          int `json:"comment"`
+	CommentPerSecond int `json:"comment_per_second"`
+	Search           int `json:"search"`
+	SearchPerSecond  int `json:"search_per_second"`
+}
+
+// SiteView represents a site with its local settings
+type SiteView struct {
+	Site               Site               `json:"site"`
+	LocalSite          LocalSite          `json:"local_site"`
+	LocalSiteRateLimit LocalSiteRateLimit `json:"local_site_rate_limit"`
+}
+
+// Tagline represents a site tagline
+type Tagline struct {
+	ID      int64  `json:"id"`
+	Content string `json:"content"`
+}
+
+// Language represents a language available on the instance
+type Language struct {
+	ID   int    `json:"id"`
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+// SiteResponse represents the API response for getting site information
+type SiteResponse struct {
+	SiteView            SiteView   `json:"site_view"`
+	Version             string     `json:"version"`
+	Taglines            []Tagline  `json:"taglines"`
+	AllLanguages        []Language `json:"all_languages"`
+	DiscussionLanguages []int      `json:"discussion_languages"`
+	MyUser              *MyUserInfo `json:"my_user,omitempty"` // Only present when logged in
+}
+
+// MyUserInfo represents the logged-in user's details in the site response
+type MyUserInfo struct {
+	LocalUserView struct {
+		Person Person `json:"person"`
+	} `json:"local_user_view"`
+}